@@ -0,0 +1,71 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/mendersoftware/reporting/app/ratelimit"
+)
+
+// MetadataRetryAfter is the metadata key of the number of seconds after
+// which a call rejected by the rate limits should be retried
+const MetadataRetryAfter = "retry-after"
+
+func acquire(ctx context.Context, limiter *ratelimit.Limiter) (func(), error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	release, retryAfter, err := limiter.Acquire(tenantID)
+	if err != nil {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(MetadataRetryAfter,
+			strconv.Itoa(ratelimit.RetryAfterSeconds(retryAfter))))
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return release, nil
+}
+
+// WithRateLimiter returns the server options enforcing the per-tenant
+// limits of the limiter on all the calls, rejecting the calls exceeding
+// them with the ResourceExhausted code and the retry-after header
+func WithRateLimiter(limiter *ratelimit.Limiter) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{},
+			info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			release, err := acquire(ctx, limiter)
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, stream grpc.ServerStream,
+			info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			release, err := acquire(stream.Context(), limiter)
+			if err != nil {
+				return err
+			}
+			defer release()
+			return handler(srv, stream)
+		}),
+	}
+}
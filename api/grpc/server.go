@@ -0,0 +1,272 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/mendersoftware/reporting/api/grpc/pb"
+	"github.com/mendersoftware/reporting/app/reporting"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// Metadata keys
+const (
+	// MetadataTenantID is the metadata key of the tenant of the calls
+	MetadataTenantID = "x-mender-tenant-id"
+	// MetadataPartialResults is the trailer key of the reasons why the
+	// streamed results are incomplete
+	MetadataPartialResults = "x-partial-results"
+)
+
+var (
+	errMissingTenant = status.Error(codes.Unauthenticated,
+		"missing "+MetadataTenantID+" metadata")
+	errInternal = status.Error(codes.Internal, "internal error")
+)
+
+type server struct {
+	pb.UnimplementedReportingServer
+	reporting reporting.App
+}
+
+// NewServer returns a new gRPC server exposing the reporting API
+func NewServer(reporting reporting.App, opts ...grpc.ServerOption) *grpc.Server {
+	srv := grpc.NewServer(opts...)
+	pb.RegisterReportingServer(srv, &server{reporting: reporting})
+	return srv
+}
+
+func tenantFromContext(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(MetadataTenantID); len(values) > 0 && values[0] != "" {
+		return values[0], nil
+	}
+	return "", errMissingTenant
+}
+
+func invalidArgument(err error) error {
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+func internalError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return status.Error(codes.Canceled, ctx.Err().Error())
+	}
+	log.FromContext(ctx).Error(err)
+	return errInternal
+}
+
+func filterPredicates(filters []*pb.FilterPredicate) []model.FilterPredicate {
+	if len(filters) == 0 {
+		return nil
+	}
+	predicates := make([]model.FilterPredicate, len(filters))
+	for i, filter := range filters {
+		predicates[i] = model.FilterPredicate{
+			Scope:     filter.GetScope(),
+			Attribute: filter.GetAttribute(),
+			Type:      filter.GetType(),
+		}
+		if filter.GetValue() != nil {
+			predicates[i].Value = filter.GetValue().AsInterface()
+		}
+	}
+	return predicates
+}
+
+func searchParams(tenantID string, filter *pb.Filter) *model.SearchParams {
+	return &model.SearchParams{
+		Filters:     filterPredicates(filter.GetFilters()),
+		FilterQuery: filter.GetQuery(),
+		Query:       filter.GetText(),
+		DeviceIDs:   filter.GetDeviceIds(),
+		TenantID:    tenantID,
+	}
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func attributes(scope string, inventory model.DeviceInventory) []*pb.Attribute {
+	attrs := make([]*pb.Attribute, 0, len(inventory))
+	for _, attr := range inventory {
+		if attr == nil {
+			continue
+		}
+		attrs = append(attrs, &pb.Attribute{
+			Scope:        scope,
+			Name:         attr.GetName(),
+			StringValues: attr.String,
+			NumericValue: attr.Numeric,
+		})
+	}
+	return attrs
+}
+
+func device(d *model.Device) *pb.Device {
+	attrs := attributes(model.ScopeIdentity, d.IdentityAttributes)
+	attrs = append(attrs, attributes(model.ScopeInventory, d.InventoryAttributes)...)
+	attrs = append(attrs, attributes(model.ScopeCustom, d.CustomAttributes)...)
+	return &pb.Device{
+		Id:         d.GetID(),
+		Name:       d.GetName(),
+		GroupName:  d.GetGroupName(),
+		Status:     d.GetStatus(),
+		Attributes: attrs,
+		CreatedAt:  timestamp(d.CreatedAt),
+		UpdatedAt:  timestamp(d.UpdatedAt),
+	}
+}
+
+// Search returns a page of the devices matching the filter
+func (s *server) Search(ctx context.Context, req *pb.SearchRequest) (*pb.SearchResponse, error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params := searchParams(tenantID, req.GetFilter())
+	params.Page = int(req.GetPage())
+	params.PerPage = int(req.GetPerPage())
+	for _, sort := range req.GetSort() {
+		params.Sort = append(params.Sort, model.SortCriteria{
+			Scope:     sort.GetScope(),
+			Attribute: sort.GetAttribute(),
+			Order:     sort.GetOrder(),
+		})
+	}
+	if err := params.Validate(); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	ctx, queryStatus := model.WithQueryStatus(ctx)
+	devices, total, err := s.reporting.SearchDevices(ctx, params)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	res := &pb.SearchResponse{
+		Devices: make([]*pb.Device, len(devices)),
+		Total:   int64(total),
+		Partial: queryStatus.Partial(),
+	}
+	for i, d := range devices {
+		res.Devices[i] = device(d)
+	}
+	return res, nil
+}
+
+// Count returns the number of devices matching the filter
+func (s *server) Count(ctx context.Context, req *pb.CountRequest) (*pb.CountResponse, error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params := searchParams(tenantID, req.GetFilter())
+	if err := params.Validate(); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	ctx, queryStatus := model.WithQueryStatus(ctx)
+	count, err := s.reporting.CountDevices(ctx, params)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	return &pb.CountResponse{
+		Count:   int64(count),
+		Partial: queryStatus.Partial(),
+	}, nil
+}
+
+// Aggregate returns the number of matching devices for the most common
+// values of an attribute
+func (s *server) Aggregate(ctx context.Context,
+	req *pb.AggregateRequest) (*pb.AggregateResponse, error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter := req.GetFilter()
+	params := &model.AggregateParams{
+		Filters:     filterPredicates(filter.GetFilters()),
+		FilterQuery: filter.GetQuery(),
+		Query:       filter.GetText(),
+		DeviceIDs:   filter.GetDeviceIds(),
+		Scope:       req.GetScope(),
+		Attribute:   req.GetAttribute(),
+		Size:        int(req.GetSize()),
+		TenantID:    tenantID,
+	}
+	if err := params.Validate(); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	ctx, queryStatus := model.WithQueryStatus(ctx)
+	buckets, total, err := s.reporting.Aggregate(ctx, params)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	res := &pb.AggregateResponse{
+		Buckets: make([]*pb.AggregateBucket, len(buckets)),
+		Total:   int64(total),
+		Partial: queryStatus.Partial(),
+	}
+	for i, bucket := range buckets {
+		res.Buckets[i] = &pb.AggregateBucket{
+			Value: bucket.Value,
+			Count: int64(bucket.Count),
+		}
+	}
+	return res, nil
+}
+
+// StreamDeviceIDs streams the IDs of all the matching devices
+func (s *server) StreamDeviceIDs(req *pb.StreamDeviceIDsRequest,
+	stream pb.Reporting_StreamDeviceIDsServer) error {
+	ctx := stream.Context()
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	params := searchParams(tenantID, req.GetFilter())
+	if err := params.Validate(); err != nil {
+		return invalidArgument(err)
+	}
+
+	ctx, queryStatus := model.WithQueryStatus(ctx)
+	err = s.reporting.StreamDeviceIDs(ctx, params, func(deviceID string) error {
+		return stream.Send(&pb.DeviceID{Id: deviceID})
+	})
+	if partial := queryStatus.Partial(); len(partial) > 0 {
+		stream.SetTrailer(metadata.Pairs(MetadataPartialResults,
+			strings.Join(partial, ",")))
+	}
+	if err != nil {
+		return internalError(ctx, err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/mendersoftware/reporting/api/grpc/pb"
+	"github.com/mendersoftware/reporting/app/ratelimit"
+	"github.com/mendersoftware/reporting/app/reporting/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func newClient(t *testing.T, app *mocks.App, opts ...grpc.ServerOption) pb.ReportingClient {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := NewServer(app, opts...)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewReportingClient(conn)
+}
+
+func tenantContext(tenantID string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(),
+		MetadataTenantID, tenantID)
+}
+
+func TestSearch(t *testing.T) {
+	testCases := map[string]struct {
+		ctx context.Context
+		req *pb.SearchRequest
+
+		params  *model.SearchParams
+		devices []*model.Device
+		total   int
+		err     error
+
+		code codes.Code
+	}{
+		"ok": {
+			ctx: tenantContext("tenant"),
+			req: &pb.SearchRequest{
+				Filter: &pb.Filter{
+					Filters: []*pb.FilterPredicate{{
+						Scope:     model.ScopeInventory,
+						Attribute: "device_type",
+						Type:      model.FilterTypeIn,
+						Value: structpb.NewListValue(&structpb.ListValue{
+							Values: []*structpb.Value{structpb.NewStringValue("dm1")},
+						}),
+					}},
+					Query: `status == "accepted"`,
+				},
+				Sort: []*pb.SortCriteria{{
+					Scope:     model.ScopeSystem,
+					Attribute: "name",
+					Order:     model.SortOrderAsc,
+				}},
+				PerPage: 10,
+			},
+			params: &model.SearchParams{
+				Page:    1,
+				PerPage: 10,
+				Filters: []model.FilterPredicate{{
+					Scope:     model.ScopeInventory,
+					Attribute: "device_type",
+					Type:      model.FilterTypeIn,
+					Value:     []interface{}{"dm1"},
+				}},
+				FilterQuery: `status == "accepted"`,
+				Sort: []model.SortCriteria{{
+					Scope:     model.ScopeSystem,
+					Attribute: "name",
+					Order:     model.SortOrderAsc,
+				}},
+				TenantID: "tenant",
+			},
+			devices: []*model.Device{{
+				ID:   strPtr("1"),
+				Name: strPtr("foo"),
+				InventoryAttributes: model.DeviceInventory{
+					model.NewInventoryAttribute().SetName("device_type").SetString("dm1"),
+				},
+			}},
+			total: 1,
+			code:  codes.OK,
+		},
+		"ko, missing tenant": {
+			ctx:  context.Background(),
+			req:  &pb.SearchRequest{},
+			code: codes.Unauthenticated,
+		},
+		"ko, invalid filter query": {
+			ctx: tenantContext("tenant"),
+			req: &pb.SearchRequest{
+				Filter: &pb.Filter{Query: `status ==`},
+			},
+			code: codes.InvalidArgument,
+		},
+		"ko, internal error": {
+			ctx: tenantContext("tenant"),
+			req: &pb.SearchRequest{},
+			params: &model.SearchParams{
+				Page:     1,
+				PerPage:  20,
+				TenantID: "tenant",
+			},
+			err:  errors.New("error"),
+			code: codes.Internal,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+			if tc.params != nil {
+				app.On("SearchDevices", mock.Anything, tc.params).
+					Return(tc.devices, tc.total, tc.err)
+			}
+
+			res, err := newClient(t, app).Search(tc.ctx, tc.req)
+			assert.Equal(t, tc.code, status.Code(err))
+			if tc.code == codes.OK {
+				assert.Equal(t, int64(tc.total), res.GetTotal())
+				assert.Len(t, res.GetDevices(), len(tc.devices))
+				assert.Equal(t, "foo", res.GetDevices()[0].GetName())
+				assert.Equal(t, []string{"dm1"},
+					res.GetDevices()[0].GetAttributes()[0].GetStringValues())
+			}
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	app := &mocks.App{}
+	defer app.AssertExpectations(t)
+	app.On("CountDevices", mock.Anything, &model.SearchParams{
+		Page:      1,
+		PerPage:   20,
+		DeviceIDs: []string{"1", "2"},
+		TenantID:  "tenant",
+	}).Return(2, nil)
+
+	res, err := newClient(t, app).Count(tenantContext("tenant"), &pb.CountRequest{
+		Filter: &pb.Filter{DeviceIds: []string{"1", "2"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), res.GetCount())
+}
+
+func TestCountPartial(t *testing.T) {
+	app := &mocks.App{}
+	defer app.AssertExpectations(t)
+	app.On("CountDevices", mock.Anything, mock.AnythingOfType("*model.SearchParams")).
+		Run(func(args mock.Arguments) {
+			ctx := args.Get(0).(context.Context)
+			model.QueryStatusFromContext(ctx).Record(true, 1)
+		}).
+		Return(2, nil)
+
+	res, err := newClient(t, app).Count(tenantContext("tenant"), &pb.CountRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), res.GetCount())
+	assert.Equal(t, []string{model.PartialTimedOut, model.PartialShardFailures},
+		res.GetPartial())
+}
+
+func TestAggregate(t *testing.T) {
+	app := &mocks.App{}
+	defer app.AssertExpectations(t)
+	app.On("Aggregate", mock.Anything, &model.AggregateParams{
+		Scope:     model.ScopeInventory,
+		Attribute: "device_type",
+		Size:      20,
+		TenantID:  "tenant",
+	}).Return([]*model.AggregateBucket{{Value: "dm1", Count: 3}}, 3, nil)
+
+	client := newClient(t, app)
+	res, err := client.Aggregate(tenantContext("tenant"), &pb.AggregateRequest{
+		Scope:     model.ScopeInventory,
+		Attribute: "device_type",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), res.GetTotal())
+	assert.Equal(t, "dm1", res.GetBuckets()[0].GetValue())
+	assert.Equal(t, int64(3), res.GetBuckets()[0].GetCount())
+
+	_, err = client.Aggregate(tenantContext("tenant"), &pb.AggregateRequest{
+		Scope: model.ScopeInventory,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestStreamDeviceIDs(t *testing.T) {
+	app := &mocks.App{}
+	defer app.AssertExpectations(t)
+	app.On("StreamDeviceIDs", mock.Anything, &model.SearchParams{
+		Page:     1,
+		PerPage:  20,
+		Query:    "raspberry",
+		TenantID: "tenant",
+	}, mock.Anything).Return(func(_ context.Context, _ *model.SearchParams,
+		send func(string) error) error {
+		for _, id := range []string{"1", "2", "3"} {
+			if err := send(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	stream, err := newClient(t, app).StreamDeviceIDs(tenantContext("tenant"),
+		&pb.StreamDeviceIDsRequest{Filter: &pb.Filter{Text: "raspberry"}})
+	assert.NoError(t, err)
+	ids := []string{}
+	for {
+		id, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		ids = append(ids, id.GetId())
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+}
+
+func TestRateLimit(t *testing.T) {
+	app := &mocks.App{}
+	defer app.AssertExpectations(t)
+	app.On("CountDevices", mock.Anything, mock.AnythingOfType("*model.SearchParams")).
+		Return(1, nil).Once()
+
+	limiter := ratelimit.NewLimiter(model.RateLimits{Rate: 0.5, Burst: 1}, nil)
+	client := newClient(t, app, WithRateLimiter(limiter)...)
+
+	_, err := client.Count(tenantContext("tenant"), &pb.CountRequest{})
+	assert.NoError(t, err)
+
+	var header metadata.MD
+	_, err = client.Count(tenantContext("tenant"), &pb.CountRequest{},
+		grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"2"}, header.Get(MetadataRetryAfter))
+}
@@ -16,16 +16,34 @@ package http
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mendersoftware/go-lib-micro/log"
+	rest "github.com/mendersoftware/go-lib-micro/rest.utils"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/app/reporting"
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	paramTenantID     = "tenant_id"
+	paramDeadLetterID = "id"
+
+	queryTenantID = "tenant_id"
 )
 
 // InternalController contains internal end-points
-type InternalController struct{}
+type InternalController struct {
+	reporting reporting.App
+}
 
 // NewInternalController returns a new InternalController
-func NewInternalController() *InternalController {
-	return new(InternalController)
+func NewInternalController(r reporting.App) *InternalController {
+	return &InternalController{
+		reporting: r,
+	}
 }
 
 // Internal responds to GET /health/alive
@@ -34,3 +52,174 @@ func (h InternalController) HealthAlive(c *gin.Context) {
 		"status": "ok",
 	})
 }
+
+// renderTenantError renders the errors of the tenant operations
+func renderTenantError(c *gin.Context, err error) {
+	switch errors.Cause(err) {
+	case reporting.ErrTenantNotFound:
+		rest.RenderError(c, http.StatusNotFound, err)
+	case reporting.ErrTenantDeleting:
+		rest.RenderError(c, http.StatusConflict, err)
+	default:
+		log.FromContext(c.Request.Context()).Error(err)
+		rest.RenderError(c, http.StatusInternalServerError, errInternal)
+	}
+}
+
+// ProvisionTenant responds to POST /tenants
+func (h InternalController) ProvisionTenant(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var params model.ProvisionTenantParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		rest.RenderError(c, http.StatusBadRequest,
+			errors.Wrap(err, "malformed request body"))
+		return
+	}
+	if err := params.Validate(); err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	tenant, err := h.reporting.ProvisionTenant(ctx, &params)
+	if err != nil {
+		renderTenantError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, tenant)
+}
+
+// tenantIDParam returns the tenant ID of the path, rendering an error if
+// it is not valid
+func tenantIDParam(c *gin.Context) (string, bool) {
+	tenantID := c.Param(paramTenantID)
+	if err := model.ValidateTenantID(tenantID); err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return "", false
+	}
+	return tenantID, true
+}
+
+// GetTenant responds to GET /tenants/:tenant_id
+func (h InternalController) GetTenant(c *gin.Context) {
+	tenantID, ok := tenantIDParam(c)
+	if !ok {
+		return
+	}
+	tenant, err := h.reporting.GetTenant(c.Request.Context(), tenantID)
+	if err != nil {
+		renderTenantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tenant)
+}
+
+// SuspendTenant responds to POST /tenants/:tenant_id/suspend
+func (h InternalController) SuspendTenant(c *gin.Context) {
+	tenantID, ok := tenantIDParam(c)
+	if !ok {
+		return
+	}
+	tenant, err := h.reporting.SuspendTenant(c.Request.Context(), tenantID)
+	if err != nil {
+		renderTenantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tenant)
+}
+
+// ResumeTenant responds to POST /tenants/:tenant_id/resume
+func (h InternalController) ResumeTenant(c *gin.Context) {
+	tenantID, ok := tenantIDParam(c)
+	if !ok {
+		return
+	}
+	tenant, err := h.reporting.ResumeTenant(c.Request.Context(), tenantID)
+	if err != nil {
+		renderTenantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tenant)
+}
+
+// DeleteTenant responds to DELETE /tenants/:tenant_id, starting the
+// deletion of the tenant data in background
+func (h InternalController) DeleteTenant(c *gin.Context) {
+	tenantID, ok := tenantIDParam(c)
+	if !ok {
+		return
+	}
+	tenant, err := h.reporting.DeleteTenant(c.Request.Context(), tenantID)
+	if err != nil {
+		renderTenantError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, tenant)
+}
+
+// renderDeadLetterError renders the errors of the dead letter operations
+func renderDeadLetterError(c *gin.Context, err error) {
+	switch errors.Cause(err) {
+	case reporting.ErrDeadLetterNotFound:
+		rest.RenderError(c, http.StatusNotFound, err)
+	case reporting.ErrDeviceRejected:
+		rest.RenderError(c, http.StatusConflict, err)
+	default:
+		log.FromContext(c.Request.Context()).Error(err)
+		rest.RenderError(c, http.StatusInternalServerError, errInternal)
+	}
+}
+
+// ListDeadLetters responds to GET /dead-letters
+func (h InternalController) ListDeadLetters(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	page, perPage, err := rest.ParsePagingParameters(c.Request)
+	if err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return
+	}
+	filter := &model.DeadLetterFilter{
+		TenantID: c.Query(queryTenantID),
+		Page:     page,
+		PerPage:  perPage,
+	}
+
+	deadLetters, total, err := h.reporting.ListDeadLetters(ctx, filter)
+	if err != nil {
+		renderDeadLetterError(c, err)
+		return
+	}
+
+	links, err := rest.MakePagingHeaders(c.Request, rest.NewPagingHints().
+		SetPage(page).
+		SetPerPage(perPage).
+		SetTotalCount(int64(total)))
+	if err == nil {
+		for _, link := range links {
+			c.Writer.Header().Add("Link", link)
+		}
+	}
+	c.Header(hdrTotalCount, strconv.Itoa(total))
+	c.JSON(http.StatusOK, deadLetters)
+}
+
+// RetryDeadLetter responds to POST /dead-letters/:id/retry
+func (h InternalController) RetryDeadLetter(c *gin.Context) {
+	err := h.reporting.RetryDeadLetter(c.Request.Context(), c.Param(paramDeadLetterID))
+	if err != nil {
+		renderDeadLetterError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DiscardDeadLetter responds to DELETE /dead-letters/:id
+func (h InternalController) DiscardDeadLetter(c *gin.Context) {
+	err := h.reporting.DiscardDeadLetter(c.Request.Context(), c.Param(paramDeadLetterID))
+	if err != nil {
+		renderDeadLetterError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -18,14 +18,21 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/app/reporting"
+	"github.com/mendersoftware/reporting/app/reporting/mocks"
+	"github.com/mendersoftware/reporting/model"
 )
 
 func TestStatus(t *testing.T) {
-	router := NewRouter()
+	router := NewRouter(nil)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest(http.MethodGet, URIInternal+URILiveliness, nil)
@@ -45,3 +52,255 @@ func TestStatus(t *testing.T) {
 	}
 	assert.Equal(t, expectedBody["status"], value)
 }
+
+func TestTenants(t *testing.T) {
+	tenant := &model.Tenant{
+		ID:     "tenant",
+		Tier:   model.TierOS,
+		Status: model.TenantStatusActive,
+	}
+	testCases := map[string]struct {
+		method string
+		uri    string
+		body   string
+		mock   func(app *mocks.App)
+		code   int
+		error  string
+	}{
+		"ok, provision": {
+			method: http.MethodPost,
+			uri:    URITenants,
+			body:   `{"tenant_id": "tenant"}`,
+			mock: func(app *mocks.App) {
+				app.On("ProvisionTenant", mock.Anything, &model.ProvisionTenantParams{
+					TenantID: "tenant",
+					Tier:     model.TierOS,
+				}).Return(tenant, nil)
+			},
+			code: http.StatusCreated,
+		},
+		"ko, provision, bad tier": {
+			method: http.MethodPost,
+			uri:    URITenants,
+			body:   `{"tenant_id": "tenant", "tier": "gold"}`,
+			code:   http.StatusBadRequest,
+			error:  "invalid request body: tier: value is not one of the allowed values",
+		},
+		"ko, provision, bad tenant": {
+			method: http.MethodPost,
+			uri:    URITenants,
+			body:   `{"tenant_id": "Tenant"}`,
+			code:   http.StatusBadRequest,
+			error: "tenant_id: must be at most 128 lowercase " +
+				"alphanumeric characters, dashes or underscores",
+		},
+		"ko, provision, deleting": {
+			method: http.MethodPost,
+			uri:    URITenants,
+			body:   `{"tenant_id": "tenant"}`,
+			mock: func(app *mocks.App) {
+				app.On("ProvisionTenant", mock.Anything, mock.Anything).
+					Return(nil, reporting.ErrTenantDeleting)
+			},
+			code:  http.StatusConflict,
+			error: "tenant is being deleted",
+		},
+		"ok, get": {
+			method: http.MethodGet,
+			uri:    "/tenants/tenant",
+			mock: func(app *mocks.App) {
+				app.On("GetTenant", mock.Anything, "tenant").Return(tenant, nil)
+			},
+			code: http.StatusOK,
+		},
+		"ko, get, not found": {
+			method: http.MethodGet,
+			uri:    "/tenants/tenant",
+			mock: func(app *mocks.App) {
+				app.On("GetTenant", mock.Anything, "tenant").
+					Return(nil, reporting.ErrTenantNotFound)
+			},
+			code:  http.StatusNotFound,
+			error: "tenant not found",
+		},
+		"ko, get, internal error": {
+			method: http.MethodGet,
+			uri:    "/tenants/tenant",
+			mock: func(app *mocks.App) {
+				app.On("GetTenant", mock.Anything, "tenant").
+					Return(nil, errors.New("connection refused"))
+			},
+			code:  http.StatusInternalServerError,
+			error: "internal error",
+		},
+		"ok, suspend": {
+			method: http.MethodPost,
+			uri:    "/tenants/tenant/suspend",
+			mock: func(app *mocks.App) {
+				app.On("SuspendTenant", mock.Anything, "tenant").Return(tenant, nil)
+			},
+			code: http.StatusOK,
+		},
+		"ok, resume": {
+			method: http.MethodPost,
+			uri:    "/tenants/tenant/resume",
+			mock: func(app *mocks.App) {
+				app.On("ResumeTenant", mock.Anything, "tenant").Return(tenant, nil)
+			},
+			code: http.StatusOK,
+		},
+		"ok, delete": {
+			method: http.MethodDelete,
+			uri:    "/tenants/tenant",
+			mock: func(app *mocks.App) {
+				app.On("DeleteTenant", mock.Anything, "tenant").Return(tenant, nil)
+			},
+			code: http.StatusAccepted,
+		},
+		"ko, delete, bad tenant": {
+			method: http.MethodDelete,
+			uri:    "/tenants/devices-*",
+			code:   http.StatusBadRequest,
+			error: "tenant_id: must be at most 128 lowercase " +
+				"alphanumeric characters, dashes or underscores",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+			if tc.mock != nil {
+				tc.mock(app)
+			}
+
+			router := NewRouter(app)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, URIInternal+tc.uri,
+				strings.NewReader(tc.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.error != "" {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tc.error, response["error"])
+			} else {
+				var response model.Tenant
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, *tenant, response)
+			}
+		})
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	deadLetters := []*model.DeadLetter{{
+		ID:        "tenant:1",
+		TenantID:  "tenant",
+		DeviceID:  "1",
+		ErrorType: "mapper_parsing_exception",
+		Reason:    "failed to parse field [location]",
+		Attempts:  1,
+		Payload:   json.RawMessage(`{"id":"1"}`),
+	}}
+	testCases := map[string]struct {
+		method string
+		uri    string
+		mock   func(app *mocks.App)
+		code   int
+		total  string
+		error  string
+	}{
+		"ok, list": {
+			method: http.MethodGet,
+			uri:    "/dead-letters?tenant_id=tenant&page=2&per_page=1",
+			mock: func(app *mocks.App) {
+				app.On("ListDeadLetters", mock.Anything, &model.DeadLetterFilter{
+					TenantID: "tenant",
+					Page:     2,
+					PerPage:  1,
+				}).Return(deadLetters, 3, nil)
+			},
+			code:  http.StatusOK,
+			total: "3",
+		},
+		"ko, list, bad paging": {
+			method: http.MethodGet,
+			uri:    "/dead-letters?page=0",
+			code:   http.StatusBadRequest,
+			error:  `invalid query parameter "page": number must be at least 1`,
+		},
+		"ok, retry": {
+			method: http.MethodPost,
+			uri:    "/dead-letters/tenant:1/retry",
+			mock: func(app *mocks.App) {
+				app.On("RetryDeadLetter", mock.Anything, "tenant:1").Return(nil)
+			},
+			code: http.StatusNoContent,
+		},
+		"ko, retry, rejected": {
+			method: http.MethodPost,
+			uri:    "/dead-letters/tenant:1/retry",
+			mock: func(app *mocks.App) {
+				app.On("RetryDeadLetter", mock.Anything, "tenant:1").
+					Return(errors.Wrap(reporting.ErrDeviceRejected, "mapping conflict"))
+			},
+			code:  http.StatusConflict,
+			error: "mapping conflict: device rejected",
+		},
+		"ok, discard": {
+			method: http.MethodDelete,
+			uri:    "/dead-letters/tenant:1",
+			mock: func(app *mocks.App) {
+				app.On("DiscardDeadLetter", mock.Anything, "tenant:1").Return(nil)
+			},
+			code: http.StatusNoContent,
+		},
+		"ko, discard, not found": {
+			method: http.MethodDelete,
+			uri:    "/dead-letters/tenant:1",
+			mock: func(app *mocks.App) {
+				app.On("DiscardDeadLetter", mock.Anything, "tenant:1").
+					Return(reporting.ErrDeadLetterNotFound)
+			},
+			code:  http.StatusNotFound,
+			error: "dead letter not found",
+		},
+		"ko, discard, internal error": {
+			method: http.MethodDelete,
+			uri:    "/dead-letters/tenant:1",
+			mock: func(app *mocks.App) {
+				app.On("DiscardDeadLetter", mock.Anything, "tenant:1").
+					Return(errors.New("connection refused"))
+			},
+			code:  http.StatusInternalServerError,
+			error: "internal error",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+			if tc.mock != nil {
+				tc.mock(app)
+			}
+
+			router := NewRouter(app)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, URIInternal+tc.uri, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.error != "" {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tc.error, response["error"])
+			} else if tc.code == http.StatusOK {
+				assert.Equal(t, tc.total, w.Header().Get(hdrTotalCount))
+				var response []*model.DeadLetter
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, deadLetters, response)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	rest "github.com/mendersoftware/go-lib-micro/rest.utils"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/app/reporting"
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	paramDeviceID = "id"
+
+	queryScope     = "scope"
+	queryAttribute = "attribute"
+	queryFrom      = "from"
+	queryTo        = "to"
+	queryThreshold = "threshold"
+	querySearch    = "q"
+	queryFilter    = "query"
+	queryPerGroup  = "per_group"
+
+	perGroupMax = 100
+
+	hdrTotalCount = "X-Total-Count"
+)
+
+var (
+	errMissingIdentity = errors.New("missing or invalid identity")
+	errInternal        = errors.New("internal error")
+)
+
+// ManagementController contains management end-points
+type ManagementController struct {
+	reporting reporting.App
+}
+
+// NewManagementController returns a new ManagementController
+func NewManagementController(r reporting.App) *ManagementController {
+	return &ManagementController{
+		reporting: r,
+	}
+}
+
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.Errorf("invalid %s query: \"%s\"", name, value)
+	}
+	return &t, nil
+}
+
+// DeviceHistory responds to GET /devices/:id/history
+func (mc *ManagementController) DeviceHistory(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id := identity.FromContext(ctx)
+	if id == nil {
+		rest.RenderError(c, http.StatusUnauthorized, errMissingIdentity)
+		return
+	}
+
+	page, perPage, err := rest.ParsePagingParameters(c.Request)
+	if err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return
+	}
+	filter := &model.HistoryFilter{
+		Scope:     c.Query(queryScope),
+		Attribute: c.Query(queryAttribute),
+		Page:      page,
+		PerPage:   perPage,
+	}
+	if filter.From, err = parseTimeQuery(c, queryFrom); err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return
+	}
+	if filter.To, err = parseTimeQuery(c, queryTo); err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	changes, total, err := mc.reporting.GetDeviceHistory(ctx, id.Tenant,
+		c.Param(paramDeviceID), filter)
+	if err != nil {
+		log.FromContext(ctx).Error(err)
+		rest.RenderError(c, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	links, err := rest.MakePagingHeaders(c.Request, rest.NewPagingHints().
+		SetPage(page).
+		SetPerPage(perPage).
+		SetTotalCount(int64(total)))
+	if err == nil {
+		for _, link := range links {
+			c.Writer.Header().Add("Link", link)
+		}
+	}
+	c.Header(hdrTotalCount, strconv.Itoa(total))
+	c.JSON(http.StatusOK, changes)
+}
+
+// SearchDevices responds to POST /devices/search
+func (mc *ManagementController) SearchDevices(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id := identity.FromContext(ctx)
+	if id == nil {
+		rest.RenderError(c, http.StatusUnauthorized, errMissingIdentity)
+		return
+	}
+
+	var params model.SearchParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		rest.RenderError(c, http.StatusBadRequest,
+			errors.Wrap(err, "malformed request body"))
+		return
+	}
+	if q := c.Query(querySearch); q != "" {
+		params.Query = q
+	}
+	if query := c.Query(queryFilter); query != "" {
+		params.FilterQuery = query
+	}
+	if err := params.Validate(); err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return
+	}
+	params.TenantID = id.Tenant
+
+	devices, total, err := mc.reporting.SearchDevices(ctx, &params)
+	if err != nil {
+		log.FromContext(ctx).Error(err)
+		rest.RenderError(c, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	c.Header(hdrTotalCount, strconv.Itoa(total))
+	c.JSON(http.StatusOK, devices)
+}
+
+// StaleDevicesReport responds to GET /reports/stale-devices
+func (mc *ManagementController) StaleDevicesReport(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id := identity.FromContext(ctx)
+	if id == nil {
+		rest.RenderError(c, http.StatusUnauthorized, errMissingIdentity)
+		return
+	}
+
+	var (
+		threshold time.Duration
+		perGroup  int
+		err       error
+	)
+	if value := c.Query(queryThreshold); value != "" {
+		threshold, err = time.ParseDuration(value)
+		if err != nil || threshold <= 0 {
+			rest.RenderError(c, http.StatusBadRequest,
+				errors.Errorf("invalid threshold query: \"%s\"", value))
+			return
+		}
+	}
+	if value := c.Query(queryPerGroup); value != "" {
+		perGroup, err = strconv.Atoi(value)
+		if err != nil || perGroup < 1 || perGroup > perGroupMax {
+			rest.RenderError(c, http.StatusBadRequest,
+				errors.Errorf("invalid per_group query: \"%s\" (max: %d)",
+					value, perGroupMax))
+			return
+		}
+	}
+
+	report, err := mc.reporting.StaleDevicesReport(ctx, id.Tenant, threshold, perGroup)
+	if err != nil {
+		log.FromContext(ctx).Error(err)
+		rest.RenderError(c, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GeoGrid responds to POST /devices/aggregate/geo
+func (mc *ManagementController) GeoGrid(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id := identity.FromContext(ctx)
+	if id == nil {
+		rest.RenderError(c, http.StatusUnauthorized, errMissingIdentity)
+		return
+	}
+
+	var params model.GeoGridParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		rest.RenderError(c, http.StatusBadRequest,
+			errors.Wrap(err, "malformed request body"))
+		return
+	}
+	if err := params.Validate(); err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return
+	}
+	params.TenantID = id.Tenant
+
+	buckets, err := mc.reporting.GeoGrid(ctx, &params)
+	if err != nil {
+		log.FromContext(ctx).Error(err)
+		rest.RenderError(c, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, buckets)
+}
+
+// Subnets responds to POST /devices/aggregate/subnets
+func (mc *ManagementController) Subnets(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id := identity.FromContext(ctx)
+	if id == nil {
+		rest.RenderError(c, http.StatusUnauthorized, errMissingIdentity)
+		return
+	}
+
+	var params model.SubnetsParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		rest.RenderError(c, http.StatusBadRequest,
+			errors.Wrap(err, "malformed request body"))
+		return
+	}
+	if err := params.Validate(); err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return
+	}
+	params.TenantID = id.Tenant
+
+	buckets, err := mc.reporting.Subnets(ctx, &params)
+	if err != nil {
+		log.FromContext(ctx).Error(err)
+		rest.RenderError(c, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	c.JSON(http.StatusOK, buckets)
+}
@@ -0,0 +1,495 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/app/reporting/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func makeJWT(tenantID string) string {
+	claims, _ := json.Marshal(map[string]interface{}{
+		"sub":           "user",
+		"mender.tenant": tenantID,
+		"mender.user":   true,
+	})
+	return "header." + base64.RawURLEncoding.EncodeToString(claims) + ".signature"
+}
+
+func TestDeviceHistory(t *testing.T) {
+	timestamp := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	from := timestamp.Add(-time.Hour)
+
+	testCases := map[string]struct {
+		query string
+		auth  bool
+
+		filter  *model.HistoryFilter
+		changes []*model.AttributeChange
+		total   int
+		err     error
+
+		code int
+	}{
+		"ok": {
+			query: "?attribute=artifact_name&scope=inventory&from=" + from.Format(time.RFC3339),
+			auth:  true,
+			filter: &model.HistoryFilter{
+				Scope:     model.ScopeInventory,
+				Attribute: "artifact_name",
+				From:      &from,
+				Page:      1,
+				PerPage:   20,
+			},
+			changes: []*model.AttributeChange{
+				{
+					DeviceID:  "1",
+					TenantID:  "tenant",
+					Scope:     model.ScopeInventory,
+					Name:      "artifact_name",
+					OldValue:  &model.AttributeValue{String: []string{"release-1"}},
+					NewValue:  &model.AttributeValue{String: []string{"release-2"}},
+					Timestamp: timestamp,
+				},
+			},
+			total: 1,
+			code:  http.StatusOK,
+		},
+		"ko, unauthorized": {
+			code: http.StatusUnauthorized,
+		},
+		"ko, bad time range": {
+			query: "?to=yesterday",
+			auth:  true,
+			code:  http.StatusBadRequest,
+		},
+		"ko, bad paging": {
+			query: "?page=0",
+			auth:  true,
+			code:  http.StatusBadRequest,
+		},
+		"ko, internal error": {
+			auth: true,
+			filter: &model.HistoryFilter{
+				Page:    1,
+				PerPage: 20,
+			},
+			err:  errors.New("error"),
+			code: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+			if tc.filter != nil {
+				app.On("GetDeviceHistory", mock.Anything, "tenant", "1", tc.filter).
+					Return(tc.changes, tc.total, tc.err)
+			}
+
+			router := NewRouter(app)
+			w := httptest.NewRecorder()
+			uri := URIManagement + strings.Replace(URIDeviceHistory, ":id", "1", 1)
+			req, _ := http.NewRequest(http.MethodGet, uri+tc.query, nil)
+			if tc.auth {
+				req.Header.Set("Authorization", "Bearer "+makeJWT("tenant"))
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.code == http.StatusOK {
+				var changes []*model.AttributeChange
+				err := json.Unmarshal(w.Body.Bytes(), &changes)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.changes, changes)
+				assert.Equal(t, "1", w.Header().Get(hdrTotalCount))
+			}
+		})
+	}
+}
+
+func TestSearchDevices(t *testing.T) {
+	testCases := map[string]struct {
+		query string
+		body  string
+
+		params  *model.SearchParams
+		devices []*model.Device
+		total   int
+		err     error
+
+		code  int
+		error string
+	}{
+		"ok": {
+			body: `{"filters": [{"scope": "system", "attribute": "lastDeploymentStatus", "type": "$eq", "value": "failure"}]}`,
+			params: &model.SearchParams{
+				Page:    1,
+				PerPage: 20,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     model.ScopeSystem,
+						Attribute: "lastDeploymentStatus",
+						Type:      model.FilterTypeEq,
+						Value:     model.DeploymentStatusFailure,
+					},
+				},
+				TenantID: "tenant",
+			},
+			devices: []*model.Device{
+				model.NewDevice("1").SetTenantID("tenant"),
+			},
+			total: 1,
+			code:  http.StatusOK,
+		},
+		"ok, free-text query": {
+			query: "?q=serial",
+			body:  `{}`,
+			params: &model.SearchParams{
+				Page:     1,
+				PerPage:  20,
+				Query:    "serial",
+				TenantID: "tenant",
+			},
+			devices: []*model.Device{},
+			code:    http.StatusOK,
+		},
+		"ok, filter query": {
+			query: "?query=" + url.QueryEscape(`status IN [accepted]`),
+			body:  `{}`,
+			params: &model.SearchParams{
+				Page:        1,
+				PerPage:     20,
+				FilterQuery: "status IN [accepted]",
+				TenantID:    "tenant",
+			},
+			devices: []*model.Device{},
+			code:    http.StatusOK,
+		},
+		"ko, malformed body": {
+			body: `{`,
+			code: http.StatusBadRequest,
+		},
+		"ko, filter query syntax error": {
+			body:  `{"query": "status == \"accepted\" AND (name == foo"}`,
+			code:  http.StatusBadRequest,
+			error: `query: position 38: expected ")", found end of query`,
+		},
+		"ko, invalid filter": {
+			body: `{"filters": [{"scope": "system", "attribute": "foo", "type": "$eq", "value": "bar"}]}`,
+			code: http.StatusBadRequest,
+		},
+		"ko, internal error": {
+			body: `{}`,
+			params: &model.SearchParams{
+				Page:     1,
+				PerPage:  20,
+				TenantID: "tenant",
+			},
+			err:  errors.New("error"),
+			code: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+			if tc.params != nil {
+				app.On("SearchDevices", mock.Anything, tc.params).
+					Return(tc.devices, tc.total, tc.err)
+			}
+
+			router := NewRouter(app)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost,
+				URIManagement+URIDevicesSearch+tc.query, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+makeJWT("tenant"))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.code == http.StatusOK {
+				var devices []*model.Device
+				err := json.Unmarshal(w.Body.Bytes(), &devices)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.devices, devices)
+			}
+			if tc.error != "" {
+				var body map[string]string
+				err := json.Unmarshal(w.Body.Bytes(), &body)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.error, body["error"])
+			}
+		})
+	}
+}
+
+func TestStaleDevicesReport(t *testing.T) {
+	testCases := map[string]struct {
+		query string
+
+		threshold time.Duration
+		perGroup  int
+		report    *model.StaleDevicesReport
+		err       error
+
+		code int
+	}{
+		"ok, defaults": {
+			report: &model.StaleDevicesReport{
+				Threshold: "24h0m0s",
+				Total:     1,
+				Groups: []*model.StaleDevicesGroup{
+					{
+						GroupName: "production",
+						Count:     1,
+						Devices: []*model.StaleDevice{
+							{ID: "1"},
+						},
+					},
+				},
+			},
+			code: http.StatusOK,
+		},
+		"ok, threshold and per group": {
+			query:     "?threshold=48h&per_group=5",
+			threshold: 48 * time.Hour,
+			perGroup:  5,
+			report: &model.StaleDevicesReport{
+				Threshold: "48h0m0s",
+				Groups:    []*model.StaleDevicesGroup{},
+			},
+			code: http.StatusOK,
+		},
+		"ko, bad threshold": {
+			query: "?threshold=yesterday",
+			code:  http.StatusBadRequest,
+		},
+		"ko, bad per group": {
+			query: "?per_group=1000",
+			code:  http.StatusBadRequest,
+		},
+		"ko, internal error": {
+			err:  errors.New("error"),
+			code: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+			if tc.report != nil || tc.err != nil {
+				app.On("StaleDevicesReport", mock.Anything, "tenant",
+					tc.threshold, tc.perGroup).
+					Return(tc.report, tc.err)
+			}
+
+			router := NewRouter(app)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet,
+				URIManagement+URIStaleDevicesReport+tc.query, nil)
+			req.Header.Set("Authorization", "Bearer "+makeJWT("tenant"))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.code == http.StatusOK {
+				var report model.StaleDevicesReport
+				err := json.Unmarshal(w.Body.Bytes(), &report)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.report, &report)
+			}
+		})
+	}
+}
+
+func TestGeoGrid(t *testing.T) {
+	testCases := map[string]struct {
+		body string
+
+		params  *model.GeoGridParams
+		buckets []*model.GeoGridBucket
+		err     error
+
+		code int
+	}{
+		"ok": {
+			body: `{"precision": 3, "geo_distance": {"point": {"lat": 59.9, "lon": 10.7}, "distance": "10km"}}`,
+			params: &model.GeoGridParams{
+				Precision: 3,
+				GeoDistance: &model.GeoDistanceFilter{
+					Point:    model.GeoPoint{Lat: 59.9, Lon: 10.7},
+					Distance: "10km",
+				},
+				TenantID: "tenant",
+			},
+			buckets: []*model.GeoGridBucket{
+				{
+					Geohash:  "ukq",
+					Count:    2,
+					Centroid: &model.GeoPoint{Lat: 59.91, Lon: 10.75},
+				},
+			},
+			code: http.StatusOK,
+		},
+		"ok, defaults": {
+			body: `{}`,
+			params: &model.GeoGridParams{
+				Precision: model.GeoGridPrecisionDefault,
+				TenantID:  "tenant",
+			},
+			buckets: []*model.GeoGridBucket{},
+			code:    http.StatusOK,
+		},
+		"ko, malformed body": {
+			body: `{`,
+			code: http.StatusBadRequest,
+		},
+		"ko, invalid precision": {
+			body: `{"precision": 13}`,
+			code: http.StatusBadRequest,
+		},
+		"ko, internal error": {
+			body: `{}`,
+			params: &model.GeoGridParams{
+				Precision: model.GeoGridPrecisionDefault,
+				TenantID:  "tenant",
+			},
+			err:  errors.New("error"),
+			code: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+			if tc.params != nil {
+				app.On("GeoGrid", mock.Anything, tc.params).
+					Return(tc.buckets, tc.err)
+			}
+
+			router := NewRouter(app)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost,
+				URIManagement+URIDevicesGeoGrid, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+makeJWT("tenant"))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.code == http.StatusOK {
+				var buckets []*model.GeoGridBucket
+				err := json.Unmarshal(w.Body.Bytes(), &buckets)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.buckets, buckets)
+			}
+		})
+	}
+}
+
+func TestSubnets(t *testing.T) {
+	testCases := map[string]struct {
+		body string
+
+		params  *model.SubnetsParams
+		buckets []*model.SubnetBucket
+		err     error
+
+		code int
+	}{
+		"ok": {
+			body: `{"scope": "identity", "attribute": "ipv4_eth0", "size": 5}`,
+			params: &model.SubnetsParams{
+				Scope:     model.ScopeIdentity,
+				Attribute: "ipv4_eth0",
+				Size:      5,
+				TenantID:  "tenant",
+			},
+			buckets: []*model.SubnetBucket{
+				{Network: "10.0.0.0/24", Count: 3},
+				{Network: "192.168.1.0/24", Count: 1},
+			},
+			code: http.StatusOK,
+		},
+		"ok, defaults": {
+			body: `{}`,
+			params: &model.SubnetsParams{
+				Scope:    model.ScopeInventory,
+				Size:     model.PerPageDefault,
+				TenantID: "tenant",
+			},
+			buckets: []*model.SubnetBucket{},
+			code:    http.StatusOK,
+		},
+		"ko, malformed body": {
+			body: `{`,
+			code: http.StatusBadRequest,
+		},
+		"ko, invalid scope": {
+			body: `{"scope": "system"}`,
+			code: http.StatusBadRequest,
+		},
+		"ko, internal error": {
+			body: `{}`,
+			params: &model.SubnetsParams{
+				Scope:    model.ScopeInventory,
+				Size:     model.PerPageDefault,
+				TenantID: "tenant",
+			},
+			err:  errors.New("error"),
+			code: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+			if tc.params != nil {
+				app.On("Subnets", mock.Anything, tc.params).
+					Return(tc.buckets, tc.err)
+			}
+
+			router := NewRouter(app)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost,
+				URIManagement+URIDevicesSubnets, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+makeJWT("tenant"))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.code == http.StatusOK {
+				var buckets []*model.SubnetBucket
+				err := json.Unmarshal(w.Body.Bytes(), &buckets)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.buckets, buckets)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/gin-gonic/gin"
+	rest "github.com/mendersoftware/go-lib-micro/rest.utils"
+	"github.com/pkg/errors"
+)
+
+const contentTypeYAML = "application/yaml"
+
+// newOpenAPIRouter loads the OpenAPI specification and returns the router
+// matching the requests to its operations; the servers of the specification
+// are replaced by the prefix of the API, to match the requests regardless of
+// the host they were sent to
+func newOpenAPIRouter(spec []byte, prefix string) (routers.Router, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the OpenAPI specification")
+	}
+	doc.Servers = openapi3.Servers{{URL: prefix}}
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid OpenAPI specification")
+	}
+	return router, nil
+}
+
+// validationError returns a short description of a request validation
+// error, without the schemas and the values
+func validationError(err error) error {
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return err
+	}
+	reason := reqErr.Reason
+	var schemaErr *openapi3.SchemaError
+	if errors.As(reqErr.Err, &schemaErr) {
+		reason = schemaErr.Reason
+		if path := schemaErr.JSONPointer(); len(path) > 0 {
+			reason = strings.Join(path, ".") + ": " + reason
+		}
+	} else if reqErr.Err != nil {
+		if reason != "" {
+			reason += ": "
+		}
+		reason += reqErr.Err.Error()
+	}
+	switch {
+	case reqErr.Parameter != nil:
+		return errors.Errorf("invalid %s parameter %q: %s",
+			reqErr.Parameter.In, reqErr.Parameter.Name, reason)
+	case reqErr.RequestBody != nil:
+		return errors.Errorf("invalid request body: %s", reason)
+	}
+	return errors.New(reason)
+}
+
+// OpenAPIValidator returns a middleware validating the query parameters and
+// the bodies of the requests against the OpenAPI specification of the API
+// mounted at the given prefix; requests to operations missing from the
+// specification are not validated
+func OpenAPIValidator(spec []byte, prefix string) (gin.HandlerFunc, error) {
+	router, err := newOpenAPIRouter(spec, prefix)
+	if err != nil {
+		return nil, err
+	}
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			c.Next()
+			return
+		}
+		// the handlers bind the bodies as JSON regardless of the
+		// content type
+		if c.Request.Header.Get("Content-Type") == "" {
+			c.Request.Header.Set("Content-Type", gin.MIMEJSON)
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			rest.RenderError(c, http.StatusBadRequest, validationError(err))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+func mustOpenAPIValidator(spec []byte, prefix string) gin.HandlerFunc {
+	validator, err := OpenAPIValidator(spec, prefix)
+	if err != nil {
+		panic(err)
+	}
+	return validator
+}
+
+// OpenAPISpec returns a handler serving the OpenAPI specification
+func OpenAPISpec(spec []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, contentTypeYAML, spec)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/app/reporting/mocks"
+	"github.com/mendersoftware/reporting/docs"
+)
+
+func TestOpenAPISpecs(t *testing.T) {
+	for name, spec := range map[string][]byte{
+		URIInternal:   docs.InternalAPI,
+		URIManagement: docs.ManagementAPI,
+	} {
+		_, err := OpenAPIValidator(spec, name)
+		assert.NoError(t, err, name)
+
+		router := NewRouter(nil)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, name+URIOpenAPISpec, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, contentTypeYAML, w.Header().Get("Content-Type"))
+		assert.Equal(t, spec, w.Body.Bytes())
+	}
+}
+
+func TestOpenAPIValidator(t *testing.T) {
+	testCases := map[string]struct {
+		method string
+		uri    string
+		body   string
+
+		error string
+	}{
+		"ko, query parameter out of range": {
+			method: http.MethodGet,
+			uri:    URIStaleDevicesReport + "?per_group=0",
+			error: `invalid query parameter "per_group": ` +
+				`number must be at least 1`,
+		},
+		"ko, query parameter type": {
+			method: http.MethodGet,
+			uri:    "/devices/1/history?page=first",
+			error: `invalid query parameter "page": ` +
+				`value first: an invalid integer: ` +
+				`strconv.ParseFloat: parsing "first": invalid syntax`,
+		},
+		"ko, unknown filter type": {
+			method: http.MethodPost,
+			uri:    URIDevicesSearch,
+			body:   `{"filters": [{"scope": "system", "attribute": "status", "type": "$like"}]}`,
+			error: `invalid request body: filters.0.type: ` +
+				`value is not one of the allowed values`,
+		},
+		"ko, missing required property": {
+			method: http.MethodPost,
+			uri:    URIDevicesSearch,
+			body:   `{"sort": [{"scope": "system", "attribute": "name"}]}`,
+			error: `invalid request body: sort.0.order: ` +
+				`property "order" is missing`,
+		},
+		"ko, property type": {
+			method: http.MethodPost,
+			uri:    URIDevicesGeoGrid,
+			body:   `{"precision": "high"}`,
+			error: `invalid request body: precision: ` +
+				`Field must be set to integer or not be present`,
+		},
+		"ko, malformed body": {
+			method: http.MethodPost,
+			uri:    URIDevicesSubnets,
+			body:   `{`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+
+			router := NewRouter(app)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method,
+				URIManagement+tc.uri, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+makeJWT("tenant"))
+			req.Header.Set("X-Men-Requestid", "test")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var body map[string]string
+			err := json.Unmarshal(w.Body.Bytes(), &body)
+			assert.NoError(t, err)
+			assert.Equal(t, "test", body["request_id"])
+			if tc.error != "" {
+				assert.Equal(t, tc.error, body["error"])
+			} else {
+				assert.NotEmpty(t, body["error"])
+			}
+		})
+	}
+}
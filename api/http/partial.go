@@ -0,0 +1,54 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+// hdrPartialResults lists the reasons why the results are incomplete
+const hdrPartialResults = "X-Partial-Results"
+
+type partialResultsWriter struct {
+	gin.ResponseWriter
+	status *model.QueryStatus
+}
+
+func (w *partialResultsWriter) WriteHeader(code int) {
+	if partial := w.status.Partial(); len(partial) > 0 {
+		w.Header().Set(hdrPartialResults, strings.Join(partial, ","))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// PartialResults returns a middleware collecting the status of the queries
+// run by the handlers and setting the X-Partial-Results header when the
+// results are incomplete, because a query timed out or failed on some of
+// the shards
+func PartialResults() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, status := model.WithQueryStatus(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = &partialResultsWriter{
+			ResponseWriter: c.Writer,
+			status:         status,
+		}
+		c.Next()
+	}
+}
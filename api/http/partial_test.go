@@ -0,0 +1,72 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/app/reporting/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestPartialResults(t *testing.T) {
+	testCases := map[string]struct {
+		timedOut     bool
+		failedShards int
+		header       string
+	}{
+		"complete": {},
+		"timed out": {
+			timedOut: true,
+			header:   "timed_out",
+		},
+		"timed out and shard failures": {
+			timedOut:     true,
+			failedShards: 2,
+			header:       "timed_out,shard_failures",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mocks.App{}
+			defer app.AssertExpectations(t)
+			app.On("SearchDevices", mock.Anything,
+				mock.AnythingOfType("*model.SearchParams")).
+				Run(func(args mock.Arguments) {
+					ctx := args.Get(0).(context.Context)
+					model.QueryStatusFromContext(ctx).
+						Record(tc.timedOut, tc.failedShards)
+				}).
+				Return([]*model.Device{}, 0, nil)
+
+			router := NewRouter(app)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost,
+				URIManagement+URIDevicesSearch, strings.NewReader(`{}`))
+			req.Header.Set("Authorization", "Bearer "+makeJWT("tenant"))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tc.header, w.Header().Get(hdrPartialResults))
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	rest "github.com/mendersoftware/go-lib-micro/rest.utils"
+
+	"github.com/mendersoftware/reporting/app/ratelimit"
+)
+
+const hdrRetryAfter = "Retry-After"
+
+// RateLimit returns a middleware enforcing the per-tenant rate and
+// concurrency limits, responding 429 with the Retry-After header to the
+// rejected requests; it requires the identity middleware
+func RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := identity.FromContext(c.Request.Context())
+		if id == nil {
+			c.Next()
+			return
+		}
+		release, retryAfter, err := limiter.Acquire(id.Tenant)
+		if err != nil {
+			c.Header(hdrRetryAfter,
+				strconv.Itoa(ratelimit.RetryAfterSeconds(retryAfter)))
+			rest.RenderError(c, http.StatusTooManyRequests, err)
+			c.Abort()
+			return
+		}
+		defer release()
+		c.Next()
+	}
+}
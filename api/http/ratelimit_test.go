@@ -0,0 +1,58 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/app/ratelimit"
+	"github.com/mendersoftware/reporting/app/reporting/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestRateLimit(t *testing.T) {
+	app := &mocks.App{}
+	defer app.AssertExpectations(t)
+	app.On("SearchDevices", mock.Anything, mock.AnythingOfType("*model.SearchParams")).
+		Return([]*model.Device{}, 0, nil).Twice()
+
+	limiter := ratelimit.NewLimiter(model.RateLimits{Rate: 0.1, Burst: 1}, nil)
+	router := NewRouter(app, WithRateLimiter(limiter))
+
+	search := func(tenantID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost,
+			URIManagement+URIDevicesSearch, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+makeJWT(tenantID))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, search("tenant").Code)
+
+	w := search("tenant")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "10", w.Header().Get(hdrRetryAfter))
+	assert.JSONEq(t, `{"error": "rate limit exceeded", "request_id": "`+
+		w.Header().Get("X-Men-Requestid")+`"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusOK, search("other").Code)
+}
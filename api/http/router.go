@@ -16,9 +16,16 @@ package http
 
 import (
 	"context"
+	"expvar"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mendersoftware/go-lib-micro/identity"
 	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+
+	"github.com/mendersoftware/reporting/app/ratelimit"
+	"github.com/mendersoftware/reporting/app/reporting"
+	"github.com/mendersoftware/reporting/docs"
 )
 
 // API URL used by the HTTP router
@@ -26,11 +33,48 @@ const (
 	URIInternal   = "/api/internal/v1/reporting"
 	URIManagement = "/api/management/v1/reporting"
 
-	URILiveliness = "/health/alive"
+	URILiveliness     = "/health/alive"
+	URIOpenAPISpec    = "/docs/openapi.yml"
+	URIMetrics        = "/metrics"
+	URIDeviceHistory  = "/devices/:id/history"
+	URIDevicesSearch  = "/devices/search"
+	URIDevicesGeoGrid = "/devices/aggregate/geo"
+	URIDevicesSubnets = "/devices/aggregate/subnets"
+
+	URIStaleDevicesReport = "/reports/stale-devices"
+
+	URITenants       = "/tenants"
+	URITenant        = "/tenants/:tenant_id"
+	URITenantSuspend = "/tenants/:tenant_id/suspend"
+	URITenantResume  = "/tenants/:tenant_id/resume"
+
+	URIDeadLetters     = "/dead-letters"
+	URIDeadLetter      = "/dead-letters/:id"
+	URIDeadLetterRetry = "/dead-letters/:id/retry"
 )
 
+type routerOptions struct {
+	limiter *ratelimit.Limiter
+}
+
+// Option is a functional option of the router
+type Option func(*routerOptions)
+
+// WithRateLimiter enforces the per-tenant limits of the limiter on the
+// management API
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(opts *routerOptions) {
+		opts.limiter = limiter
+	}
+}
+
 // NewRouter returns the gin router
-func NewRouter() *gin.Engine {
+func NewRouter(reporting reporting.App, opts ...Option) *gin.Engine {
+	options := &routerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	gin.DisableConsoleColor()
 
@@ -40,10 +84,36 @@ func NewRouter() *gin.Engine {
 
 	router.Use(routerLogger(l))
 	router.Use(gin.Recovery())
+	router.Use(requestid.Middleware())
 
-	internal := NewInternalController()
-	internalAPI := router.Group(URIInternal)
+	internal := NewInternalController(reporting)
+	internalAPI := router.Group(URIInternal,
+		mustOpenAPIValidator(docs.InternalAPI, URIInternal))
 	internalAPI.GET(URILiveliness, internal.HealthAlive)
+	internalAPI.GET(URIOpenAPISpec, OpenAPISpec(docs.InternalAPI))
+	internalAPI.GET(URIMetrics, gin.WrapH(expvar.Handler()))
+	internalAPI.POST(URITenants, internal.ProvisionTenant)
+	internalAPI.GET(URITenant, internal.GetTenant)
+	internalAPI.DELETE(URITenant, internal.DeleteTenant)
+	internalAPI.POST(URITenantSuspend, internal.SuspendTenant)
+	internalAPI.POST(URITenantResume, internal.ResumeTenant)
+	internalAPI.GET(URIDeadLetters, internal.ListDeadLetters)
+	internalAPI.DELETE(URIDeadLetter, internal.DiscardDeadLetter)
+	internalAPI.POST(URIDeadLetterRetry, internal.RetryDeadLetter)
+
+	router.GET(URIManagement+URIOpenAPISpec, OpenAPISpec(docs.ManagementAPI))
+
+	management := NewManagementController(reporting)
+	managementAPI := router.Group(URIManagement, identity.Middleware(),
+		mustOpenAPIValidator(docs.ManagementAPI, URIManagement), PartialResults())
+	if options.limiter != nil {
+		managementAPI.Use(RateLimit(options.limiter))
+	}
+	managementAPI.GET(URIDeviceHistory, management.DeviceHistory)
+	managementAPI.POST(URIDevicesSearch, management.SearchDevices)
+	managementAPI.POST(URIDevicesGeoGrid, management.GeoGrid)
+	managementAPI.POST(URIDevicesSubnets, management.Subnets)
+	managementAPI.GET(URIStaleDevicesReport, management.StaleDevicesReport)
 
 	return router
 }
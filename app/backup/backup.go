@@ -0,0 +1,320 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/app/reporting"
+	"github.com/mendersoftware/reporting/client/elasticsearch"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// restoreBatchSize is the number of documents restored by bulk request
+const restoreBatchSize = 500
+
+// maxDocumentSize is the maximum size of a line of the data files
+const maxDocumentSize = 16 * 1024 * 1024
+
+var (
+	ErrTenantSuspended = errors.New("the tenant is suspended")
+	ErrTenantHasData   = errors.New("the tenant already has data")
+)
+
+// Backup writes a gzipped tar archive of the devices, history and
+// deployments of the tenant to w: the manifest, then a NDJSON file by
+// tenant data. Saved searches are not stored by the service, so they are
+// not part of the backups. The documents are spooled to temporary files
+// first, to count them in the manifest.
+func Backup(ctx context.Context, esClient elasticsearch.Client,
+	tenantID string, w io.Writer) (*model.BackupManifest, error) {
+	if err := model.ValidateTenantID(tenantID); err != nil {
+		return nil, err
+	}
+	tenant, err := esClient.GetTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	} else if tenant != nil && tenant.Status == model.TenantStatusSuspended {
+		return nil, ErrTenantSuspended
+	}
+
+	dir, err := ioutil.TempDir("", "reporting-backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := &model.BackupManifest{
+		Version:   model.BackupVersion,
+		TenantID:  tenantID,
+		Tenant:    tenant,
+		CreatedAt: time.Now().UTC(),
+		Documents: make(map[string]int, len(model.TenantData)),
+	}
+	files := make(map[string]*os.File, len(model.TenantData))
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, data := range model.TenantData {
+		file, err := ioutil.TempFile(dir, data)
+		if err != nil {
+			return nil, err
+		}
+		files[data] = file
+		count, err := spool(ctx, esClient, tenantID, data, file)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Documents[data] = count
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = writeFile(archive, model.BackupManifestFile, int64(len(manifestJSON)),
+		manifest.CreatedAt, bytes.NewReader(manifestJSON))
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range model.TenantData {
+		file := files[data]
+		size, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		err = writeFile(archive, model.BackupDataFile(data), size,
+			manifest.CreatedAt, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// spool writes the documents of the tenant data to w as JSON lines, and
+// returns their number
+func spool(ctx context.Context, esClient elasticsearch.Client,
+	tenantID, data string, w io.Writer) (int, error) {
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	count := 0
+	err := esClient.ScanTenantData(ctx, tenantID, data,
+		func(doc *model.BackupDocument) error {
+			count++
+			return encoder.Encode(doc)
+		})
+	if err != nil {
+		return 0, err
+	}
+	return count, buf.Flush()
+}
+
+func writeFile(archive *tar.Writer, name string, size int64,
+	modTime time.Time, r io.Reader) error {
+	err := archive.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s", name)
+	}
+	if _, err := io.Copy(archive, r); err != nil {
+		return errors.Wrapf(err, "failed to write %s", name)
+	}
+	return nil
+}
+
+// Restore loads a backup archive written by Backup: it recreates the
+// tenant indices with the current templates and the settings of the tier
+// of the tenant, bulk loads the documents, and verifies the number of
+// documents of each tenant data against the manifest. Unless overwrite is
+// set, restoring a tenant which already has data fails with
+// ErrTenantHasData; otherwise, the existing data is deleted first.
+func Restore(ctx context.Context, app reporting.App, esClient elasticsearch.Client,
+	r io.Reader, overwrite bool) (*model.BackupManifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the archive")
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+
+	manifest, err := readManifest(archive)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareTenant(ctx, app, esClient, manifest, overwrite); err != nil {
+		return nil, err
+	}
+
+	restored := make(map[string]int, len(manifest.Documents))
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to read the archive")
+		}
+		data, ok := dataOfFile(header.Name)
+		if !ok {
+			return nil, errors.Errorf("unexpected file in the archive: %s", header.Name)
+		}
+		count, err := restoreData(ctx, esClient, manifest.TenantID, data, archive)
+		if err != nil {
+			return nil, err
+		}
+		restored[data] = count
+	}
+	return manifest, verify(ctx, esClient, manifest, restored)
+}
+
+func readManifest(archive *tar.Reader) (*model.BackupManifest, error) {
+	header, err := archive.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the archive")
+	} else if header.Name != model.BackupManifestFile {
+		return nil, errors.Errorf("expected %s as the first file of the archive, got %s",
+			model.BackupManifestFile, header.Name)
+	}
+	var manifest model.BackupManifest
+	if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the manifest")
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid manifest")
+	}
+	return &manifest, nil
+}
+
+// prepareTenant deletes the existing data of the tenant, if allowed, and
+// provisions it again with the tier of the backup
+func prepareTenant(ctx context.Context, app reporting.App, esClient elasticsearch.Client,
+	manifest *model.BackupManifest, overwrite bool) error {
+	for _, data := range model.TenantData {
+		count, err := esClient.CountTenantData(ctx, manifest.TenantID, data)
+		if err != nil {
+			return err
+		} else if count == 0 {
+			continue
+		} else if !overwrite {
+			return ErrTenantHasData
+		}
+		if err := esClient.DeleteTenantData(ctx, manifest.TenantID, data); err != nil {
+			return err
+		}
+	}
+	params := &model.ProvisionTenantParams{TenantID: manifest.TenantID}
+	if manifest.Tenant != nil {
+		params.Tier = manifest.Tenant.Tier
+	}
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	_, err := app.ProvisionTenant(ctx, params)
+	return err
+}
+
+func dataOfFile(name string) (string, bool) {
+	for _, data := range model.TenantData {
+		if model.BackupDataFile(data) == name {
+			return data, true
+		}
+	}
+	return "", false
+}
+
+// restoreData bulk loads the JSON lines of r, and returns the number of
+// documents restored
+func restoreData(ctx context.Context, esClient elasticsearch.Client,
+	tenantID, data string, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxDocumentSize)
+	batch := make([]*model.BackupDocument, 0, restoreBatchSize)
+	count, line := 0, 0
+	for scanner.Scan() {
+		line++
+		doc := &model.BackupDocument{}
+		if err := json.Unmarshal(scanner.Bytes(), doc); err != nil {
+			return count, errors.Wrapf(err, "%s, line %d",
+				model.BackupDataFile(data), line)
+		} else if doc.ID == "" || len(doc.Source) == 0 {
+			return count, errors.Errorf("%s, line %d: missing id or source",
+				model.BackupDataFile(data), line)
+		}
+		batch = append(batch, doc)
+		if len(batch) == restoreBatchSize {
+			if err := esClient.RestoreTenantData(ctx, tenantID, data, batch); err != nil {
+				return count, err
+			}
+			count += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return count, errors.Wrapf(err, "failed to read %s", model.BackupDataFile(data))
+	}
+	if err := esClient.RestoreTenantData(ctx, tenantID, data, batch); err != nil {
+		return count, err
+	}
+	return count + len(batch), nil
+}
+
+// verify compares the number of documents restored and indexed with the
+// manifest
+func verify(ctx context.Context, esClient elasticsearch.Client,
+	manifest *model.BackupManifest, restored map[string]int) error {
+	for _, data := range model.TenantData {
+		expected := manifest.Documents[data]
+		if restored[data] != expected {
+			return errors.Errorf("%s: %d documents in the archive, %d in the manifest",
+				data, restored[data], expected)
+		}
+		count, err := esClient.CountTenantData(ctx, manifest.TenantID, data)
+		if err != nil {
+			return err
+		} else if count != expected {
+			return errors.Errorf("%s: %d documents indexed, %d in the manifest",
+				data, count, expected)
+		}
+	}
+	return nil
+}
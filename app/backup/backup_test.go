@@ -0,0 +1,306 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	appMocks "github.com/mendersoftware/reporting/app/reporting/mocks"
+	esMocks "github.com/mendersoftware/reporting/client/elasticsearch/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// documents returns n documents of the tenant data
+func documents(data string, n int) []*model.BackupDocument {
+	docs := make([]*model.BackupDocument, n)
+	for i := range docs {
+		id := fmt.Sprintf("%s-%d", data, i)
+		docs[i] = &model.BackupDocument{
+			ID:     id,
+			Source: json.RawMessage(`{"id":"` + id + `"}`),
+		}
+	}
+	return docs
+}
+
+func writeArchive(t *testing.T, files map[string]string, order ...string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	archive := tar.NewWriter(gz)
+	for _, name := range order {
+		content := files[name]
+		err := archive.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: int64(len(content)),
+		})
+		assert.NoError(t, err)
+		_, err = archive.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, archive.Close())
+	assert.NoError(t, gz.Close())
+	return buf
+}
+
+func TestBackupRestore(t *testing.T) {
+	stored := map[string][]*model.BackupDocument{
+		model.TenantDataDevices:     documents(model.TenantDataDevices, 1200),
+		model.TenantDataHistory:     documents(model.TenantDataHistory, 3),
+		model.TenantDataDeployments: {},
+	}
+	tenant := &model.Tenant{
+		ID:     "tenant",
+		Status: model.TenantStatusActive,
+		Tier:   model.TierEnterprise,
+	}
+
+	ctx := context.Background()
+	source := &esMocks.Client{}
+	source.On("GetTenant", ctx, "tenant").Return(tenant, nil)
+	for data, docs := range stored {
+		docs := docs
+		source.On("ScanTenantData", ctx, "tenant", data, mock.Anything).
+			Return(func(_ context.Context, _, _ string,
+				send func(*model.BackupDocument) error) error {
+				for _, doc := range docs {
+					if err := send(doc); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+	}
+
+	archive := &bytes.Buffer{}
+	manifest, err := Backup(ctx, source, "tenant", archive)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		model.TenantDataDevices:     1200,
+		model.TenantDataHistory:     3,
+		model.TenantDataDeployments: 0,
+	}, manifest.Documents)
+	source.AssertExpectations(t)
+
+	restored := map[string][]*model.BackupDocument{}
+	target := &esMocks.Client{}
+	target.On("RestoreTenantData", ctx, "tenant", mock.AnythingOfType("string"),
+		mock.AnythingOfType("[]*model.BackupDocument")).
+		Return(func(_ context.Context, _, data string,
+			docs []*model.BackupDocument) error {
+			assert.LessOrEqual(t, len(docs), restoreBatchSize)
+			restored[data] = append(restored[data], docs...)
+			return nil
+		})
+	for _, data := range model.TenantData {
+		data := data
+		target.On("CountTenantData", ctx, "tenant", data).
+			Return(func(context.Context, string, string) int {
+				return len(restored[data])
+			}, nil)
+	}
+	app := &appMocks.App{}
+	app.On("ProvisionTenant", ctx, &model.ProvisionTenantParams{
+		TenantID: "tenant",
+		Tier:     model.TierEnterprise,
+	}).Return(tenant, nil)
+
+	restoredManifest, err := Restore(ctx, app, target, archive, false)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest.Documents, restoredManifest.Documents)
+	assert.Equal(t, tenant, restoredManifest.Tenant)
+	for data, docs := range stored {
+		assert.Equal(t, len(docs), len(restored[data]), data)
+		for i, doc := range restored[data] {
+			assert.Equal(t, docs[i].ID, doc.ID)
+			assert.JSONEq(t, string(docs[i].Source), string(doc.Source))
+		}
+	}
+	target.AssertExpectations(t)
+	app.AssertExpectations(t)
+}
+
+func TestBackupSuspended(t *testing.T) {
+	ctx := context.Background()
+	esClient := &esMocks.Client{}
+	esClient.On("GetTenant", ctx, "tenant").Return(&model.Tenant{
+		ID:     "tenant",
+		Status: model.TenantStatusSuspended,
+	}, nil)
+
+	_, err := Backup(ctx, esClient, "tenant", io.Discard)
+	assert.Equal(t, ErrTenantSuspended, err)
+	esClient.AssertExpectations(t)
+}
+
+func TestRestore(t *testing.T) {
+	manifest := func(documents map[string]int) string {
+		data, _ := json.Marshal(&model.BackupManifest{
+			Version:   model.BackupVersion,
+			TenantID:  "tenant",
+			Documents: documents,
+		})
+		return string(data)
+	}
+	devices := model.BackupDataFile(model.TenantDataDevices)
+	testCases := map[string]struct {
+		files     map[string]string
+		order     []string
+		existing  int
+		indexed   int
+		overwrite bool
+
+		provision bool
+		restored  int
+		err       error
+	}{
+		"ok, overwrite": {
+			files: map[string]string{
+				model.BackupManifestFile: manifest(map[string]int{
+					model.TenantDataDevices: 2,
+				}),
+				devices: `{"id": "1", "source": {}}` + "\n" +
+					`{"id": "2", "source": {}}` + "\n",
+			},
+			order:     []string{model.BackupManifestFile, devices},
+			existing:  5,
+			indexed:   2,
+			overwrite: true,
+			provision: true,
+			restored:  2,
+		},
+		"ko, existing data": {
+			files: map[string]string{
+				model.BackupManifestFile: manifest(map[string]int{}),
+			},
+			order:    []string{model.BackupManifestFile},
+			existing: 5,
+			err:      ErrTenantHasData,
+		},
+		"ko, manifest not first": {
+			files: map[string]string{
+				model.BackupManifestFile: manifest(map[string]int{}),
+				devices:                  "",
+			},
+			order: []string{devices, model.BackupManifestFile},
+			err: fmt.Errorf("expected manifest.json as the first file " +
+				"of the archive, got devices.ndjson"),
+		},
+		"ko, invalid manifest": {
+			files: map[string]string{
+				model.BackupManifestFile: `{"version": 2, "tenantID": "tenant"}`,
+			},
+			order: []string{model.BackupManifestFile},
+			err:   fmt.Errorf("invalid manifest: unsupported backup version: 2"),
+		},
+		"ko, missing documents": {
+			files: map[string]string{
+				model.BackupManifestFile: manifest(map[string]int{
+					model.TenantDataDevices: 3,
+				}),
+				devices: `{"id": "1", "source": {}}` + "\n" +
+					`{"id": "2", "source": {}}` + "\n",
+			},
+			order:     []string{model.BackupManifestFile, devices},
+			provision: true,
+			restored:  2,
+			err: fmt.Errorf("devices: 2 documents in the archive, " +
+				"3 in the manifest"),
+		},
+		"ko, documents not indexed": {
+			files: map[string]string{
+				model.BackupManifestFile: manifest(map[string]int{
+					model.TenantDataDevices: 2,
+				}),
+				devices: `{"id": "1", "source": {}}` + "\n" +
+					`{"id": "2", "source": {}}` + "\n",
+			},
+			order:     []string{model.BackupManifestFile, devices},
+			indexed:   1,
+			provision: true,
+			restored:  2,
+			err: fmt.Errorf("devices: 1 documents indexed, " +
+				"2 in the manifest"),
+		},
+		"ko, invalid document": {
+			files: map[string]string{
+				model.BackupManifestFile: manifest(map[string]int{
+					model.TenantDataDevices: 1,
+				}),
+				devices: `{"source": {}}` + "\n",
+			},
+			order:     []string{model.BackupManifestFile, devices},
+			provision: true,
+			err:       fmt.Errorf("devices.ndjson, line 1: missing id or source"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			esClient := &esMocks.Client{}
+			app := &appMocks.App{}
+
+			counted := false
+			esClient.On("CountTenantData", ctx, "tenant", mock.AnythingOfType("string")).
+				Return(func(_ context.Context, _, data string) int {
+					if data != model.TenantDataDevices {
+						return 0
+					} else if !counted {
+						counted = true
+						return tc.existing
+					}
+					return tc.indexed
+				}, nil)
+			if tc.overwrite {
+				esClient.On("DeleteTenantData", ctx, "tenant",
+					model.TenantDataDevices).Return(nil)
+			}
+			if tc.provision {
+				app.On("ProvisionTenant", ctx, &model.ProvisionTenantParams{
+					TenantID: "tenant",
+					Tier:     model.TierDefault,
+				}).Return(&model.Tenant{ID: "tenant"}, nil)
+			}
+			restored := 0
+			esClient.On("RestoreTenantData", ctx, "tenant", model.TenantDataDevices,
+				mock.AnythingOfType("[]*model.BackupDocument")).
+				Return(func(_ context.Context, _, _ string,
+					docs []*model.BackupDocument) error {
+					restored += len(docs)
+					return nil
+				}).Maybe()
+
+			_, err := Restore(ctx, app, esClient,
+				writeArchive(t, tc.files, tc.order...), tc.overwrite)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.restored, restored)
+			app.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mendersoftware/reporting/app/reporting"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// queryResults are the results of the queries of a type sent by a worker
+type queryResults struct {
+	latencies []time.Duration
+	errors    int
+	lastError error
+}
+
+// Run replays the mix of queries against the reporting app with concurrent
+// workers, until the end of the duration or after the number of requests
+// of the parameters, and reports the statistics of each query
+func Run(ctx context.Context, app reporting.App, mix *model.BenchMix,
+	params *model.BenchParams) (*model.BenchReport, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if params.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, params.Duration)
+		defer cancel()
+	}
+	seed := params.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	weights := make([]int, len(mix.Queries))
+	total := 0
+	for i, query := range mix.Queries {
+		total += query.Weight
+		weights[i] = total
+	}
+
+	// remaining is the number of requests left to send, if limited
+	remaining := int64(params.Requests)
+	results := make([][]queryResults, params.Workers)
+	startedAt := time.Now()
+	var wg sync.WaitGroup
+	for w := range results {
+		results[w] = make([]queryResults, len(mix.Queries))
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(w)))
+			for ctx.Err() == nil {
+				if params.Requests > 0 && atomic.AddInt64(&remaining, -1) < 0 {
+					return
+				}
+				pick := rng.Intn(total)
+				q := 0
+				for weights[q] <= pick {
+					q++
+				}
+				tenantID := mix.Tenants[rng.Intn(len(mix.Tenants))]
+				start := time.Now()
+				err := send(ctx, app, mix.Queries[q], tenantID)
+				latency := time.Since(start)
+				result := &results[w][q]
+				if err == nil {
+					result.latencies = append(result.latencies, latency)
+				} else if ctx.Err() == nil {
+					// the queries interrupted by the end of the run are
+					// not counted
+					result.errors++
+					result.lastError = err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(startedAt)
+
+	report := &model.BenchReport{
+		Workers:   params.Workers,
+		StartedAt: startedAt.UTC(),
+		Elapsed:   elapsed.Seconds(),
+		Queries:   make([]*model.BenchQueryStats, len(mix.Queries)),
+	}
+	var allLatencies []time.Duration
+	allErrors := 0
+	for q, query := range mix.Queries {
+		var latencies []time.Duration
+		errors := 0
+		var lastError error
+		for w := range results {
+			latencies = append(latencies, results[w][q].latencies...)
+			errors += results[w][q].errors
+			if results[w][q].lastError != nil {
+				lastError = results[w][q].lastError
+			}
+		}
+		stats := model.NewBenchQueryStats(query.Name, query.Type,
+			latencies, errors, elapsed)
+		if lastError != nil {
+			stats.LastError = lastError.Error()
+		}
+		report.Queries[q] = stats
+		allLatencies = append(allLatencies, latencies...)
+		allErrors += errors
+	}
+	report.Total = model.NewBenchQueryStats("total", "", allLatencies, allErrors, elapsed)
+	return report, nil
+}
+
+// send sends the query for the tenant
+func send(ctx context.Context, app reporting.App, query *model.BenchQuery,
+	tenantID string) error {
+	var err error
+	switch query.Type {
+	case model.BenchQuerySearch:
+		_, _, err = app.SearchDevices(ctx, query.SearchParams(tenantID))
+	case model.BenchQueryCount:
+		_, err = app.CountDevices(ctx, query.SearchParams(tenantID))
+	case model.BenchQueryAggregate:
+		_, _, err = app.Aggregate(ctx, query.AggregateParams(tenantID))
+	default:
+		err = fmt.Errorf("unknown query type %q", query.Type)
+	}
+	return err
+}
+
+// WriteText writes the report as a table, one query by row
+func WriteText(w io.Writer, report *model.BenchReport) error {
+	fmt.Fprintf(w, "%d workers, %.1fs\n\n", report.Workers, report.Elapsed)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "QUERY\tTYPE\tREQUESTS\tERRORS\tERROR RATE\tREQ/S\t"+
+		"MEAN (ms)\tP50\tP90\tP95\tP99\tMAX\t")
+	rows := make([]*model.BenchQueryStats, 0, len(report.Queries)+1)
+	rows = append(rows, report.Queries...)
+	for _, stats := range append(rows, report.Total) {
+		l := stats.Latency
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f%%\t%.1f\t"+
+			"%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			stats.Name, stats.Type, stats.Requests, stats.Errors,
+			stats.ErrorRate*100, stats.Throughput,
+			l.Mean, l.P50, l.P90, l.P95, l.P99, l.Max)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, stats := range report.Queries {
+		if stats.LastError == "" {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "%s: last error: %s\n", stats.Name, stats.LastError)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
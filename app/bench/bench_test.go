@@ -0,0 +1,148 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package bench
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/app/reporting/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestRun(t *testing.T) {
+	mix, err := model.ParseBenchMix([]byte(`{
+		"tenants": ["t1", "t2"],
+		"queries": [
+			{"name": "list", "type": "search", "weight": 3},
+			{"name": "count", "type": "count"},
+			{"name": "os", "type": "aggregate",
+			 "params": {"scope": "inventory", "attribute": "os"}}
+		]
+	}`))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	app := &mocks.App{}
+	app.On("SearchDevices", mock.Anything, mock.AnythingOfType("*model.SearchParams")).
+		Return([]*model.Device{}, 0, nil)
+	app.On("CountDevices", mock.Anything, mock.AnythingOfType("*model.SearchParams")).
+		Return(0, errors.New("search_phase_execution_exception"))
+	app.On("Aggregate", mock.Anything, mock.AnythingOfType("*model.AggregateParams")).
+		Return([]*model.AggregateBucket{}, 0, nil)
+
+	report, err := Run(ctx, app, mix, &model.BenchParams{
+		Workers:  4,
+		Requests: 1000,
+		Seed:     42,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.Workers)
+
+	tenants := map[string]int{}
+	requests := map[string]int{}
+	for _, stats := range report.Queries {
+		requests[stats.Name] = stats.Requests
+	}
+	assert.Equal(t, 1000, report.Total.Requests)
+	assert.InDelta(t, 600, requests["list"], 60)
+	assert.InDelta(t, 200, requests["count"], 50)
+	assert.InDelta(t, 200, requests["os"], 50)
+
+	count := report.Queries[1]
+	assert.Equal(t, count.Requests, count.Errors)
+	assert.Equal(t, 1.0, count.ErrorRate)
+	assert.Equal(t, "search_phase_execution_exception", count.LastError)
+	assert.Equal(t, count.Errors, report.Total.Errors)
+	assert.Zero(t, report.Queries[0].Errors)
+
+	for _, call := range app.Calls {
+		switch params := call.Arguments.Get(1).(type) {
+		case *model.SearchParams:
+			tenants[params.TenantID]++
+		case *model.AggregateParams:
+			tenants[params.TenantID]++
+		}
+	}
+	assert.Equal(t, 1000, tenants["t1"]+tenants["t2"])
+	assert.NotZero(t, tenants["t1"])
+	assert.NotZero(t, tenants["t2"])
+}
+
+func TestRunDuration(t *testing.T) {
+	mix := model.DefaultBenchMix()
+
+	app := &mocks.App{}
+	slow := func(args mock.Arguments) {
+		select {
+		case <-time.After(time.Millisecond):
+		case <-args.Get(0).(context.Context).Done():
+		}
+	}
+	app.On("SearchDevices", mock.Anything, mock.Anything).Run(slow).
+		Return([]*model.Device{}, 0, nil)
+	app.On("CountDevices", mock.Anything, mock.Anything).Run(slow).
+		Return(0, nil)
+	app.On("Aggregate", mock.Anything, mock.Anything).Run(slow).
+		Return([]*model.AggregateBucket{}, 0, nil)
+
+	report, err := Run(context.Background(), app, mix, &model.BenchParams{
+		Workers:  2,
+		Duration: 50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, report.Elapsed, 0.05)
+	assert.NotZero(t, report.Total.Requests)
+	assert.Zero(t, report.Total.Errors)
+	assert.Greater(t, report.Total.Latency.P50, 0.0)
+
+	_, err = Run(context.Background(), app, mix, &model.BenchParams{Workers: 1})
+	assert.EqualError(t, err, "either a duration or a number of requests is required")
+}
+
+func TestWriteText(t *testing.T) {
+	report := &model.BenchReport{
+		Workers: 4,
+		Elapsed: 10,
+		Queries: []*model.BenchQueryStats{
+			{
+				Name: "list", Type: model.BenchQuerySearch, Requests: 100,
+				Throughput: 10,
+				Latency:    model.BenchLatency{Mean: 12, P50: 10, P99: 40, Max: 50},
+			},
+			{
+				Name: "count", Type: model.BenchQueryCount, Requests: 10,
+				Errors: 1, ErrorRate: 0.1, Throughput: 1, LastError: "timeout",
+			},
+		},
+		Total: &model.BenchQueryStats{Name: "total", Requests: 110, Errors: 1},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, WriteText(&buf, report))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, "4 workers, 10.0s", lines[0])
+	assert.Contains(t, lines[2], "QUERY")
+	assert.Regexp(t, `list +search +100 +0 +0.00% +10.0 +12.0 +10.0`, lines[3])
+	assert.Regexp(t, `count +count +10 +1 +10.00%`, lines[4])
+	assert.Regexp(t, `total +110 +1`, lines[5])
+	assert.Equal(t, "count: last error: timeout", lines[6])
+}
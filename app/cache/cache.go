@@ -0,0 +1,194 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/client/elasticsearch"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// Metric names, used as keys of the cache metrics
+const (
+	MetricHits          = "hits"
+	MetricMisses        = "misses"
+	MetricInvalidations = "invalidations"
+	MetricErrors        = "errors"
+)
+
+var (
+	// ErrNotFound is returned by Get when the key is not cached
+	ErrNotFound = errors.New("not found")
+)
+
+var metrics = expvar.NewMap("aggregation_cache")
+
+// Cache stores the results of the aggregations per tenant
+type Cache interface {
+	// Get returns the value cached for the key, or ErrNotFound
+	Get(ctx context.Context, tenantID, key string) ([]byte, error)
+	// Set caches the value for the key
+	Set(ctx context.Context, tenantID, key string, value []byte) error
+	// Invalidate drops all the values cached for the tenant
+	Invalidate(ctx context.Context, tenantID string) error
+}
+
+// Key returns the cache key of a query: the digest of its JSON encoding,
+// where the keys of the objects are sorted
+func Key(query model.Query) (string, error) {
+	data, err := json.Marshal(query)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode the query")
+	}
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+type cachedAggregation struct {
+	Aggregations json.RawMessage `json:"aggregations"`
+	Total        int             `json:"total"`
+}
+
+type client struct {
+	elasticsearch.Client
+	cache Cache
+}
+
+// NewClient returns an Elasticsearch client caching the results of the
+// aggregations, and invalidating the results cached for a tenant when
+// devices of the tenant are indexed, or its indices are closed, opened or
+// deleted. Partial results are not cached, and cache failures are logged
+// and fall back to Elasticsearch.
+//
+// The results of the aggregations running while devices are indexed can be
+// cached after the invalidation, hence the cache entries must expire.
+func NewClient(esClient elasticsearch.Client, cache Cache) elasticsearch.Client {
+	return &client{
+		Client: esClient,
+		cache:  cache,
+	}
+}
+
+func (c *client) AggregateDevices(ctx context.Context, tenantID string,
+	query model.Query) (json.RawMessage, int, error) {
+	l := log.FromContext(ctx)
+	key, err := Key(query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err := c.cache.Get(ctx, tenantID, key)
+	if err == nil {
+		var cached cachedAggregation
+		if err = json.Unmarshal(data, &cached); err == nil {
+			metrics.Add(MetricHits, 1)
+			return cached.Aggregations, cached.Total, nil
+		}
+	}
+	if err != ErrNotFound {
+		metrics.Add(MetricErrors, 1)
+		l.Warnf("failed to read the aggregation cache: %s", err)
+	}
+	metrics.Add(MetricMisses, 1)
+
+	queryCtx, status := model.WithQueryStatus(ctx)
+	aggregations, total, err := c.Client.AggregateDevices(queryCtx, tenantID, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	model.QueryStatusFromContext(ctx).Merge(status)
+	if len(status.Partial()) > 0 {
+		return aggregations, total, nil
+	}
+
+	data, err = json.Marshal(cachedAggregation{
+		Aggregations: aggregations,
+		Total:        total,
+	})
+	if err == nil {
+		err = c.cache.Set(ctx, tenantID, key, data)
+	}
+	if err != nil {
+		metrics.Add(MetricErrors, 1)
+		l.Warnf("failed to update the aggregation cache: %s", err)
+	}
+	return aggregations, total, nil
+}
+
+func (c *client) IndexDevice(ctx context.Context, device *model.Device) error {
+	err := c.Client.IndexDevice(ctx, device)
+	c.invalidate(ctx, device.GetTenantID())
+	return err
+}
+
+func (c *client) BulkIndexDevices(ctx context.Context, devices []*model.Device) error {
+	err := c.Client.BulkIndexDevices(ctx, devices)
+	tenants := make(map[string]bool)
+	for _, device := range devices {
+		tenantID := device.GetTenantID()
+		if !tenants[tenantID] {
+			tenants[tenantID] = true
+			c.invalidate(ctx, tenantID)
+		}
+	}
+	return err
+}
+
+func (c *client) DeleteDevices(ctx context.Context, tenantID string,
+	deviceIDs []string) error {
+	err := c.Client.DeleteDevices(ctx, tenantID, deviceIDs)
+	c.invalidate(ctx, tenantID)
+	return err
+}
+
+func (c *client) CloseTenantIndices(ctx context.Context, tenantID string) error {
+	err := c.Client.CloseTenantIndices(ctx, tenantID)
+	c.invalidate(ctx, tenantID)
+	return err
+}
+
+func (c *client) OpenTenantIndices(ctx context.Context, tenantID string) error {
+	err := c.Client.OpenTenantIndices(ctx, tenantID)
+	c.invalidate(ctx, tenantID)
+	return err
+}
+
+func (c *client) DeleteTenantData(ctx context.Context, tenantID string, data string) error {
+	err := c.Client.DeleteTenantData(ctx, tenantID, data)
+	c.invalidate(ctx, tenantID)
+	return err
+}
+
+// invalidate drops the results cached for the tenant; it runs even if the
+// indexing failed, as some of the devices may have been indexed
+func (c *client) invalidate(ctx context.Context, tenantID string) {
+	if err := c.cache.Invalidate(ctx, tenantID); err != nil {
+		metrics.Add(MetricErrors, 1)
+		log.FromContext(ctx).Warnf(
+			"failed to invalidate the aggregation cache of tenant %q: %s",
+			tenantID, err)
+		return
+	}
+	metrics.Add(MetricInvalidations, 1)
+}
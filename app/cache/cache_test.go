@@ -0,0 +1,147 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/client/elasticsearch/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func metric(name string) int64 {
+	if v := metrics.Get(name); v != nil {
+		var value int64
+		_ = json.Unmarshal([]byte(v.String()), &value)
+		return value
+	}
+	return 0
+}
+
+func TestKey(t *testing.T) {
+	a, err := Key(model.Query{"size": 0, "query": model.Query{"term": "x"}})
+	assert.NoError(t, err)
+	b, err := Key(model.Query{"query": model.Query{"term": "x"}, "size": 0})
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+	c, err := Key(model.Query{"query": model.Query{"term": "y"}, "size": 0})
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, c)
+}
+
+func TestClientAggregateDevices(t *testing.T) {
+	ctx := context.Background()
+	query := model.Query{"size": 0}
+	aggregations := json.RawMessage(`{"values":{"buckets":[]}}`)
+
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	esClient.On("AggregateDevices", mock.Anything, "tenant", query).
+		Return(aggregations, 10, nil).Twice()
+
+	client := NewClient(esClient, NewLRU(10, time.Minute))
+
+	hits, misses := metric(MetricHits), metric(MetricMisses)
+	for i := 0; i < 2; i++ {
+		result, total, err := client.AggregateDevices(ctx, "tenant", query)
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(aggregations), string(result))
+		assert.Equal(t, 10, total)
+	}
+	assert.Equal(t, hits+1, metric(MetricHits))
+	assert.Equal(t, misses+1, metric(MetricMisses))
+
+	// indexing devices of another tenant keeps the cached results
+	esClient.On("IndexDevice", ctx, mock.AnythingOfType("*model.Device")).
+		Return(nil)
+	assert.NoError(t, client.IndexDevice(ctx,
+		model.NewDevice("1").SetTenantID("other")))
+	_, _, err := client.AggregateDevices(ctx, "tenant", query)
+	assert.NoError(t, err)
+
+	// indexing devices of the tenant drops the cached results
+	esClient.On("BulkIndexDevices", ctx, mock.AnythingOfType("[]*model.Device")).
+		Return(nil)
+	assert.NoError(t, client.BulkIndexDevices(ctx, []*model.Device{
+		model.NewDevice("1").SetTenantID("tenant"),
+		model.NewDevice("2").SetTenantID("tenant"),
+	}))
+	_, _, err = client.AggregateDevices(ctx, "tenant", query)
+	assert.NoError(t, err)
+}
+
+func TestClientAggregateDevicesPartial(t *testing.T) {
+	query := model.Query{"size": 0}
+
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	esClient.On("AggregateDevices", mock.Anything, "tenant", query).
+		Run(func(args mock.Arguments) {
+			ctx := args.Get(0).(context.Context)
+			model.QueryStatusFromContext(ctx).Record(true, 0)
+		}).
+		Return(json.RawMessage(`{}`), 10, nil).Twice()
+
+	client := NewClient(esClient, NewLRU(10, time.Minute))
+	for i := 0; i < 2; i++ {
+		ctx, status := model.WithQueryStatus(context.Background())
+		_, total, err := client.AggregateDevices(ctx, "tenant", query)
+		assert.NoError(t, err)
+		assert.Equal(t, 10, total)
+		assert.Equal(t, []string{model.PartialTimedOut}, status.Partial())
+	}
+}
+
+type failingCache struct{}
+
+func (failingCache) Get(context.Context, string, string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingCache) Set(context.Context, string, string, []byte) error {
+	return errors.New("connection refused")
+}
+
+func (failingCache) Invalidate(context.Context, string) error {
+	return errors.New("connection refused")
+}
+
+func TestClientCacheFailure(t *testing.T) {
+	ctx := context.Background()
+	query := model.Query{"size": 0}
+
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	esClient.On("AggregateDevices", mock.Anything, "tenant", query).
+		Return(json.RawMessage(`{}`), 10, nil)
+	esClient.On("IndexDevice", ctx, mock.AnythingOfType("*model.Device")).
+		Return(errors.New("index failed"))
+
+	client := NewClient(esClient, failingCache{})
+	errs := metric(MetricErrors)
+	_, total, err := client.AggregateDevices(ctx, "tenant", query)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, total)
+	assert.EqualError(t, client.IndexDevice(ctx,
+		model.NewDevice("1").SetTenantID("tenant")), "index failed")
+	assert.Equal(t, errs+3, metric(MetricErrors))
+}
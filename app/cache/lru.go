@@ -0,0 +1,134 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	tenantID string
+	key      string
+	value    []byte
+	expires  time.Time
+}
+
+// LRU is an in-process Cache holding a bounded number of entries, evicting
+// the least recently used ones; it is only invalidated by the writes of the
+// same process, the writes of the other processes are visible only once the
+// entries expire
+type LRU struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries *list.List
+	tenants map[string]map[string]*list.Element
+	now     func() time.Time
+}
+
+// NewLRU returns an in-process Cache holding at most size entries, which
+// expire after the TTL
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		entries: list.New(),
+		tenants: make(map[string]map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get returns the value cached for the key, or ErrNotFound
+func (c *LRU) Get(_ context.Context, tenantID, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.tenants[tenantID][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	entry := elem.Value.(*lruEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(elem)
+		return nil, ErrNotFound
+	}
+	c.entries.MoveToFront(elem)
+	return entry.value, nil
+}
+
+// Set caches the value for the key, evicting the least recently used entry
+// if the cache is full
+func (c *LRU) Set(_ context.Context, tenantID, key string, value []byte) error {
+	if c.size <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if elem, ok := c.tenants[tenantID][key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		c.entries.MoveToFront(elem)
+		return nil
+	}
+	for c.entries.Len() >= c.size {
+		c.remove(c.entries.Back())
+	}
+	elem := c.entries.PushFront(&lruEntry{
+		tenantID: tenantID,
+		key:      key,
+		value:    value,
+		expires:  expires,
+	})
+	keys, ok := c.tenants[tenantID]
+	if !ok {
+		keys = make(map[string]*list.Element)
+		c.tenants[tenantID] = keys
+	}
+	keys[key] = elem
+	return nil
+}
+
+// Invalidate drops all the values cached for the tenant
+func (c *LRU) Invalidate(_ context.Context, tenantID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, elem := range c.tenants[tenantID] {
+		c.entries.Remove(elem)
+	}
+	delete(c.tenants, tenantID)
+	return nil
+}
+
+// Len returns the number of cached entries, including the expired ones not
+// evicted yet
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
+
+func (c *LRU) remove(elem *list.Element) {
+	entry := c.entries.Remove(elem).(*lruEntry)
+	keys := c.tenants[entry.tenantID]
+	delete(keys, entry.key)
+	if len(keys) == 0 {
+		delete(c.tenants, entry.tenantID)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := NewLRU(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	_, err := cache.Get(ctx, "tenant", "a")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NoError(t, cache.Set(ctx, "tenant", "a", []byte("1")))
+	assert.NoError(t, cache.Set(ctx, "other", "a", []byte("2")))
+	value, err := cache.Get(ctx, "tenant", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+	value, err = cache.Get(ctx, "other", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+
+	// evicts the least recently used entry
+	_, _ = cache.Get(ctx, "tenant", "a")
+	assert.NoError(t, cache.Set(ctx, "tenant", "b", []byte("3")))
+	assert.Equal(t, 2, cache.Len())
+	_, err = cache.Get(ctx, "other", "a")
+	assert.Equal(t, ErrNotFound, err)
+
+	// invalidates the entries of the tenant only
+	assert.NoError(t, cache.Set(ctx, "other", "a", []byte("2")))
+	assert.NoError(t, cache.Invalidate(ctx, "tenant"))
+	assert.Equal(t, 1, cache.Len())
+	_, err = cache.Get(ctx, "tenant", "b")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = cache.Get(ctx, "other", "a")
+	assert.NoError(t, err)
+
+	// expires the entries after the TTL
+	now = now.Add(time.Minute)
+	_, err = cache.Get(ctx, "other", "a")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestLRUDisabled(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRU(0, time.Minute)
+	assert.NoError(t, cache.Set(ctx, "tenant", "a", []byte("1")))
+	_, err := cache.Get(ctx, "tenant", "a")
+	assert.Equal(t, ErrNotFound, err)
+}
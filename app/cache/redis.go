@@ -0,0 +1,99 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+const redisKeyPrefix = "reporting:aggregations:"
+
+// Redis is a Cache shared by the service instances, stored in Redis.
+//
+// The keys of the entries include a generation number per tenant, which
+// the invalidation increments: the entries of the previous generations are
+// never read again, and expire after the TTL.
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedis returns a Cache stored in Redis, whose entries expire after the
+// TTL
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// NewRedisFromURL returns a Cache stored in the Redis server at the URL,
+// like "redis://localhost:6379/0"
+func NewRedisFromURL(url string, ttl time.Duration) (*Redis, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid Redis URL")
+	}
+	return NewRedis(redis.NewClient(options), ttl), nil
+}
+
+func generationKey(tenantID string) string {
+	return redisKeyPrefix + tenantID + ":generation"
+}
+
+func (c *Redis) entryKey(ctx context.Context, tenantID, key string) (string, error) {
+	generation, err := c.client.Get(ctx, generationKey(tenantID)).Int64()
+	if err != nil && err != redis.Nil {
+		return "", errors.Wrap(err, "failed to get the cache generation")
+	}
+	return redisKeyPrefix + tenantID + ":" +
+		strconv.FormatInt(generation, 10) + ":" + key, nil
+}
+
+// Get returns the value cached for the key, or ErrNotFound
+func (c *Redis) Get(ctx context.Context, tenantID, key string) ([]byte, error) {
+	entryKey, err := c.entryKey(ctx, tenantID, key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := c.client.Get(ctx, entryKey).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to get the cache entry")
+	}
+	return value, nil
+}
+
+// Set caches the value for the key
+func (c *Redis) Set(ctx context.Context, tenantID, key string, value []byte) error {
+	entryKey, err := c.entryKey(ctx, tenantID, key)
+	if err != nil {
+		return err
+	}
+	err = c.client.Set(ctx, entryKey, value, c.ttl).Err()
+	return errors.Wrap(err, "failed to set the cache entry")
+}
+
+// Invalidate drops all the values cached for the tenant
+func (c *Redis) Invalidate(ctx context.Context, tenantID string) error {
+	err := c.client.Incr(ctx, generationKey(tenantID)).Err()
+	return errors.Wrap(err, "failed to increment the cache generation")
+}
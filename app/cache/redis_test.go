@@ -0,0 +1,67 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	server, err := miniredis.Run()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer server.Close()
+	cache, err := NewRedisFromURL("redis://"+server.Addr()+"/0", time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = cache.Get(ctx, "tenant", "a")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NoError(t, cache.Set(ctx, "tenant", "a", []byte("1")))
+	assert.NoError(t, cache.Set(ctx, "other", "a", []byte("2")))
+	value, err := cache.Get(ctx, "tenant", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	assert.NoError(t, cache.Invalidate(ctx, "tenant"))
+	_, err = cache.Get(ctx, "tenant", "a")
+	assert.Equal(t, ErrNotFound, err)
+	value, err = cache.Get(ctx, "other", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+
+	server.FastForward(time.Minute)
+	_, err = cache.Get(ctx, "other", "a")
+	assert.Equal(t, ErrNotFound, err)
+
+	server.Close()
+	_, err = cache.Get(ctx, "other", "a")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrNotFound, err)
+}
+
+func TestNewRedisFromURL(t *testing.T) {
+	_, err := NewRedisFromURL("http://localhost", time.Minute)
+	assert.Error(t, err)
+}
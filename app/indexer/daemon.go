@@ -0,0 +1,234 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"golang.org/x/sys/unix"
+
+	"github.com/mendersoftware/reporting/client/elasticsearch"
+	dconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// leaseKeeper acquires and renews the lease of the indexer in Elasticsearch
+type leaseKeeper struct {
+	esClient elasticsearch.Client
+	holder   string
+	duration time.Duration
+}
+
+func newLeaseKeeper(conf config.Reader, esClient elasticsearch.Client) *leaseKeeper {
+	duration := conf.GetDuration(dconfig.SettingIndexerLeaseDuration)
+	if duration <= 0 {
+		duration, _ = time.ParseDuration(dconfig.SettingIndexerLeaseDurationDefault)
+	}
+	hostname, _ := os.Hostname()
+	return &leaseKeeper{
+		esClient: esClient,
+		holder:   fmt.Sprintf("%s-%s", hostname, uuid.New().String()),
+		duration: duration,
+	}
+}
+
+func (k *leaseKeeper) acquire(ctx context.Context) (bool, error) {
+	return k.esClient.AcquireLease(ctx, model.LeaseIndexer, k.holder, k.duration)
+}
+
+func (k *leaseKeeper) release(ctx context.Context) {
+	if err := k.esClient.ReleaseLease(ctx, model.LeaseIndexer, k.holder); err != nil {
+		log.FromContext(ctx).Errorf("failed to release the lease: %s", err)
+	}
+}
+
+// check renews the lease, returning ErrLeaseLost if another holder took
+// it over
+func (k *leaseKeeper) check(ctx context.Context) error {
+	acquired, err := k.acquire(ctx)
+	if err != nil {
+		return err
+	} else if !acquired {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// keep renews the lease every third of its duration until the context is
+// done; the returned channel is closed if the lease is lost, either taken
+// by another holder or not renewed for two thirds of its duration, to stop
+// before another holder can take it over
+func (k *leaseKeeper) keep(ctx context.Context) <-chan struct{} {
+	l := log.FromContext(ctx)
+	lost := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(k.duration / 3)
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			acquired, err := k.acquire(ctx)
+			if err != nil {
+				l.Warnf("failed to renew the lease: %s", err)
+			} else if acquired {
+				renewed = time.Now()
+				continue
+			}
+			if err == nil || time.Since(renewed) >= 2*k.duration/3 {
+				l.Warn("lost the lease")
+				close(lost)
+				return
+			}
+		}
+	}()
+	return lost
+}
+
+// withLease returns a context cancelled when the lease is lost, so that
+// the requests in flight stop as soon as another holder may take over
+func withLease(ctx context.Context, lost <-chan struct{}) (context.Context,
+	context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-lost:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// RunDaemon runs the indexer as a daemon: the replica holding the lease
+// runs a sync cycle every interval, the others wait to take the lease
+// over; SIGINT and SIGTERM stop the running cycle after the batch being
+// indexed, and release the lease; the resume mode applies to the first
+// cycle led by the replica, and the devices are generated from the fleet
+// profile, or the default one if nil
+func RunDaemon(conf config.Reader, esClient elasticsearch.Client,
+	clients *Clients, devices int64, profile *model.FleetProfile, mode ResumeMode) error {
+	ctx := context.Background()
+	l := log.FromContext(ctx)
+
+	quitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, unix.SIGINT, unix.SIGTERM)
+	defer signal.Stop(quit)
+	go func() {
+		select {
+		case <-quit:
+			l.Info("Shutdown Indexer ...")
+			cancel()
+		case <-quitCtx.Done():
+		}
+	}()
+
+	i := newIndexer(conf, esClient, clients)
+	if profile != nil {
+		i.profile = profile
+	}
+	lease := newLeaseKeeper(conf, esClient)
+	interval := conf.GetDuration(dconfig.SettingIndexerSyncInterval)
+	if interval <= 0 {
+		interval, _ = time.ParseDuration(dconfig.SettingIndexerSyncIntervalDefault)
+	}
+	i.daemon(ctx, quitCtx.Done(), lease, interval, devices, mode)
+	lease.release(ctx)
+	return nil
+}
+
+// daemon leads the sync cycles whenever it acquires the lease, until quit
+// is closed
+func (i *indexer) daemon(ctx context.Context, quit <-chan struct{}, lease *leaseKeeper,
+	interval time.Duration, devices int64, mode ResumeMode) {
+	l := log.FromContext(ctx)
+	for {
+		acquired, err := lease.acquire(ctx)
+		if err != nil {
+			l.Errorf("failed to acquire the lease: %s", err)
+		} else if acquired {
+			l.Infof("acquired the lease as %s", lease.holder)
+			i.lead(ctx, quit, lease, interval, devices, mode)
+			// the cycle interrupted by the previous leader, or by a
+			// lost lease, is resumed by the next leader
+			mode = ResumeCheckpoint
+		}
+		select {
+		case <-quit:
+			return
+		case <-time.After(lease.duration / 3):
+		}
+	}
+}
+
+// lead runs a sync cycle every interval while holding the lease, until
+// quit is closed or the lease is lost; quitting lets the running cycle
+// index the batch in flight, losing the lease interrupts it at once
+func (i *indexer) lead(ctx context.Context, quit <-chan struct{}, lease *leaseKeeper,
+	interval time.Duration, devices int64, mode ResumeMode) {
+	l := log.FromContext(ctx)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := lease.keep(leadCtx)
+	runCtx, cancelRun := withLease(leadCtx, lost)
+	defer cancelRun()
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-quit:
+		case <-lost:
+		case <-leadCtx.Done():
+			return
+		}
+		close(stop)
+	}()
+
+	for {
+		finished, err := i.run(runCtx, stop, lease, devices, mode)
+		if err == ErrProfileMismatch {
+			// the profile changed since the interrupted cycle, e.g. on
+			// upgrade: resuming it would index another fleet
+			l.Warnf("%s: starting a new sync cycle", err)
+			finished, err = i.run(runCtx, stop, lease, devices, ResumeFromScratch)
+		}
+		if err != nil && runCtx.Err() != nil {
+			l.Warnf("sync cycle interrupted: %s", ErrLeaseLost)
+		} else if err != nil {
+			l.Errorf("sync cycle failed: %s", err)
+		} else if finished {
+			l.Info("sync cycle finished")
+		}
+		// after a failure, the next cycle resumes from the checkpoint
+		mode = ResumeCheckpoint
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
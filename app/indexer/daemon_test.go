@@ -0,0 +1,309 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	esmocks "github.com/mendersoftware/reporting/client/elasticsearch/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+const testLeaseDuration = 30 * time.Millisecond
+
+func TestLeaseKeeperKeep(t *testing.T) {
+	testCases := map[string]struct {
+		acquired bool
+		err      error
+
+		lost bool
+	}{
+		"renewed": {
+			acquired: true,
+		},
+		"taken by another holder": {
+			lost: true,
+		},
+		"not renewed": {
+			err:  errors.New("connection refused"),
+			lost: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			esClient := &esmocks.Client{}
+			esClient.On("AcquireLease", mock.Anything, model.LeaseIndexer, "replica",
+				testLeaseDuration).Return(tc.acquired, tc.err)
+			lease := &leaseKeeper{
+				esClient: esClient,
+				holder:   "replica",
+				duration: testLeaseDuration,
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			lost := lease.keep(ctx)
+			select {
+			case <-lost:
+				assert.True(t, tc.lost, "lease lost")
+			case <-time.After(5 * testLeaseDuration):
+				assert.False(t, tc.lost, "lease kept")
+			}
+		})
+	}
+}
+
+func TestRunStop(t *testing.T) {
+	ctx := context.Background()
+	esClient := &esmocks.Client{}
+	defer esClient.AssertExpectations(t)
+	esClient.On("GetCheckpoint", ctx, model.CheckpointIndexer).Return(nil, nil)
+	esClient.On("GetDevices", ctx, mock.AnythingOfType("string"),
+		mock.AnythingOfType("[]string")).Return([]*model.Device{}, nil)
+	esClient.On("BulkIndexHistory", ctx,
+		mock.AnythingOfType("[]*model.AttributeChange")).Return(nil)
+	esClient.On("BulkIndexDevices", ctx, mock.AnythingOfType("[]*model.Device")).
+		Return(nil).Once()
+	var last *model.Checkpoint
+	esClient.On("SaveCheckpoint", ctx, mock.AnythingOfType("*model.Checkpoint")).
+		Run(func(args mock.Arguments) {
+			last = args.Get(1).(*model.Checkpoint)
+		}).
+		Return(nil)
+
+	// the batch being indexed when stopped is indexed and saved
+	stop := make(chan struct{})
+	close(stop)
+	i := newIndexer(config.Config, esClient, &Clients{})
+	finished, err := i.run(ctx, stop, nil, 450, ResumeNone)
+	assert.NoError(t, err)
+	assert.False(t, finished)
+	if assert.NotNil(t, last) {
+		assert.Equal(t, int64(batchSize), last.Indexed)
+		assert.False(t, last.Finished())
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	ctx := context.Background()
+	esClient := &esmocks.Client{}
+
+	var mu sync.Mutex
+	attempts := 0
+	cycles := 0
+	quit := make(chan struct{})
+	// another replica holds the lease for the first attempt
+	esClient.On("AcquireLease", mock.Anything, model.LeaseIndexer, "replica",
+		testLeaseDuration).
+		Return(func(context.Context, string, string, time.Duration) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			return attempts > 1
+		}, nil)
+	esClient.On("GetCheckpoint", mock.Anything, model.CheckpointIndexer).
+		Return(nil, nil)
+	esClient.On("GetDevices", mock.Anything, mock.AnythingOfType("string"),
+		mock.AnythingOfType("[]string")).Return([]*model.Device{}, nil)
+	esClient.On("BulkIndexHistory", mock.Anything,
+		mock.AnythingOfType("[]*model.AttributeChange")).Return(nil)
+	esClient.On("BulkIndexDevices", mock.Anything, mock.AnythingOfType("[]*model.Device")).
+		Return(nil)
+	esClient.On("SaveCheckpoint", mock.Anything, mock.AnythingOfType("*model.Checkpoint")).
+		Run(func(args mock.Arguments) {
+			mu.Lock()
+			defer mu.Unlock()
+			if args.Get(1).(*model.Checkpoint).Finished() {
+				cycles++
+				if cycles == 2 {
+					close(quit)
+				}
+			}
+		}).
+		Return(nil)
+
+	lease := &leaseKeeper{
+		esClient: esClient,
+		holder:   "replica",
+		duration: testLeaseDuration,
+	}
+	i := newIndexer(config.Config, esClient, &Clients{})
+	done := make(chan struct{})
+	go func() {
+		i.daemon(ctx, quit, lease, 10*time.Millisecond, 10, ResumeNone)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the daemon did not stop")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.GreaterOrEqual(t, cycles, 2)
+	assert.GreaterOrEqual(t, attempts, 2)
+}
+
+func TestRunLeaseTakenOver(t *testing.T) {
+	ctx := context.Background()
+	esClient := &esmocks.Client{}
+	defer esClient.AssertExpectations(t)
+	esClient.On("GetCheckpoint", ctx, model.CheckpointIndexer).Return(nil, nil)
+	esClient.On("GetDevices", ctx, mock.AnythingOfType("string"),
+		mock.AnythingOfType("[]string")).Return([]*model.Device{}, nil)
+	esClient.On("BulkIndexHistory", ctx,
+		mock.AnythingOfType("[]*model.AttributeChange")).Return(nil)
+	esClient.On("BulkIndexDevices", ctx, mock.AnythingOfType("[]*model.Device")).
+		Return(nil).Once()
+	// the checkpoint of the new run only
+	esClient.On("SaveCheckpoint", ctx, mock.AnythingOfType("*model.Checkpoint")).
+		Return(nil).Once()
+	// another replica took the lease over
+	esClient.On("AcquireLease", ctx, model.LeaseIndexer, "replica",
+		testLeaseDuration).Return(false, nil).Once()
+
+	lease := &leaseKeeper{
+		esClient: esClient,
+		holder:   "replica",
+		duration: testLeaseDuration,
+	}
+	i := newIndexer(config.Config, esClient, &Clients{})
+	finished, err := i.run(ctx, make(chan struct{}), lease, 450, ResumeNone)
+	assert.Equal(t, ErrLeaseLost, err)
+	assert.False(t, finished)
+}
+
+func TestLeadLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	esClient := &esmocks.Client{}
+
+	lost := make(chan struct{})
+	// the lease is taken over at the first renewal
+	esClient.On("AcquireLease", mock.Anything, model.LeaseIndexer, "replica",
+		testLeaseDuration).Return(false, nil)
+	esClient.On("GetCheckpoint", mock.Anything, model.CheckpointIndexer).
+		Return(nil, nil)
+	esClient.On("SaveCheckpoint", mock.Anything,
+		mock.AnythingOfType("*model.Checkpoint")).Return(nil)
+	esClient.On("GetDevices", mock.Anything, mock.AnythingOfType("string"),
+		mock.AnythingOfType("[]string")).Return([]*model.Device{}, nil)
+	esClient.On("BulkIndexHistory", mock.Anything,
+		mock.AnythingOfType("[]*model.AttributeChange")).Return(nil)
+	// the request in flight is cancelled when the lease is lost
+	esClient.On("BulkIndexDevices", mock.Anything,
+		mock.AnythingOfType("[]*model.Device")).
+		Return(func(ctx context.Context, _ []*model.Device) error {
+			<-ctx.Done()
+			close(lost)
+			return ctx.Err()
+		}).Once()
+
+	lease := &leaseKeeper{
+		esClient: esClient,
+		holder:   "replica",
+		duration: testLeaseDuration,
+	}
+	i := newIndexer(config.Config, esClient, &Clients{})
+	done := make(chan struct{})
+	go func() {
+		i.lead(ctx, make(chan struct{}), lease, time.Hour, 450, ResumeNone)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the leader did not stop")
+	}
+	select {
+	case <-lost:
+	default:
+		t.Fatal("the request in flight was not cancelled")
+	}
+	esClient.AssertNumberOfCalls(t, "SaveCheckpoint", 1)
+}
+
+func TestLeadProfileMismatch(t *testing.T) {
+	ctx := context.Background()
+	esClient := &esmocks.Client{}
+
+	quit := make(chan struct{})
+	esClient.On("AcquireLease", mock.Anything, model.LeaseIndexer, "replica",
+		testLeaseDuration).Return(true, nil)
+	// the cycle interrupted with another profile
+	esClient.On("GetCheckpoint", mock.Anything, model.CheckpointIndexer).
+		Return(&model.Checkpoint{
+			ID:      model.CheckpointIndexer,
+			Devices: 500,
+			Indexed: 400,
+			Seed:    42,
+			Profile: "other",
+		}, nil)
+	esClient.On("GetDevices", mock.Anything, mock.AnythingOfType("string"),
+		mock.AnythingOfType("[]string")).Return([]*model.Device{}, nil)
+	esClient.On("BulkIndexHistory", mock.Anything,
+		mock.AnythingOfType("[]*model.AttributeChange")).Return(nil)
+	esClient.On("BulkIndexDevices", mock.Anything, mock.AnythingOfType("[]*model.Device")).
+		Return(nil)
+	var mu sync.Mutex
+	var last *model.Checkpoint
+	finished := false
+	esClient.On("SaveCheckpoint", mock.Anything, mock.AnythingOfType("*model.Checkpoint")).
+		Run(func(args mock.Arguments) {
+			mu.Lock()
+			defer mu.Unlock()
+			if last == nil {
+				last = args.Get(1).(*model.Checkpoint)
+			}
+			if last.Finished() && !finished {
+				finished = true
+				close(quit)
+			}
+		}).
+		Return(nil)
+
+	lease := &leaseKeeper{
+		esClient: esClient,
+		holder:   "replica",
+		duration: testLeaseDuration,
+	}
+	i := newIndexer(config.Config, esClient, &Clients{})
+	done := make(chan struct{})
+	go func() {
+		i.lead(ctx, quit, lease, time.Hour, 10, ResumeCheckpoint)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the leader did not stop")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.NotNil(t, last) {
+		assert.True(t, last.Finished())
+		assert.Equal(t, int64(10), last.Indexed)
+		assert.NotEqual(t, "other", last.Profile)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/reporting/client/elasticsearch"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// importProgressInterval is the interval between the logs of the progress
+// of an import
+const importProgressInterval = 5 * time.Second
+
+// Import indexes the devices read from a file through the indexing path of
+// the indexer, in batches, setting the tenant of the devices without one;
+// the malformed and invalid records, and the devices rejected by
+// Elasticsearch, are passed to onError and skipped
+func Import(ctx context.Context, conf config.Reader, esClient elasticsearch.Client,
+	clients *Clients, reader model.ImportReader, tenantID string,
+	onError func(*model.ImportError) error) (*model.ImportStats, error) {
+	l := log.FromContext(ctx)
+	i := newIndexer(conf, esClient, clients)
+
+	stats := &model.ImportStats{}
+	lastProgress := time.Now()
+	devices := make([]*model.Device, 0, batchSize)
+	lines := make([]int, 0, batchSize)
+	indexBatch := func() error {
+		batchCtx, rejections := model.WithRejections(ctx)
+		if err := i.indexDevices(batchCtx, devices); err != nil {
+			return err
+		}
+		for n, device := range devices {
+			reason, rejected := rejections.Reason(device.GetTenantID(), device.GetID())
+			if !rejected {
+				stats.Imported++
+				continue
+			}
+			stats.Failed++
+			err := onError(&model.ImportError{
+				Line:     lines[n],
+				DeviceID: device.GetID(),
+				Reason:   reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		devices = devices[:0]
+		lines = lines[:0]
+		if time.Since(lastProgress) >= importProgressInterval {
+			l.Infof("%d records read, %d devices imported, %d records failed",
+				stats.Records, stats.Imported, stats.Failed)
+			lastProgress = time.Now()
+		}
+		return nil
+	}
+
+	for {
+		device, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var importErr *model.ImportError
+		if err == nil {
+			stats.Records++
+			if device.TenantID == nil && tenantID != "" {
+				device.SetTenantID(tenantID)
+			}
+			if err := model.ValidateImportedDevice(device); err != nil {
+				importErr = &model.ImportError{
+					Line:     reader.Line(),
+					DeviceID: device.GetID(),
+					Reason:   err.Error(),
+				}
+			}
+		} else if recordErr, ok := err.(*model.ImportError); ok {
+			stats.Records++
+			importErr = recordErr
+		} else {
+			return stats, err
+		}
+		if importErr != nil {
+			stats.Failed++
+			if err := onError(importErr); err != nil {
+				return stats, err
+			}
+			continue
+		}
+
+		devices = append(devices, device)
+		lines = append(lines, reader.Line())
+		if len(devices) == batchSize {
+			if err := indexBatch(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if len(devices) > 0 {
+		if err := indexBatch(); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	esmocks "github.com/mendersoftware/reporting/client/elasticsearch/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestImport(t *testing.T) {
+	lines := []string{}
+	for n := 0; n < batchSize+10; n++ {
+		lines = append(lines, fmt.Sprintf(`{"id": "%d"}`, n))
+	}
+	lines = append(lines,
+		`{"id": "other", "tenantID": "other"}`,
+		`{"id": "bad", "tenantID": "Bad Tenant"}`,
+		`{"id": "malformed"`,
+	)
+	input := strings.Join(lines, "\n")
+
+	testCases := map[string]struct {
+		rejected map[string]string
+		indexErr error
+
+		stats   *model.ImportStats
+		reasons []string
+		lines   []int
+		err     string
+	}{
+		"ok": {
+			stats: &model.ImportStats{
+				Records:  batchSize + 13,
+				Imported: batchSize + 11,
+				Failed:   2,
+			},
+			reasons: []string{
+				"invalid tenant: tenant_id: must be at most 128 lowercase " +
+					"alphanumeric characters, dashes or underscores",
+				"unexpected EOF",
+			},
+		},
+		"ok, rejected devices": {
+			rejected: map[string]string{
+				"7":     "failed to parse field [inventoryAttributes]",
+				"other": "mapper_parsing_exception",
+			},
+			stats: &model.ImportStats{
+				Records:  batchSize + 13,
+				Imported: batchSize + 9,
+				Failed:   4,
+			},
+			reasons: []string{
+				"failed to parse field [inventoryAttributes]",
+				"invalid tenant: tenant_id: must be at most 128 lowercase " +
+					"alphanumeric characters, dashes or underscores",
+				"unexpected EOF",
+				"mapper_parsing_exception",
+			},
+			lines: []int{8, batchSize + 12, batchSize + 13, batchSize + 11},
+		},
+		"ko, indexing failure": {
+			indexErr: errors.New("failed to bulk index: 503 Service Unavailable"),
+			stats:    &model.ImportStats{Records: batchSize},
+			reasons:  []string{},
+			err:      "failed to bulk index: 503 Service Unavailable",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			esClient := &esmocks.Client{}
+			defer esClient.AssertExpectations(t)
+
+			tenants := map[string]int{}
+			esClient.On("GetDevices", mock.Anything, mock.AnythingOfType("string"),
+				mock.AnythingOfType("[]string")).Return([]*model.Device{}, nil)
+			esClient.On("BulkIndexHistory", mock.Anything,
+				mock.AnythingOfType("[]*model.AttributeChange")).Return(nil)
+			esClient.On("BulkIndexDevices", mock.Anything,
+				mock.AnythingOfType("[]*model.Device")).
+				Run(func(args mock.Arguments) {
+					rejections := model.RejectionsFromContext(args.Get(0).(context.Context))
+					for _, device := range args.Get(1).([]*model.Device) {
+						tenants[device.GetTenantID()]++
+						if reason, ok := tc.rejected[device.GetID()]; ok {
+							rejections.Record(device.GetTenantID(), device.GetID(), reason)
+						}
+					}
+				}).
+				Return(tc.indexErr)
+
+			reasons := []string{}
+			lines := []int{}
+			stats, err := Import(ctx, config.Config, esClient, &Clients{},
+				model.NewNDJSONReader(strings.NewReader(input)), "tenant",
+				func(importErr *model.ImportError) error {
+					reasons = append(reasons, importErr.Reason)
+					lines = append(lines, importErr.Line)
+					return nil
+				})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, map[string]int{
+					"tenant": batchSize + 10,
+					"other":  1,
+				}, tenants)
+			}
+			assert.Equal(t, tc.stats, stats)
+			assert.Equal(t, tc.reasons, reasons)
+			if tc.lines != nil {
+				assert.Equal(t, tc.lines, lines)
+			}
+		})
+	}
+}
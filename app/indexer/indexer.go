@@ -16,36 +16,340 @@ package indexer
 
 import (
 	"context"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/client/deployments"
+	"github.com/mendersoftware/reporting/client/deviceauth"
+	"github.com/mendersoftware/reporting/client/deviceconnect"
 	"github.com/mendersoftware/reporting/client/elasticsearch"
+	"github.com/mendersoftware/reporting/client/inventory"
+	dconfig "github.com/mendersoftware/reporting/config"
 	"github.com/mendersoftware/reporting/model"
 )
 
 const batchSize = 200
 
-// InitAndRun initializes the indexer and runs it
-func InitAndRun(conf config.Reader, esClient elasticsearch.Client, devices int64) error {
+// Clients holds the clients of the services the indexer ingests data from;
+// a nil client disables the ingestion from the corresponding service
+type Clients struct {
+	Deployments   deployments.Client
+	DeviceAuth    deviceauth.Client
+	DeviceConnect deviceconnect.Client
+	Inventory     inventory.Client
+}
+
+type indexer struct {
+	esClient          elasticsearch.Client
+	clients           *Clients
+	geoAttributes     model.GeoAttributes
+	versionAttributes model.VersionAttributes
+	historyRetention  time.Duration
+	profile           *model.FleetProfile
+}
+
+func newIndexer(conf config.Reader, esClient elasticsearch.Client,
+	clients *Clients) *indexer {
+	return &indexer{
+		esClient: esClient,
+		clients:  clients,
+		geoAttributes: model.GeoAttributes{
+			Latitude:  conf.GetString(dconfig.SettingGeoLatitudeAttribute),
+			Longitude: conf.GetString(dconfig.SettingGeoLongitudeAttribute),
+		},
+		versionAttributes: model.NewVersionAttributes(
+			dconfig.StringList(conf, dconfig.SettingVersionAttributes)),
+		historyRetention: conf.GetDuration(dconfig.SettingHistoryRetention),
+		profile:          model.DefaultFleetProfile(),
+	}
+}
+
+// ResumeMode selects how the indexer handles a run which was interrupted
+type ResumeMode int
+
+const (
+	// ResumeNone fails if the previous run was interrupted
+	ResumeNone ResumeMode = iota
+	// ResumeCheckpoint resumes the interrupted run from its checkpoint
+	ResumeCheckpoint
+	// ResumeFromScratch discards the checkpoint of the interrupted run
+	ResumeFromScratch
+)
+
+// ErrRunInterrupted is returned when the previous run of the indexer was
+// interrupted, and neither resumed nor restarted from scratch
+var ErrRunInterrupted = errors.New("the previous run of the indexer was interrupted")
+
+// ErrProfileMismatch is returned when resuming a run with a fleet profile
+// other than the one of the interrupted run, which would index another fleet
+var ErrProfileMismatch = errors.New("the fleet profile differs from the one " +
+	"of the interrupted run")
+
+// ErrLeaseHeld is returned when another indexer holds the lease
+var ErrLeaseHeld = errors.New("another indexer is running")
+
+// ErrLeaseLost is returned when the indexer loses its lease while running
+var ErrLeaseLost = errors.New("the indexer lost its lease")
+
+// InitAndRun initializes the indexer and runs it once, indexing devices
+// generated from the fleet profile, or the default one if nil, and saving
+// a checkpoint after each batch of devices; it holds the lease of the
+// indexer daemon while running, so that it does not run along with a daemon
+func InitAndRun(conf config.Reader, esClient elasticsearch.Client,
+	clients *Clients, devices int64, profile *model.FleetProfile, mode ResumeMode) error {
 	ctx := context.Background()
 
+	i := newIndexer(conf, esClient, clients)
+	if profile != nil {
+		i.profile = profile
+	}
+	lease := newLeaseKeeper(conf, esClient)
+
+	acquired, err := lease.acquire(ctx)
+	if err != nil {
+		return err
+	} else if !acquired {
+		return ErrLeaseHeld
+	}
+	defer lease.release(ctx)
+
+	keepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := lease.keep(keepCtx)
+	runCtx, cancelRun := withLease(keepCtx, lost)
+	defer cancelRun()
+	finished, err := i.run(runCtx, lost, lease, devices, mode)
+	if err == nil && !finished || err != nil && runCtx.Err() != nil {
+		err = ErrLeaseLost
+	}
+	return err
+}
+
+// run indexes the devices, saving a checkpoint after each batch, and then
+// deletes the expired history; it stops after the batch being indexed when
+// stop is closed, and returns whether the run finished. The lease, if not
+// nil, is checked before saving each checkpoint, not to overwrite the
+// progress of the replica which took it over.
+func (i *indexer) run(ctx context.Context, stop <-chan struct{}, lease *leaseKeeper,
+	devices int64, mode ResumeMode) (bool, error) {
+	l := log.FromContext(ctx)
+
+	checkpoint, err := startRun(ctx, i.esClient, devices, i.profile, mode)
+	if err != nil {
+		return false, err
+	}
+	if checkpoint.Indexed > 0 {
+		l.Infof("resuming the run started at %s: %d of %d devices indexed",
+			checkpoint.StartedAt.Format(time.RFC3339), checkpoint.Indexed,
+			checkpoint.Devices)
+	} else {
+		l.Infof("indexing %d devices generated with the seed %d",
+			checkpoint.Devices, checkpoint.Seed)
+	}
+	generator := model.NewFleetGenerator(i.profile, checkpoint.Seed)
+	saveCheckpoint := func() error {
+		if lease != nil {
+			if err := lease.check(ctx); err != nil {
+				return err
+			}
+		}
+		return i.esClient.SaveCheckpoint(ctx, checkpoint)
+	}
+
 	devicesToIndex := make([]*model.Device, 0, batchSize)
+	indexBatch := func() error {
+		err := i.indexDevices(ctx, devicesToIndex)
+		if err != nil {
+			return err
+		}
+		checkpoint.Advance(devicesToIndex, time.Now().UTC())
+		devicesToIndex = devicesToIndex[:0]
+		return saveCheckpoint()
+	}
 
-	for i := int64(1); i <= devices; i++ {
-		device := model.RandomDevice()
+	for n := checkpoint.Indexed; n < checkpoint.Devices; n++ {
+		device := generator.Device(n)
 		devicesToIndex = append(devicesToIndex, device)
 		if len(devicesToIndex) == batchSize {
-			err := esClient.BulkIndexDevices(ctx, devicesToIndex)
+			if err := indexBatch(); err != nil {
+				return false, err
+			}
+			select {
+			case <-stop:
+				l.Infof("run stopped: %d of %d devices indexed",
+					checkpoint.Indexed, checkpoint.Devices)
+				return false, nil
+			default:
+			}
+		}
+	}
+	if len(devicesToIndex) > 0 {
+		if err := indexBatch(); err != nil {
+			return false, err
+		}
+	}
+
+	if i.historyRetention > 0 {
+		err := i.esClient.DeleteHistoryBefore(ctx, time.Now().Add(-i.historyRetention))
+		if err != nil {
+			return false, err
+		}
+	}
+	checkpoint.Finish(time.Now().UTC())
+	return true, saveCheckpoint()
+}
+
+// startRun returns the checkpoint of the run: the one of the interrupted
+// run to resume, which must have the same fleet profile, or a new one
+// generating the devices with the seed of the profile, or a random seed if
+// zero
+func startRun(ctx context.Context, esClient elasticsearch.Client, devices int64,
+	profile *model.FleetProfile, mode ResumeMode) (*model.Checkpoint, error) {
+	now := time.Now().UTC()
+	hash, err := profile.Hash()
+	if err != nil {
+		return nil, err
+	}
+	checkpoint, err := esClient.GetCheckpoint(ctx, model.CheckpointIndexer)
+	if err != nil {
+		return nil, err
+	}
+	interrupted := checkpoint != nil && !checkpoint.Finished()
+	switch {
+	case interrupted && mode == ResumeCheckpoint:
+		if checkpoint.Profile != hash {
+			return nil, ErrProfileMismatch
+		}
+		if checkpoint.Devices != devices {
+			log.FromContext(ctx).Warnf("resuming the run indexing %d devices, "+
+				"ignoring the requested %d devices", checkpoint.Devices, devices)
+		}
+		return checkpoint, nil
+	case interrupted && mode == ResumeNone:
+		return nil, ErrRunInterrupted
+	}
+	checkpoint = model.NewCheckpoint(model.CheckpointIndexer, devices, now)
+	checkpoint.Seed = profile.Seed
+	checkpoint.Profile = hash
+	if checkpoint.Seed == 0 {
+		checkpoint.Seed = now.UnixNano()
+	}
+	if err := esClient.SaveCheckpoint(ctx, checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// indexDevices records the attribute changes of the devices compared to
+// their stored documents, and then indexes the new documents enriched with
+// the data ingested from the other services
+func (i *indexer) indexDevices(ctx context.Context, devices []*model.Device) error {
+	now := time.Now().UTC()
+
+	deviceIDs := make(map[string][]string)
+	for _, device := range devices {
+		tenantID := device.GetTenantID()
+		deviceIDs[tenantID] = append(deviceIDs[tenantID], device.GetID())
+		device.IdentityAttributes.ParseAddresses()
+		device.InventoryAttributes.ParseAddresses()
+		device.InventoryAttributes.ParseVersions(i.versionAttributes)
+		device.SetLocation(i.geoAttributes.Location(device.InventoryAttributes))
+	}
+	for tenantID, ids := range deviceIDs {
+		if i.clients.Deployments != nil {
+			err := i.indexDeployments(ctx, tenantID, ids, devices)
 			if err != nil {
 				return err
 			}
-			devicesToIndex = devicesToIndex[:0]
+		}
+		err := i.setConnectivity(ctx, tenantID, ids, devices)
+		if err != nil {
+			return err
 		}
 	}
-	if len(devicesToIndex) > 0 {
-		err := esClient.BulkIndexDevices(ctx, devicesToIndex)
+
+	stored := make(map[string]*model.Device, len(devices))
+	for tenantID, ids := range deviceIDs {
+		storedDevices, err := i.esClient.GetDevices(ctx, tenantID, ids)
 		if err != nil {
 			return err
 		}
+		for _, device := range storedDevices {
+			stored[tenantID+"/"+device.GetID()] = device
+		}
+	}
+
+	changes := []*model.AttributeChange{}
+	for _, device := range devices {
+		key := device.GetTenantID() + "/" + device.GetID()
+		changes = append(changes, model.DiffDevices(stored[key], device, now)...)
+	}
+	err := i.esClient.BulkIndexHistory(ctx, changes)
+	if err != nil {
+		return err
+	}
+
+	return i.esClient.BulkIndexDevices(ctx, devices)
+}
+
+// indexDeployments indexes the deployments of the tenant's devices and
+// denormalizes the last deployment of each device into its document
+func (i *indexer) indexDeployments(ctx context.Context, tenantID string,
+	deviceIDs []string, devices []*model.Device) error {
+	deviceDeployments, err := i.clients.Deployments.GetDeviceDeployments(ctx,
+		tenantID, deviceIDs)
+	if err != nil {
+		return err
+	}
+	err = i.esClient.BulkIndexDeviceDeployments(ctx, deviceDeployments)
+	if err != nil {
+		return err
+	}
+
+	last := model.LastDeviceDeployments(deviceDeployments)
+	for _, device := range devices {
+		if device.GetTenantID() == tenantID {
+			device.SetLastDeployment(last[device.GetID()])
+		}
+	}
+	return nil
+}
+
+// setConnectivity sets the last check-in time and the connection status
+// of the tenant's devices
+func (i *indexer) setConnectivity(ctx context.Context, tenantID string,
+	deviceIDs []string, devices []*model.Device) error {
+	checkInTimes := map[string]time.Time{}
+	if i.clients.DeviceAuth != nil {
+		var err error
+		checkInTimes, err = i.clients.DeviceAuth.GetCheckInTimes(ctx, tenantID, deviceIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	connectStatuses := map[string]*model.ConnectStatus{}
+	if i.clients.DeviceConnect != nil {
+		var err error
+		connectStatuses, err = i.clients.DeviceConnect.GetConnectStatuses(ctx,
+			tenantID, deviceIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, device := range devices {
+		if device.GetTenantID() != tenantID {
+			continue
+		}
+		var lastCheckIn *time.Time
+		if checkIn, ok := checkInTimes[device.GetID()]; ok {
+			lastCheckIn = &checkIn
+		}
+		device.SetConnectivity(lastCheckIn, connectStatuses[device.GetID()])
 	}
 	return nil
 }
@@ -0,0 +1,180 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	esmocks "github.com/mendersoftware/reporting/client/elasticsearch/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestInitAndRunCheckpoint(t *testing.T) {
+	startedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	finished := startedAt.Add(time.Hour)
+	profile, _ := model.DefaultFleetProfile().Hash()
+	interrupted := &model.Checkpoint{
+		ID:        model.CheckpointIndexer,
+		Devices:   500,
+		Indexed:   400,
+		Seed:      42,
+		Profile:   profile,
+		StartedAt: startedAt,
+		UpdatedAt: startedAt,
+	}
+	otherProfile := *interrupted
+	otherProfile.Profile = "other"
+
+	testCases := map[string]struct {
+		checkpoint *model.Checkpoint
+		mode       ResumeMode
+
+		indexed []int
+		saved   []int64
+		cursors int64
+		seed    int64
+		err     error
+	}{
+		"new run": {
+			mode:    ResumeNone,
+			indexed: []int{batchSize, batchSize, 50},
+			saved:   []int64{0, 200, 400, 450, 450},
+			cursors: 450,
+		},
+		"new run, previous run finished": {
+			checkpoint: &model.Checkpoint{
+				ID:         model.CheckpointIndexer,
+				Devices:    1000,
+				Indexed:    1000,
+				FinishedAt: &finished,
+			},
+			mode:    ResumeCheckpoint,
+			indexed: []int{batchSize, batchSize, 50},
+			saved:   []int64{0, 200, 400, 450, 450},
+			cursors: 450,
+		},
+		"ko, previous run interrupted": {
+			checkpoint: interrupted,
+			mode:       ResumeNone,
+			err:        ErrRunInterrupted,
+		},
+		"resume": {
+			checkpoint: interrupted,
+			mode:       ResumeCheckpoint,
+			indexed:    []int{100},
+			saved:      []int64{500, 500},
+			// the interrupted run saved no cursors
+			cursors: 100,
+			seed:    42,
+		},
+		"ko, resume with another profile": {
+			checkpoint: &otherProfile,
+			mode:       ResumeCheckpoint,
+			err:        ErrProfileMismatch,
+		},
+		"from scratch": {
+			checkpoint: interrupted,
+			mode:       ResumeFromScratch,
+			indexed:    []int{batchSize, batchSize, 50},
+			saved:      []int64{0, 200, 400, 450, 450},
+			cursors:    450,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			esClient := &esmocks.Client{}
+			defer esClient.AssertExpectations(t)
+
+			var checkpoint *model.Checkpoint
+			if tc.checkpoint != nil {
+				copied := *tc.checkpoint
+				checkpoint = &copied
+			}
+			esClient.On("AcquireLease", mock.Anything, model.LeaseIndexer,
+				mock.AnythingOfType("string"), 30*time.Second).Return(true, nil)
+			esClient.On("ReleaseLease", ctx, model.LeaseIndexer,
+				mock.AnythingOfType("string")).Return(nil)
+			esClient.On("GetCheckpoint", mock.Anything, model.CheckpointIndexer).
+				Return(checkpoint, nil)
+
+			indexed := []int{}
+			saved := []int64{}
+			var last *model.Checkpoint
+			if tc.err == nil {
+				esClient.On("GetDevices", mock.Anything, mock.AnythingOfType("string"),
+					mock.AnythingOfType("[]string")).Return([]*model.Device{}, nil)
+				esClient.On("BulkIndexHistory", mock.Anything,
+					mock.AnythingOfType("[]*model.AttributeChange")).Return(nil)
+				esClient.On("BulkIndexDevices", mock.Anything,
+					mock.AnythingOfType("[]*model.Device")).
+					Run(func(args mock.Arguments) {
+						indexed = append(indexed, len(args.Get(1).([]*model.Device)))
+					}).
+					Return(nil)
+				esClient.On("SaveCheckpoint", mock.Anything,
+					mock.AnythingOfType("*model.Checkpoint")).
+					Run(func(args mock.Arguments) {
+						last = args.Get(1).(*model.Checkpoint)
+						saved = append(saved, last.Indexed)
+					}).
+					Return(nil)
+			}
+
+			err := InitAndRun(config.Config, esClient, &Clients{}, 450, nil, tc.mode)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.indexed, indexed)
+			assert.Equal(t, tc.saved, saved)
+			if assert.NotNil(t, last) {
+				assert.True(t, last.Finished())
+				if tc.seed != 0 {
+					assert.Equal(t, tc.seed, last.Seed)
+				} else {
+					assert.NotZero(t, last.Seed)
+				}
+				assert.Equal(t, int64(0), last.Remaining())
+				assert.Equal(t, profile, last.Profile)
+				tenants := int64(0)
+				for _, cursor := range last.Tenants {
+					assert.NotEmpty(t, cursor.LastDeviceID)
+					tenants += cursor.Indexed
+				}
+				assert.Equal(t, tc.cursors, tenants)
+			}
+		})
+	}
+}
+
+func TestInitAndRunLeaseHeld(t *testing.T) {
+	ctx := context.Background()
+	esClient := &esmocks.Client{}
+	defer esClient.AssertExpectations(t)
+	esClient.On("AcquireLease", ctx, model.LeaseIndexer,
+		mock.AnythingOfType("string"), 30*time.Second).Return(false, nil)
+
+	err := InitAndRun(config.Config, esClient, &Clients{}, 450, nil, ResumeNone)
+	assert.Equal(t, ErrLeaseHeld, err)
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/client/elasticsearch"
+	"github.com/mendersoftware/reporting/model"
+)
+
+const reconcileBatchSize = 500
+
+// Reconcile compares the devices of the tenant in the inventory with the
+// indexed devices, and fixes the drift unless dryRun is set: it reindexes
+// the missing and stale devices, and deletes the orphaned ones
+func Reconcile(ctx context.Context, conf config.Reader, esClient elasticsearch.Client,
+	clients *Clients, tenantID string, dryRun bool) (*model.DriftReport, error) {
+	if clients.Inventory == nil {
+		return nil, errors.New("the inventory service address is not configured")
+	}
+	i := newIndexer(conf, esClient, clients)
+	return i.reconcile(ctx, tenantID, dryRun)
+}
+
+func (i *indexer) reconcile(ctx context.Context, tenantID string,
+	dryRun bool) (*model.DriftReport, error) {
+	report := &model.DriftReport{
+		TenantID:  tenantID,
+		StartedAt: time.Now().UTC(),
+		DryRun:    dryRun,
+		Missing:   []string{},
+		Stale:     []string{},
+		Orphaned:  []string{},
+	}
+
+	source := make(map[string]time.Time)
+	for page := 1; ; page++ {
+		devices, err := i.clients.Inventory.SearchDevices(ctx, tenantID,
+			page, reconcileBatchSize, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			source[device.GetID()] = device.GetUpdatedAt()
+		}
+		if len(devices) < reconcileBatchSize {
+			break
+		}
+	}
+	report.SourceDevices = len(source)
+
+	// orphans are the indexed devices not listed by the inventory, checked
+	// again by ID: the listing is not consistent if the inventory changes
+	orphans := make(map[string]time.Time)
+	after := ""
+	for {
+		query := model.BuildReconcileQuery(after, reconcileBatchSize)
+		devices, _, err := i.esClient.SearchDevices(ctx, tenantID, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			id := device.GetID()
+			updatedAt, ok := source[id]
+			switch {
+			// the devices indexed since the start may be missing in the
+			// listing of the inventory
+			case !ok && device.GetUpdatedAt().Before(report.StartedAt):
+				orphans[id] = device.GetUpdatedAt()
+			case ok && device.GetUpdatedAt().Before(updatedAt):
+				report.Stale = append(report.Stale, id)
+			}
+			delete(source, id)
+		}
+		report.IndexedDevices += len(devices)
+		if len(devices) < reconcileBatchSize {
+			break
+		}
+		after = devices[len(devices)-1].GetID()
+	}
+	for id := range source {
+		report.Missing = append(report.Missing, id)
+	}
+	sort.Strings(report.Missing)
+	if err := i.checkOrphans(ctx, report, orphans); err != nil {
+		return nil, err
+	}
+	sort.Strings(report.Stale)
+
+	if dryRun {
+		return report, nil
+	}
+
+	reindex := append(append([]string{}, report.Missing...), report.Stale...)
+	for start := 0; start < len(reindex); start += batchSize {
+		end := start + batchSize
+		if end > len(reindex) {
+			end = len(reindex)
+		}
+		devices, err := i.clients.Inventory.SearchDevices(ctx, tenantID,
+			1, end-start, reindex[start:end])
+		if err != nil {
+			return report, err
+		}
+		if len(devices) > 0 {
+			if err := i.indexDevices(ctx, devices); err != nil {
+				return report, err
+			}
+		}
+		report.Reindexed += len(devices)
+	}
+
+	for start := 0; start < len(report.Orphaned); start += batchSize {
+		end := start + batchSize
+		if end > len(report.Orphaned) {
+			end = len(report.Orphaned)
+		}
+		err := i.esClient.DeleteDevices(ctx, tenantID, report.Orphaned[start:end])
+		if err != nil {
+			return report, err
+		}
+		report.Deleted += end - start
+	}
+	return report, nil
+}
+
+// checkOrphans looks up the orphan candidates in the inventory by ID, and
+// adds the ones not found to the orphaned devices of the report, and the
+// ones found but indexed before their last update to the stale devices
+func (i *indexer) checkOrphans(ctx context.Context, report *model.DriftReport,
+	orphans map[string]time.Time) error {
+	ids := make([]string, 0, len(orphans))
+	for id := range orphans {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for start := 0; start < len(ids); start += batchSize {
+		end := start + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		devices, err := i.clients.Inventory.SearchDevices(ctx, report.TenantID,
+			1, end-start, ids[start:end])
+		if err != nil {
+			return err
+		}
+		for _, device := range devices {
+			indexedAt, ok := orphans[device.GetID()]
+			if !ok {
+				continue
+			}
+			if indexedAt.Before(device.GetUpdatedAt()) {
+				report.Stale = append(report.Stale, device.GetID())
+			}
+			delete(orphans, device.GetID())
+		}
+	}
+	for _, id := range ids {
+		if _, ok := orphans[id]; ok {
+			report.Orphaned = append(report.Orphaned, id)
+		}
+	}
+	return nil
+}
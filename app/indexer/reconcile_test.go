@@ -0,0 +1,150 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	esmocks "github.com/mendersoftware/reporting/client/elasticsearch/mocks"
+	invmocks "github.com/mendersoftware/reporting/client/inventory/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestReconcile(t *testing.T) {
+	const tenantID = "tenant"
+	t1 := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	device := func(id string, updatedAt time.Time) *model.Device {
+		return model.NewDevice(id).SetTenantID(tenantID).SetUpdatedAt(updatedAt)
+	}
+
+	testCases := map[string]struct {
+		dryRun    bool
+		reindexed []string
+		err       error
+
+		report *model.DriftReport
+		outErr string
+	}{
+		"dry run": {
+			dryRun: true,
+			report: &model.DriftReport{
+				TenantID:       tenantID,
+				DryRun:         true,
+				SourceDevices:  3,
+				IndexedDevices: 5,
+				Missing:        []string{"3"},
+				Stale:          []string{"2", "5"},
+				Orphaned:       []string{"4"},
+			},
+		},
+		"fix the drift": {
+			reindexed: []string{"3", "2", "5"},
+			report: &model.DriftReport{
+				TenantID:       tenantID,
+				SourceDevices:  3,
+				IndexedDevices: 5,
+				Missing:        []string{"3"},
+				Stale:          []string{"2", "5"},
+				Orphaned:       []string{"4"},
+				Reindexed:      3,
+				Deleted:        1,
+			},
+		},
+		"ko, deletion failure": {
+			reindexed: []string{"3", "2", "5"},
+			err:       errors.New("failed to delete the devices: 500"),
+			report: &model.DriftReport{
+				TenantID:       tenantID,
+				SourceDevices:  3,
+				IndexedDevices: 5,
+				Missing:        []string{"3"},
+				Stale:          []string{"2", "5"},
+				Orphaned:       []string{"4"},
+				Reindexed:      3,
+			},
+			outErr: "failed to delete the devices: 500",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			inv := &invmocks.Client{}
+			defer inv.AssertExpectations(t)
+			esClient := &esmocks.Client{}
+			defer esClient.AssertExpectations(t)
+
+			inv.On("SearchDevices", ctx, tenantID, 1, reconcileBatchSize, []string(nil)).
+				Return([]*model.Device{
+					device("1", t1), device("2", t2), device("3", t1),
+				}, nil)
+			esClient.On("SearchDevices", ctx, tenantID,
+				model.BuildReconcileQuery("", reconcileBatchSize)).
+				Return([]*model.Device{
+					device("1", t1),
+					device("2", t1),
+					device("4", t1),
+					device("5", t1),
+					// indexed after the listing of the inventory
+					device("6", time.Now().Add(time.Hour)),
+				}, 0, nil)
+			inv.On("SearchDevices", ctx, tenantID, 1, 2, []string{"4", "5"}).
+				Return([]*model.Device{device("5", t2)}, nil)
+
+			if len(tc.reindexed) > 0 {
+				devices := make([]*model.Device, 0, len(tc.reindexed))
+				for _, id := range tc.reindexed {
+					devices = append(devices, device(id, t2))
+				}
+				inv.On("SearchDevices", ctx, tenantID, 1, len(tc.reindexed),
+					tc.reindexed).Return(devices, nil)
+				esClient.On("GetDevices", ctx, tenantID, tc.reindexed).
+					Return([]*model.Device{}, nil)
+				esClient.On("BulkIndexHistory", ctx,
+					mock.AnythingOfType("[]*model.AttributeChange")).Return(nil)
+				esClient.On("BulkIndexDevices", ctx, devices).Return(nil)
+				esClient.On("DeleteDevices", ctx, tenantID, []string{"4"}).
+					Return(tc.err)
+			}
+
+			report, err := Reconcile(ctx, config.Config, esClient,
+				&Clients{Inventory: inv}, tenantID, tc.dryRun)
+			if tc.outErr != "" {
+				assert.EqualError(t, err, tc.outErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			if assert.NotNil(t, report) {
+				assert.False(t, report.StartedAt.IsZero())
+				report.StartedAt = time.Time{}
+				assert.Equal(t, tc.report, report)
+			}
+		})
+	}
+}
+
+func TestReconcileNoInventory(t *testing.T) {
+	_, err := Reconcile(context.Background(), config.Config, &esmocks.Client{},
+		&Clients{}, "tenant", true)
+	assert.EqualError(t, err, "the inventory service address is not configured")
+}
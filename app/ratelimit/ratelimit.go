@@ -0,0 +1,207 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ratelimit
+
+import (
+	"expvar"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+// Rejection reasons, used as keys of the rejection metrics
+const (
+	ReasonRate        = "rate"
+	ReasonConcurrency = "concurrency"
+)
+
+// concurrencyRetryAfter is the time after which a request rejected because
+// of the concurrency limit should be retried
+const concurrencyRetryAfter = time.Second
+
+// sweepInterval is the interval between the evictions of the idle tenants
+const sweepInterval = time.Minute
+
+// otherTenants is the key of the rejection metrics of the tenants without
+// overrides; tenant IDs cannot start with an underscore
+const otherTenants = "_other"
+
+var (
+	// ErrRateLimited is returned when the tenant exceeded its request rate
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrConcurrencyLimited is returned when the tenant has too many
+	// queries in flight
+	ErrConcurrencyLimited = errors.New("too many concurrent queries")
+)
+
+var (
+	rejections         = expvar.NewMap("rate_limit_rejections")
+	rejectionsByTenant = expvar.NewMap("rate_limit_rejections_by_tenant")
+)
+
+// burst returns the size of the token bucket of the limits
+func burst(l model.RateLimits) float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+type tenant struct {
+	limits   model.RateLimits
+	tokens   float64
+	updated  time.Time
+	inFlight int
+}
+
+// Limiter enforces per-tenant token-bucket rate limits and caps on the
+// concurrent requests
+type Limiter struct {
+	defaults  model.RateLimits
+	overrides map[string]model.RateLimits
+
+	mu        sync.Mutex
+	tenants   map[string]*tenant
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLimiter returns a new limiter applying the default limits to all the
+// tenants but the ones with overrides
+func NewLimiter(defaults model.RateLimits, overrides map[string]model.RateLimits) *Limiter {
+	return &Limiter{
+		defaults:  defaults,
+		overrides: overrides,
+		tenants:   map[string]*tenant{},
+		now:       time.Now,
+	}
+}
+
+// SetLimits replaces the default limits and the overrides; the tenants
+// keep their requests in flight, and their tokens up to the new burst
+func (l *Limiter) SetLimits(defaults model.RateLimits, overrides map[string]model.RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.defaults = defaults
+	l.overrides = overrides
+	for tenantID, t := range l.tenants {
+		limits, ok := overrides[tenantID]
+		if !ok {
+			limits = defaults
+		}
+		t.limits = limits
+		t.tokens = math.Min(t.tokens, burst(limits))
+	}
+}
+
+func (l *Limiter) tenant(tenantID string, now time.Time) *tenant {
+	t, ok := l.tenants[tenantID]
+	if !ok {
+		limits, ok := l.overrides[tenantID]
+		if !ok {
+			limits = l.defaults
+		}
+		t = &tenant{
+			limits:  limits,
+			tokens:  burst(limits),
+			updated: now,
+		}
+		l.tenants[tenantID] = t
+	}
+	return t
+}
+
+// idle returns true if the tenant has no requests in flight and a full
+// bucket, being then indistinguishable from a new tenant
+func (t *tenant) idle(now time.Time) bool {
+	if t.inFlight > 0 {
+		return false
+	} else if t.limits.Rate <= 0 {
+		return true
+	}
+	elapsed := now.Sub(t.updated).Seconds()
+	return t.tokens+elapsed*t.limits.Rate >= burst(t.limits)
+}
+
+// sweep evicts the idle tenants, so the tenants are not kept forever
+func (l *Limiter) sweep(now time.Time) {
+	for tenantID, t := range l.tenants {
+		if t.idle(now) {
+			delete(l.tenants, tenantID)
+		}
+	}
+	l.lastSweep = now
+}
+
+// reject records the rejection in the metrics; the rejections of the
+// tenants without overrides are counted together, not to create a key for
+// each tenant ID presented by the callers
+func (l *Limiter) reject(tenantID, reason string) {
+	rejections.Add(reason, 1)
+	if _, ok := l.overrides[tenantID]; !ok {
+		tenantID = otherTenants
+	}
+	rejectionsByTenant.Add(tenantID, 1)
+}
+
+// Acquire admits a request of the tenant, returning the function to call
+// when the request completes; if the request is rejected, it returns
+// ErrRateLimited or ErrConcurrencyLimited and the time after which the
+// request should be retried
+func (l *Limiter) Acquire(tenantID string) (release func(), retryAfter time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+	t := l.tenant(tenantID, now)
+	if t.limits.Concurrency > 0 && t.inFlight >= t.limits.Concurrency {
+		l.reject(tenantID, ReasonConcurrency)
+		return nil, concurrencyRetryAfter, ErrConcurrencyLimited
+	}
+	if t.limits.Rate > 0 {
+		elapsed := now.Sub(t.updated).Seconds()
+		t.tokens = math.Min(burst(t.limits), t.tokens+elapsed*t.limits.Rate)
+		t.updated = now
+		if t.tokens < 1 {
+			l.reject(tenantID, ReasonRate)
+			wait := (1 - t.tokens) / t.limits.Rate
+			return nil, time.Duration(wait * float64(time.Second)), ErrRateLimited
+		}
+		t.tokens--
+	}
+
+	t.inFlight++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			t.inFlight--
+			l.mu.Unlock()
+		})
+	}, 0, nil
+}
+
+// RetryAfterSeconds returns the value of the Retry-After header for the
+// time after which the request should be retried
+func RetryAfterSeconds(retryAfter time.Duration) int {
+	return int(math.Max(1, math.Ceil(retryAfter.Seconds())))
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ratelimit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func tenantRejections(key string) int {
+	var n int
+	if value := rejectionsByTenant.Get(key); value != nil {
+		n, _ = strconv.Atoi(value.String())
+	}
+	return n
+}
+
+func TestLimiterRate(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(model.RateLimits{Rate: 2, Burst: 2}, nil)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		release, _, err := limiter.Acquire("tenant")
+		assert.NoError(t, err)
+		release()
+	}
+	_, retryAfter, err := limiter.Acquire("tenant")
+	assert.Equal(t, ErrRateLimited, err)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+	assert.Equal(t, 1, RetryAfterSeconds(retryAfter))
+
+	// other tenants have their own bucket
+	_, _, err = limiter.Acquire("other")
+	assert.NoError(t, err)
+
+	now = now.Add(500 * time.Millisecond)
+	_, _, err = limiter.Acquire("tenant")
+	assert.NoError(t, err)
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	limiter := NewLimiter(model.RateLimits{Concurrency: 1}, map[string]model.RateLimits{
+		"big": {Concurrency: 2},
+	})
+
+	others := tenantRejections(otherTenants)
+
+	release, _, err := limiter.Acquire("tenant")
+	assert.NoError(t, err)
+	_, retryAfter, err := limiter.Acquire("tenant")
+	assert.Equal(t, ErrConcurrencyLimited, err)
+	assert.Equal(t, time.Second, retryAfter)
+
+	release()
+	release()
+	_, _, err = limiter.Acquire("tenant")
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, _, err := limiter.Acquire("big")
+		assert.NoError(t, err)
+	}
+	_, _, err = limiter.Acquire("big")
+	assert.Equal(t, ErrConcurrencyLimited, err)
+	assert.Equal(t, 1, tenantRejections("big"))
+	// the tenants without overrides are counted together
+	assert.Nil(t, rejectionsByTenant.Get("tenant"))
+	assert.Equal(t, others+1, tenantRejections(otherTenants))
+}
+
+func TestLimiterEvictsIdleTenants(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(model.RateLimits{Rate: 0.01, Burst: 2, Concurrency: 1},
+		map[string]model.RateLimits{"unlimited": {Concurrency: 1}})
+	limiter.now = func() time.Time { return now }
+
+	// a request in flight
+	_, _, err := limiter.Acquire("busy")
+	assert.NoError(t, err)
+	// a bucket not refilled yet after the sweep interval
+	release, _, err := limiter.Acquire("refilling")
+	assert.NoError(t, err)
+	release()
+	// no rate limit and no requests in flight
+	release, _, err = limiter.Acquire("unlimited")
+	assert.NoError(t, err)
+	release()
+	assert.Len(t, limiter.tenants, 3)
+
+	now = now.Add(sweepInterval)
+	_, _, err = limiter.Acquire("new")
+	assert.NoError(t, err)
+	assert.Contains(t, limiter.tenants, "busy")
+	assert.Contains(t, limiter.tenants, "refilling")
+	assert.NotContains(t, limiter.tenants, "unlimited")
+	assert.Contains(t, limiter.tenants, "new")
+
+	// the bucket is refilled after 100 seconds
+	now = now.Add(100*time.Second - sweepInterval)
+	_, _, err = limiter.Acquire("new")
+	assert.Equal(t, ErrConcurrencyLimited, err)
+	now = now.Add(sweepInterval)
+	_, _, err = limiter.Acquire("new")
+	assert.Equal(t, ErrConcurrencyLimited, err)
+	assert.NotContains(t, limiter.tenants, "refilling")
+}
+
+func TestLimiterSetLimits(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(model.RateLimits{Rate: 1, Burst: 10}, nil)
+	limiter.now = func() time.Time { return now }
+
+	release, _, err := limiter.Acquire("tenant")
+	assert.NoError(t, err)
+	release()
+
+	// the tokens of the existing tenants are clamped to the new burst
+	limiter.SetLimits(model.RateLimits{Rate: 1, Burst: 1}, map[string]model.RateLimits{
+		"big": {Rate: 1, Burst: 3},
+	})
+	_, _, err = limiter.Acquire("tenant")
+	assert.NoError(t, err)
+	_, _, err = limiter.Acquire("tenant")
+	assert.Equal(t, ErrRateLimited, err)
+
+	for i := 0; i < 3; i++ {
+		_, _, err := limiter.Acquire("big")
+		assert.NoError(t, err)
+	}
+	_, _, err = limiter.Acquire("big")
+	assert.Equal(t, ErrRateLimited, err)
+}
@@ -0,0 +1,396 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/client/elasticsearch"
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	defaultStaleDevicesThreshold = 24 * time.Hour
+	defaultStaleDevicesPerGroup  = 20
+
+	deviceIDsBatchSize = 1000
+)
+
+// App is the reporting application
+type App interface {
+	GetDeviceHistory(ctx context.Context, tenantID string, deviceID string,
+		filter *model.HistoryFilter) ([]*model.AttributeChange, int, error)
+	SearchDevices(ctx context.Context,
+		searchParams *model.SearchParams) ([]*model.Device, int, error)
+	StaleDevicesReport(ctx context.Context, tenantID string, threshold time.Duration,
+		perGroup int) (*model.StaleDevicesReport, error)
+	GeoGrid(ctx context.Context, params *model.GeoGridParams) ([]*model.GeoGridBucket, error)
+	Subnets(ctx context.Context, params *model.SubnetsParams) ([]*model.SubnetBucket, error)
+	CountDevices(ctx context.Context, searchParams *model.SearchParams) (int, error)
+	Aggregate(ctx context.Context, params *model.AggregateParams) ([]*model.AggregateBucket, int, error)
+	StreamDeviceIDs(ctx context.Context, searchParams *model.SearchParams,
+		send func(deviceID string) error) error
+	GetTenant(ctx context.Context, tenantID string) (*model.Tenant, error)
+	ProvisionTenant(ctx context.Context, params *model.ProvisionTenantParams) (*model.Tenant, error)
+	SuspendTenant(ctx context.Context, tenantID string) (*model.Tenant, error)
+	ResumeTenant(ctx context.Context, tenantID string) (*model.Tenant, error)
+	DeleteTenant(ctx context.Context, tenantID string) (*model.Tenant, error)
+	ResumeTenantDeletions(ctx context.Context) error
+	ListDeadLetters(ctx context.Context,
+		filter *model.DeadLetterFilter) ([]*model.DeadLetter, int, error)
+	RetryDeadLetter(ctx context.Context, id string) error
+	DiscardDeadLetter(ctx context.Context, id string) error
+	ReplayDeadLetters(ctx context.Context, tenantID string) (*model.ReplayResult, error)
+}
+
+type app struct {
+	esClient              elasticsearch.Client
+	staleDevicesThreshold time.Duration
+	versionAttributes     model.VersionAttributes
+	tierIndexSettings     map[string]model.IndexSettings
+	deletions             tenantDeletions
+}
+
+// Option is a functional option of the reporting App
+type Option func(*app)
+
+// WithStaleDevicesThreshold sets the default duration after which a device
+// is reported as stale
+func WithStaleDevicesThreshold(threshold time.Duration) Option {
+	return func(a *app) {
+		a.staleDevicesThreshold = threshold
+	}
+}
+
+// WithVersionAttributes sets the inventory attributes compared and sorted
+// by version order
+func WithVersionAttributes(names []string) Option {
+	return func(a *app) {
+		a.versionAttributes = model.NewVersionAttributes(names)
+	}
+}
+
+// WithTierIndexSettings sets the settings of the indices of the tenants
+// provisioned with each tier
+func WithTierIndexSettings(settings map[string]model.IndexSettings) Option {
+	return func(a *app) {
+		a.tierIndexSettings = settings
+	}
+}
+
+// NewApp returns a new reporting App
+func NewApp(esClient elasticsearch.Client, opts ...Option) App {
+	app := &app{
+		esClient:              esClient,
+		staleDevicesThreshold: defaultStaleDevicesThreshold,
+		tierIndexSettings:     model.DefaultTierIndexSettings,
+	}
+	for _, opt := range opts {
+		opt(app)
+	}
+	return app
+}
+
+// GetDeviceHistory returns the attribute changes of a device, most recent
+// first, and the total number of changes matching the filter
+func (a *app) GetDeviceHistory(ctx context.Context, tenantID string, deviceID string,
+	filter *model.HistoryFilter) ([]*model.AttributeChange, int, error) {
+	return a.esClient.GetDeviceHistory(ctx, tenantID, deviceID, filter)
+}
+
+// SearchDevices returns the devices matching the search parameters and the
+// total number of matching devices
+func (a *app) SearchDevices(ctx context.Context,
+	searchParams *model.SearchParams) ([]*model.Device, int, error) {
+	searchParams.VersionAttributes = a.versionAttributes
+	query, err := model.BuildQuery(searchParams)
+	if err != nil {
+		return nil, 0, err
+	}
+	return a.esClient.SearchDevices(ctx, searchParams.TenantID, query)
+}
+
+// CountDevices returns the number of devices matching the search
+// parameters
+func (a *app) CountDevices(ctx context.Context,
+	searchParams *model.SearchParams) (int, error) {
+	searchParams.VersionAttributes = a.versionAttributes
+	query, err := model.BuildCountQuery(searchParams)
+	if err != nil {
+		return 0, err
+	}
+	_, total, err := a.esClient.AggregateDevices(ctx, searchParams.TenantID, query)
+	return total, err
+}
+
+type termsBucket struct {
+	Key         interface{} `json:"key"`
+	KeyAsString string      `json:"key_as_string"`
+	DocCount    int         `json:"doc_count"`
+	Devices     *struct {
+		DocCount int `json:"doc_count"`
+	} `json:"devices"`
+}
+
+func (b termsBucket) bucket() *model.AggregateBucket {
+	bucket := &model.AggregateBucket{
+		Value: b.KeyAsString,
+		Count: b.DocCount,
+	}
+	if bucket.Value == "" {
+		bucket.Value = fmt.Sprint(b.Key)
+	}
+	if b.Devices != nil {
+		bucket.Count = b.Devices.DocCount
+	}
+	return bucket
+}
+
+type termsAggregation struct {
+	Buckets []termsBucket `json:"buckets"`
+}
+
+type valuesAggregations struct {
+	Values     termsAggregation `json:"values"`
+	Attributes struct {
+		Filtered struct {
+			Strings termsAggregation `json:"strings"`
+			Numbers termsAggregation `json:"numbers"`
+		} `json:"filtered"`
+	} `json:"attributes"`
+}
+
+// Aggregate returns the number of matching devices for the most common
+// values of an attribute, and the total number of matching devices
+func (a *app) Aggregate(ctx context.Context,
+	params *model.AggregateParams) ([]*model.AggregateBucket, int, error) {
+	params.VersionAttributes = a.versionAttributes
+	query, err := model.BuildAggregateQuery(params)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, total, err := a.esClient.AggregateDevices(ctx, params.TenantID, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	buckets := []*model.AggregateBucket{}
+	if len(result) == 0 {
+		return buckets, total, nil
+	}
+	var aggs valuesAggregations
+	if err := json.Unmarshal(result, &aggs); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to parse the aggregations")
+	}
+	for _, terms := range []termsAggregation{
+		aggs.Values,
+		aggs.Attributes.Filtered.Strings,
+		aggs.Attributes.Filtered.Numbers,
+	} {
+		for _, bucket := range terms.Buckets {
+			buckets = append(buckets, bucket.bucket())
+		}
+	}
+	sort.SliceStable(buckets, func(i, j int) bool {
+		return buckets[i].Count > buckets[j].Count
+	})
+	if len(buckets) > params.Size {
+		buckets = buckets[:params.Size]
+	}
+	return buckets, total, nil
+}
+
+// StreamDeviceIDs sends the IDs of all the devices matching the search
+// parameters, sorted by ID, until send returns an error; paging and sorting
+// of the search parameters are ignored
+func (a *app) StreamDeviceIDs(ctx context.Context, searchParams *model.SearchParams,
+	send func(deviceID string) error) error {
+	searchParams.VersionAttributes = a.versionAttributes
+	after := ""
+	for {
+		query, err := model.BuildDeviceIDsQuery(searchParams, after, deviceIDsBatchSize)
+		if err != nil {
+			return err
+		}
+		devices, _, err := a.esClient.SearchDevices(ctx, searchParams.TenantID, query)
+		if err != nil {
+			return err
+		}
+		for _, device := range devices {
+			if err := send(device.GetID()); err != nil {
+				return err
+			}
+		}
+		if len(devices) < deviceIDsBatchSize {
+			return nil
+		}
+		after = devices[len(devices)-1].GetID()
+	}
+}
+
+type staleDevicesAggregations struct {
+	Groups struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount int    `json:"doc_count"`
+			Devices  struct {
+				Hits struct {
+					Hits []struct {
+						Source *model.StaleDevice `json:"_source"`
+					} `json:"hits"`
+				} `json:"hits"`
+			} `json:"devices"`
+		} `json:"buckets"`
+	} `json:"groups"`
+}
+
+// StaleDevicesReport returns the devices not seen within the threshold,
+// grouped by group name; a zero threshold or perGroup selects the defaults
+func (a *app) StaleDevicesReport(ctx context.Context, tenantID string,
+	threshold time.Duration, perGroup int) (*model.StaleDevicesReport, error) {
+	if threshold <= 0 {
+		threshold = a.staleDevicesThreshold
+	}
+	if perGroup <= 0 {
+		perGroup = defaultStaleDevicesPerGroup
+	}
+	since := time.Now().UTC().Add(-threshold)
+
+	query := model.BuildStaleDevicesQuery(since, perGroup)
+	result, total, err := a.esClient.AggregateDevices(ctx, tenantID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.StaleDevicesReport{
+		Threshold: threshold.String(),
+		Since:     since,
+		Total:     total,
+		Groups:    []*model.StaleDevicesGroup{},
+	}
+	if len(result) == 0 {
+		return report, nil
+	}
+	var aggs staleDevicesAggregations
+	if err := json.Unmarshal(result, &aggs); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the aggregations")
+	}
+	for _, bucket := range aggs.Groups.Buckets {
+		group := &model.StaleDevicesGroup{
+			GroupName: bucket.Key,
+			Count:     bucket.DocCount,
+			Devices:   make([]*model.StaleDevice, 0, len(bucket.Devices.Hits.Hits)),
+		}
+		for _, hit := range bucket.Devices.Hits.Hits {
+			group.Devices = append(group.Devices, hit.Source)
+		}
+		report.Groups = append(report.Groups, group)
+	}
+	return report, nil
+}
+
+type geoGridAggregations struct {
+	Grid struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount int    `json:"doc_count"`
+			Centroid struct {
+				Location *model.GeoPoint `json:"location"`
+			} `json:"centroid"`
+		} `json:"buckets"`
+	} `json:"grid"`
+}
+
+// GeoGrid returns the number of matching devices in each cell of a
+// geohash grid, along with the centroid of their locations
+func (a *app) GeoGrid(ctx context.Context,
+	params *model.GeoGridParams) ([]*model.GeoGridBucket, error) {
+	query, err := model.BuildGeoGridQuery(params)
+	if err != nil {
+		return nil, err
+	}
+	result, _, err := a.esClient.AggregateDevices(ctx, params.TenantID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []*model.GeoGridBucket{}
+	if len(result) == 0 {
+		return buckets, nil
+	}
+	var aggs geoGridAggregations
+	if err := json.Unmarshal(result, &aggs); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the aggregations")
+	}
+	for _, bucket := range aggs.Grid.Buckets {
+		buckets = append(buckets, &model.GeoGridBucket{
+			Geohash:  bucket.Key,
+			Count:    bucket.DocCount,
+			Centroid: bucket.Centroid.Location,
+		})
+	}
+	return buckets, nil
+}
+
+type subnetsAggregations struct {
+	Attributes struct {
+		Filtered struct {
+			Networks struct {
+				Buckets []struct {
+					Key     string `json:"key"`
+					Devices struct {
+						DocCount int `json:"doc_count"`
+					} `json:"devices"`
+				} `json:"buckets"`
+			} `json:"networks"`
+		} `json:"filtered"`
+	} `json:"attributes"`
+}
+
+// Subnets returns the number of matching devices with addresses in each
+// network, for the largest networks
+func (a *app) Subnets(ctx context.Context,
+	params *model.SubnetsParams) ([]*model.SubnetBucket, error) {
+	query, err := model.BuildSubnetsQuery(params)
+	if err != nil {
+		return nil, err
+	}
+	result, _, err := a.esClient.AggregateDevices(ctx, params.TenantID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []*model.SubnetBucket{}
+	if len(result) == 0 {
+		return buckets, nil
+	}
+	var aggs subnetsAggregations
+	if err := json.Unmarshal(result, &aggs); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the aggregations")
+	}
+	for _, bucket := range aggs.Attributes.Filtered.Networks.Buckets {
+		buckets = append(buckets, &model.SubnetBucket{
+			Network: bucket.Key,
+			Count:   bucket.Devices.DocCount,
+		})
+	}
+	return buckets, nil
+}
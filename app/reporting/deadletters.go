@@ -0,0 +1,129 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/client/elasticsearch"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// replayBatchSize is the number of dead letters retried per batch
+const replayBatchSize = 100
+
+var (
+	// ErrDeadLetterNotFound is returned when the dead letter does not exist
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrDeviceRejected is returned when the device of a dead letter is
+	// rejected again
+	ErrDeviceRejected = errors.New("device rejected")
+)
+
+// ListDeadLetters returns a page of the dead letters, oldest rejection
+// first, and the total number of dead letters matching the filter
+func (a *app) ListDeadLetters(ctx context.Context,
+	filter *model.DeadLetterFilter) ([]*model.DeadLetter, int, error) {
+	return a.esClient.ListDeadLetters(ctx, filter)
+}
+
+// RetryDeadLetter indexes again the device of the dead letter, and discards
+// the dead letter if it succeeds; if the device is rejected again, or its
+// tenant is still suspended, the dead letter is updated and ErrDeviceRejected
+// is returned
+func (a *app) RetryDeadLetter(ctx context.Context, id string) error {
+	deadLetter, err := a.esClient.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	} else if deadLetter == nil {
+		return ErrDeadLetterNotFound
+	}
+	return a.retryDeadLetter(ctx, deadLetter)
+}
+
+func (a *app) retryDeadLetter(ctx context.Context, deadLetter *model.DeadLetter) error {
+	device := &model.Device{}
+	if err := json.Unmarshal(deadLetter.Payload, device); err != nil {
+		return errors.Wrap(err, "failed to parse the payload of the dead letter")
+	}
+	err := a.esClient.IndexDevice(ctx, device)
+	if cause := errors.Cause(err); cause == elasticsearch.ErrDocumentRejected ||
+		cause == elasticsearch.ErrIndexClosed {
+		return errors.Wrap(ErrDeviceRejected, err.Error())
+	} else if err != nil {
+		return err
+	}
+	return a.esClient.DeleteDeadLetter(ctx, deadLetter.ID)
+}
+
+// DiscardDeadLetter deletes the dead letter without indexing its device
+func (a *app) DiscardDeadLetter(ctx context.Context, id string) error {
+	deadLetter, err := a.esClient.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	} else if deadLetter == nil {
+		return ErrDeadLetterNotFound
+	}
+	return a.esClient.DeleteDeadLetter(ctx, id)
+}
+
+// ReplayDeadLetters retries each dead letter of the tenant, or of all the
+// tenants if empty, once; the devices rejected again stay in the dead
+// letters
+func (a *app) ReplayDeadLetters(ctx context.Context,
+	tenantID string) (*model.ReplayResult, error) {
+	l := log.FromContext(ctx)
+	result := &model.ReplayResult{}
+	retried := make(map[string]bool)
+	filter := &model.DeadLetterFilter{
+		TenantID: tenantID,
+		Page:     1,
+		PerPage:  replayBatchSize,
+	}
+	for {
+		// the dead letters retried are either deleted or moved to the end
+		// of the list, being the oldest rejection first; the first page
+		// holds the dead letters not retried yet, if any
+		deadLetters, _, err := a.esClient.ListDeadLetters(ctx, filter)
+		if err != nil {
+			return result, err
+		}
+		pending := 0
+		for _, deadLetter := range deadLetters {
+			if retried[deadLetter.ID] {
+				continue
+			}
+			pending++
+			retried[deadLetter.ID] = true
+			err := a.retryDeadLetter(ctx, deadLetter)
+			if errors.Cause(err) == ErrDeviceRejected {
+				l.Warnf("device %s of tenant %q rejected again: %s",
+					deadLetter.DeviceID, deadLetter.TenantID, err.Error())
+				result.Rejected++
+				continue
+			} else if err != nil {
+				return result, err
+			}
+			result.Indexed++
+		}
+		if pending == 0 {
+			return result, nil
+		}
+	}
+}
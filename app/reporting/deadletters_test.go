@@ -0,0 +1,202 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/client/elasticsearch"
+	"github.com/mendersoftware/reporting/client/elasticsearch/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// deadLetterStore stores the dead letters of the mocked client, rejecting
+// again the devices in rejected, or all of them while closed
+type deadLetterStore struct {
+	mu          sync.Mutex
+	now         time.Time
+	deadLetters map[string]*model.DeadLetter
+	rejected    map[string]bool
+	closed      bool
+}
+
+func newDeadLetterStore(esClient *mocks.Client, tenantID string, count int,
+	rejected ...string) *deadLetterStore {
+	store := &deadLetterStore{
+		now:         time.Now(),
+		deadLetters: make(map[string]*model.DeadLetter),
+		rejected:    make(map[string]bool),
+	}
+	for _, id := range rejected {
+		store.rejected[id] = true
+	}
+	for i := 0; i < count; i++ {
+		deviceID := fmt.Sprintf("%03d", i)
+		payload, _ := json.Marshal(model.NewDevice(deviceID).SetTenantID(tenantID))
+		store.fail(&model.DeadLetter{
+			ID:       model.DeadLetterID(tenantID, deviceID),
+			TenantID: tenantID,
+			DeviceID: deviceID,
+			Payload:  payload,
+		})
+	}
+
+	esClient.On("ListDeadLetters", mock.Anything,
+		mock.AnythingOfType("*model.DeadLetterFilter")).
+		Return(func(_ context.Context, filter *model.DeadLetterFilter) []*model.DeadLetter {
+			return store.list(filter)
+		}, func(_ context.Context, _ *model.DeadLetterFilter) int {
+			return len(store.deadLetters)
+		}, nil).Maybe()
+	esClient.On("GetDeadLetter", mock.Anything, mock.AnythingOfType("string")).
+		Return(func(_ context.Context, id string) *model.DeadLetter {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			return store.deadLetters[id]
+		}, nil).Maybe()
+	esClient.On("DeleteDeadLetter", mock.Anything, mock.AnythingOfType("string")).
+		Run(func(args mock.Arguments) {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			delete(store.deadLetters, args.String(1))
+		}).
+		Return(nil).Maybe()
+	esClient.On("IndexDevice", mock.Anything, mock.AnythingOfType("*model.Device")).
+		Return(func(_ context.Context, device *model.Device) error {
+			store.mu.Lock()
+			closed := store.closed
+			store.mu.Unlock()
+			if !closed && !store.rejected[device.GetID()] {
+				return nil
+			}
+			store.fail(&model.DeadLetter{
+				ID: model.DeadLetterID(device.GetTenantID(), device.GetID()),
+			})
+			if closed {
+				return errors.Wrap(elasticsearch.ErrIndexClosed, "closed")
+			}
+			return errors.Wrap(elasticsearch.ErrDocumentRejected, "mapping conflict")
+		}).Maybe()
+	return store
+}
+
+// fail records a rejection of the device of the dead letter
+func (s *deadLetterStore) fail(deadLetter *model.DeadLetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(time.Second)
+	if existing, ok := s.deadLetters[deadLetter.ID]; ok {
+		deadLetter = existing
+	}
+	deadLetter.Attempts++
+	deadLetter.LastFailedAt = s.now
+	s.deadLetters[deadLetter.ID] = deadLetter
+}
+
+func (s *deadLetterStore) list(filter *model.DeadLetterFilter) []*model.DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deadLetters := []*model.DeadLetter{}
+	for _, deadLetter := range s.deadLetters {
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].LastFailedAt.Before(deadLetters[j].LastFailedAt)
+	})
+	from := int((filter.Page - 1) * filter.PerPage)
+	if from > len(deadLetters) {
+		from = len(deadLetters)
+	}
+	to := from + int(filter.PerPage)
+	if to > len(deadLetters) {
+		to = len(deadLetters)
+	}
+	return deadLetters[from:to]
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	store := newDeadLetterStore(esClient, "tenant", 2, "001")
+
+	reporting := NewApp(esClient)
+	err := reporting.RetryDeadLetter(ctx, "tenant:002")
+	assert.Equal(t, ErrDeadLetterNotFound, err)
+
+	// the dead letters of a suspended tenant are kept
+	store.closed = true
+	err = reporting.RetryDeadLetter(ctx, "tenant:000")
+	assert.Equal(t, ErrDeviceRejected, errors.Cause(err))
+	assert.Contains(t, store.deadLetters, "tenant:000")
+	store.closed = false
+
+	err = reporting.RetryDeadLetter(ctx, "tenant:000")
+	assert.NoError(t, err)
+	assert.NotContains(t, store.deadLetters, "tenant:000")
+
+	err = reporting.RetryDeadLetter(ctx, "tenant:001")
+	assert.Equal(t, ErrDeviceRejected, errors.Cause(err))
+	if assert.Contains(t, store.deadLetters, "tenant:001") {
+		assert.Equal(t, 2, store.deadLetters["tenant:001"].Attempts)
+	}
+}
+
+func TestDiscardDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	store := newDeadLetterStore(esClient, "tenant", 1)
+
+	reporting := NewApp(esClient)
+	err := reporting.DiscardDeadLetter(ctx, "tenant:000")
+	assert.NoError(t, err)
+	assert.Empty(t, store.deadLetters)
+	esClient.AssertNotCalled(t, "IndexDevice", mock.Anything, mock.Anything)
+
+	err = reporting.DiscardDeadLetter(ctx, "tenant:000")
+	assert.Equal(t, ErrDeadLetterNotFound, err)
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	// more dead letters than a batch, some rejected again
+	store := newDeadLetterStore(esClient, "tenant", replayBatchSize+50,
+		"000", "001", "120")
+
+	reporting := NewApp(esClient)
+	result, err := reporting.ReplayDeadLetters(ctx, "tenant")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.ReplayResult{
+		Indexed:  replayBatchSize + 47,
+		Rejected: 3,
+	}, result)
+	assert.Len(t, store.deadLetters, 3)
+	for _, deadLetter := range store.deadLetters {
+		assert.Equal(t, 2, deadLetter.Attempts)
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package reporting
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+var (
+	// ErrTenantNotFound is returned when the tenant does not exist
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrTenantDeleting is returned when the operation conflicts with the
+	// deletion of the tenant
+	ErrTenantDeleting = errors.New("tenant is being deleted")
+)
+
+// tenantDeletions tracks the tenant deletions running in background
+type tenantDeletions struct {
+	mu      sync.Mutex
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+// start marks the deletion of the tenant as running, and returns false if
+// it already is
+func (d *tenantDeletions) start(tenantID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running == nil {
+		d.running = make(map[string]bool)
+	}
+	if d.running[tenantID] {
+		return false
+	}
+	d.running[tenantID] = true
+	d.wg.Add(1)
+	return true
+}
+
+func (d *tenantDeletions) done(tenantID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.running, tenantID)
+	d.wg.Done()
+}
+
+// GetTenant returns the tenant, or ErrTenantNotFound
+func (a *app) GetTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	tenant, err := a.esClient.GetTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	} else if tenant == nil {
+		return nil, ErrTenantNotFound
+	}
+	return tenant, nil
+}
+
+// ProvisionTenant creates the indices of the tenant with the settings of its
+// tier and marks it as active; provisioning an existing tenant updates its
+// tier, but not the settings of the existing indices
+func (a *app) ProvisionTenant(ctx context.Context,
+	params *model.ProvisionTenantParams) (*model.Tenant, error) {
+	now := time.Now().UTC()
+	tenant, err := a.esClient.GetTenant(ctx, params.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tenant == nil, tenant.Status == model.TenantStatusDeleted:
+		tenant = &model.Tenant{
+			ID:        params.TenantID,
+			Status:    model.TenantStatusActive,
+			CreatedAt: now,
+		}
+	case tenant.Status == model.TenantStatusDeleting:
+		return nil, ErrTenantDeleting
+	}
+
+	settings, ok := a.tierIndexSettings[params.Tier]
+	if !ok {
+		return nil, errors.Errorf("no index settings for tier %q", params.Tier)
+	}
+	err = a.esClient.CreateTenantIndices(ctx, params.TenantID, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant.Tier = params.Tier
+	tenant.UpdatedAt = now
+	if err := a.esClient.SaveTenant(ctx, tenant); err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// getOrCreateTenant returns the tenant, or a new active tenant for the
+// tenants whose indices were created implicitly by the indexer
+func (a *app) getOrCreateTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	tenant, err := a.esClient.GetTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	} else if tenant == nil {
+		now := time.Now().UTC()
+		tenant = &model.Tenant{
+			ID:        tenantID,
+			Status:    model.TenantStatusActive,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+	return tenant, nil
+}
+
+// SuspendTenant closes the indices of the tenant: its data is kept, but
+// the searches return no devices
+func (a *app) SuspendTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	tenant, err := a.getOrCreateTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	switch tenant.Status {
+	case model.TenantStatusDeleting, model.TenantStatusDeleted:
+		return nil, ErrTenantDeleting
+	}
+	if err := a.esClient.CloseTenantIndices(ctx, tenantID); err != nil {
+		return nil, err
+	}
+	tenant.Status = model.TenantStatusSuspended
+	tenant.UpdatedAt = time.Now().UTC()
+	if err := a.esClient.SaveTenant(ctx, tenant); err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// ResumeTenant reopens the indices of a suspended tenant, and replays its
+// dead letters, holding the devices written while it was suspended
+func (a *app) ResumeTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	tenant, err := a.GetTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	switch tenant.Status {
+	case model.TenantStatusDeleting, model.TenantStatusDeleted:
+		return nil, ErrTenantDeleting
+	}
+	if err := a.esClient.OpenTenantIndices(ctx, tenantID); err != nil {
+		return nil, err
+	}
+	tenant.Status = model.TenantStatusActive
+	tenant.UpdatedAt = time.Now().UTC()
+	if err := a.esClient.SaveTenant(ctx, tenant); err != nil {
+		return nil, err
+	}
+	result, err := a.ReplayDeadLetters(ctx, tenantID)
+	if err != nil {
+		log.FromContext(ctx).Errorf("failed to replay the dead letters of the "+
+			"tenant %s: %s", tenantID, err)
+	} else if result.Indexed > 0 || result.Rejected > 0 {
+		log.FromContext(ctx).Infof("tenant %s resumed: %d dead letters indexed, "+
+			"%d rejected", tenantID, result.Indexed, result.Rejected)
+	}
+	return tenant, nil
+}
+
+// DeleteTenant marks the tenant as being deleted and starts the deletion of
+// its data in background, returning the tenant with the deletion progress.
+// The deletion is idempotent: deleting a tenant being deleted resumes the
+// interrupted deletion, or returns the progress of the running one.
+func (a *app) DeleteTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	tenant, err := a.getOrCreateTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	switch tenant.Status {
+	case model.TenantStatusDeleted:
+		return tenant, nil
+	case model.TenantStatusDeleting:
+	default:
+		now := time.Now().UTC()
+		tenant.Status = model.TenantStatusDeleting
+		tenant.UpdatedAt = now
+		tenant.Deletion = &model.TenantDeletion{
+			StartedAt: now,
+			Deleted:   []string{},
+		}
+		if err := a.esClient.SaveTenant(ctx, tenant); err != nil {
+			return nil, err
+		}
+	}
+	a.startTenantDeletion(tenant)
+	return tenant, nil
+}
+
+// ResumeTenantDeletions resumes the deletions of the tenants interrupted by
+// a restart of the service
+func (a *app) ResumeTenantDeletions(ctx context.Context) error {
+	tenants, err := a.esClient.SearchTenants(ctx, model.TenantStatusDeleting)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		a.startTenantDeletion(tenant)
+	}
+	return nil
+}
+
+func (a *app) startTenantDeletion(tenant *model.Tenant) {
+	if tenant.Deletion == nil {
+		// a tenant being deleted without progress, e.g. written by hand
+		tenant.Deletion = &model.TenantDeletion{
+			StartedAt: time.Now().UTC(),
+			Deleted:   []string{},
+		}
+	}
+	if !a.deletions.start(tenant.ID) {
+		return
+	}
+	// copy the tenant, as the caller renders it while the deletion runs
+	deletion := *tenant.Deletion
+	deletion.Deleted = append([]string{}, tenant.Deletion.Deleted...)
+	job := *tenant
+	job.Deletion = &deletion
+	go func() {
+		defer a.deletions.done(job.ID)
+		ctx := context.Background()
+		if err := a.deleteTenant(ctx, &job); err != nil {
+			log.FromContext(ctx).Errorf(
+				"failed to delete the tenant %q: %s", job.ID, err)
+		}
+	}()
+}
+
+// deleteTenant deletes the data of the tenant not deleted yet, saving the
+// progress after each step
+func (a *app) deleteTenant(ctx context.Context, tenant *model.Tenant) error {
+	tenant.Deletion.Attempts++
+	tenant.Deletion.Error = ""
+	for _, data := range model.TenantData {
+		if tenant.Deletion.IsDeleted(data) {
+			continue
+		}
+		err := a.esClient.DeleteTenantData(ctx, tenant.ID, data)
+		tenant.UpdatedAt = time.Now().UTC()
+		if err != nil {
+			tenant.Deletion.Error = err.Error()
+			if saveErr := a.esClient.SaveTenant(ctx, tenant); saveErr != nil {
+				return errors.Wrap(saveErr, err.Error())
+			}
+			return err
+		}
+		tenant.Deletion.Deleted = append(tenant.Deletion.Deleted, data)
+		if err := a.esClient.SaveTenant(ctx, tenant); err != nil {
+			return err
+		}
+	}
+	now := time.Now().UTC()
+	tenant.Status = model.TenantStatusDeleted
+	tenant.UpdatedAt = now
+	tenant.Deletion.FinishedAt = &now
+	return a.esClient.SaveTenant(ctx, tenant)
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/reporting/client/elasticsearch/mocks"
+	"github.com/mendersoftware/reporting/model"
+)
+
+// tenantStore stores the tenants saved through the mocked client
+type tenantStore struct {
+	mu      sync.Mutex
+	tenants map[string][]byte
+}
+
+func newTenantStore(esClient *mocks.Client) *tenantStore {
+	store := &tenantStore{tenants: make(map[string][]byte)}
+	esClient.On("GetTenant", mock.Anything, mock.AnythingOfType("string")).
+		Return(func(_ context.Context, tenantID string) *model.Tenant {
+			return store.get(tenantID)
+		}, nil).Maybe()
+	esClient.On("SaveTenant", mock.Anything, mock.AnythingOfType("*model.Tenant")).
+		Run(func(args mock.Arguments) {
+			store.save(args.Get(1).(*model.Tenant))
+		}).
+		Return(nil)
+	return store
+}
+
+func (s *tenantStore) get(tenantID string) *model.Tenant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.tenants[tenantID]
+	if !ok {
+		return nil
+	}
+	var tenant model.Tenant
+	_ = json.Unmarshal(data, &tenant)
+	return &tenant
+}
+
+func (s *tenantStore) save(tenant *model.Tenant) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants[tenant.ID], _ = json.Marshal(tenant)
+}
+
+func TestProvisionTenant(t *testing.T) {
+	ctx := context.Background()
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	store := newTenantStore(esClient)
+	esClient.On("CreateTenantIndices", ctx, "tenant",
+		model.IndexSettings{Shards: 2, Replicas: 1}).Return(nil)
+
+	reporting := NewApp(esClient)
+	tenant, err := reporting.ProvisionTenant(ctx, &model.ProvisionTenantParams{
+		TenantID: "tenant",
+		Tier:     model.TierEnterprise,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant", tenant.ID)
+	assert.Equal(t, model.TierEnterprise, tenant.Tier)
+	assert.Equal(t, model.TenantStatusActive, tenant.Status)
+	assert.Equal(t, tenant.Tier, store.get("tenant").Tier)
+
+	store.save(&model.Tenant{ID: "deleting", Status: model.TenantStatusDeleting})
+	_, err = reporting.ProvisionTenant(ctx, &model.ProvisionTenantParams{
+		TenantID: "deleting",
+		Tier:     model.TierOS,
+	})
+	assert.Equal(t, ErrTenantDeleting, err)
+}
+
+func TestSuspendResumeTenant(t *testing.T) {
+	ctx := context.Background()
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	store := newTenantStore(esClient)
+	esClient.On("CloseTenantIndices", ctx, "tenant").Return(nil)
+	esClient.On("OpenTenantIndices", ctx, "tenant").Return(nil)
+	// the devices written while the tenant was suspended
+	deadLetters := newDeadLetterStore(esClient, "tenant", 2)
+
+	reporting := NewApp(esClient)
+	_, err := reporting.ResumeTenant(ctx, "tenant")
+	assert.Equal(t, ErrTenantNotFound, err)
+
+	// the tenants created implicitly by the indexer can be suspended
+	tenant, err := reporting.SuspendTenant(ctx, "tenant")
+	assert.NoError(t, err)
+	assert.Equal(t, model.TenantStatusSuspended, tenant.Status)
+	assert.Equal(t, model.TenantStatusSuspended, store.get("tenant").Status)
+
+	tenant, err = reporting.ResumeTenant(ctx, "tenant")
+	assert.NoError(t, err)
+	assert.Equal(t, model.TenantStatusActive, tenant.Status)
+	assert.Empty(t, deadLetters.deadLetters)
+
+	store.save(&model.Tenant{ID: "deleted", Status: model.TenantStatusDeleted})
+	_, err = reporting.SuspendTenant(ctx, "deleted")
+	assert.Equal(t, ErrTenantDeleting, err)
+}
+
+func TestDeleteTenant(t *testing.T) {
+	ctx := context.Background()
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	store := newTenantStore(esClient)
+	esClient.On("DeleteTenantData", mock.Anything, "tenant",
+		model.TenantDataDevices).Return(nil).Once()
+	esClient.On("DeleteTenantData", mock.Anything, "tenant",
+		model.TenantDataHistory).Return(errors.New("timeout")).Once()
+
+	reporting := NewApp(esClient)
+	tenant, err := reporting.DeleteTenant(ctx, "tenant")
+	assert.NoError(t, err)
+	assert.Equal(t, model.TenantStatusDeleting, tenant.Status)
+	reporting.(*app).deletions.wg.Wait()
+
+	tenant = store.get("tenant")
+	assert.Equal(t, model.TenantStatusDeleting, tenant.Status)
+	assert.Equal(t, []string{model.TenantDataDevices}, tenant.Deletion.Deleted)
+	assert.Equal(t, 1, tenant.Deletion.Attempts)
+	assert.Equal(t, "timeout", tenant.Deletion.Error)
+
+	// deleting again resumes the interrupted deletion
+	esClient.On("DeleteTenantData", mock.Anything, "tenant",
+		model.TenantDataHistory).Return(nil).Once()
+	esClient.On("DeleteTenantData", mock.Anything, "tenant",
+		model.TenantDataDeployments).Return(nil).Once()
+	_, err = reporting.DeleteTenant(ctx, "tenant")
+	assert.NoError(t, err)
+	reporting.(*app).deletions.wg.Wait()
+
+	tenant = store.get("tenant")
+	assert.Equal(t, model.TenantStatusDeleted, tenant.Status)
+	assert.Equal(t, model.TenantData, tenant.Deletion.Deleted)
+	assert.Equal(t, 2, tenant.Deletion.Attempts)
+	assert.Empty(t, tenant.Deletion.Error)
+	assert.NotNil(t, tenant.Deletion.FinishedAt)
+
+	// deleting a deleted tenant is a no-op
+	tenant, err = reporting.DeleteTenant(ctx, "tenant")
+	assert.NoError(t, err)
+	assert.Equal(t, model.TenantStatusDeleted, tenant.Status)
+}
+
+func TestResumeTenantDeletions(t *testing.T) {
+	ctx := context.Background()
+	esClient := &mocks.Client{}
+	defer esClient.AssertExpectations(t)
+	store := newTenantStore(esClient)
+	esClient.On("SearchTenants", ctx, model.TenantStatusDeleting).
+		Return([]*model.Tenant{{
+			ID:     "tenant",
+			Status: model.TenantStatusDeleting,
+			Deletion: &model.TenantDeletion{
+				Deleted: []string{
+					model.TenantDataDevices,
+					model.TenantDataHistory,
+				},
+				Attempts: 1,
+			},
+		}, {
+			// without progress, e.g. written by hand
+			ID:     "legacy",
+			Status: model.TenantStatusDeleting,
+		}}, nil)
+	esClient.On("DeleteTenantData", mock.Anything, "tenant",
+		model.TenantDataDeployments).Return(nil).Once()
+	for _, data := range model.TenantData {
+		esClient.On("DeleteTenantData", mock.Anything, "legacy", data).
+			Return(nil).Once()
+	}
+
+	reporting := NewApp(esClient)
+	assert.NoError(t, reporting.ResumeTenantDeletions(ctx))
+	reporting.(*app).deletions.wg.Wait()
+	assert.Equal(t, model.TenantStatusDeleted, store.get("tenant").Status)
+	legacy := store.get("legacy")
+	assert.Equal(t, model.TenantStatusDeleted, legacy.Status)
+	assert.Equal(t, model.TenantData, legacy.Deletion.Deleted)
+	assert.Equal(t, 1, legacy.Deletion.Attempts)
+}
@@ -16,6 +16,7 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -26,10 +27,17 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mendersoftware/go-lib-micro/config"
 	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 
+	grpcapi "github.com/mendersoftware/reporting/api/grpc"
 	api "github.com/mendersoftware/reporting/api/http"
+	"github.com/mendersoftware/reporting/app/ratelimit"
+	"github.com/mendersoftware/reporting/app/reporting"
 	"github.com/mendersoftware/reporting/client/elasticsearch"
 	dconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/model"
 )
 
 func init() {
@@ -40,15 +48,50 @@ func init() {
 	}
 }
 
-// InitAndRun initializes the server and runs it
-func InitAndRun(conf config.Reader, esClient elasticsearch.Client) error {
+// InitAndRun initializes the server and runs it; on SIGHUP, it calls
+// reload to read the configuration again, and applies the reloadable
+// settings: the debug log and the rate limits
+func InitAndRun(conf config.Reader, esClient elasticsearch.Client,
+	reload func() error) error {
 	ctx := context.Background()
 
-	log.Setup(conf.GetBool(dconfig.SettingDebugLog))
+	setLogLevel(conf.GetBool(dconfig.SettingDebugLog))
 	l := log.FromContext(ctx)
+	values := dconfig.Values(conf)
+
+	model.SetQueryLimits(model.QueryLimits{
+		MaxBuckets:       conf.GetInt(dconfig.SettingMaxBuckets),
+		MaxFilterClauses: conf.GetInt(dconfig.SettingMaxFilterClauses),
+		MaxDepth:         conf.GetInt(dconfig.SettingMaxExpressionDepth),
+	})
+
+	tierIndexSettings, err := model.ParseTierIndexSettings(
+		conf.GetStringMap(dconfig.SettingIndexTiers), model.IndexSettings{
+			Shards:   conf.GetInt(dconfig.SettingIndexShards),
+			Replicas: conf.GetInt(dconfig.SettingIndexReplicas),
+		})
+	if err != nil {
+		return errors.Wrap(err, "invalid "+dconfig.SettingIndexTiers)
+	}
 
 	var listen = conf.GetString(dconfig.SettingListen)
-	var router = api.NewRouter()
+	var reportingApp = reporting.NewApp(esClient,
+		reporting.WithStaleDevicesThreshold(
+			conf.GetDuration(dconfig.SettingStaleDevicesThreshold)),
+		reporting.WithVersionAttributes(
+			dconfig.StringList(conf, dconfig.SettingVersionAttributes)),
+		reporting.WithTierIndexSettings(tierIndexSettings))
+	if err := reportingApp.ResumeTenantDeletions(ctx); err != nil {
+		l.Errorf("failed to resume the tenant deletions: %s", err)
+	}
+
+	limits, overrides, err := rateLimits(conf)
+	if err != nil {
+		return err
+	}
+	limiter := ratelimit.NewLimiter(limits, overrides)
+
+	var router = api.NewRouter(reportingApp, api.WithRateLimiter(limiter))
 	srv := &http.Server{
 		Addr:    listen,
 		Handler: router,
@@ -60,9 +103,33 @@ func InitAndRun(conf config.Reader, esClient elasticsearch.Client) error {
 		}
 	}()
 
+	var grpcSrv *grpc.Server
+	if grpcListen := conf.GetString(dconfig.SettingGRPCListen); grpcListen != "" {
+		lis, err := net.Listen("tcp", grpcListen)
+		if err != nil {
+			return errors.Wrap(err, "failed to listen for gRPC")
+		}
+		grpcSrv = grpcapi.NewServer(reportingApp, grpcapi.WithRateLimiter(limiter)...)
+		go func() {
+			if err := grpcSrv.Serve(lis); err != nil {
+				l.Fatalf("listen gRPC: %s\n", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, unix.SIGINT, unix.SIGTERM)
-	<-quit
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, unix.SIGHUP)
+	defer signal.Stop(hup)
+	for running := true; running; {
+		select {
+		case <-hup:
+			values = reloadSettings(ctx, conf, reload, limiter, values)
+		case <-quit:
+			running = false
+		}
+	}
 
 	l.Info("Shutdown Server ...")
 
@@ -71,6 +138,74 @@ func InitAndRun(conf config.Reader, esClient elasticsearch.Client) error {
 	if err := srv.Shutdown(ctxWithTimeout); err != nil {
 		l.Fatal("Server Shutdown: ", err)
 	}
+	if grpcSrv != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctxWithTimeout.Done():
+			grpcSrv.Stop()
+		}
+	}
 
 	return nil
 }
+
+func setLogLevel(debug bool) {
+	if debug {
+		log.Log.SetLevel(logrus.DebugLevel)
+	} else {
+		log.Log.SetLevel(logrus.InfoLevel)
+	}
+}
+
+// rateLimits returns the default rate limits and the per-tenant overrides
+func rateLimits(conf config.Reader) (model.RateLimits, map[string]model.RateLimits, error) {
+	limits := model.RateLimits{
+		Rate:        conf.GetFloat64(dconfig.SettingRateLimitRate),
+		Burst:       conf.GetInt(dconfig.SettingRateLimitBurst),
+		Concurrency: conf.GetInt(dconfig.SettingRateLimitConcurrency),
+	}
+	overrides, err := model.ParseRateLimitOverrides(
+		conf.GetStringMap(dconfig.SettingRateLimitTenants), limits)
+	if err != nil {
+		return limits, nil, errors.Wrap(err, "invalid "+dconfig.SettingRateLimitTenants)
+	}
+	return limits, overrides, nil
+}
+
+// reloadSettings reloads the configuration and applies the reloadable
+// settings, warning about the changes of the other settings, which require
+// a restart; an invalid configuration is not applied. It returns the
+// values of the settings applied.
+func reloadSettings(ctx context.Context, conf config.Reader, reload func() error,
+	limiter *ratelimit.Limiter, applied []*dconfig.Value) []*dconfig.Value {
+	l := log.FromContext(ctx)
+	if reload != nil {
+		if err := reload(); err != nil {
+			l.Errorf("configuration not reloaded: %s", err)
+			return applied
+		}
+	}
+	limits, overrides, err := rateLimits(conf)
+	if err != nil {
+		l.Errorf("configuration not reloaded: %s", err)
+		return applied
+	}
+	setLogLevel(conf.GetBool(dconfig.SettingDebugLog))
+	limiter.SetLimits(limits, overrides)
+
+	values := dconfig.Values(conf)
+	for i, value := range values {
+		if value.Reloadable {
+			applied[i] = value
+		} else if value.String() != applied[i].String() {
+			l.Warnf("%s changed; restart the server to apply it", value.Key)
+		}
+	}
+	l.Info("configuration reloaded")
+	return applied
+}
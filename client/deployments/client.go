@@ -0,0 +1,165 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package deployments
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	URIDeviceDeployments = "/api/internal/v1/deployments/tenants/:tenant/deployments/devices"
+
+	defaultTimeout = 10 * time.Second
+)
+
+// perPage is the number of device deployments requested per page
+var perPage = 500
+
+// idsPerRequest is the number of device IDs of each request, sent as query
+// parameters and kept well below the URL length limits
+var idsPerRequest = 50
+
+// Client is the deployments service client
+type Client interface {
+	GetDeviceDeployments(ctx context.Context, tenantID string,
+		deviceIDs []string) ([]*model.DeviceDeployment, error)
+}
+
+type client struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewClient returns a new deployments service client
+func NewClient(baseURL string) Client {
+	return &client{
+		client:  &http.Client{Timeout: defaultTimeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+type deployment struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	ArtifactName string     `json:"artifact_name"`
+	Status       string     `json:"status"`
+	Created      *time.Time `json:"created"`
+	Finished     *time.Time `json:"finished"`
+}
+
+type deviceDeployment struct {
+	ID         string      `json:"id"`
+	Deployment *deployment `json:"deployment"`
+	Device     struct {
+		ID       string     `json:"id"`
+		Status   string     `json:"status"`
+		Created  *time.Time `json:"created"`
+		Finished *time.Time `json:"finished"`
+	} `json:"device"`
+}
+
+// GetDeviceDeployments returns the deployments of the given devices,
+// requesting the pages of the device deployments until the last one, for
+// each chunk of idsPerRequest devices
+func (c *client) GetDeviceDeployments(ctx context.Context, tenantID string,
+	deviceIDs []string) ([]*model.DeviceDeployment, error) {
+	result := []*model.DeviceDeployment{}
+	for start := 0; start < len(deviceIDs); start += idsPerRequest {
+		end := start + idsPerRequest
+		if end > len(deviceIDs) {
+			end = len(deviceIDs)
+		}
+		for page := 1; ; page++ {
+			deviceDeployments, err := c.getDeviceDeploymentsPage(ctx, tenantID,
+				deviceIDs[start:end], page)
+			if err != nil {
+				return nil, err
+			}
+			for _, dd := range deviceDeployments {
+				result = append(result, dd.toModel(tenantID))
+			}
+			if len(deviceDeployments) < perPage {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (c *client) getDeviceDeploymentsPage(ctx context.Context, tenantID string,
+	deviceIDs []string, page int) ([]deviceDeployment, error) {
+	query := url.Values{}
+	for _, id := range deviceIDs {
+		query.Add("id", id)
+	}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+	uri := c.baseURL + strings.Replace(URIDeviceDeployments, ":tenant",
+		url.PathEscape(tenantID), 1) + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the request")
+	}
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the device deployments")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf(
+			"failed to get the device deployments: unexpected status code %d",
+			rsp.StatusCode)
+	}
+
+	var deviceDeployments []deviceDeployment
+	if err := json.NewDecoder(rsp.Body).Decode(&deviceDeployments); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	return deviceDeployments, nil
+}
+
+func (dd *deviceDeployment) toModel(tenantID string) *model.DeviceDeployment {
+	d := &model.DeviceDeployment{
+		ID:       dd.ID,
+		TenantID: tenantID,
+		DeviceID: dd.Device.ID,
+		Status:   dd.Device.Status,
+		Created:  dd.Device.Created,
+		Finished: dd.Device.Finished,
+	}
+	if dd.Deployment != nil {
+		d.Deployment = &model.Deployment{
+			ID:           dd.Deployment.ID,
+			Name:         dd.Deployment.Name,
+			ArtifactName: dd.Deployment.ArtifactName,
+			Status:       dd.Deployment.Status,
+			Created:      dd.Deployment.Created,
+			Finished:     dd.Deployment.Finished,
+		}
+	}
+	return d
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package deployments
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestGetDeviceDeployments(t *testing.T) {
+	created := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		status int
+		body   string
+
+		deployments []*model.DeviceDeployment
+		err         string
+	}{
+		"ok": {
+			status: http.StatusOK,
+			body: `[{
+				"id": "dd1",
+				"deployment": {"id": "d1", "name": "release", "artifact_name": "release-1"},
+				"device": {"id": "1", "status": "failure", "created": "2021-06-01T12:00:00Z"}
+			}]`,
+			deployments: []*model.DeviceDeployment{
+				{
+					ID:       "dd1",
+					TenantID: "tenant",
+					DeviceID: "1",
+					Status:   model.DeploymentStatusFailure,
+					Created:  &created,
+					Deployment: &model.Deployment{
+						ID:           "d1",
+						Name:         "release",
+						ArtifactName: "release-1",
+					},
+				},
+			},
+		},
+		"ko, unexpected status code": {
+			status: http.StatusInternalServerError,
+			err:    "failed to get the device deployments: unexpected status code 500",
+		},
+		"ko, malformed body": {
+			status: http.StatusOK,
+			body:   "{",
+			err:    "failed to parse the response: unexpected EOF",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t,
+						"/api/internal/v1/deployments/tenants/tenant/deployments/devices",
+						r.URL.Path)
+					assert.Equal(t, []string{"1", "2"}, r.URL.Query()["id"])
+					w.WriteHeader(tc.status)
+					_, _ = w.Write([]byte(tc.body))
+				}))
+			defer srv.Close()
+
+			client := NewClient(srv.URL)
+			deployments, err := client.GetDeviceDeployments(context.Background(),
+				"tenant", []string{"1", "2"})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.deployments, deployments)
+			}
+		})
+	}
+}
+
+func TestGetDeviceDeploymentsPages(t *testing.T) {
+	pages := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			page := r.URL.Query().Get("page")
+			assert.Equal(t, "2", r.URL.Query().Get("per_page"))
+			pages = append(pages, page)
+			switch page {
+			case "1":
+				_, _ = w.Write([]byte(`[
+					{"id": "dd1", "device": {"id": "1"}},
+					{"id": "dd2", "device": {"id": "1"}}
+				]`))
+			case "2":
+				_, _ = w.Write([]byte(`[{"id": "dd3", "device": {"id": "2"}}]`))
+			default:
+				_, _ = w.Write([]byte(`[]`))
+			}
+		}))
+	defer srv.Close()
+
+	defer func(n int) { perPage = n }(perPage)
+	perPage = 2
+
+	client := NewClient(srv.URL)
+	deployments, err := client.GetDeviceDeployments(context.Background(),
+		"tenant", []string{"1", "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, pages)
+	ids := []string{}
+	for _, d := range deployments {
+		ids = append(ids, d.ID)
+	}
+	assert.Equal(t, []string{"dd1", "dd2", "dd3"}, ids)
+}
+
+func TestGetDeviceDeploymentsChunks(t *testing.T) {
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			ids := r.URL.Query()["id"]
+			requests = append(requests,
+				strings.Join(ids, ",")+"/"+r.URL.Query().Get("page"))
+			if r.URL.Query().Get("page") != "1" {
+				_, _ = w.Write([]byte(`[]`))
+				return
+			}
+			body := []string{}
+			for _, id := range ids {
+				body = append(body, `{"id": "dd`+id+`", "device": {"id": "`+id+`"}}`)
+			}
+			_, _ = w.Write([]byte("[" + strings.Join(body, ",") + "]"))
+		}))
+	defer srv.Close()
+
+	defer func(n, m int) { perPage, idsPerRequest = n, m }(perPage, idsPerRequest)
+	perPage, idsPerRequest = 2, 2
+
+	client := NewClient(srv.URL)
+	deployments, err := client.GetDeviceDeployments(context.Background(),
+		"tenant", []string{"1", "2", "3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1,2/1", "1,2/2", "3/1"}, requests)
+	ids := []string{}
+	for _, d := range deployments {
+		ids = append(ids, d.ID)
+	}
+	assert.Equal(t, []string{"dd1", "dd2", "dd3"}, ids)
+}
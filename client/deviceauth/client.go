@@ -0,0 +1,120 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package deviceauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	URIDevices = "/api/internal/v1/devauth/tenants/:tenant/devices"
+
+	defaultTimeout = 10 * time.Second
+)
+
+// idsPerRequest is the number of device IDs of each request, sent as query
+// parameters and kept well below the URL length limits
+var idsPerRequest = 50
+
+// Client is the deviceauth service client
+type Client interface {
+	GetCheckInTimes(ctx context.Context, tenantID string,
+		deviceIDs []string) (map[string]time.Time, error)
+}
+
+type client struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewClient returns a new deviceauth service client
+func NewClient(baseURL string) Client {
+	return &client{
+		client:  &http.Client{Timeout: defaultTimeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+type device struct {
+	ID          string     `json:"id"`
+	CheckInTime *time.Time `json:"check_in_time"`
+}
+
+// GetCheckInTimes returns the time the devices last authenticated, indexed
+// by device ID; devices which never authenticated are not returned. The
+// devices are requested in chunks of idsPerRequest devices.
+func (c *client) GetCheckInTimes(ctx context.Context, tenantID string,
+	deviceIDs []string) (map[string]time.Time, error) {
+	checkInTimes := make(map[string]time.Time, len(deviceIDs))
+	for start := 0; start < len(deviceIDs); start += idsPerRequest {
+		end := start + idsPerRequest
+		if end > len(deviceIDs) {
+			end = len(deviceIDs)
+		}
+		err := c.getCheckInTimes(ctx, tenantID, deviceIDs[start:end], checkInTimes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return checkInTimes, nil
+}
+
+// getCheckInTimes adds the check-in times of the devices to checkInTimes
+func (c *client) getCheckInTimes(ctx context.Context, tenantID string,
+	deviceIDs []string, checkInTimes map[string]time.Time) error {
+	query := url.Values{}
+	for _, id := range deviceIDs {
+		query.Add("id", id)
+	}
+	query.Set("per_page", strconv.Itoa(len(deviceIDs)))
+	uri := c.baseURL + strings.Replace(URIDevices, ":tenant",
+		url.PathEscape(tenantID), 1) + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the request")
+	}
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the devices")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return errors.Errorf(
+			"failed to get the devices: unexpected status code %d",
+			rsp.StatusCode)
+	}
+
+	var devices []device
+	if err := json.NewDecoder(rsp.Body).Decode(&devices); err != nil {
+		return errors.Wrap(err, "failed to parse the response")
+	}
+
+	for _, d := range devices {
+		if d.CheckInTime != nil {
+			checkInTimes[d.ID] = *d.CheckInTime
+		}
+	}
+	return nil
+}
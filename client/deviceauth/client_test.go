@@ -0,0 +1,106 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package deviceauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCheckInTimes(t *testing.T) {
+	checkIn := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		status int
+		body   string
+
+		checkInTimes map[string]time.Time
+		err          string
+	}{
+		"ok": {
+			status: http.StatusOK,
+			body: `[
+				{"id": "1", "check_in_time": "2021-06-01T12:00:00Z"},
+				{"id": "2"}
+			]`,
+			checkInTimes: map[string]time.Time{"1": checkIn},
+		},
+		"ko, unexpected status code": {
+			status: http.StatusInternalServerError,
+			err:    "failed to get the devices: unexpected status code 500",
+		},
+		"ko, malformed body": {
+			status: http.StatusOK,
+			body:   "{",
+			err:    "failed to parse the response: unexpected EOF",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t,
+						"/api/internal/v1/devauth/tenants/tenant/devices",
+						r.URL.Path)
+					assert.Equal(t, []string{"1", "2"}, r.URL.Query()["id"])
+					assert.Equal(t, "2", r.URL.Query().Get("per_page"))
+					w.WriteHeader(tc.status)
+					_, _ = w.Write([]byte(tc.body))
+				}))
+			defer srv.Close()
+
+			client := NewClient(srv.URL)
+			checkInTimes, err := client.GetCheckInTimes(context.Background(),
+				"tenant", []string{"1", "2"})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.checkInTimes, checkInTimes)
+			}
+		})
+	}
+}
+
+func TestGetCheckInTimesChunks(t *testing.T) {
+	requests := [][]string{}
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			ids := r.URL.Query()["id"]
+			requests = append(requests, ids)
+			assert.Equal(t, strconv.Itoa(len(ids)), r.URL.Query().Get("per_page"))
+			_, _ = w.Write([]byte(`[{"id": "` + ids[0] +
+				`", "check_in_time": "2021-06-01T12:00:00Z"}]`))
+		}))
+	defer srv.Close()
+
+	defer func(n int) { idsPerRequest = n }(idsPerRequest)
+	idsPerRequest = 2
+
+	client := NewClient(srv.URL)
+	checkInTimes, err := client.GetCheckInTimes(context.Background(),
+		"tenant", []string{"1", "2", "3"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"1", "2"}, {"3"}}, requests)
+	checkIn := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, map[string]time.Time{"1": checkIn, "3": checkIn}, checkInTimes)
+}
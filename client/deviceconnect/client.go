@@ -0,0 +1,158 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package deviceconnect
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	URIDevice = "/api/internal/v1/deviceconnect/tenants/:tenant/devices/:device"
+
+	defaultTimeout = 10 * time.Second
+
+	// maxConcurrency is the maximum number of requests in flight while
+	// getting the connection statuses of several devices, as the service
+	// has no endpoint returning the statuses of several devices at once
+	maxConcurrency = 8
+)
+
+// Client is the deviceconnect service client
+type Client interface {
+	GetConnectStatus(ctx context.Context, tenantID string,
+		deviceID string) (*model.ConnectStatus, error)
+	GetConnectStatuses(ctx context.Context, tenantID string,
+		deviceIDs []string) (map[string]*model.ConnectStatus, error)
+}
+
+type client struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewClient returns a new deviceconnect service client
+func NewClient(baseURL string) Client {
+	return &client{
+		client:  &http.Client{Timeout: defaultTimeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+type device struct {
+	ID        string     `json:"device_id"`
+	Status    string     `json:"status"`
+	UpdatedTs *time.Time `json:"updated_ts"`
+}
+
+// GetConnectStatus returns the connection status of the device, or nil if
+// the device never connected
+func (c *client) GetConnectStatus(ctx context.Context, tenantID string,
+	deviceID string) (*model.ConnectStatus, error) {
+	uri := c.baseURL + strings.NewReplacer(
+		":tenant", url.PathEscape(tenantID),
+		":device", url.PathEscape(deviceID),
+	).Replace(URIDevice)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the request")
+	}
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the device")
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Errorf(
+			"failed to get the device: unexpected status code %d",
+			rsp.StatusCode)
+	}
+
+	var d device
+	if err := json.NewDecoder(rsp.Body).Decode(&d); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+
+	return &model.ConnectStatus{
+		Status:    d.Status,
+		UpdatedAt: d.UpdatedTs,
+	}, nil
+}
+
+// GetConnectStatuses returns the connection statuses of the devices known
+// to the service, requesting at most maxConcurrency of them at once
+func (c *client) GetConnectStatuses(ctx context.Context, tenantID string,
+	deviceIDs []string) (map[string]*model.ConnectStatus, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	statuses := make(map[string]*model.ConnectStatus, len(deviceIDs))
+	sem := make(chan struct{}, maxConcurrency)
+	for _, deviceID := range deviceIDs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(deviceID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			status, err := c.GetConnectStatus(ctx, tenantID, deviceID)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+			} else if status != nil {
+				statuses[deviceID] = status
+			}
+		}(deviceID)
+	}
+	wg.Wait()
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = errors.Wrap(ctx.Err(), "failed to get the devices")
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return statuses, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package deviceconnect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestGetConnectStatus(t *testing.T) {
+	updated := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		status int
+		body   string
+
+		connectStatus *model.ConnectStatus
+		err           string
+	}{
+		"ok": {
+			status: http.StatusOK,
+			body: `{"device_id": "1", "status": "connected",
+				"updated_ts": "2021-06-01T12:00:00Z"}`,
+			connectStatus: &model.ConnectStatus{
+				Status:    "connected",
+				UpdatedAt: &updated,
+			},
+		},
+		"ok, unknown device": {
+			status: http.StatusNotFound,
+		},
+		"ko, unexpected status code": {
+			status: http.StatusInternalServerError,
+			err:    "failed to get the device: unexpected status code 500",
+		},
+		"ko, malformed body": {
+			status: http.StatusOK,
+			body:   "{",
+			err:    "failed to parse the response: unexpected EOF",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t,
+						"/api/internal/v1/deviceconnect/tenants/tenant/devices/1",
+						r.URL.Path)
+					w.WriteHeader(tc.status)
+					_, _ = w.Write([]byte(tc.body))
+				}))
+			defer srv.Close()
+
+			client := NewClient(srv.URL)
+			connectStatus, err := client.GetConnectStatus(context.Background(),
+				"tenant", "1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.connectStatus, connectStatus)
+			}
+		})
+	}
+}
+
+func TestGetConnectStatuses(t *testing.T) {
+	testCases := map[string]struct {
+		deviceIDs []string
+		failing   string
+
+		statuses map[string]*model.ConnectStatus
+		err      string
+	}{
+		"ok": {
+			deviceIDs: []string{"1", "2", "3", "unknown", "4", "5", "6", "7", "8", "9"},
+			statuses: map[string]*model.ConnectStatus{
+				"1": {Status: "connected"}, "2": {Status: "connected"},
+				"3": {Status: "connected"}, "4": {Status: "connected"},
+				"5": {Status: "connected"}, "6": {Status: "connected"},
+				"7": {Status: "connected"}, "8": {Status: "connected"},
+				"9": {Status: "connected"},
+			},
+		},
+		"ok, no devices": {
+			statuses: map[string]*model.ConnectStatus{},
+		},
+		"ko, request failure": {
+			deviceIDs: []string{"1", "2", "3"},
+			failing:   "2",
+			err:       "failed to get the device: unexpected status code 500",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			inFlight, maxInFlight := 0, 0
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					inFlight++
+					if inFlight > maxInFlight {
+						maxInFlight = inFlight
+					}
+					mu.Unlock()
+					defer func() {
+						mu.Lock()
+						inFlight--
+						mu.Unlock()
+					}()
+					time.Sleep(10 * time.Millisecond)
+
+					id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+					switch id {
+					case tc.failing:
+						w.WriteHeader(http.StatusInternalServerError)
+					case "unknown":
+						w.WriteHeader(http.StatusNotFound)
+					default:
+						_, _ = w.Write([]byte(`{"status": "connected"}`))
+					}
+				}))
+			defer srv.Close()
+
+			client := NewClient(srv.URL)
+			statuses, err := client.GetConnectStatuses(context.Background(),
+				"tenant", tc.deviceIDs)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.statuses, statuses)
+			}
+			assert.LessOrEqual(t, maxInFlight, maxConcurrency)
+		})
+	}
+}
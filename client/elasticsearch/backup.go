@@ -0,0 +1,232 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	scanBatchSize = 1000
+	scanKeepAlive = time.Minute
+)
+
+type scrollResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []struct {
+			ID     string          `json:"_id"`
+			Source json.RawMessage `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// tenantDataPrefix returns the prefix of the indices of the tenant data
+func tenantDataPrefix(data string) (string, error) {
+	prefix, ok := tenantDataIndices[data]
+	if !ok {
+		return "", errors.Errorf("unknown tenant data: %q", data)
+	}
+	return prefix, nil
+}
+
+// ScanTenantData sends each document of the tenant data, one of
+// model.TenantData, in no particular order
+func (e *ElasticsearchClient) ScanTenantData(ctx context.Context, tenantID, data string,
+	send func(doc *model.BackupDocument) error) error {
+	prefix, err := tenantDataPrefix(data)
+	if err != nil {
+		return err
+	}
+	size := scanBatchSize
+	ignoreUnavailable := true
+	req := esapi.SearchRequest{
+		Index:             []string{tenantIndex(prefix, tenantID)},
+		Sort:              []string{"_doc"},
+		Size:              &size,
+		Scroll:            scanKeepAlive,
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrapf(err, "failed to scan the tenant %s", data)
+	}
+	scrollID := ""
+	defer func() {
+		if scrollID != "" {
+			e.clearScroll(ctx, scrollID)
+		}
+	}()
+	for {
+		response, err := decodeScrollResponse(res, data)
+		if err != nil {
+			return err
+		}
+		scrollID = response.ScrollID
+		if len(response.Hits.Hits) == 0 {
+			return nil
+		}
+		for _, hit := range response.Hits.Hits {
+			err := send(&model.BackupDocument{
+				ID:     e.strategy.sourceID(tenantID, hit.ID),
+				Source: hit.Source,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		req := esapi.ScrollRequest{
+			Body: esutil.NewJSONReader(map[string]interface{}{
+				"scroll_id": scrollID,
+			}),
+			Scroll: scanKeepAlive,
+		}
+		res, err = req.Do(ctx, e.client)
+		if err != nil {
+			return errors.Wrapf(err, "failed to scan the tenant %s", data)
+		}
+	}
+}
+
+func decodeScrollResponse(res *esapi.Response, data string) (*scrollResponse, error) {
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.Errorf("failed to scan the tenant %s: %s", data, res.Status())
+	}
+	var response scrollResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	return &response, nil
+}
+
+func (e *ElasticsearchClient) clearScroll(ctx context.Context, scrollID string) {
+	req := esapi.ClearScrollRequest{
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"scroll_id": []string{scrollID},
+		}),
+	}
+	res, err := req.Do(ctx, e.client)
+	if err == nil {
+		res.Body.Close()
+	}
+}
+
+// RestoreTenantData indexes the documents of the tenant data, one of
+// model.TenantData, keeping their IDs
+func (e *ElasticsearchClient) RestoreTenantData(ctx context.Context, tenantID, data string,
+	docs []*model.BackupDocument) error {
+	prefix, err := tenantDataPrefix(data)
+	if err != nil {
+		return err
+	} else if len(docs) == 0 {
+		return nil
+	}
+	var body strings.Builder
+	for _, doc := range docs {
+		action, err := e.bulkIndexAction(ctx, prefix, tenantID, doc.ID)
+		if err != nil {
+			return err
+		}
+		actionJSON, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+		body.WriteString(string(actionJSON) + "\n" + string(doc.Source) + "\n")
+	}
+	req := esapi.BulkRequest{
+		Body: strings.NewReader(body.String()),
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrapf(err, "failed to restore the tenant %s", data)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to restore the tenant %s: %s", data, res.Status())
+	}
+	var response bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Wrap(err, "failed to parse the response")
+	}
+	if response.Errors {
+		for _, item := range response.Items {
+			for _, result := range item {
+				if result.Error != nil {
+					return errors.Errorf("failed to restore the document %s: %s",
+						result.ID, result.Error.Reason)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type countResponse struct {
+	Count int `json:"count"`
+}
+
+// CountTenantData refreshes the indices of the tenant data, one of
+// model.TenantData, and returns the number of its documents
+func (e *ElasticsearchClient) CountTenantData(ctx context.Context,
+	tenantID, data string) (int, error) {
+	prefix, err := tenantDataPrefix(data)
+	if err != nil {
+		return 0, err
+	}
+	index := []string{tenantIndex(prefix, tenantID)}
+	ignoreUnavailable := true
+	refresh := esapi.IndicesRefreshRequest{
+		Index:             index,
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := refresh.Do(ctx, e.client)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to refresh the tenant %s", data)
+	}
+	res.Body.Close()
+
+	req := esapi.CountRequest{
+		Index:             index,
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err = req.Do(ctx, e.client)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to count the tenant %s", data)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return 0, nil
+	} else if res.IsError() {
+		return 0, errors.Errorf("failed to count the tenant %s: %s", data, res.Status())
+	}
+	var response countResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, errors.Wrap(err, "failed to parse the response")
+	}
+	return response.Count, nil
+}
@@ -0,0 +1,303 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestScanTenantData(t *testing.T) {
+	testCases := map[string]struct {
+		strategy string
+		data     string
+		pages    []string
+		status   int
+		sendErr  error
+
+		ids      []string
+		requests []string
+		err      string
+	}{
+		"ok": {
+			data: model.TenantDataDevices,
+			pages: []string{
+				`{"_scroll_id": "scroll", "hits": {"hits": [
+					{"_id": "1", "_source": {"id": "1"}},
+					{"_id": "2", "_source": {"id": "2"}}
+				]}}`,
+				`{"_scroll_id": "scroll", "hits": {"hits": [
+					{"_id": "3", "_source": {"id": "3"}}
+				]}}`,
+				`{"_scroll_id": "scroll", "hits": {"hits": []}}`,
+			},
+			ids: []string{"1", "2", "3"},
+			requests: []string{
+				"POST /" + tenantIndex(indexDevices, "tenant") + "/_search",
+				"POST /_search/scroll",
+				"POST /_search/scroll",
+				"DELETE /_search/scroll",
+			},
+		},
+		"ok, shared": {
+			strategy: IndexStrategyShared,
+			data:     model.TenantDataDevices,
+			pages: []string{
+				`{"_scroll_id": "scroll", "hits": {"hits": [
+					{"_id": "tenant/1", "_source": {"id": "1"}}
+				]}}`,
+				`{"_scroll_id": "scroll", "hits": {"hits": []}}`,
+			},
+			ids: []string{"1"},
+			requests: []string{
+				"POST /" + tenantIndex(indexDevices, "tenant") + "/_search",
+				"POST /_search/scroll",
+				"DELETE /_search/scroll",
+			},
+		},
+		"ok, no documents": {
+			data: model.TenantDataHistory,
+			pages: []string{
+				`{"hits": {"hits": []}}`,
+			},
+			ids: []string{},
+			requests: []string{
+				"POST /" + tenantIndex(indexDeviceHistory, "tenant") + "/_search",
+			},
+		},
+		"ko, unknown data": {
+			data:     "searches",
+			ids:      []string{},
+			requests: []string{},
+			err:      `unknown tenant data: "searches"`,
+		},
+		"ko, error": {
+			data:   model.TenantDataDevices,
+			pages:  []string{`{}`},
+			status: http.StatusInternalServerError,
+			ids:    []string{},
+			requests: []string{
+				"POST /" + tenantIndex(indexDevices, "tenant") + "/_search",
+			},
+			err: "failed to scan the tenant devices: 500 Internal Server Error",
+		},
+		"ko, send error": {
+			data: model.TenantDataDevices,
+			pages: []string{
+				`{"_scroll_id": "scroll", "hits": {"hits": [
+					{"_id": "1", "_source": {"id": "1"}}
+				]}}`,
+			},
+			sendErr: errors.New("disk full"),
+			ids:     []string{"1"},
+			requests: []string{
+				"POST /" + tenantIndex(indexDevices, "tenant") + "/_search",
+				"DELETE /_search/scroll",
+			},
+			err: "disk full",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			page := 0
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				if r.Method == http.MethodDelete {
+					return http.StatusOK, ""
+				}
+				if tc.status != 0 {
+					return tc.status, ""
+				}
+				page++
+				return http.StatusOK, tc.pages[page-1]
+			})
+			if tc.strategy == "" {
+				tc.strategy = IndexStrategyPerTenant
+			}
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(tc.strategy),
+			)
+			assert.NoError(t, err)
+
+			ids := []string{}
+			err = client.ScanTenantData(context.Background(), "tenant", tc.data,
+				func(doc *model.BackupDocument) error {
+					ids = append(ids, doc.ID)
+					assert.JSONEq(t, `{"id": "`+doc.ID+`"}`, string(doc.Source))
+					return tc.sendErr
+				})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.ids, ids)
+			paths := []string{}
+			for _, req := range *requests {
+				paths = append(paths, req.Method+" "+req.Path)
+			}
+			assert.Equal(t, tc.requests, paths)
+		})
+	}
+}
+
+func TestRestoreTenantData(t *testing.T) {
+	docs := []*model.BackupDocument{
+		{ID: "1", Source: json.RawMessage(`{"id":"1"}`)},
+		{ID: "2", Source: json.RawMessage(`{"id":"2"}`)},
+	}
+	testCases := map[string]struct {
+		strategy string
+		docs     []*model.BackupDocument
+		response string
+
+		index    string
+		routing  string
+		idPrefix string
+		err      string
+	}{
+		"ok, per-tenant": {
+			strategy: IndexStrategyPerTenant,
+			docs:     docs,
+			response: `{"errors": false, "items": []}`,
+			index:    tenantIndex(indexDevices, "tenant"),
+		},
+		"ok, shared": {
+			strategy: IndexStrategyShared,
+			docs:     docs,
+			response: `{"errors": false, "items": []}`,
+			index:    sharedIndex(indexDevices),
+			routing:  "tenant",
+			idPrefix: "tenant/",
+		},
+		"ok, no documents": {
+			strategy: IndexStrategyPerTenant,
+		},
+		"ko, rejected": {
+			strategy: IndexStrategyPerTenant,
+			docs:     docs,
+			response: `{"errors": true, "items": [
+				{"index": {"_id": "1", "status": 200}},
+				{"index": {"_id": "2", "status": 400, "error": {
+					"type": "mapper_parsing_exception",
+					"reason": "failed to parse field [location]"
+				}}}
+			]}`,
+			index: tenantIndex(indexDevices, "tenant"),
+			err:   "failed to restore the document 2: failed to parse field [location]",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				if r.Path == "/_bulk" {
+					return http.StatusOK, tc.response
+				}
+				return http.StatusOK, ""
+			})
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(tc.strategy),
+			)
+			assert.NoError(t, err)
+
+			err = client.RestoreTenantData(context.Background(), "tenant",
+				model.TenantDataDevices, tc.docs)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			bulks := 0
+			for _, req := range *requests {
+				if req.Path != "/_bulk" {
+					continue
+				}
+				bulks++
+				actions := bulkActions(req.Body)
+				assert.Len(t, actions, len(tc.docs))
+				for i, action := range actions {
+					assert.Equal(t, tc.idPrefix+tc.docs[i].ID, action.Index.ID)
+					assert.Equal(t, tc.index, action.Index.Index)
+					assert.Equal(t, tc.routing, action.Index.Routing)
+				}
+				assert.True(t, strings.Contains(req.Body, `{"id":"1"}`))
+			}
+			if len(tc.docs) == 0 {
+				assert.Equal(t, 0, bulks)
+			} else {
+				assert.Equal(t, 1, bulks)
+			}
+		})
+	}
+}
+
+func TestCountTenantData(t *testing.T) {
+	testCases := map[string]struct {
+		status   int
+		response string
+
+		count int
+		err   string
+	}{
+		"ok": {
+			status:   http.StatusOK,
+			response: `{"count": 42}`,
+			count:    42,
+		},
+		"ok, not found": {
+			status: http.StatusNotFound,
+		},
+		"ko": {
+			status: http.StatusInternalServerError,
+			err:    "failed to count the tenant deployments: 500 Internal Server Error",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				if strings.HasSuffix(r.Path, "/_count") {
+					return tc.status, tc.response
+				}
+				return http.StatusOK, ""
+			})
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(IndexStrategyPerTenant),
+			)
+			assert.NoError(t, err)
+
+			count, err := client.CountTenantData(context.Background(), "tenant",
+				model.TenantDataDeployments)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.count, count)
+			index := "/" + tenantIndex(indexDeployments, "tenant")
+			assert.Equal(t, index+"/_refresh", (*requests)[0].Path)
+			assert.Equal(t, index+"/_count", (*requests)[1].Path)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	indexIndexerState         = "reporting-indexer-state"
+	indexIndexerStateTemplate = `{
+	"index_patterns": ["reporting-indexer-state"],
+	"priority": 1,
+	"template": {
+		"settings": {
+			"number_of_shards": 1,
+			"number_of_replicas": 1
+		},
+		"mappings": {
+			"_source": {
+				"enabled": true
+			},
+			"dynamic": false,
+			"properties": {
+				"id": {
+					"type": "keyword"
+				},
+				"startedAt": {
+					"type": "date"
+				},
+				"updatedAt": {
+					"type": "date"
+				},
+				"finishedAt": {
+					"type": "date"
+				}
+			}
+		}
+	}
+}`
+)
+
+type getCheckpointResponse struct {
+	Found  bool              `json:"found"`
+	Source *model.Checkpoint `json:"_source"`
+}
+
+// GetCheckpoint returns the checkpoint, or nil if not found
+func (e *ElasticsearchClient) GetCheckpoint(ctx context.Context,
+	id string) (*model.Checkpoint, error) {
+	req := esapi.GetRequest{
+		Index:      indexIndexerState,
+		DocumentID: id,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the checkpoint")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if res.IsError() {
+		return nil, errors.Errorf("failed to get the checkpoint: %s", res.Status())
+	}
+
+	var response getCheckpointResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	if !response.Found {
+		return nil, nil
+	}
+	return response.Source, nil
+}
+
+// SaveCheckpoint creates or replaces the checkpoint
+func (e *ElasticsearchClient) SaveCheckpoint(ctx context.Context,
+	checkpoint *model.Checkpoint) error {
+	req := esapi.IndexRequest{
+		Index:      indexIndexerState,
+		DocumentID: checkpoint.ID,
+		Body:       esutil.NewJSONReader(checkpoint),
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to save the checkpoint")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to save the checkpoint: %s", res.Status())
+	}
+	return nil
+}
@@ -17,7 +17,9 @@ package elasticsearch
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"strings"
+	"time"
 
 	es "github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
@@ -34,8 +36,21 @@ const (
 	"priority": 1,
 	"template": {
 		"settings": {
-			"number_of_shards": 1,
-			"number_of_replicas": 1
+			"analysis": {
+				"normalizer": {
+					"lowercase": {
+						"type": "custom",
+						"filter": ["lowercase"]
+					}
+				},
+				"analyzer": {
+					"device_text": {
+						"type": "custom",
+						"tokenizer": "standard",
+						"filter": ["lowercase", "asciifolding"]
+					}
+				}
+			}
 		},
 		"mappings": {
 			"_source": {
@@ -49,7 +64,17 @@ const (
 					"type": "keyword"
 				},
 				"name": {
-					"type": "keyword"
+					"type": "keyword",
+					"fields": {
+						"text": {
+							"type": "text",
+							"analyzer": "device_text"
+						},
+						"lowercase": {
+							"type": "keyword",
+							"normalizer": "lowercase"
+						}
+					}
 				},
 				"groupName": {
 					"type": "keyword"
@@ -78,10 +103,26 @@ const (
 							"type": "keyword"
 						},
 						"string": {
-							"type": "keyword"
+							"type": "keyword",
+							"fields": {
+								"text": {
+									"type": "text",
+									"analyzer": "device_text"
+								},
+								"lowercase": {
+									"type": "keyword",
+									"normalizer": "lowercase"
+								}
+							}
 						},
 						"numeric": {
 							"type": "double"
+						},
+						"ip": {
+							"type": "ip"
+						},
+						"network": {
+							"type": "keyword"
 						}
 					}
 				},
@@ -92,10 +133,29 @@ const (
 							"type": "keyword"
 						},
 						"string": {
-							"type": "keyword"
+							"type": "keyword",
+							"fields": {
+								"text": {
+									"type": "text",
+									"analyzer": "device_text"
+								},
+								"lowercase": {
+									"type": "keyword",
+									"normalizer": "lowercase"
+								}
+							}
 						},
 						"numeric": {
 							"type": "double"
+						},
+						"ip": {
+							"type": "ip"
+						},
+						"network": {
+							"type": "keyword"
+						},
+						"version": {
+							"type": "keyword"
 						}
 					}
 				},
@@ -104,6 +164,36 @@ const (
 				},
 				"updatedAt": {
 					"type": "date"
+				},
+				"lastDeploymentID": {
+					"type": "keyword"
+				},
+				"lastDeploymentName": {
+					"type": "keyword"
+				},
+				"lastDeploymentArtifact": {
+					"type": "keyword"
+				},
+				"lastDeploymentStatus": {
+					"type": "keyword"
+				},
+				"lastDeploymentFinished": {
+					"type": "date"
+				},
+				"lastCheckIn": {
+					"type": "date"
+				},
+				"connectStatus": {
+					"type": "keyword"
+				},
+				"connectUpdatedAt": {
+					"type": "date"
+				},
+				"lastSeen": {
+					"type": "date"
+				},
+				"location": {
+					"type": "geo_point"
 				}
 			}
 		}
@@ -111,15 +201,71 @@ const (
 }`
 )
 
+// indexTemplates are the templates of the indices; the templates of the
+// tenant data indices get the index settings of the client, and the
+// lifecycle policy, if any
+var indexTemplates = []struct {
+	name            string
+	body            string
+	tenantData      bool
+	lifecyclePolicy string
+}{
+	{name: indexDevices, body: indexDevicesTemplate, tenantData: true},
+	{name: indexDeviceHistory, body: indexDeviceHistoryTemplate, tenantData: true,
+		lifecyclePolicy: lifecyclePolicyHistory},
+	{name: indexDeployments, body: indexDeploymentsTemplate, tenantData: true},
+	{name: indexTenants, body: indexTenantsTemplate},
+	{name: indexDeadLetters, body: indexDeadLettersTemplate},
+	{name: indexIndexerState, body: indexIndexerStateTemplate},
+}
+
 type Client interface {
 	IndexDevice(ctx context.Context, device *model.Device) error
 	BulkIndexDevices(ctx context.Context, devices []*model.Device) error
+	GetDevices(ctx context.Context, tenantID string, deviceIDs []string) ([]*model.Device, error)
+	DeleteDevices(ctx context.Context, tenantID string, deviceIDs []string) error
+	SearchDevices(ctx context.Context, tenantID string, query model.Query) ([]*model.Device, int, error)
+	AggregateDevices(ctx context.Context, tenantID string, query model.Query) (json.RawMessage, int, error)
+	BulkIndexDeviceDeployments(ctx context.Context, deployments []*model.DeviceDeployment) error
+	BulkIndexHistory(ctx context.Context, changes []*model.AttributeChange) error
+	GetDeviceHistory(ctx context.Context, tenantID string, deviceID string,
+		filter *model.HistoryFilter) ([]*model.AttributeChange, int, error)
+	DeleteHistoryBefore(ctx context.Context, before time.Time) error
+	CreateTenantIndices(ctx context.Context, tenantID string, settings model.IndexSettings) error
+	OpenTenantIndices(ctx context.Context, tenantID string) error
+	CloseTenantIndices(ctx context.Context, tenantID string) error
+	DeleteTenantData(ctx context.Context, tenantID string, data string) error
+	GetTenant(ctx context.Context, tenantID string) (*model.Tenant, error)
+	SaveTenant(ctx context.Context, tenant *model.Tenant) error
+	SearchTenants(ctx context.Context, status string) ([]*model.Tenant, error)
+	ListTenantIDs(ctx context.Context, strategy string) ([]string, error)
+	MigrateTenant(ctx context.Context, tenantID, from string) error
+	ListDeadLetters(ctx context.Context,
+		filter *model.DeadLetterFilter) ([]*model.DeadLetter, int, error)
+	GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, id string) error
+	GetCheckpoint(ctx context.Context, id string) (*model.Checkpoint, error)
+	SaveCheckpoint(ctx context.Context, checkpoint *model.Checkpoint) error
+	AcquireLease(ctx context.Context, id, holder string, duration time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, id, holder string) error
+	ScanTenantData(ctx context.Context, tenantID, data string,
+		send func(doc *model.BackupDocument) error) error
+	RestoreTenantData(ctx context.Context, tenantID, data string,
+		docs []*model.BackupDocument) error
+	CountTenantData(ctx context.Context, tenantID, data string) (int, error)
+	IndexSizes(ctx context.Context) ([]*model.IndexSize, error)
+	SplitIndex(ctx context.Context, index string, shards int) error
 	Migrate(ctx context.Context) error
 }
 
 type ElasticsearchClient struct {
-	addresses []string
-	client    *es.Client
+	addresses     []string
+	queryTimeout  time.Duration
+	indexStrategy string
+	indexSettings model.IndexSettings
+	historyPolicy json.RawMessage
+	strategy      indexStrategy
+	client        *es.Client
 }
 
 type ElasticsearchClientOption func(*ElasticsearchClient)
@@ -130,8 +276,68 @@ func WithServerAddresses(addresses []string) ElasticsearchClientOption {
 	}
 }
 
+// WithQueryTimeout sets the timeout of the device searches and
+// aggregations; Elasticsearch returns the partial results collected within
+// the timeout, and the request is aborted if no response is received
+// shortly after it
+func WithQueryTimeout(timeout time.Duration) ElasticsearchClientOption {
+	return func(c *ElasticsearchClient) {
+		c.queryTimeout = timeout
+	}
+}
+
+// WithIndexStrategy sets the strategy mapping the data of the tenants to
+// indices: IndexStrategyPerTenant (the default) or IndexStrategyShared
+func WithIndexStrategy(strategy string) ElasticsearchClientOption {
+	return func(c *ElasticsearchClient) {
+		c.indexStrategy = strategy
+	}
+}
+
+// WithIndexSettings sets the default settings of the tenant indices, set
+// in their templates by Migrate
+func WithIndexSettings(settings model.IndexSettings) ElasticsearchClientOption {
+	return func(c *ElasticsearchClient) {
+		c.indexSettings = settings
+	}
+}
+
+// WithHistoryLifecyclePolicy sets the ILM policy of the history indices,
+// put by Migrate; defaults to defaultHistoryPolicy
+func WithHistoryLifecyclePolicy(policy json.RawMessage) ElasticsearchClientOption {
+	return func(c *ElasticsearchClient) {
+		c.historyPolicy = policy
+	}
+}
+
+// queryTimeoutGrace is the time allowed to Elasticsearch to respond after
+// the query timeout
+const queryTimeoutGrace = 5 * time.Second
+
+// withQueryTimeout applies the query timeout to the search request and
+// returns the context bounding the request
+func (e *ElasticsearchClient) withQueryTimeout(ctx context.Context,
+	req *esapi.SearchRequest) (context.Context, context.CancelFunc) {
+	if e.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	req.Timeout = e.queryTimeout
+	return context.WithTimeout(ctx, e.queryTimeout+queryTimeoutGrace)
+}
+
+// queryStatus is the status of a search or aggregation in the response
+type queryStatus struct {
+	TimedOut bool `json:"timed_out"`
+	Shards   struct {
+		Failed int `json:"failed"`
+	} `json:"_shards"`
+}
+
 func NewClient(opts ...ElasticsearchClientOption) (Client, error) {
-	client := &ElasticsearchClient{}
+	client := &ElasticsearchClient{
+		indexSettings: model.DefaultIndexSettings,
+		historyPolicy: json.RawMessage(defaultHistoryPolicy),
+	}
 	for _, opt := range opts {
 		opt(client)
 	}
@@ -144,20 +350,31 @@ func NewClient(opts ...ElasticsearchClientOption) (Client, error) {
 		return nil, errors.Wrap(err, "invalid Elasticsearch configuration")
 	}
 
+	strategy, err := newIndexStrategy(client.indexStrategy, esClient)
+	if err != nil {
+		return nil, err
+	}
+
 	_, err = esClient.Ping()
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to connect to Elasticsearch")
 	}
 
 	client.client = esClient
+	client.strategy = strategy
 	return client, nil
 }
 
 func (e *ElasticsearchClient) IndexDevice(ctx context.Context, device *model.Device) error {
+	tenantID := device.GetTenantID()
+	if err := e.strategy.prepareWrite(ctx, indexDevices, tenantID); err != nil {
+		return err
+	}
 	req := esapi.IndexRequest{
-		Index:      indexDevices + "-" + device.GetTenantID(),
-		DocumentID: device.GetID(),
+		Index:      e.strategy.writeIndex(indexDevices, tenantID),
+		DocumentID: e.strategy.documentID(tenantID, device.GetID()),
 		Body:       esutil.NewJSONReader(device),
+		Routing:    e.strategy.routing(tenantID),
 	}
 
 	res, err := req.Do(ctx, e.client)
@@ -166,27 +383,74 @@ func (e *ElasticsearchClient) IndexDevice(ctx context.Context, device *model.Dev
 	}
 	defer res.Body.Close()
 
-	return nil
+	if !res.IsError() {
+		return e.clearDeadLetters(ctx, []*model.Device{device})
+	}
+	var response errorResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Errorf("failed to index the device: %s", res.Status())
+	}
+	if !isRejected(res.StatusCode) {
+		return errors.Errorf("failed to index the device: %s", response.Error.Reason)
+	}
+	deadLetter, err := newDeadLetter(device, response.Error.Type,
+		response.Error.Reason, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := e.saveDeadLetters(ctx, []*model.DeadLetter{deadLetter}); err != nil {
+		return err
+	}
+	model.RejectionsFromContext(ctx).Record(tenantID, device.GetID(),
+		response.Error.Reason)
+	if response.Error.Type == errTypeIndexClosed {
+		return errors.Wrap(ErrIndexClosed, response.Error.Reason)
+	}
+	return errors.Wrap(ErrDocumentRejected, response.Error.Reason)
 }
 
 type bulkAction struct {
-	Index *bulkActionIndex `json:"index"`
+	Index  *bulkActionIndex `json:"index,omitempty"`
+	Delete *bulkActionIndex `json:"delete,omitempty"`
 }
 
 type bulkActionIndex struct {
-	ID    string `json:"_id"`
-	Index string `json:"_index"`
+	ID      string `json:"_id,omitempty"`
+	Index   string `json:"_index"`
+	Routing string `json:"routing,omitempty"`
+}
+
+// bulkIndexAction returns the bulk action indexing a document of the tenant
+// in the indices with the prefix; an empty ID lets Elasticsearch generate it
+func (e *ElasticsearchClient) bulkIndexAction(ctx context.Context, prefix, tenantID,
+	id string) (*bulkAction, error) {
+	if err := e.strategy.prepareWrite(ctx, prefix, tenantID); err != nil {
+		return nil, err
+	}
+	if id != "" {
+		id = e.strategy.documentID(tenantID, id)
+	}
+	return &bulkAction{
+		Index: &bulkActionIndex{
+			ID:      id,
+			Index:   e.strategy.writeIndex(prefix, tenantID),
+			Routing: e.strategy.routing(tenantID),
+		},
+	}, nil
 }
 
+// BulkIndexDevices indexes the devices; the devices rejected by
+// Elasticsearch are recorded in the dead letters and in the rejections of
+// the context, and do not fail the batch
 func (e *ElasticsearchClient) BulkIndexDevices(ctx context.Context, devices []*model.Device) error {
 	data := ""
 	for _, device := range devices {
-		actionJSON, err := json.Marshal(bulkAction{
-			Index: &bulkActionIndex{
-				ID:    device.GetID(),
-				Index: indexDevices + "-" + device.GetTenantID(),
-			},
-		})
+		action, err := e.bulkIndexAction(ctx, indexDevices, device.GetTenantID(),
+			device.GetID())
+		if err != nil {
+			return err
+		}
+		actionJSON, err := json.Marshal(action)
 		if err != nil {
 			return err
 		}
@@ -205,23 +469,292 @@ func (e *ElasticsearchClient) BulkIndexDevices(ctx context.Context, devices []*m
 	}
 	defer res.Body.Close()
 
-	return nil
+	if res.IsError() {
+		return errors.Errorf("failed to bulk index: %s", res.Status())
+	}
+	var response bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Wrap(err, "failed to parse the response")
+	}
+	if !response.Errors {
+		return e.clearDeadLetters(ctx, devices)
+	}
+	return e.handleBulkIndexErrors(ctx, devices, &response)
 }
 
-func (e *ElasticsearchClient) Migrate(ctx context.Context) error {
-	req := esapi.IndicesPutIndexTemplateRequest{
-		Name: indexDevices,
-		Body: strings.NewReader(indexDevicesTemplate),
+// handleBulkIndexErrors records the rejected devices in the dead letters
+// and in the rejections of the context, clears the dead letters of the
+// indexed ones, and fails if any other device could not be indexed, to
+// retry the batch
+func (e *ElasticsearchClient) handleBulkIndexErrors(ctx context.Context,
+	devices []*model.Device, response *bulkResponse) error {
+	now := time.Now()
+	deadLetters := []*model.DeadLetter{}
+	indexed := []*model.Device{}
+	var failed error
+	for i, item := range response.Items {
+		for _, result := range item {
+			if i >= len(devices) {
+				continue
+			} else if result.Error == nil {
+				indexed = append(indexed, devices[i])
+				continue
+			} else if !isRejected(result.Status) {
+				if failed == nil {
+					failed = errors.Errorf("failed to index the device %s: %s",
+						result.ID, result.Error.Reason)
+				}
+				continue
+			}
+			deadLetter, err := newDeadLetter(devices[i], result.Error.Type,
+				result.Error.Reason, now)
+			if err != nil {
+				return err
+			}
+			deadLetters = append(deadLetters, deadLetter)
+		}
+	}
+	if err := e.saveDeadLetters(ctx, deadLetters); err != nil {
+		return err
 	}
+	rejections := model.RejectionsFromContext(ctx)
+	for _, deadLetter := range deadLetters {
+		rejections.Record(deadLetter.TenantID, deadLetter.DeviceID, deadLetter.Reason)
+	}
+	if err := e.clearDeadLetters(ctx, indexed); err != nil {
+		return err
+	}
+	return failed
+}
 
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// DeleteDevices deletes the devices of the tenant; deleting devices which
+// do not exist is not an error
+func (e *ElasticsearchClient) DeleteDevices(ctx context.Context, tenantID string,
+	deviceIDs []string) error {
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+	data := ""
+	for _, id := range deviceIDs {
+		actionJSON, err := json.Marshal(bulkAction{
+			Delete: &bulkActionIndex{
+				ID:      e.strategy.documentID(tenantID, id),
+				Index:   e.strategy.writeIndex(indexDevices, tenantID),
+				Routing: e.strategy.routing(tenantID),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		data += string(actionJSON) + "\n"
+	}
+	req := esapi.BulkRequest{
+		Body: strings.NewReader(data),
+	}
 	res, err := req.Do(ctx, e.client)
 	if err != nil {
-		return errors.Wrap(err, "failed to put the index template")
+		return errors.Wrap(err, "failed to bulk delete")
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
-		return errors.New("failed to set up the index template")
+	if res.IsError() {
+		return errors.Errorf("failed to delete the devices: %s", res.Status())
+	}
+	var response bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Wrap(err, "failed to parse the response")
+	}
+	if response.Errors {
+		for _, item := range response.Items {
+			for _, result := range item {
+				if result.Error != nil && result.Status != http.StatusNotFound {
+					return errors.Errorf("failed to delete the device %s: %s",
+						result.ID, result.Error.Reason)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type getDocsResponse struct {
+	Docs []struct {
+		ID     string        `json:"_id"`
+		Found  bool          `json:"found"`
+		Source *model.Device `json:"_source"`
+	} `json:"docs"`
+}
+
+// GetDevices returns the stored devices of the tenant with the IDs
+func (e *ElasticsearchClient) GetDevices(ctx context.Context, tenantID string,
+	deviceIDs []string) ([]*model.Device, error) {
+	if len(deviceIDs) == 0 {
+		return []*model.Device{}, nil
+	}
+	ids := make([]string, len(deviceIDs))
+	for n, id := range deviceIDs {
+		ids[n] = e.strategy.documentID(tenantID, id)
+	}
+	req := esapi.MgetRequest{
+		Index:   tenantIndex(indexDevices, tenantID),
+		Routing: e.strategy.routing(tenantID),
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"ids": ids,
+		}),
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the devices")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return []*model.Device{}, nil
+	} else if res.IsError() {
+		return nil, errors.Errorf("failed to get the devices: %s", res.Status())
+	}
+
+	var response getDocsResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+
+	devices := make([]*model.Device, 0, len(response.Docs))
+	for _, doc := range response.Docs {
+		if doc.Found && doc.Source != nil {
+			devices = append(devices, doc.Source)
+		}
+	}
+	return devices, nil
+}
+
+type devicesSearchResponse struct {
+	queryStatus
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source *model.Device `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func (e *ElasticsearchClient) SearchDevices(ctx context.Context, tenantID string,
+	query model.Query) ([]*model.Device, int, error) {
+	ignoreUnavailable := true
+	req := esapi.SearchRequest{
+		Index:             []string{tenantIndex(indexDevices, tenantID)},
+		Body:              esutil.NewJSONReader(query),
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	reqCtx, cancel := e.withQueryTimeout(ctx, &req)
+	defer cancel()
+	res, err := req.Do(reqCtx, e.client)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to search the devices")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, 0, errors.Errorf("failed to search the devices: %s", res.Status())
+	}
+
+	var response devicesSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to parse the response")
+	}
+
+	model.QueryStatusFromContext(ctx).Record(response.TimedOut, response.Shards.Failed)
+
+	devices := make([]*model.Device, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		devices = append(devices, hit.Source)
+	}
+	return devices, response.Hits.Total.Value, nil
+}
+
+type devicesAggregateResponse struct {
+	queryStatus
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+	} `json:"hits"`
+	Aggregations json.RawMessage `json:"aggregations"`
+}
+
+func (e *ElasticsearchClient) AggregateDevices(ctx context.Context, tenantID string,
+	query model.Query) (json.RawMessage, int, error) {
+	ignoreUnavailable := true
+	req := esapi.SearchRequest{
+		Index:             []string{tenantIndex(indexDevices, tenantID)},
+		Body:              esutil.NewJSONReader(query),
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	reqCtx, cancel := e.withQueryTimeout(ctx, &req)
+	defer cancel()
+	res, err := req.Do(reqCtx, e.client)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to aggregate the devices")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, 0, errors.Errorf("failed to aggregate the devices: %s", res.Status())
+	}
+
+	var response devicesAggregateResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to parse the response")
+	}
+
+	model.QueryStatusFromContext(ctx).Record(response.TimedOut, response.Shards.Failed)
+
+	return response.Aggregations, response.Hits.Total.Value, nil
+}
+
+func (e *ElasticsearchClient) Migrate(ctx context.Context) error {
+	if err := e.putLifecyclePolicy(ctx, lifecyclePolicyHistory,
+		e.historyPolicy); err != nil {
+		return err
+	}
+	for _, template := range indexTemplates {
+		body := template.body
+		if template.tenantData {
+			var err error
+			body, err = e.tenantDataTemplate(template.body, template.lifecyclePolicy)
+			if err != nil {
+				return errors.Wrapf(err, "invalid index template %q", template.name)
+			}
+		}
+		req := esapi.IndicesPutIndexTemplateRequest{
+			Name: template.name,
+			Body: strings.NewReader(body),
+		}
+
+		res, err := req.Do(ctx, e.client)
+		if err != nil {
+			return errors.Wrap(err, "failed to put the index template")
+		}
+		res.Body.Close()
+
+		if res.StatusCode != 200 {
+			return errors.Errorf("failed to set up the index template %q",
+				template.name)
+		}
 	}
 
 	return nil
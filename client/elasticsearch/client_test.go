@@ -0,0 +1,155 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteDevices(t *testing.T) {
+	testCases := map[string]struct {
+		strategy string
+		response string
+
+		body string
+		err  string
+	}{
+		"per-tenant": {
+			strategy: IndexStrategyPerTenant,
+			response: `{"errors": false, "items": [
+				{"delete": {"_id": "1", "status": 200}},
+				{"delete": {"_id": "2", "status": 404}}
+			]}`,
+			body: `{"delete":{"_id":"1","_index":"devices-tenant"}}` + "\n" +
+				`{"delete":{"_id":"2","_index":"devices-tenant"}}` + "\n",
+		},
+		"shared": {
+			strategy: IndexStrategyShared,
+			response: `{"errors": false, "items": [
+				{"delete": {"_id": "tenant/1", "status": 200}},
+				{"delete": {"_id": "tenant/2", "status": 404}}
+			]}`,
+			body: `{"delete":{"_id":"tenant/1","_index":"devices-_shared","routing":"tenant"}}` +
+				"\n" +
+				`{"delete":{"_id":"tenant/2","_index":"devices-_shared","routing":"tenant"}}` +
+				"\n",
+		},
+		"ko, item failure": {
+			strategy: IndexStrategyPerTenant,
+			response: `{"errors": true, "items": [
+				{"delete": {"_id": "1", "status": 200}},
+				{"delete": {"_id": "2", "status": 429, "error": {
+					"type": "es_rejected_execution_exception",
+					"reason": "rejected execution"
+				}}}
+			]}`,
+			body: `{"delete":{"_id":"1","_index":"devices-tenant"}}` + "\n" +
+				`{"delete":{"_id":"2","_index":"devices-tenant"}}` + "\n",
+			err: "failed to delete the device 2: rejected execution",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				return http.StatusOK, tc.response
+			})
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(tc.strategy),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = client.DeleteDevices(context.Background(), "tenant",
+				[]string{"1", "2"})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if assert.Len(t, *requests, 1) {
+				assert.Equal(t, "/_bulk", (*requests)[0].Path)
+				assert.Equal(t, tc.body, (*requests)[0].Body)
+			}
+		})
+	}
+}
+
+func TestGetDevices(t *testing.T) {
+	testCases := map[string]struct {
+		strategy string
+		response string
+
+		path  string
+		query string
+		body  string
+		ids   []string
+	}{
+		"per-tenant": {
+			strategy: IndexStrategyPerTenant,
+			response: `{"docs": [
+				{"_id": "1", "found": true, "_source": {"id": "1", "tenantID": "tenant"}},
+				{"_id": "2", "found": false}
+			]}`,
+			path: "/devices-tenant/_mget",
+			body: `{"ids":["1","2"]}` + "\n",
+			ids:  []string{"1"},
+		},
+		"shared": {
+			strategy: IndexStrategyShared,
+			response: `{"docs": [
+				{"_id": "tenant/1", "found": false},
+				{"_id": "tenant/2", "found": true, "_source": {"id": "2", "tenantID": "tenant"}}
+			]}`,
+			path:  "/devices-tenant/_mget",
+			query: "routing=tenant",
+			body:  `{"ids":["tenant/1","tenant/2"]}` + "\n",
+			ids:   []string{"2"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				return http.StatusOK, tc.response
+			})
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(tc.strategy),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+			devices, err := client.GetDevices(context.Background(), "tenant",
+				[]string{"1", "2"})
+			assert.NoError(t, err)
+			ids := []string{}
+			for _, device := range devices {
+				ids = append(ids, device.GetID())
+			}
+			assert.Equal(t, tc.ids, ids)
+			if assert.Len(t, *requests, 1) {
+				assert.Equal(t, tc.path, (*requests)[0].Path)
+				if tc.query != "" {
+					assert.Equal(t, tc.query, (*requests)[0].Query)
+				}
+				assert.Equal(t, tc.body, (*requests)[0].Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	indexDeadLetters         = "reporting-dead-letters"
+	indexDeadLettersTemplate = `{
+	"index_patterns": ["reporting-dead-letters"],
+	"priority": 1,
+	"template": {
+		"settings": {
+			"number_of_shards": 1,
+			"number_of_replicas": 1
+		},
+		"mappings": {
+			"_source": {
+				"enabled": true
+			},
+			"properties": {
+				"id": {
+					"type": "keyword"
+				},
+				"tenantID": {
+					"type": "keyword"
+				},
+				"deviceID": {
+					"type": "keyword"
+				},
+				"errorType": {
+					"type": "keyword"
+				},
+				"reason": {
+					"type": "text"
+				},
+				"attempts": {
+					"type": "integer"
+				},
+				"payload": {
+					"type": "object",
+					"enabled": false
+				},
+				"firstFailedAt": {
+					"type": "date"
+				},
+				"lastFailedAt": {
+					"type": "date"
+				}
+			}
+		}
+	}
+}`
+
+	// deadLetterScript updates the dead letter of a document rejected again
+	deadLetterScript = "ctx._source.attempts += 1; " +
+		"ctx._source.errorType = params.errorType; " +
+		"ctx._source.reason = params.reason; " +
+		"ctx._source.payload = params.payload; " +
+		"ctx._source.lastFailedAt = params.lastFailedAt"
+
+	errTypeIndexClosed = "index_closed_exception"
+)
+
+// ErrDocumentRejected is returned when Elasticsearch rejects a document,
+// which is recorded in the dead letters
+var ErrDocumentRejected = errors.New("document rejected")
+
+// ErrIndexClosed is returned when a document is written to the closed index
+// of a suspended tenant; the document is recorded in the dead letters, to be
+// indexed again once the tenant is resumed
+var ErrIndexClosed = errors.New("index closed")
+
+// isRejected tells if the failure to index a document is caused by the
+// document itself, e.g. a mapping conflict, so retrying it is pointless, or
+// by the suspension of its tenant, closing its index, so retrying it must
+// wait for the resumption of the tenant
+func isRejected(status int) bool {
+	return status == http.StatusBadRequest
+}
+
+// newDeadLetter returns the dead letter of the rejected device
+func newDeadLetter(device *model.Device, errType, reason string,
+	failedAt time.Time) (*model.DeadLetter, error) {
+	payload, err := json.Marshal(device)
+	if err != nil {
+		return nil, err
+	}
+	return &model.DeadLetter{
+		ID:            model.DeadLetterID(device.GetTenantID(), device.GetID()),
+		TenantID:      device.GetTenantID(),
+		DeviceID:      device.GetID(),
+		ErrorType:     errType,
+		Reason:        reason,
+		Attempts:      1,
+		Payload:       payload,
+		FirstFailedAt: failedAt,
+		LastFailedAt:  failedAt,
+	}, nil
+}
+
+type bulkUpdateAction struct {
+	Update *bulkActionIndex `json:"update"`
+}
+
+type bulkUpsert struct {
+	Script struct {
+		Source string                 `json:"source"`
+		Lang   string                 `json:"lang"`
+		Params map[string]interface{} `json:"params"`
+	} `json:"script"`
+	Upsert *model.DeadLetter `json:"upsert"`
+}
+
+// saveDeadLetters records the dead letters, incrementing the attempts of
+// the documents already rejected before
+func (e *ElasticsearchClient) saveDeadLetters(ctx context.Context,
+	deadLetters []*model.DeadLetter) error {
+	if len(deadLetters) == 0 {
+		return nil
+	}
+	data := ""
+	for _, deadLetter := range deadLetters {
+		actionJSON, err := json.Marshal(bulkUpdateAction{
+			Update: &bulkActionIndex{
+				ID:    deadLetter.ID,
+				Index: indexDeadLetters,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		upsert := bulkUpsert{Upsert: deadLetter}
+		upsert.Script.Source = deadLetterScript
+		upsert.Script.Lang = "painless"
+		upsert.Script.Params = map[string]interface{}{
+			"errorType":    deadLetter.ErrorType,
+			"reason":       deadLetter.Reason,
+			"payload":      deadLetter.Payload,
+			"lastFailedAt": deadLetter.LastFailedAt,
+		}
+		upsertJSON, err := json.Marshal(upsert)
+		if err != nil {
+			return err
+		}
+		data += string(actionJSON) + "\n" + string(upsertJSON) + "\n"
+	}
+	req := esapi.BulkRequest{
+		Body:    strings.NewReader(data),
+		Refresh: "wait_for",
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to save the dead letters")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to save the dead letters: %s", res.Status())
+	}
+	var response bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Wrap(err, "failed to parse the response")
+	}
+	if response.Errors {
+		for _, item := range response.Items {
+			for _, result := range item {
+				if result.Error != nil {
+					return errors.Errorf("failed to save the dead letter %s: %s",
+						result.ID, result.Error.Reason)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// clearDeadLetters deletes the dead letters of the devices indexed since
+// their rejection, so that retrying them does not overwrite the devices with
+// stale payloads; as the dead letters are saved with a refresh, the query
+// sees all of them, and usually deletes nothing
+func (e *ElasticsearchClient) clearDeadLetters(ctx context.Context,
+	devices []*model.Device) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, model.DeadLetterID(device.GetTenantID(), device.GetID()))
+	}
+	ignoreUnavailable := true
+	refresh := true
+	req := esapi.DeleteByQueryRequest{
+		Index: []string{indexDeadLetters},
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"query": map[string]interface{}{
+				"ids": map[string]interface{}{"values": ids},
+			},
+		}),
+		Conflicts:         "proceed",
+		Refresh:           &refresh,
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to clear the dead letters")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return errors.Errorf("failed to clear the dead letters: %s", res.Status())
+	}
+	return nil
+}
+
+type deadLettersSearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source *model.DeadLetter `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// ListDeadLetters returns a page of the dead letters, oldest rejection
+// first, and the total number of dead letters matching the filter
+func (e *ElasticsearchClient) ListDeadLetters(ctx context.Context,
+	filter *model.DeadLetterFilter) ([]*model.DeadLetter, int, error) {
+	filters := []interface{}{}
+	if filter.TenantID != "" {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"tenantID": filter.TenantID},
+		})
+	}
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filters,
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"lastFailedAt": "asc"},
+			map[string]interface{}{"id": "asc"},
+		},
+		"from":             (filter.Page - 1) * filter.PerPage,
+		"size":             filter.PerPage,
+		"track_total_hits": true,
+	}
+
+	ignoreUnavailable := true
+	req := esapi.SearchRequest{
+		Index:             []string{indexDeadLetters},
+		Body:              esutil.NewJSONReader(query),
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to search the dead letters")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, 0, errors.Errorf("failed to search the dead letters: %s", res.Status())
+	}
+
+	var response deadLettersSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to parse the response")
+	}
+
+	deadLetters := make([]*model.DeadLetter, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		deadLetters = append(deadLetters, hit.Source)
+	}
+	return deadLetters, response.Hits.Total.Value, nil
+}
+
+type getDeadLetterResponse struct {
+	Found  bool              `json:"found"`
+	Source *model.DeadLetter `json:"_source"`
+}
+
+// GetDeadLetter returns the dead letter, or nil if not found
+func (e *ElasticsearchClient) GetDeadLetter(ctx context.Context,
+	id string) (*model.DeadLetter, error) {
+	req := esapi.GetRequest{
+		Index:      indexDeadLetters,
+		DocumentID: id,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the dead letter")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if res.IsError() {
+		return nil, errors.Errorf("failed to get the dead letter: %s", res.Status())
+	}
+
+	var response getDeadLetterResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	if !response.Found {
+		return nil, nil
+	}
+	return response.Source, nil
+}
+
+// DeleteDeadLetter deletes the dead letter; deleting a dead letter which
+// does not exist is not an error
+func (e *ElasticsearchClient) DeleteDeadLetter(ctx context.Context, id string) error {
+	req := esapi.DeleteRequest{
+		Index:      indexDeadLetters,
+		DocumentID: id,
+		Refresh:    "wait_for",
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete the dead letter")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return errors.Errorf("failed to delete the dead letter: %s", res.Status())
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+// deadLetterUpserts returns the dead letters upserted by the bulk requests
+func deadLetterUpserts(requests []esRequest) []*model.DeadLetter {
+	deadLetters := []*model.DeadLetter{}
+	for _, req := range requests {
+		if req.Path != "/_bulk" || !strings.Contains(req.Body, indexDeadLetters) {
+			continue
+		}
+		for i, line := range strings.Split(strings.TrimSpace(req.Body), "\n") {
+			if i%2 == 1 {
+				var upsert bulkUpsert
+				_ = json.Unmarshal([]byte(line), &upsert)
+				deadLetters = append(deadLetters, upsert.Upsert)
+			}
+		}
+	}
+	return deadLetters
+}
+
+// clearedDeadLetters returns the IDs of the dead letters cleared by the
+// delete by query requests
+func clearedDeadLetters(requests []esRequest) []string {
+	ids := []string{}
+	for _, req := range requests {
+		if req.Path != "/"+indexDeadLetters+"/_delete_by_query" {
+			continue
+		}
+		var body struct {
+			Query struct {
+				IDs struct {
+					Values []string `json:"values"`
+				} `json:"ids"`
+			} `json:"query"`
+		}
+		_ = json.Unmarshal([]byte(req.Body), &body)
+		ids = append(ids, body.Query.IDs.Values...)
+	}
+	return ids
+}
+
+func TestBulkIndexDevicesDeadLetters(t *testing.T) {
+	devices := []*model.Device{
+		model.NewDevice("1").SetTenantID("tenant"),
+		model.NewDevice("2").SetTenantID("tenant"),
+		model.NewDevice("3").SetTenantID("tenant"),
+	}
+	testCases := map[string]struct {
+		response string
+
+		deadLetters []string
+		cleared     []string
+		err         string
+	}{
+		"ok": {
+			response: `{"errors": false, "items": [
+				{"index": {"_id": "1", "status": 200}},
+				{"index": {"_id": "2", "status": 201}},
+				{"index": {"_id": "3", "status": 200}}
+			]}`,
+			deadLetters: []string{},
+			cleared:     []string{"tenant:1", "tenant:2", "tenant:3"},
+		},
+		"ok, rejected": {
+			response: `{"errors": true, "items": [
+				{"index": {"_id": "1", "status": 200}},
+				{"index": {"_id": "2", "status": 400, "error": {
+					"type": "mapper_parsing_exception",
+					"reason": "failed to parse field [location]"
+				}}},
+				{"index": {"_id": "3", "status": 400, "error": {
+					"type": "illegal_argument_exception",
+					"reason": "Limit of total fields [1000] has been exceeded"
+				}}}
+			]}`,
+			deadLetters: []string{"tenant:2", "tenant:3"},
+			cleared:     []string{"tenant:1"},
+		},
+		"ok, index closed": {
+			response: `{"errors": true, "items": [
+				{"index": {"_id": "1", "status": 400, "error": {
+					"type": "index_closed_exception",
+					"reason": "closed"
+				}}},
+				{"index": {"_id": "2", "status": 200}},
+				{"index": {"_id": "3", "status": 200}}
+			]}`,
+			deadLetters: []string{"tenant:1"},
+			cleared:     []string{"tenant:2", "tenant:3"},
+		},
+		"ko, transient failure": {
+			response: `{"errors": true, "items": [
+				{"index": {"_id": "1", "status": 429, "error": {
+					"type": "es_rejected_execution_exception",
+					"reason": "rejected execution"
+				}}},
+				{"index": {"_id": "2", "status": 400, "error": {
+					"type": "mapper_parsing_exception",
+					"reason": "failed to parse field [location]"
+				}}},
+				{"index": {"_id": "3", "status": 200}}
+			]}`,
+			deadLetters: []string{"tenant:2"},
+			cleared:     []string{"tenant:3"},
+			err:         "failed to index the device 1: rejected execution",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				if r.Path == "/_bulk" && !strings.Contains(r.Body, indexDeadLetters) {
+					return http.StatusOK, tc.response
+				}
+				return http.StatusOK, `{"errors": false, "items": []}`
+			})
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(IndexStrategyPerTenant),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = client.BulkIndexDevices(context.Background(), devices)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			ids := []string{}
+			for _, deadLetter := range deadLetterUpserts(*requests) {
+				ids = append(ids, deadLetter.ID)
+				assert.Equal(t, "tenant", deadLetter.TenantID)
+				assert.Equal(t, 1, deadLetter.Attempts)
+				assert.Contains(t, []string{
+					"mapper_parsing_exception", "illegal_argument_exception",
+					"index_closed_exception",
+				}, deadLetter.ErrorType)
+
+				var device model.Device
+				assert.NoError(t, json.Unmarshal(deadLetter.Payload, &device))
+				assert.Equal(t, deadLetter.DeviceID, device.GetID())
+			}
+			assert.Equal(t, tc.deadLetters, ids)
+			// the dead letters of the devices indexed are stale
+			assert.Equal(t, tc.cleared, clearedDeadLetters(*requests))
+		})
+	}
+}
+
+func TestIndexDeviceRejected(t *testing.T) {
+	testCases := map[string]struct {
+		code     int
+		response string
+
+		deadLetters int
+		cleared     []string
+		rejected    bool
+		closed      bool
+		err         string
+	}{
+		"ok": {
+			code:    http.StatusCreated,
+			cleared: []string{"tenant:1"},
+		},
+		"ko, index closed": {
+			code: http.StatusBadRequest,
+			response: `{"error": {
+				"type": "index_closed_exception", "reason": "closed"
+			}}`,
+			deadLetters: 1,
+			closed:      true,
+			err:         "closed: index closed",
+		},
+		"ko, rejected": {
+			code: http.StatusBadRequest,
+			response: `{"error": {
+				"type": "mapper_parsing_exception",
+				"reason": "failed to parse field [location]"
+			}}`,
+			deadLetters: 1,
+			rejected:    true,
+			err:         "failed to parse field [location]: document rejected",
+		},
+		"ko, unavailable": {
+			code: http.StatusServiceUnavailable,
+			response: `{"error": {
+				"type": "unavailable_shards_exception", "reason": "unavailable"
+			}}`,
+			err: "failed to index the device: unavailable",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				if r.Method == http.MethodPut && strings.HasPrefix(r.Path, "/devices-") &&
+					strings.Contains(r.Path, "/_doc/") {
+					return tc.code, tc.response
+				}
+				return http.StatusOK, `{"errors": false, "items": []}`
+			})
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(IndexStrategyPerTenant),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = client.IndexDevice(context.Background(),
+				model.NewDevice("1").SetTenantID("tenant"))
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.rejected, errors.Cause(err) == ErrDocumentRejected)
+			assert.Equal(t, tc.closed, errors.Cause(err) == ErrIndexClosed)
+			assert.Len(t, deadLetterUpserts(*requests), tc.deadLetters)
+			if tc.cleared == nil {
+				tc.cleared = []string{}
+			}
+			assert.Equal(t, tc.cleared, clearedDeadLetters(*requests))
+		})
+	}
+}
+
+func TestListDeadLetters(t *testing.T) {
+	server, requests := newTestServer(t, func(r esRequest) (int, string) {
+		return http.StatusOK, `{"hits": {"total": {"value": 3}, "hits": [
+			{"_source": {"id": "tenant:1", "tenantID": "tenant", "deviceID": "1",
+				"attempts": 2, "payload": {"id": "1"}}}
+		]}}`
+	})
+	client, err := NewClient(WithServerAddresses([]string{server.URL}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	deadLetters, total, err := client.ListDeadLetters(context.Background(),
+		&model.DeadLetterFilter{TenantID: "tenant", Page: 2, PerPage: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	if assert.Len(t, deadLetters, 1) {
+		assert.Equal(t, "tenant:1", deadLetters[0].ID)
+		assert.Equal(t, 2, deadLetters[0].Attempts)
+		assert.JSONEq(t, `{"id": "1"}`, string(deadLetters[0].Payload))
+	}
+	if assert.Len(t, *requests, 1) {
+		assert.Equal(t, "/"+indexDeadLetters+"/_search", (*requests)[0].Path)
+		assert.JSONEq(t, `{
+			"query": {"bool": {"filter": [{"term": {"tenantID": "tenant"}}]}},
+			"sort": [{"lastFailedAt": "asc"}, {"id": "asc"}],
+			"from": 1,
+			"size": 1,
+			"track_total_hits": true
+		}`, (*requests)[0].Body)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	indexDeployments         = "deployments"
+	indexDeploymentsTemplate = `{
+	"index_patterns": ["deployments-*"],
+	"priority": 1,
+	"template": {
+		"mappings": {
+			"_source": {
+				"enabled": true
+			},
+			"properties": {
+				"id": {
+					"type": "keyword"
+				},
+				"tenantID": {
+					"type": "keyword"
+				},
+				"deviceID": {
+					"type": "keyword"
+				},
+				"status": {
+					"type": "keyword"
+				},
+				"created": {
+					"type": "date"
+				},
+				"finished": {
+					"type": "date"
+				},
+				"deployment": {
+					"properties": {
+						"id": {
+							"type": "keyword"
+						},
+						"name": {
+							"type": "keyword"
+						},
+						"artifactName": {
+							"type": "keyword"
+						},
+						"status": {
+							"type": "keyword"
+						},
+						"created": {
+							"type": "date"
+						},
+						"finished": {
+							"type": "date"
+						}
+					}
+				}
+			}
+		}
+	}
+}`
+)
+
+func (e *ElasticsearchClient) BulkIndexDeviceDeployments(ctx context.Context,
+	deployments []*model.DeviceDeployment) error {
+	if len(deployments) == 0 {
+		return nil
+	}
+	var data strings.Builder
+	for _, deployment := range deployments {
+		action, err := e.bulkIndexAction(ctx, indexDeployments, deployment.TenantID,
+			deployment.ID)
+		if err != nil {
+			return err
+		}
+		actionJSON, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+		deploymentJSON, err := json.Marshal(deployment)
+		if err != nil {
+			return err
+		}
+		data.WriteString(string(actionJSON) + "\n" + string(deploymentJSON) + "\n")
+	}
+	req := esapi.BulkRequest{
+		Body: strings.NewReader(data.String()),
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to bulk index the deployments")
+	}
+	defer res.Body.Close()
+
+	return nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	indexDeviceHistory         = "device-history"
+	indexDeviceHistoryTemplate = `{
+	"index_patterns": ["device-history-*"],
+	"priority": 1,
+	"template": {
+		"mappings": {
+			"_source": {
+				"enabled": true
+			},
+			"properties": {
+				"deviceID": {
+					"type": "keyword"
+				},
+				"tenantID": {
+					"type": "keyword"
+				},
+				"scope": {
+					"type": "keyword"
+				},
+				"name": {
+					"type": "keyword"
+				},
+				"oldValue": {
+					"properties": {
+						"string": {
+							"type": "keyword"
+						},
+						"numeric": {
+							"type": "double"
+						}
+					}
+				},
+				"newValue": {
+					"properties": {
+						"string": {
+							"type": "keyword"
+						},
+						"numeric": {
+							"type": "double"
+						}
+					}
+				},
+				"timestamp": {
+					"type": "date"
+				}
+			}
+		}
+	}
+}`
+)
+
+// BulkIndexHistory indexes the attribute changes; it fails if any of them
+// could not be indexed, to retry the batch
+func (e *ElasticsearchClient) BulkIndexHistory(ctx context.Context,
+	changes []*model.AttributeChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	var data strings.Builder
+	for _, change := range changes {
+		action, err := e.bulkIndexAction(ctx, indexDeviceHistory, change.TenantID, "")
+		if err != nil {
+			return err
+		}
+		actionJSON, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+		changeJSON, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		data.WriteString(string(actionJSON) + "\n" + string(changeJSON) + "\n")
+	}
+	req := esapi.BulkRequest{
+		Body: strings.NewReader(data.String()),
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to bulk index the history")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to bulk index the history: %s", res.Status())
+	}
+	var response bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Wrap(err, "failed to parse the response")
+	}
+	if response.Errors {
+		for _, item := range response.Items {
+			for _, result := range item {
+				// the history of the suspended tenants, whose indices
+				// are closed, is not recorded
+				if result.Error != nil && result.Error.Type != errTypeIndexClosed {
+					return errors.Errorf("failed to index the attribute change: %s",
+						result.Error.Reason)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type historySearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source *model.AttributeChange `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func (e *ElasticsearchClient) GetDeviceHistory(ctx context.Context, tenantID string,
+	deviceID string, filter *model.HistoryFilter) ([]*model.AttributeChange, int, error) {
+	filters := []interface{}{
+		map[string]interface{}{
+			"term": map[string]interface{}{"deviceID": deviceID},
+		},
+	}
+	if filter.Scope != "" {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"scope": filter.Scope},
+		})
+	}
+	if filter.Attribute != "" {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"name": filter.Attribute},
+		})
+	}
+	if filter.From != nil || filter.To != nil {
+		timeRange := map[string]interface{}{}
+		if filter.From != nil {
+			timeRange["gte"] = filter.From
+		}
+		if filter.To != nil {
+			timeRange["lte"] = filter.To
+		}
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"timestamp": timeRange},
+		})
+	}
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filters,
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"timestamp": "desc"},
+		},
+		"from":             (filter.Page - 1) * filter.PerPage,
+		"size":             filter.PerPage,
+		"track_total_hits": true,
+	}
+
+	ignoreUnavailable := true
+	req := esapi.SearchRequest{
+		Index:             []string{tenantIndex(indexDeviceHistory, tenantID)},
+		Body:              esutil.NewJSONReader(query),
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to search the history")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, 0, errors.Errorf("failed to search the history: %s", res.Status())
+	}
+
+	var response historySearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to parse the response")
+	}
+
+	changes := make([]*model.AttributeChange, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		changes = append(changes, hit.Source)
+	}
+	return changes, response.Hits.Total.Value, nil
+}
+
+func (e *ElasticsearchClient) DeleteHistoryBefore(ctx context.Context, before time.Time) error {
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{
+				"timestamp": map[string]interface{}{
+					"lt": before,
+				},
+			},
+		},
+	}
+
+	ignoreUnavailable := true
+	req := esapi.DeleteByQueryRequest{
+		Index:             []string{indexDeviceHistory + "-*"},
+		Body:              esutil.NewJSONReader(query),
+		Conflicts:         "proceed",
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete the history")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to delete the history: %s", res.Status())
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestBulkIndexHistory(t *testing.T) {
+	changes := []*model.AttributeChange{
+		{DeviceID: "1", TenantID: "tenant", Scope: model.ScopeInventory,
+			Name: "cpu", Timestamp: time.Now()},
+		{DeviceID: "2", TenantID: "tenant", Scope: model.ScopeInventory,
+			Name: "cpu", Timestamp: time.Now()},
+	}
+	testCases := map[string]struct {
+		status   int
+		response string
+
+		err string
+	}{
+		"ok": {
+			status: http.StatusOK,
+			response: `{"errors": false, "items": [
+				{"index": {"_id": "a", "status": 201}},
+				{"index": {"_id": "b", "status": 201}}
+			]}`,
+		},
+		"ok, closed index": {
+			status: http.StatusOK,
+			response: `{"errors": true, "items": [
+				{"index": {"_id": "a", "status": 201}},
+				{"index": {"status": 400, "error": {
+					"type": "index_closed_exception", "reason": "closed"
+				}}}
+			]}`,
+		},
+		"ko, item failure": {
+			status: http.StatusOK,
+			response: `{"errors": true, "items": [
+				{"index": {"_id": "a", "status": 201}},
+				{"index": {"status": 400, "error": {
+					"type": "mapper_parsing_exception",
+					"reason": "failed to parse field [oldValue.numeric]"
+				}}}
+			]}`,
+			err: "failed to index the attribute change: " +
+				"failed to parse field [oldValue.numeric]",
+		},
+		"ko, error": {
+			status: http.StatusInternalServerError,
+			err:    "failed to bulk index the history: 500 Internal Server Error",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				return tc.status, tc.response
+			})
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(IndexStrategyPerTenant),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			err = client.BulkIndexHistory(context.Background(), changes)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if assert.Len(t, *requests, 1) {
+				assert.Equal(t, "/_bulk", (*requests)[0].Path)
+				assert.Len(t, bulkActions((*requests)[0].Body), len(changes))
+			}
+		})
+	}
+}
@@ -0,0 +1,482 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	// lifecyclePolicyHistory is the name of the ILM policy of the history
+	// indices
+	lifecyclePolicyHistory = "reporting-device-history"
+
+	// defaultHistoryPolicy is the default ILM policy of the history
+	// indices. The history of each tenant is written to a single index,
+	// without rollover, so the indices cannot be deleted by age: the
+	// history older than the retention is deleted by the indexer instead,
+	// and the policy lowers the priority of the history indices, recovered
+	// after the device indices when a node restarts. There are no snapshot
+	// indices in the service for another policy to manage.
+	defaultHistoryPolicy = `{
+	"phases": {
+		"hot": {
+			"min_age": "0ms",
+			"actions": {
+				"set_priority": {
+					"priority": 10
+				}
+			}
+		}
+	}
+}`
+
+	// splitIndexSuffix is the suffix of the temporary index an index is
+	// split into
+	splitIndexSuffix = ".split"
+
+	// healthCheckTimeout is the timeout of each wait for the health of an
+	// index, repeated until the index is healthy
+	healthCheckTimeout = time.Minute
+
+	// autoCreateIndexSetting is the cluster setting with the patterns of
+	// the indices automatically created by the writes
+	autoCreateIndexSetting = "action.auto_create_index"
+)
+
+// putLifecyclePolicy creates or updates the ILM policy
+func (e *ElasticsearchClient) putLifecyclePolicy(ctx context.Context, name string,
+	policy json.RawMessage) error {
+	req := esapi.ILMPutLifecycleRequest{
+		Policy: name,
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"policy": policy,
+		}),
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to put the lifecycle policy")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		var response errorResponse
+		_ = json.NewDecoder(res.Body).Decode(&response)
+		return errors.Errorf("failed to set up the lifecycle policy %q: %s: %s",
+			name, res.Status(), response.Error.Reason)
+	}
+	return nil
+}
+
+// tenantDataTemplate returns the body of the index template with the index
+// settings of the client and the lifecycle policy, if any
+func (e *ElasticsearchClient) tenantDataTemplate(body string,
+	lifecyclePolicy string) (string, error) {
+	var template struct {
+		IndexPatterns []string `json:"index_patterns"`
+		Priority      int      `json:"priority"`
+		Template      struct {
+			Settings map[string]interface{} `json:"settings,omitempty"`
+			Mappings json.RawMessage        `json:"mappings"`
+		} `json:"template"`
+	}
+	if err := json.Unmarshal([]byte(body), &template); err != nil {
+		return "", err
+	}
+	if template.Template.Settings == nil {
+		template.Template.Settings = make(map[string]interface{})
+	}
+	settings := template.Template.Settings
+	settings["number_of_shards"] = e.indexSettings.Shards
+	settings["number_of_replicas"] = e.indexSettings.Replicas
+	if lifecyclePolicy != "" {
+		settings["index.lifecycle.name"] = lifecyclePolicy
+	}
+	data, err := json.Marshal(template)
+	return string(data), err
+}
+
+// IndexSizes returns the size of the primary shards of the open tenant
+// data indices, sorted by index
+func (e *ElasticsearchClient) IndexSizes(ctx context.Context) ([]*model.IndexSize, error) {
+	patterns := make([]string, 0, len(model.TenantData))
+	for _, data := range model.TenantData {
+		patterns = append(patterns, tenantDataIndices[data]+"-*")
+	}
+	req := esapi.CatIndicesRequest{
+		Index:  patterns,
+		Bytes:  "b",
+		Format: "json",
+		H:      []string{"index", "pri", "pri.store.size"},
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the indices")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, errors.Errorf("failed to list the indices: %s", res.Status())
+	}
+	var indices []struct {
+		Index  string `json:"index"`
+		Shards string `json:"pri"`
+		Size   string `json:"pri.store.size"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	sizes := make([]*model.IndexSize, 0, len(indices))
+	for _, index := range indices {
+		// the closed indices have no size
+		if index.Size == "" || strings.HasSuffix(index.Index, splitIndexSuffix) {
+			continue
+		}
+		shards, err := strconv.Atoi(index.Shards)
+		if err != nil {
+			return nil, errors.Errorf("invalid number of shards of the index %q: %q",
+				index.Index, index.Shards)
+		}
+		size, err := strconv.ParseInt(index.Size, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid size of the index %q: %q",
+				index.Index, index.Size)
+		}
+		sizes = append(sizes, &model.IndexSize{
+			Index:  index.Index,
+			Shards: shards,
+			Size:   size,
+		})
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		return sizes[i].Index < sizes[j].Index
+	})
+	return sizes, nil
+}
+
+// SplitIndex splits the primary shards of the index into the number of
+// shards, a multiple of its shards by a power of two, keeping the name and
+// the aliases of the index: the index is split into a temporary index,
+// which replaces the index and is cloned back into it. The writes to the
+// index are rejected during the split, and the reads fail while the index
+// is cloned; the automatic creation of the index by the writes is blocked
+// until the clone completes, in the cluster settings. An interrupted split
+// is resumed by calling SplitIndex again.
+func (e *ElasticsearchClient) SplitIndex(ctx context.Context, index string,
+	shards int) error {
+	if strings.HasSuffix(index, splitIndexSuffix) {
+		return errors.Errorf("cannot split the temporary index %q", index)
+	}
+	target := index + splitIndexSuffix
+	exists, err := e.indexExists(ctx, index)
+	if err != nil {
+		return err
+	}
+	targetExists, err := e.indexExists(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	if !exists && !targetExists {
+		return errors.Errorf("index not found: %q", index)
+	}
+	// the index does not exist between its replacement and the clone, and
+	// a write would create it from the template, failing the clone
+	if err := e.blockIndexCreation(ctx, index); err != nil {
+		return err
+	}
+
+	if exists {
+		if !targetExists {
+			err := e.putIndexSettings(ctx, index, map[string]interface{}{
+				"index.blocks.write": true,
+			})
+			if err != nil {
+				return err
+			}
+			err = e.resizeIndex(ctx, esapi.IndicesSplitRequest{
+				Index:  index,
+				Target: target,
+				Body: esutil.NewJSONReader(map[string]interface{}{
+					"settings": map[string]interface{}{
+						"index.number_of_shards": shards,
+					},
+				}),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := e.waitForIndex(ctx, target); err != nil {
+			return err
+		}
+		if err := e.replaceIndex(ctx, index, target); err != nil {
+			return err
+		}
+	}
+
+	err = e.resizeIndex(ctx, esapi.IndicesCloneRequest{
+		Index:  target,
+		Target: index,
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"settings": map[string]interface{}{
+				"index.blocks.write": false,
+			},
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	if err := e.waitForIndex(ctx, index); err != nil {
+		return err
+	}
+	if err := e.replaceIndex(ctx, target, index); err != nil {
+		return err
+	}
+	return e.unblockIndexCreation(ctx, index)
+}
+
+// blockIndexCreation excludes the index from the indices automatically
+// created, in the transient cluster settings
+func (e *ElasticsearchClient) blockIndexCreation(ctx context.Context,
+	index string) error {
+	transient, fallback, err := e.autoCreateIndex(ctx)
+	if err != nil {
+		return err
+	}
+	patterns := transient
+	if patterns == "" {
+		patterns = fallback
+	}
+	patterns = withoutIndexPattern(patterns, index)
+	switch patterns {
+	case "false":
+		return nil
+	case "", "true":
+		patterns = "*"
+	}
+	return e.putAutoCreateIndex(ctx, "-"+index+","+patterns)
+}
+
+// unblockIndexCreation removes the exclusion of the index added by
+// blockIndexCreation, restoring the previous settings
+func (e *ElasticsearchClient) unblockIndexCreation(ctx context.Context,
+	index string) error {
+	transient, fallback, err := e.autoCreateIndex(ctx)
+	if err != nil {
+		return err
+	}
+	patterns := withoutIndexPattern(transient, index)
+	if patterns == transient {
+		return nil
+	}
+	var value interface{} = patterns
+	if patterns == fallback || (patterns == "*" && fallback == "true") {
+		value = nil
+	}
+	return e.putAutoCreateIndex(ctx, value)
+}
+
+// autoCreateIndex returns the transient value of the automatic index
+// creation setting, if any, and the persistent or default value it falls
+// back to
+func (e *ElasticsearchClient) autoCreateIndex(ctx context.Context) (string,
+	string, error) {
+	includeDefaults, flatSettings := true, true
+	req := esapi.ClusterGetSettingsRequest{
+		IncludeDefaults: &includeDefaults,
+		FlatSettings:    &flatSettings,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to get the cluster settings")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return "", "", errors.Errorf("failed to get the cluster settings: %s",
+			res.Status())
+	}
+	var response struct {
+		Transient  map[string]interface{} `json:"transient"`
+		Persistent map[string]interface{} `json:"persistent"`
+		Defaults   map[string]interface{} `json:"defaults"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", "", errors.Wrap(err, "failed to parse the response")
+	}
+	transient, _ := response.Transient[autoCreateIndexSetting].(string)
+	fallback, ok := response.Persistent[autoCreateIndexSetting].(string)
+	if !ok {
+		fallback, _ = response.Defaults[autoCreateIndexSetting].(string)
+	}
+	return transient, fallback, nil
+}
+
+// putAutoCreateIndex sets the transient value of the automatic index
+// creation setting, or resets it if nil
+func (e *ElasticsearchClient) putAutoCreateIndex(ctx context.Context,
+	value interface{}) error {
+	req := esapi.ClusterPutSettingsRequest{
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"transient": map[string]interface{}{
+				autoCreateIndexSetting: value,
+			},
+		}),
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to update the cluster settings")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		var response errorResponse
+		_ = json.NewDecoder(res.Body).Decode(&response)
+		return errors.Errorf("failed to update the cluster settings: %s: %s",
+			res.Status(), response.Error.Reason)
+	}
+	return nil
+}
+
+// withoutIndexPattern removes the exclusion of the index from the patterns
+// of the automatic index creation setting
+func withoutIndexPattern(patterns, index string) string {
+	if patterns == "" {
+		return ""
+	}
+	kept := make([]string, 0, strings.Count(patterns, ",")+1)
+	for _, pattern := range strings.Split(patterns, ",") {
+		if strings.TrimSpace(pattern) != "-"+index {
+			kept = append(kept, pattern)
+		}
+	}
+	return strings.Join(kept, ",")
+}
+
+func (e *ElasticsearchClient) putIndexSettings(ctx context.Context, index string,
+	settings map[string]interface{}) error {
+	req := esapi.IndicesPutSettingsRequest{
+		Index: []string{index},
+		Body:  esutil.NewJSONReader(settings),
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to update the index settings")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to update the settings of the index %q: %s",
+			index, res.Status())
+	}
+	return nil
+}
+
+// resizeIndex executes the split or clone request
+func (e *ElasticsearchClient) resizeIndex(ctx context.Context,
+	req esapi.Request) error {
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to resize the index")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		var response errorResponse
+		_ = json.NewDecoder(res.Body).Decode(&response)
+		return errors.Errorf("failed to resize the index: %s: %s",
+			res.Status(), response.Error.Reason)
+	}
+	return nil
+}
+
+// waitForIndex waits for the primary shards of the index to be allocated
+func (e *ElasticsearchClient) waitForIndex(ctx context.Context, index string) error {
+	for {
+		req := esapi.ClusterHealthRequest{
+			Index:         []string{index},
+			WaitForStatus: "yellow",
+			Timeout:       healthCheckTimeout,
+		}
+		res, err := req.Do(ctx, e.client)
+		if err != nil {
+			return errors.Wrap(err, "failed to check the index health")
+		}
+		var response struct {
+			TimedOut bool `json:"timed_out"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&response)
+		res.Body.Close()
+		switch {
+		case err != nil:
+			return errors.Wrap(err, "failed to parse the response")
+		case res.StatusCode == http.StatusRequestTimeout || response.TimedOut:
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		case res.IsError():
+			return errors.Errorf("failed to check the health of the index %q: %s",
+				index, res.Status())
+		default:
+			return nil
+		}
+	}
+}
+
+// replaceIndex moves the aliases of the index to the replacement and
+// deletes the index, atomically
+func (e *ElasticsearchClient) replaceIndex(ctx context.Context, index,
+	replacement string) error {
+	req := esapi.IndicesGetAliasRequest{Index: []string{index}}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the aliases")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to get the aliases of the index %q: %s",
+			index, res.Status())
+	}
+	var response map[string]struct {
+		Aliases map[string]map[string]interface{} `json:"aliases"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Wrap(err, "failed to parse the response")
+	}
+	actions := make([]map[string]interface{}, 0, len(response[index].Aliases)+1)
+	for alias, definition := range response[index].Aliases {
+		definition["index"] = replacement
+		definition["alias"] = alias
+		actions = append(actions, map[string]interface{}{"add": definition})
+	}
+	actions = append(actions, map[string]interface{}{
+		"remove_index": map[string]interface{}{"index": index},
+	})
+	return updateAliases(ctx, e.client, actions...)
+}
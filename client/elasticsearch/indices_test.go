@@ -0,0 +1,278 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestMigrateIndexSettings(t *testing.T) {
+	server, requests := newTestServer(t, func(esRequest) (int, string) {
+		return http.StatusOK, ""
+	})
+	client, err := NewClient(
+		WithServerAddresses([]string{server.URL}),
+		WithIndexSettings(model.IndexSettings{Shards: 3, Replicas: 0}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, client.Migrate(context.Background()))
+
+	bodies := make(map[string]string)
+	for _, r := range *requests {
+		bodies[r.Method+" "+r.Path] = r.Body
+	}
+	assert.JSONEq(t, `{"policy": `+defaultHistoryPolicy+`}`,
+		bodies["PUT /_ilm/policy/reporting-device-history"])
+
+	type template struct {
+		Template struct {
+			Settings map[string]interface{} `json:"settings"`
+		} `json:"template"`
+	}
+	settings := func(name string) map[string]interface{} {
+		var body template
+		_ = json.Unmarshal([]byte(bodies["PUT /_index_template/"+name]), &body)
+		return body.Template.Settings
+	}
+	devices := settings(indexDevices)
+	assert.Equal(t, float64(3), devices["number_of_shards"])
+	assert.Equal(t, float64(0), devices["number_of_replicas"])
+	assert.Contains(t, devices, "analysis")
+	assert.NotContains(t, devices, "index.lifecycle.name")
+	assert.Equal(t, map[string]interface{}{
+		"number_of_shards":     float64(3),
+		"number_of_replicas":   float64(0),
+		"index.lifecycle.name": lifecyclePolicyHistory,
+	}, settings(indexDeviceHistory))
+	assert.Equal(t, map[string]interface{}{
+		"number_of_shards":   float64(1),
+		"number_of_replicas": float64(1),
+	}, settings(indexTenants))
+}
+
+func TestSplitIndex(t *testing.T) {
+	const index = "devices-_shared"
+	const target = index + splitIndexSuffix
+	aliases := `{"%s": {"aliases": {"devices-t1": {
+		"filter": {"term": {"tenantID": "t1"}},
+		"index_routing": "t1",
+		"search_routing": "t1"
+	}}}}`
+	testCases := map[string]struct {
+		exists     []string
+		transient  interface{}
+		persistent interface{}
+		calls      []string
+
+		block   string
+		restore string
+	}{
+		"split": {
+			exists: []string{index},
+			calls: []string{
+				"GET /_cluster/settings",
+				"PUT /_cluster/settings",
+				"PUT /" + index + "/_settings",
+				"PUT /" + index + "/_split/" + target,
+				"GET /_cluster/health/" + target,
+				"GET /" + index + "/_alias",
+				"POST /_aliases",
+				"PUT /" + target + "/_clone/" + index,
+				"GET /_cluster/health/" + index,
+				"GET /" + target + "/_alias",
+				"POST /_aliases",
+				"GET /_cluster/settings",
+				"PUT /_cluster/settings",
+			},
+			block:   `{"transient": {"action.auto_create_index": "-` + index + `,*"}}`,
+			restore: `{"transient": {"action.auto_create_index": null}}`,
+		},
+		"split, auto creation patterns": {
+			exists:    []string{index},
+			transient: "+devices-*,-*",
+			calls: []string{
+				"GET /_cluster/settings",
+				"PUT /_cluster/settings",
+				"PUT /" + index + "/_settings",
+				"PUT /" + index + "/_split/" + target,
+				"GET /_cluster/health/" + target,
+				"GET /" + index + "/_alias",
+				"POST /_aliases",
+				"PUT /" + target + "/_clone/" + index,
+				"GET /_cluster/health/" + index,
+				"GET /" + target + "/_alias",
+				"POST /_aliases",
+				"GET /_cluster/settings",
+				"PUT /_cluster/settings",
+			},
+			block:   `{"transient": {"action.auto_create_index": "-` + index + `,+devices-*,-*"}}`,
+			restore: `{"transient": {"action.auto_create_index": "+devices-*,-*"}}`,
+		},
+		"split, auto creation disabled": {
+			exists:     []string{index},
+			persistent: "false",
+			calls: []string{
+				"GET /_cluster/settings",
+				"PUT /" + index + "/_settings",
+				"PUT /" + index + "/_split/" + target,
+				"GET /_cluster/health/" + target,
+				"GET /" + index + "/_alias",
+				"POST /_aliases",
+				"PUT /" + target + "/_clone/" + index,
+				"GET /_cluster/health/" + index,
+				"GET /" + target + "/_alias",
+				"POST /_aliases",
+				"GET /_cluster/settings",
+			},
+		},
+		"resumed after the replacement of the index": {
+			exists:    []string{target},
+			transient: "-" + index + ",*",
+			calls: []string{
+				"GET /_cluster/settings",
+				"PUT /_cluster/settings",
+				"PUT /" + target + "/_clone/" + index,
+				"GET /_cluster/health/" + index,
+				"GET /" + target + "/_alias",
+				"POST /_aliases",
+				"GET /_cluster/settings",
+				"PUT /_cluster/settings",
+			},
+			block:   `{"transient": {"action.auto_create_index": "-` + index + `,*"}}`,
+			restore: `{"transient": {"action.auto_create_index": null}}`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			transient := tc.transient
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				if r.Path == "/_cluster/settings" {
+					return clusterSettings(t, r, &transient, tc.persistent)
+				}
+				switch r.Method {
+				case http.MethodHead:
+					for _, exists := range tc.exists {
+						if r.Path == "/"+exists {
+							return http.StatusOK, ""
+						}
+					}
+					return http.StatusNotFound, ""
+				case http.MethodGet:
+					if r.Path == "/"+index+"/_alias" {
+						return http.StatusOK, fmt.Sprintf(aliases, index)
+					} else if r.Path == "/"+target+"/_alias" {
+						return http.StatusOK, fmt.Sprintf(aliases, target)
+					}
+				}
+				return http.StatusOK, ""
+			})
+			client, err := NewClient(WithServerAddresses([]string{server.URL}))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.NoError(t, client.SplitIndex(context.Background(), index, 4))
+
+			calls := []string{}
+			bodies := make(map[string][]string)
+			for _, r := range *requests {
+				if r.Method == http.MethodHead {
+					continue
+				}
+				call := r.Method + " " + r.Path
+				calls = append(calls, call)
+				bodies[call] = append(bodies[call], r.Body)
+			}
+			assert.Equal(t, tc.calls, calls)
+
+			updates := bodies["POST /_aliases"]
+			assert.JSONEq(t, `{"actions": [
+				{"add": {
+					"index": "`+index+`",
+					"alias": "devices-t1",
+					"filter": {"term": {"tenantID": "t1"}},
+					"index_routing": "t1",
+					"search_routing": "t1"
+				}},
+				{"remove_index": {"index": "`+target+`"}}
+			]}`, updates[len(updates)-1])
+			if tc.block != "" {
+				puts := bodies["PUT /_cluster/settings"]
+				if assert.Len(t, puts, 2) {
+					assert.JSONEq(t, tc.block, puts[0])
+					assert.JSONEq(t, tc.restore, puts[1])
+				}
+			}
+			if len(tc.exists) == 1 && tc.exists[0] == index {
+				assert.JSONEq(t, `{"index.blocks.write": true}`,
+					bodies["PUT /"+index+"/_settings"][0])
+				assert.JSONEq(t, `{"settings": {"index.number_of_shards": 4}}`,
+					bodies["PUT /"+index+"/_split/"+target][0])
+			}
+		})
+	}
+}
+
+// clusterSettings responds to the cluster settings requests with the
+// automatic index creation setting, updating its transient value
+func clusterSettings(t *testing.T, r esRequest, transient *interface{},
+	persistent interface{}) (int, string) {
+	setting := func(value interface{}) map[string]interface{} {
+		if value == nil {
+			return map[string]interface{}{}
+		}
+		return map[string]interface{}{autoCreateIndexSetting: value}
+	}
+	if r.Method == http.MethodPut {
+		var update struct {
+			Transient map[string]interface{} `json:"transient"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(r.Body), &update))
+		*transient = update.Transient[autoCreateIndexSetting]
+		return http.StatusOK, ""
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"transient":  setting(*transient),
+		"persistent": setting(persistent),
+		"defaults":   setting("true"),
+	})
+	return http.StatusOK, string(body)
+}
+
+func TestSplitIndexNotFound(t *testing.T) {
+	server, _ := newTestServer(t, func(r esRequest) (int, string) {
+		if r.Method == http.MethodHead {
+			return http.StatusNotFound, ""
+		}
+		return http.StatusOK, ""
+	})
+	client, err := NewClient(WithServerAddresses([]string{server.URL}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = client.SplitIndex(context.Background(), "devices-t1", 2)
+	assert.EqualError(t, err, `index not found: "devices-t1"`)
+	err = client.SplitIndex(context.Background(), "devices-t1"+splitIndexSuffix, 2)
+	assert.EqualError(t, err, `cannot split the temporary index "devices-t1.split"`)
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+type getLeaseResponse struct {
+	Found       bool         `json:"found"`
+	SeqNo       int          `json:"_seq_no"`
+	PrimaryTerm int          `json:"_primary_term"`
+	Source      *model.Lease `json:"_source"`
+}
+
+// getLease returns the lease with its sequence number and primary term, to
+// update it with optimistic concurrency control
+func (e *ElasticsearchClient) getLease(ctx context.Context,
+	id string) (*getLeaseResponse, error) {
+	req := esapi.GetRequest{
+		Index:      indexIndexerState,
+		DocumentID: id,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the lease")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return &getLeaseResponse{}, nil
+	} else if res.IsError() {
+		return nil, errors.Errorf("failed to get the lease: %s", res.Status())
+	}
+
+	var response getLeaseResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	if response.Source == nil {
+		response.Found = false
+	}
+	return &response, nil
+}
+
+// AcquireLease acquires or renews the lease for the holder until the
+// duration elapses; it returns false if another holder has the lease
+func (e *ElasticsearchClient) AcquireLease(ctx context.Context, id, holder string,
+	duration time.Duration) (bool, error) {
+	current, err := e.getLease(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	lease := &model.Lease{
+		ID:         id,
+		Holder:     holder,
+		AcquiredAt: now,
+		RenewedAt:  now,
+		ExpiresAt:  now.Add(duration),
+	}
+	req := esapi.IndexRequest{
+		Index:      indexIndexerState,
+		DocumentID: id,
+		Body:       esutil.NewJSONReader(lease),
+	}
+	if current.Found {
+		if current.Source.Holder != holder && !current.Source.Expired(now) {
+			return false, nil
+		} else if current.Source.Holder == holder {
+			lease.AcquiredAt = current.Source.AcquiredAt
+		}
+		req.IfSeqNo = &current.SeqNo
+		req.IfPrimaryTerm = &current.PrimaryTerm
+	} else {
+		req.OpType = "create"
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to acquire the lease")
+	}
+	defer res.Body.Close()
+
+	// another holder acquired the lease since we read it
+	if res.StatusCode == http.StatusConflict {
+		return false, nil
+	} else if res.IsError() {
+		return false, errors.Errorf("failed to acquire the lease: %s", res.Status())
+	}
+	return true, nil
+}
+
+// ReleaseLease releases the lease, if still held by the holder
+func (e *ElasticsearchClient) ReleaseLease(ctx context.Context, id, holder string) error {
+	current, err := e.getLease(ctx, id)
+	if err != nil {
+		return err
+	} else if !current.Found || current.Source.Holder != holder {
+		return nil
+	}
+	req := esapi.DeleteRequest{
+		Index:         indexIndexerState,
+		DocumentID:    id,
+		IfSeqNo:       &current.SeqNo,
+		IfPrimaryTerm: &current.PrimaryTerm,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to release the lease")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound &&
+		res.StatusCode != http.StatusConflict {
+		return errors.Errorf("failed to release the lease: %s", res.Status())
+	}
+	return nil
+}
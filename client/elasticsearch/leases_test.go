@@ -0,0 +1,101 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireLease(t *testing.T) {
+	expired := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano)
+	valid := time.Now().Add(time.Minute).UTC().Format(time.RFC3339Nano)
+	testCases := map[string]struct {
+		lease     string
+		writeCode int
+
+		acquired bool
+		query    string
+	}{
+		"ok, new lease": {
+			writeCode: http.StatusCreated,
+			acquired:  true,
+			query:     "op_type=create",
+		},
+		"ok, renewed": {
+			lease: `{"_seq_no": 7, "_primary_term": 2, "found": true, "_source": {
+				"id": "lease", "holder": "replica", "expiresAt": "` + valid + `"}}`,
+			writeCode: http.StatusOK,
+			acquired:  true,
+			query:     "if_primary_term=2&if_seq_no=7",
+		},
+		"ok, expired lease taken over": {
+			lease: `{"_seq_no": 7, "_primary_term": 2, "found": true, "_source": {
+				"id": "lease", "holder": "other", "expiresAt": "` + expired + `"}}`,
+			writeCode: http.StatusOK,
+			acquired:  true,
+			query:     "if_primary_term=2&if_seq_no=7",
+		},
+		"ko, held by another holder": {
+			lease: `{"_seq_no": 7, "_primary_term": 2, "found": true, "_source": {
+				"id": "lease", "holder": "other", "expiresAt": "` + valid + `"}}`,
+		},
+		"ko, taken over concurrently": {
+			lease: `{"_seq_no": 7, "_primary_term": 2, "found": true, "_source": {
+				"id": "lease", "holder": "other", "expiresAt": "` + expired + `"}}`,
+			writeCode: http.StatusConflict,
+			query:     "if_primary_term=2&if_seq_no=7",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				if r.Method == http.MethodGet {
+					if tc.lease == "" {
+						return http.StatusNotFound, `{"found": false}`
+					}
+					return http.StatusOK, tc.lease
+				}
+				return tc.writeCode, ""
+			})
+			client, err := NewClient(WithServerAddresses([]string{server.URL}))
+			if !assert.NoError(t, err) {
+				return
+			}
+			acquired, err := client.AcquireLease(context.Background(), "lease",
+				"replica", time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.acquired, acquired)
+
+			writes := []esRequest{}
+			for _, req := range *requests {
+				if req.Method != http.MethodGet {
+					writes = append(writes, req)
+				}
+			}
+			if tc.query == "" {
+				assert.Empty(t, writes)
+			} else if assert.Len(t, writes, 1) {
+				assert.Equal(t, "/"+indexIndexerState+"/_doc/lease", writes[0].Path)
+				assert.Equal(t, tc.query, writes[0].Query)
+				assert.Contains(t, writes[0].Body, `"holder":"replica"`)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+// ListTenantIDs returns the IDs of the tenants with data stored with the
+// index strategy
+func (e *ElasticsearchClient) ListTenantIDs(ctx context.Context,
+	strategy string) ([]string, error) {
+	source, err := newIndexStrategy(strategy, e.client)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, data := range model.TenantData {
+		tenantIDs, err := source.listTenants(ctx, tenantDataIndices[data])
+		if err != nil {
+			return nil, err
+		}
+		for _, tenantID := range tenantIDs {
+			found[tenantID] = true
+		}
+	}
+	tenantIDs := make([]string, 0, len(found))
+	for tenantID := range found {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+	return tenantIDs, nil
+}
+
+// MigrateTenant moves the data of the tenant stored with the index strategy
+// from to the indices of the strategy of the client. The migration of each
+// data is idempotent, and can be resumed if interrupted: the data already
+// migrated is skipped.
+//
+// Migrating to the shared strategy swaps the tenant index with its alias
+// atomically; migrating to the per-tenant strategy removes the alias before
+// copying the documents, so the data is not readable until it completes.
+// The documents written to the old indices during the copy are lost: the
+// indexer must be stopped during the migration.
+func (e *ElasticsearchClient) MigrateTenant(ctx context.Context, tenantID,
+	from string) error {
+	if from == e.strategy.name() {
+		return errors.Errorf("the data is already stored with the %q index strategy", from)
+	}
+	for _, data := range model.TenantData {
+		var err error
+		prefix := tenantDataIndices[data]
+		switch e.strategy.name() {
+		case IndexStrategyShared:
+			err = e.migrateToShared(ctx, prefix, tenantID)
+		case IndexStrategyPerTenant:
+			err = e.migrateToPerTenant(ctx, prefix, tenantID)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to migrate the tenant %s", data)
+		}
+	}
+	return nil
+}
+
+// Scripts of the reindex mapping the IDs of the documents of a tenant
+// between the strategies, see indexStrategy.documentID
+const (
+	scopeDocumentIDScript   = "ctx._id = params.prefix + ctx._id"
+	unscopeDocumentIDScript = "if (ctx._id.startsWith(params.prefix)) " +
+		"{ ctx._id = ctx._id.substring(params.prefix.length()) }"
+)
+
+// documentIDScript returns the script of the reindex rewriting the IDs of
+// the documents of the tenant
+func documentIDScript(source, tenantID string) map[string]interface{} {
+	return map[string]interface{}{
+		"source": source,
+		"lang":   "painless",
+		"params": map[string]interface{}{
+			"prefix": sharedDocumentID(tenantID, ""),
+		},
+	}
+}
+
+type reindexResponse struct {
+	Total            int               `json:"total"`
+	Created          int               `json:"created"`
+	Updated          int               `json:"updated"`
+	VersionConflicts int               `json:"version_conflicts"`
+	Failures         []json.RawMessage `json:"failures"`
+}
+
+// reindex copies the documents matching the query from the source index to
+// the destination index, rewriting them with the script, if any; it fails
+// unless all the documents were copied, as the source documents are deleted
+// afterwards
+func (e *ElasticsearchClient) reindex(ctx context.Context, source, dest string,
+	query model.Query, routing string, script map[string]interface{}) error {
+	sourceBody := map[string]interface{}{"index": source}
+	if query != nil {
+		sourceBody["query"] = query
+	}
+	destBody := map[string]interface{}{"index": dest}
+	if routing != "" {
+		destBody["routing"] = "=" + routing
+	}
+	body := map[string]interface{}{
+		"source": sourceBody,
+		"dest":   destBody,
+	}
+	if script != nil {
+		body["script"] = script
+	}
+	waitForCompletion := true
+	refresh := true
+	req := esapi.ReindexRequest{
+		Body:              esutil.NewJSONReader(body),
+		WaitForCompletion: &waitForCompletion,
+		Refresh:           &refresh,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to reindex")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to reindex: %s", res.Status())
+	}
+	var response reindexResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Wrap(err, "failed to parse the response")
+	}
+	if len(response.Failures) > 0 {
+		return errors.Errorf("failed to reindex: %d failures, the first one: %s",
+			len(response.Failures), response.Failures[0])
+	} else if copied := response.Created + response.Updated; copied < response.Total {
+		return errors.Errorf("failed to reindex: %d of %d documents copied, "+
+			"%d version conflicts", copied, response.Total, response.VersionConflicts)
+	}
+	return nil
+}
+
+// indexExists returns true if a concrete index exists with the name
+func (e *ElasticsearchClient) indexExists(ctx context.Context, index string) (bool, error) {
+	isAlias, err := aliasExists(ctx, e.client, index)
+	if err != nil || isAlias {
+		return false, err
+	}
+	req := esapi.IndicesExistsRequest{Index: []string{index}}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to check the index %q", index)
+	}
+	defer res.Body.Close()
+	return res.StatusCode == http.StatusOK, nil
+}
+
+func (e *ElasticsearchClient) migrateToShared(ctx context.Context, prefix,
+	tenantID string) error {
+	index := tenantIndex(prefix, tenantID)
+	exists, err := e.indexExists(ctx, index)
+	if err != nil || !exists {
+		return err
+	}
+	shared := e.strategy.(*sharedStrategy)
+	if err := shared.ensureSharedIndex(ctx, prefix); err != nil {
+		return err
+	}
+	err = e.reindex(ctx, index, sharedIndex(prefix), nil, tenantID,
+		documentIDScript(scopeDocumentIDScript, tenantID))
+	if err != nil {
+		return err
+	}
+	return updateAliases(ctx, e.client,
+		aliasAction(prefix, tenantID, false),
+		map[string]interface{}{
+			"remove_index": map[string]interface{}{"index": index},
+		},
+	)
+}
+
+func (e *ElasticsearchClient) migrateToPerTenant(ctx context.Context, prefix,
+	tenantID string) error {
+	index := tenantIndex(prefix, tenantID)
+	isAlias, err := aliasExists(ctx, e.client, index)
+	if err != nil {
+		return err
+	}
+	if isAlias {
+		err = updateAliases(ctx, e.client, map[string]interface{}{
+			"remove": map[string]interface{}{
+				"index": sharedIndex(prefix),
+				"alias": index,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// the alias may have been removed by an interrupted migration: copy
+	// the documents left in the shared index, if any
+	exists, err := e.indexExists(ctx, sharedIndex(prefix))
+	if err != nil || !exists {
+		return err
+	}
+	if err := createIndex(ctx, e.client, index, nil); err != nil {
+		return err
+	}
+	query := model.Query{
+		"term": map[string]interface{}{fieldTenantID: tenantID},
+	}
+	err = e.reindex(ctx, sharedIndex(prefix), index, query, "",
+		documentIDScript(unscopeDocumentIDScript, tenantID))
+	if err != nil {
+		return err
+	}
+	return deleteTenantDocuments(ctx, e.client, sharedIndex(prefix), tenantID)
+}
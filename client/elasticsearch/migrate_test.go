@@ -0,0 +1,119 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestMigrateTenant(t *testing.T) {
+	testCases := map[string]struct {
+		strategy    string
+		from        string
+		aliasStatus int
+		reindex     string
+
+		script  string
+		deletes int
+		err     string
+	}{
+		"ok, to per-tenant": {
+			strategy:    IndexStrategyPerTenant,
+			from:        IndexStrategyShared,
+			aliasStatus: http.StatusOK,
+			reindex:     `{"total": 2, "created": 2, "updated": 0, "failures": []}`,
+			script:      unscopeDocumentIDScript,
+			deletes:     len(model.TenantData),
+		},
+		"ok, to shared": {
+			strategy:    IndexStrategyShared,
+			from:        IndexStrategyPerTenant,
+			aliasStatus: http.StatusNotFound,
+			reindex:     `{"total": 2, "created": 1, "updated": 1, "failures": []}`,
+			script:      scopeDocumentIDScript,
+			deletes:     len(model.TenantData),
+		},
+		"ko, to per-tenant, failures": {
+			strategy:    IndexStrategyPerTenant,
+			from:        IndexStrategyShared,
+			aliasStatus: http.StatusOK,
+			reindex: `{"total": 2, "created": 1, "failures": [
+				{"id": "tenant/2", "cause": {"type": "mapper_parsing_exception"}}
+			]}`,
+			script: unscopeDocumentIDScript,
+			err: `failed to migrate the tenant devices: failed to reindex: 1 failures, ` +
+				`the first one: {"id": "tenant/2", "cause": {"type": "mapper_parsing_exception"}}`,
+		},
+		"ko, to shared, version conflicts": {
+			strategy:    IndexStrategyShared,
+			from:        IndexStrategyPerTenant,
+			aliasStatus: http.StatusNotFound,
+			reindex:     `{"total": 2, "created": 1, "version_conflicts": 1, "failures": []}`,
+			script:      scopeDocumentIDScript,
+			err: "failed to migrate the tenant devices: failed to reindex: " +
+				"1 of 2 documents copied, 1 version conflicts",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				switch {
+				case r.Method == http.MethodHead && strings.HasPrefix(r.Path, "/_alias/"):
+					if strings.HasSuffix(r.Path, "-tenant") {
+						return tc.aliasStatus, ""
+					}
+					return http.StatusNotFound, ""
+				case r.Path == "/_reindex":
+					return http.StatusOK, tc.reindex
+				}
+				return http.StatusOK, ""
+			})
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(tc.strategy),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			err = client.MigrateTenant(context.Background(), "tenant", tc.from)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			// the source documents are deleted only once copied
+			deletes := 0
+			for _, r := range *requests {
+				switch {
+				case r.Path == "/_reindex":
+					assert.Contains(t, r.Body, `"prefix":"tenant/"`)
+					assert.Contains(t, r.Body, `"source":"`+tc.script+`"`)
+				case strings.HasSuffix(r.Path, "/_delete_by_query"),
+					r.Path == "/_aliases" && strings.Contains(r.Body, "remove_index"):
+					deletes++
+				}
+			}
+			assert.Equal(t, tc.deletes, deletes)
+		})
+	}
+}
@@ -0,0 +1,504 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+// Index strategies, mapping the data of the tenants to indices
+const (
+	// IndexStrategyPerTenant stores the data of each tenant in its own
+	// indices
+	IndexStrategyPerTenant = "per-tenant"
+	// IndexStrategyShared stores the data of all the tenants in shared
+	// indices, routed by tenant, and reads it through per-tenant filtered
+	// aliases
+	IndexStrategyShared = "shared"
+)
+
+// sharedIndexSuffix is the suffix of the shared indices; tenant IDs cannot
+// start with an underscore, so the shared indices never collide with the
+// indices of a tenant
+const sharedIndexSuffix = "_shared"
+
+// fieldTenantID is the field holding the tenant ID in all the documents
+const fieldTenantID = "tenantID"
+
+// tenantIndex returns the name the data of the tenant is read from: a
+// concrete index with the per-tenant strategy, a filtered alias of the
+// shared index with the shared strategy
+func tenantIndex(prefix, tenantID string) string {
+	return prefix + "-" + tenantID
+}
+
+func sharedIndex(prefix string) string {
+	return prefix + "-" + sharedIndexSuffix
+}
+
+// indexStrategy maps the data of the tenants to indices; the methods
+// taking a prefix apply to the indices of one data of the tenants, see
+// tenantDataIndices
+type indexStrategy interface {
+	name() string
+	// writeIndex returns the index the documents of the tenant are
+	// written to
+	writeIndex(prefix, tenantID string) string
+	// routing returns the routing of the documents of the tenant
+	routing(tenantID string) string
+	// documentID returns the ID of the document of the tenant with the ID
+	documentID(tenantID, id string) string
+	// sourceID returns the ID a document of the tenant was indexed with,
+	// the inverse of documentID
+	sourceID(tenantID, docID string) string
+	// prepareTenant creates the index of the tenant with the settings, if
+	// it does not exist yet
+	prepareTenant(ctx context.Context, prefix, tenantID string,
+		settings model.IndexSettings) error
+	// prepareWrite makes the documents of the tenant written to the index
+	// readable from tenantIndex
+	prepareWrite(ctx context.Context, prefix, tenantID string) error
+	// suspendTenant hides the data of the tenant from the reads
+	suspendTenant(ctx context.Context, prefix, tenantID string) error
+	// resumeTenant restores the reads hidden by suspendTenant
+	resumeTenant(ctx context.Context, prefix, tenantID string) error
+	// deleteTenant deletes the data of the tenant
+	deleteTenant(ctx context.Context, prefix, tenantID string) error
+	// listTenants returns the IDs of the tenants with an index
+	listTenants(ctx context.Context, prefix string) ([]string, error)
+}
+
+func newIndexStrategy(name string, client *es.Client) (indexStrategy, error) {
+	switch name {
+	case IndexStrategyPerTenant, "":
+		return &perTenantStrategy{client: client}, nil
+	case IndexStrategyShared:
+		return &sharedStrategy{client: client}, nil
+	default:
+		return nil, errors.Errorf("unknown index strategy: %q", name)
+	}
+}
+
+// createIndex creates the index with the body, if it does not exist yet
+func createIndex(ctx context.Context, client *es.Client, index string,
+	body interface{}) error {
+	req := esapi.IndicesCreateRequest{Index: index}
+	if body != nil {
+		req.Body = esutil.NewJSONReader(body)
+	}
+	res, err := req.Do(ctx, client)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create the index %q", index)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		var response errorResponse
+		_ = json.NewDecoder(res.Body).Decode(&response)
+		if response.Error.Type == errTypeIndexExists {
+			return nil
+		}
+		return errors.Errorf("failed to create the index %q: %s", index, res.Status())
+	}
+	return nil
+}
+
+// updateAliases applies the alias actions atomically
+func updateAliases(ctx context.Context, client *es.Client,
+	actions ...map[string]interface{}) error {
+	req := esapi.IndicesUpdateAliasesRequest{
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"actions": actions,
+		}),
+	}
+	res, err := req.Do(ctx, client)
+	if err != nil {
+		return errors.Wrap(err, "failed to update the aliases")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		var response errorResponse
+		_ = json.NewDecoder(res.Body).Decode(&response)
+		return errors.Errorf("failed to update the aliases: %s: %s",
+			res.Status(), response.Error.Reason)
+	}
+	return nil
+}
+
+// aliasExists returns true if the alias exists
+func aliasExists(ctx context.Context, client *es.Client, alias string) (bool, error) {
+	req := esapi.IndicesExistsAliasRequest{Name: []string{alias}}
+	res, err := req.Do(ctx, client)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to check the alias %q", alias)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.Errorf("failed to check the alias %q: %s",
+			alias, res.Status())
+	}
+}
+
+// perTenantStrategy stores the data of each tenant in its own indices,
+// created implicitly by the first write
+type perTenantStrategy struct {
+	client *es.Client
+}
+
+func (s *perTenantStrategy) name() string {
+	return IndexStrategyPerTenant
+}
+
+func (s *perTenantStrategy) writeIndex(prefix, tenantID string) string {
+	return tenantIndex(prefix, tenantID)
+}
+
+func (s *perTenantStrategy) routing(string) string {
+	return ""
+}
+
+func (s *perTenantStrategy) documentID(_, id string) string {
+	return id
+}
+
+func (s *perTenantStrategy) sourceID(_, docID string) string {
+	return docID
+}
+
+func (s *perTenantStrategy) prepareTenant(ctx context.Context, prefix, tenantID string,
+	settings model.IndexSettings) error {
+	return createIndex(ctx, s.client, tenantIndex(prefix, tenantID),
+		map[string]interface{}{"settings": settings})
+}
+
+func (s *perTenantStrategy) prepareWrite(context.Context, string, string) error {
+	return nil
+}
+
+// suspendTenant closes the index of the tenant, rejecting the writes too
+func (s *perTenantStrategy) suspendTenant(ctx context.Context, prefix, tenantID string) error {
+	ignoreUnavailable := true
+	req := esapi.IndicesCloseRequest{
+		Index:             []string{tenantIndex(prefix, tenantID)},
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to close the tenant index")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to close the tenant index: %s", res.Status())
+	}
+	return nil
+}
+
+func (s *perTenantStrategy) resumeTenant(ctx context.Context, prefix, tenantID string) error {
+	ignoreUnavailable := true
+	req := esapi.IndicesOpenRequest{
+		Index:             []string{tenantIndex(prefix, tenantID)},
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to open the tenant index")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to open the tenant index: %s", res.Status())
+	}
+	return nil
+}
+
+func (s *perTenantStrategy) deleteTenant(ctx context.Context, prefix, tenantID string) error {
+	ignoreUnavailable := true
+	req := esapi.IndicesDeleteRequest{
+		Index:             []string{tenantIndex(prefix, tenantID)},
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete the tenant index")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return errors.Errorf("failed to delete the tenant index: %s", res.Status())
+	}
+	return nil
+}
+
+// listTenants returns the IDs of the tenants with a concrete index
+func (s *perTenantStrategy) listTenants(ctx context.Context, prefix string) ([]string, error) {
+	req := esapi.CatIndicesRequest{
+		Index:  []string{prefix + "-*"},
+		Format: "json",
+		H:      []string{"index"},
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the indices")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, errors.Errorf("failed to list the indices: %s", res.Status())
+	}
+	var indices []struct {
+		Index string `json:"index"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	tenantIDs := make([]string, 0, len(indices))
+	for _, index := range indices {
+		// skip the shared index and the temporary indices of the splits
+		if index.Index == sharedIndex(prefix) ||
+			strings.HasSuffix(index.Index, splitIndexSuffix) {
+			continue
+		}
+		tenantIDs = append(tenantIDs, strings.TrimPrefix(index.Index, prefix+"-"))
+	}
+	sort.Strings(tenantIDs)
+	return tenantIDs, nil
+}
+
+// sharedStrategy stores the data of all the tenants in one index per data,
+// routed by tenant, and reads the data of each tenant through a filtered
+// alias named after its index with the per-tenant strategy. As the writes
+// cannot be rejected per tenant, the suspension of a tenant only hides its
+// data from the reads.
+type sharedStrategy struct {
+	client *es.Client
+
+	// prepared caches the shared indices and tenant aliases known to exist
+	prepared sync.Map
+}
+
+func (s *sharedStrategy) name() string {
+	return IndexStrategyShared
+}
+
+func (s *sharedStrategy) writeIndex(prefix, _ string) string {
+	return sharedIndex(prefix)
+}
+
+func (s *sharedStrategy) routing(tenantID string) string {
+	return tenantID
+}
+
+// documentID scopes the ID to the tenant: the IDs are unique per tenant
+// only, and the documents of two tenants routed to the same shard would
+// overwrite each other
+func (s *sharedStrategy) documentID(tenantID, id string) string {
+	return sharedDocumentID(tenantID, id)
+}
+
+func (s *sharedStrategy) sourceID(tenantID, docID string) string {
+	return strings.TrimPrefix(docID, sharedDocumentID(tenantID, ""))
+}
+
+// sharedDocumentID returns the ID of the document of the tenant in the
+// shared indices
+func sharedDocumentID(tenantID, id string) string {
+	return tenantID + "/" + id
+}
+
+// aliasAction returns the action adding the alias of the tenant; the alias
+// of a suspended tenant matches no documents
+func aliasAction(prefix, tenantID string, suspended bool) map[string]interface{} {
+	filter := map[string]interface{}{
+		"term": map[string]interface{}{fieldTenantID: tenantID},
+	}
+	if suspended {
+		filter = map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{"match_all": map[string]interface{}{}},
+			},
+		}
+	}
+	return map[string]interface{}{
+		"add": map[string]interface{}{
+			"index":   sharedIndex(prefix),
+			"alias":   tenantIndex(prefix, tenantID),
+			"filter":  filter,
+			"routing": tenantID,
+		},
+	}
+}
+
+// ensureSharedIndex creates the shared index, if it does not exist yet
+func (s *sharedStrategy) ensureSharedIndex(ctx context.Context, prefix string) error {
+	index := sharedIndex(prefix)
+	if _, ok := s.prepared.Load(index); ok {
+		return nil
+	}
+	if err := createIndex(ctx, s.client, index, nil); err != nil {
+		return err
+	}
+	s.prepared.Store(index, true)
+	return nil
+}
+
+// prepareTenant creates the alias of the tenant, if it does not exist yet;
+// the shared index has the settings of its index template
+func (s *sharedStrategy) prepareTenant(ctx context.Context, prefix, tenantID string,
+	_ model.IndexSettings) error {
+	return s.prepareWrite(ctx, prefix, tenantID)
+}
+
+// prepareWrite creates the alias of the tenant, if it does not exist yet,
+// leaving the aliases of the suspended tenants untouched
+func (s *sharedStrategy) prepareWrite(ctx context.Context, prefix, tenantID string) error {
+	alias := tenantIndex(prefix, tenantID)
+	if _, ok := s.prepared.Load(alias); ok {
+		return nil
+	}
+	if err := s.ensureSharedIndex(ctx, prefix); err != nil {
+		return err
+	}
+	exists, err := aliasExists(ctx, s.client, alias)
+	if err != nil {
+		return err
+	} else if !exists {
+		err = updateAliases(ctx, s.client, aliasAction(prefix, tenantID, false))
+		if err != nil {
+			return err
+		}
+	}
+	s.prepared.Store(alias, true)
+	return nil
+}
+
+func (s *sharedStrategy) suspendTenant(ctx context.Context, prefix, tenantID string) error {
+	if err := s.ensureSharedIndex(ctx, prefix); err != nil {
+		return err
+	}
+	return updateAliases(ctx, s.client, aliasAction(prefix, tenantID, true))
+}
+
+func (s *sharedStrategy) resumeTenant(ctx context.Context, prefix, tenantID string) error {
+	if err := s.ensureSharedIndex(ctx, prefix); err != nil {
+		return err
+	}
+	return updateAliases(ctx, s.client, aliasAction(prefix, tenantID, false))
+}
+
+// deleteTenant deletes the documents of the tenant from the shared index,
+// then its alias
+func (s *sharedStrategy) deleteTenant(ctx context.Context, prefix, tenantID string) error {
+	if err := deleteTenantDocuments(ctx, s.client, sharedIndex(prefix), tenantID); err != nil {
+		return err
+	}
+	alias := tenantIndex(prefix, tenantID)
+	exists, err := aliasExists(ctx, s.client, alias)
+	if err != nil {
+		return err
+	} else if exists {
+		err = updateAliases(ctx, s.client, map[string]interface{}{
+			"remove": map[string]interface{}{
+				"index": sharedIndex(prefix),
+				"alias": alias,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	s.prepared.Delete(alias)
+	return nil
+}
+
+// listTenants returns the IDs of the tenants with an alias
+func (s *sharedStrategy) listTenants(ctx context.Context, prefix string) ([]string, error) {
+	ignoreUnavailable := true
+	req := esapi.IndicesGetAliasRequest{
+		Index:             []string{sharedIndex(prefix)},
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, s.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the aliases")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return []string{}, nil
+	} else if res.IsError() {
+		return nil, errors.Errorf("failed to list the aliases: %s", res.Status())
+	}
+	var indices map[string]struct {
+		Aliases map[string]interface{} `json:"aliases"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	tenantIDs := []string{}
+	for alias := range indices[sharedIndex(prefix)].Aliases {
+		tenantIDs = append(tenantIDs, strings.TrimPrefix(alias, prefix+"-"))
+	}
+	sort.Strings(tenantIDs)
+	return tenantIDs, nil
+}
+
+// deleteTenantDocuments deletes the documents of the tenant from the index
+func deleteTenantDocuments(ctx context.Context, client *es.Client, index,
+	tenantID string) error {
+	ignoreUnavailable := true
+	refresh := true
+	req := esapi.DeleteByQueryRequest{
+		Index: []string{index},
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"query": map[string]interface{}{
+				"term": map[string]interface{}{fieldTenantID: tenantID},
+			},
+		}),
+		Routing:           []string{tenantID},
+		Conflicts:         "proceed",
+		Refresh:           &refresh,
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, client)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete the tenant documents")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return errors.Errorf("failed to delete the tenant documents: %s", res.Status())
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+type esRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+// newTestServer returns a fake Elasticsearch server recording the requests
+// and responding with the status and body returned by respond, an empty
+// object if the body is empty
+func newTestServer(t *testing.T,
+	respond func(r esRequest) (int, string)) (*httptest.Server, *[]esRequest) {
+	var mu sync.Mutex
+	requests := []esRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := esRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Body:   string(body),
+		}
+		code, response := http.StatusOK, ""
+		if req.Path != "/" {
+			mu.Lock()
+			requests = append(requests, req)
+			mu.Unlock()
+			code, response = respond(req)
+		}
+		if response == "" {
+			response = `{}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func bulkActions(body string) []bulkAction {
+	actions := []bulkAction{}
+	for i, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if i%2 == 0 {
+			var action bulkAction
+			_ = json.Unmarshal([]byte(line), &action)
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+func TestBulkIndexDevicesStrategies(t *testing.T) {
+	devices := []*model.Device{
+		model.NewDevice("1").SetTenantID("t1"),
+		model.NewDevice("2").SetTenantID("t2"),
+		model.NewDevice("3").SetTenantID("t1"),
+	}
+	testCases := map[string]struct {
+		strategy string
+		setup    []string
+		actions  []bulkActionIndex
+	}{
+		"per-tenant": {
+			strategy: IndexStrategyPerTenant,
+			actions: []bulkActionIndex{
+				{ID: "1", Index: "devices-t1"},
+				{ID: "2", Index: "devices-t2"},
+				{ID: "3", Index: "devices-t1"},
+			},
+		},
+		"shared": {
+			strategy: IndexStrategyShared,
+			setup: []string{
+				"PUT /devices-_shared",
+				"HEAD /_alias/devices-t1",
+				"POST /_aliases",
+				"HEAD /_alias/devices-t2",
+			},
+			actions: []bulkActionIndex{
+				{ID: "t1/1", Index: "devices-_shared", Routing: "t1"},
+				{ID: "t2/2", Index: "devices-_shared", Routing: "t2"},
+				{ID: "t1/3", Index: "devices-_shared", Routing: "t1"},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server, requests := newTestServer(t, func(r esRequest) (int, string) {
+				// the alias of t2 exists already
+				if r.Method == http.MethodHead && r.Path != "/_alias/devices-t2" {
+					return http.StatusNotFound, ""
+				}
+				return http.StatusOK, ""
+			})
+			client, err := NewClient(
+				WithServerAddresses([]string{server.URL}),
+				WithIndexStrategy(tc.strategy),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			ctx := context.Background()
+			assert.NoError(t, client.BulkIndexDevices(ctx, devices))
+			// the shared index and the aliases are prepared once
+			assert.NoError(t, client.BulkIndexDevices(ctx, devices))
+
+			calls := []string{}
+			var actions []bulkActionIndex
+			for _, r := range *requests {
+				if r.Path == "/_bulk" {
+					if actions == nil {
+						for _, action := range bulkActions(r.Body) {
+							actions = append(actions, *action.Index)
+						}
+					}
+					continue
+				} else if strings.HasPrefix(r.Path, "/"+indexDeadLetters+"/") {
+					continue
+				}
+				calls = append(calls, r.Method+" "+r.Path)
+			}
+			assert.Equal(t, tc.setup, nilIfEmpty(calls))
+			assert.Equal(t, tc.actions, actions)
+		})
+	}
+}
+
+func nilIfEmpty(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+func TestSharedStrategyAliases(t *testing.T) {
+	var aliases []string
+	server, _ := newTestServer(t, func(r esRequest) (int, string) {
+		if r.Path == "/_aliases" {
+			aliases = append(aliases, r.Body)
+		}
+		return http.StatusOK, ""
+	})
+	client, err := NewClient(
+		WithServerAddresses([]string{server.URL}),
+		WithIndexStrategy(IndexStrategyShared),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx := context.Background()
+	assert.NoError(t, client.CloseTenantIndices(ctx, "tenant"))
+	if assert.Len(t, aliases, len(model.TenantData)) {
+		assert.JSONEq(t, `{"actions": [{"add": {
+			"index": "devices-_shared",
+			"alias": "devices-tenant",
+			"routing": "tenant",
+			"filter": {"bool": {"must_not": {"match_all": {}}}}
+		}}]}`, aliases[0])
+	}
+
+	aliases = nil
+	assert.NoError(t, client.OpenTenantIndices(ctx, "tenant"))
+	if assert.Len(t, aliases, len(model.TenantData)) {
+		assert.JSONEq(t, `{"actions": [{"add": {
+			"index": "device-history-_shared",
+			"alias": "device-history-tenant",
+			"routing": "tenant",
+			"filter": {"term": {"tenantID": "tenant"}}
+		}}]}`, aliases[1])
+	}
+}
+
+func TestNewClientUnknownStrategy(t *testing.T) {
+	_, err := NewClient(WithIndexStrategy("sharded"))
+	assert.EqualError(t, err, `unknown index strategy: "sharded"`)
+}
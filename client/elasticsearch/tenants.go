@@ -0,0 +1,249 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	indexTenants         = "reporting-tenants"
+	indexTenantsTemplate = `{
+	"index_patterns": ["reporting-tenants"],
+	"priority": 1,
+	"template": {
+		"settings": {
+			"number_of_shards": 1,
+			"number_of_replicas": 1
+		},
+		"mappings": {
+			"_source": {
+				"enabled": true
+			},
+			"properties": {
+				"id": {
+					"type": "keyword"
+				},
+				"tier": {
+					"type": "keyword"
+				},
+				"status": {
+					"type": "keyword"
+				},
+				"createdAt": {
+					"type": "date"
+				},
+				"updatedAt": {
+					"type": "date"
+				},
+				"deletion": {
+					"properties": {
+						"startedAt": {
+							"type": "date"
+						},
+						"finishedAt": {
+							"type": "date"
+						},
+						"deleted": {
+							"type": "keyword"
+						},
+						"attempts": {
+							"type": "integer"
+						},
+						"error": {
+							"type": "text"
+						}
+					}
+				}
+			}
+		}
+	}
+}`
+
+	errTypeIndexExists = "resource_already_exists_exception"
+)
+
+// tenantDataIndices are the prefixes of the indices holding each data of
+// the tenants
+var tenantDataIndices = map[string]string{
+	model.TenantDataDevices:     indexDevices,
+	model.TenantDataHistory:     indexDeviceHistory,
+	model.TenantDataDeployments: indexDeployments,
+}
+
+type errorResponse struct {
+	Error struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// CreateTenantIndices creates the indices of the tenant with the given
+// settings, if they do not exist yet; with the shared index strategy, it
+// creates the aliases of the tenant, and the settings are ignored
+func (e *ElasticsearchClient) CreateTenantIndices(ctx context.Context, tenantID string,
+	settings model.IndexSettings) error {
+	for _, data := range model.TenantData {
+		err := e.strategy.prepareTenant(ctx, tenantDataIndices[data], tenantID, settings)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenTenantIndices restores the access to the data of the tenant removed
+// by CloseTenantIndices
+func (e *ElasticsearchClient) OpenTenantIndices(ctx context.Context, tenantID string) error {
+	for _, data := range model.TenantData {
+		if err := e.strategy.resumeTenant(ctx, tenantDataIndices[data], tenantID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CloseTenantIndices keeps the data of the tenant, but excludes it from the
+// searches; with the per-tenant index strategy, the writes are rejected too
+func (e *ElasticsearchClient) CloseTenantIndices(ctx context.Context, tenantID string) error {
+	for _, data := range model.TenantData {
+		if err := e.strategy.suspendTenant(ctx, tenantDataIndices[data], tenantID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteTenantData deletes the data of the tenant, one of model.TenantData;
+// deleting data which does not exist is not an error
+func (e *ElasticsearchClient) DeleteTenantData(ctx context.Context, tenantID string,
+	data string) error {
+	prefix, ok := tenantDataIndices[data]
+	if !ok {
+		return errors.Errorf("unknown tenant data: %q", data)
+	}
+	return errors.Wrapf(e.strategy.deleteTenant(ctx, prefix, tenantID),
+		"failed to delete the tenant %s", data)
+}
+
+type getTenantResponse struct {
+	Found  bool          `json:"found"`
+	Source *model.Tenant `json:"_source"`
+}
+
+// GetTenant returns the tenant, or nil if not found
+func (e *ElasticsearchClient) GetTenant(ctx context.Context,
+	tenantID string) (*model.Tenant, error) {
+	req := esapi.GetRequest{
+		Index:      indexTenants,
+		DocumentID: tenantID,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the tenant")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if res.IsError() {
+		return nil, errors.Errorf("failed to get the tenant: %s", res.Status())
+	}
+
+	var response getTenantResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	if !response.Found {
+		return nil, nil
+	}
+	return response.Source, nil
+}
+
+// SaveTenant creates or replaces the tenant
+func (e *ElasticsearchClient) SaveTenant(ctx context.Context, tenant *model.Tenant) error {
+	req := esapi.IndexRequest{
+		Index:      indexTenants,
+		DocumentID: tenant.ID,
+		Body:       esutil.NewJSONReader(tenant),
+		Refresh:    "wait_for",
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return errors.Wrap(err, "failed to save the tenant")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.Errorf("failed to save the tenant: %s", res.Status())
+	}
+	return nil
+}
+
+type tenantsSearchResponse struct {
+	Hits struct {
+		Hits []struct {
+			Source *model.Tenant `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// tenantsSearchSize is the maximum number of tenants returned by a search
+const tenantsSearchSize = 10000
+
+// SearchTenants returns the tenants with the given status
+func (e *ElasticsearchClient) SearchTenants(ctx context.Context,
+	status string) ([]*model.Tenant, error) {
+	ignoreUnavailable := true
+	size := tenantsSearchSize
+	req := esapi.SearchRequest{
+		Index: []string{indexTenants},
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"query": map[string]interface{}{
+				"term": map[string]interface{}{"status": status},
+			},
+			"sort": []interface{}{"id"},
+		}),
+		Size:              &size,
+		IgnoreUnavailable: &ignoreUnavailable,
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search the tenants")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, errors.Errorf("failed to search the tenants: %s", res.Status())
+	}
+
+	var response tenantsSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+	tenants := make([]*model.Tenant, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		tenants = append(tenants, hit.Source)
+	}
+	return tenants, nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+const (
+	URISearchDevices = "/api/internal/v2/inventory/tenants/:tenant/filters/search"
+
+	defaultTimeout = 30 * time.Second
+)
+
+// Inventory scopes and attributes mapped to the device fields
+const (
+	scopeIdentity  = "identity"
+	scopeInventory = "inventory"
+	scopeSystem    = "system"
+	scopeTags      = "tags"
+
+	attrStatus    = "status"
+	attrName      = "name"
+	attrGroup     = "group"
+	attrCreatedTS = "created_ts"
+	attrUpdatedTS = "updated_ts"
+)
+
+// Client is the inventory service client
+type Client interface {
+	// SearchDevices returns a page of the devices of the tenant, or the
+	// devices with the given IDs, if any
+	SearchDevices(ctx context.Context, tenantID string, page, perPage int,
+		deviceIDs []string) ([]*model.Device, error)
+}
+
+type client struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewClient returns a new inventory service client
+func NewClient(baseURL string) Client {
+	return &client{
+		client:  &http.Client{Timeout: defaultTimeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+type searchParams struct {
+	Page      int      `json:"page"`
+	PerPage   int      `json:"per_page"`
+	DeviceIDs []string `json:"device_ids,omitempty"`
+}
+
+type attribute struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+	Scope string      `json:"scope"`
+}
+
+type device struct {
+	ID         string      `json:"id"`
+	Attributes []attribute `json:"attributes"`
+	UpdatedTS  *time.Time  `json:"updated_ts"`
+}
+
+// SearchDevices returns a page of the devices of the tenant, or the
+// devices with the given IDs, if any
+func (c *client) SearchDevices(ctx context.Context, tenantID string, page, perPage int,
+	deviceIDs []string) ([]*model.Device, error) {
+	body, err := json.Marshal(searchParams{
+		Page:      page,
+		PerPage:   perPage,
+		DeviceIDs: deviceIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	uri := c.baseURL + strings.Replace(URISearchDevices, ":tenant",
+		url.PathEscape(tenantID), 1)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri,
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search the devices")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf(
+			"failed to search the devices: unexpected status code %d",
+			rsp.StatusCode)
+	}
+
+	var devices []device
+	if err := json.NewDecoder(rsp.Body).Decode(&devices); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the response")
+	}
+
+	result := make([]*model.Device, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, d.toDevice(tenantID))
+	}
+	return result, nil
+}
+
+// toDevice converts the inventory device to a device document
+func (d *device) toDevice(tenantID string) *model.Device {
+	result := model.NewDevice(d.ID).SetTenantID(tenantID)
+	if d.UpdatedTS != nil {
+		result.SetUpdatedAt(*d.UpdatedTS)
+	}
+	for _, attr := range d.Attributes {
+		switch {
+		case attr.Scope == scopeSystem:
+			switch attr.Name {
+			case attrGroup:
+				if group, ok := attr.Value.(string); ok {
+					result.SetGroupName(group)
+				}
+			case attrCreatedTS:
+				if ts, ok := parseTime(attr.Value); ok {
+					result.SetCreatedAt(ts)
+				}
+			case attrUpdatedTS:
+				if ts, ok := parseTime(attr.Value); ok {
+					result.SetUpdatedAt(ts)
+				}
+			}
+			continue
+		case attr.Scope == scopeTags && attr.Name == attrName:
+			if name, ok := attr.Value.(string); ok {
+				result.SetName(name)
+			}
+			continue
+		case attr.Scope == scopeIdentity && attr.Name == attrStatus:
+			if status, ok := attr.Value.(string); ok {
+				result.SetStatus(status)
+			}
+		}
+
+		value := inventoryAttribute(attr)
+		if value == nil {
+			continue
+		}
+		switch attr.Scope {
+		case scopeIdentity:
+			result.IdentityAttributes = append(result.IdentityAttributes, value)
+		case scopeInventory:
+			result.InventoryAttributes = append(result.InventoryAttributes, value)
+		default:
+			result.CustomAttributes = append(result.CustomAttributes, value)
+		}
+	}
+	return result
+}
+
+// inventoryAttribute converts the attribute value, a string, a number or a
+// list of them, to an inventory attribute; nil if the value is invalid
+func inventoryAttribute(attr attribute) *model.InventoryAttribute {
+	result := model.NewInventoryAttribute().SetName(attr.Name)
+	switch value := attr.Value.(type) {
+	case string:
+		return result.SetString(value)
+	case float64:
+		return result.SetNumeric(value)
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			switch item := item.(type) {
+			case string:
+				values = append(values, item)
+			case float64:
+				// the documents hold a single numeric value: keep the
+				// first one
+				if len(values) == 0 {
+					return result.SetNumeric(item)
+				}
+			}
+		}
+		return result.SetStrings(values)
+	}
+	return nil
+}
+
+func parseTime(value interface{}) (time.Time, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, s)
+	return ts, err == nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+func TestSearchDevices(t *testing.T) {
+	created := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	updated := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		status int
+		body   string
+
+		devices []*model.Device
+		err     string
+	}{
+		"ok": {
+			status: http.StatusOK,
+			body: `[{
+				"id": "1",
+				"updated_ts": "2021-06-02T12:00:00Z",
+				"attributes": [
+					{"scope": "identity", "name": "mac", "value": "00:11:22:33:44:55"},
+					{"scope": "identity", "name": "status", "value": "accepted"},
+					{"scope": "inventory", "name": "mem_total_kB", "value": 1020664},
+					{"scope": "inventory", "name": "interfaces", "value": ["eth0", "wlan0"]},
+					{"scope": "system", "name": "group", "value": "prod"},
+					{"scope": "system", "name": "created_ts", "value": "2021-06-01T12:00:00Z"},
+					{"scope": "tags", "name": "name", "value": "device-1"},
+					{"scope": "tags", "name": "location", "value": "lab"},
+					{"scope": "inventory", "name": "invalid", "value": {"a": 1}}
+				]
+			}]`,
+			devices: []*model.Device{
+				model.NewDevice("1").
+					SetTenantID("tenant").
+					SetName("device-1").
+					SetGroupName("prod").
+					SetStatus("accepted").
+					SetCreatedAt(created).
+					SetUpdatedAt(updated),
+			},
+		},
+		"ko, unexpected status code": {
+			status: http.StatusInternalServerError,
+			err:    "failed to search the devices: unexpected status code 500",
+		},
+		"ko, malformed body": {
+			status: http.StatusOK,
+			body:   "{",
+			err:    "failed to parse the response: unexpected EOF",
+		},
+	}
+	testCases["ok"].devices[0].IdentityAttributes = model.DeviceInventory{
+		model.NewInventoryAttribute().SetName("mac").SetString("00:11:22:33:44:55"),
+		model.NewInventoryAttribute().SetName("status").SetString("accepted"),
+	}
+	testCases["ok"].devices[0].InventoryAttributes = model.DeviceInventory{
+		model.NewInventoryAttribute().SetName("mem_total_kB").SetNumeric(1020664),
+		model.NewInventoryAttribute().SetName("interfaces").
+			SetStrings([]string{"eth0", "wlan0"}),
+	}
+	testCases["ok"].devices[0].CustomAttributes = model.DeviceInventory{
+		model.NewInventoryAttribute().SetName("location").SetString("lab"),
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t, http.MethodPost, r.Method)
+					assert.Equal(t,
+						"/api/internal/v2/inventory/tenants/tenant/filters/search",
+						r.URL.Path)
+					var params map[string]interface{}
+					_ = json.NewDecoder(r.Body).Decode(&params)
+					assert.Equal(t, map[string]interface{}{
+						"page":       float64(2),
+						"per_page":   float64(100),
+						"device_ids": []interface{}{"1"},
+					}, params)
+					w.WriteHeader(tc.status)
+					_, _ = w.Write([]byte(tc.body))
+				}))
+			defer srv.Close()
+
+			client := NewClient(srv.URL)
+			devices, err := client.SearchDevices(context.Background(),
+				"tenant", 2, 100, []string{"1"})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.devices, devices)
+			}
+		})
+	}
+}
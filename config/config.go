@@ -16,6 +16,8 @@ package config
 
 import (
 	"github.com/mendersoftware/go-lib-micro/config"
+
+	"github.com/mendersoftware/reporting/model"
 )
 
 const (
@@ -24,6 +26,13 @@ const (
 	// SettingListenDefault is the default value for the listen address
 	SettingListenDefault = ":8080"
 
+	// SettingGRPCListen is the config key for the listen address of the
+	// gRPC server; an empty address disables it
+	SettingGRPCListen = "grpc_listen"
+	// SettingGRPCListenDefault is the default value for the listen address
+	// of the gRPC server
+	SettingGRPCListenDefault = ":8081"
+
 	// SettingElasticsearchAddreessees is the config key for the elasticsearch addresses
 	SettingElasticsearchAddresses = "addresses"
 	// SettingListenDefault is the default value for the elasticsearch addresses
@@ -33,13 +42,249 @@ const (
 	SettingDebugLog = "debug_log"
 	// SettingDebugLogDefault is the default value for the debug log enabling
 	SettingDebugLogDefault = false
+
+	// SettingHistoryRetention is the config key for the retention of the
+	// device attribute history; zero disables the clean-up
+	SettingHistoryRetention = "history_retention"
+	// SettingHistoryRetentionDefault is the default value for the retention
+	// of the device attribute history (90 days)
+	SettingHistoryRetentionDefault = "2160h"
+
+	// SettingDeploymentsAddr is the config key for the deployments service
+	// address; if empty, the deployments are not ingested
+	SettingDeploymentsAddr = "deployments_addr"
+	// SettingDeploymentsAddrDefault is the default value for the
+	// deployments service address
+	SettingDeploymentsAddrDefault = ""
+
+	// SettingDeviceAuthAddr is the config key for the deviceauth service
+	// address; if empty, the check-in times are not ingested
+	SettingDeviceAuthAddr = "deviceauth_addr"
+	// SettingDeviceAuthAddrDefault is the default value for the deviceauth
+	// service address
+	SettingDeviceAuthAddrDefault = ""
+
+	// SettingDeviceConnectAddr is the config key for the deviceconnect
+	// service address; if empty, the connection statuses are not ingested
+	SettingDeviceConnectAddr = "deviceconnect_addr"
+	// SettingDeviceConnectAddrDefault is the default value for the
+	// deviceconnect service address
+	SettingDeviceConnectAddrDefault = ""
+
+	// SettingInventoryAddr is the config key for the inventory service
+	// address, the source of truth of the reconcile command
+	SettingInventoryAddr = "inventory_addr"
+	// SettingInventoryAddrDefault is the default value for the inventory
+	// service address
+	SettingInventoryAddrDefault = ""
+
+	// SettingStaleDevicesThreshold is the config key for the default
+	// duration after which a device which didn't contact the server is
+	// reported as stale
+	SettingStaleDevicesThreshold = "stale_devices_threshold"
+	// SettingStaleDevicesThresholdDefault is the default value for the
+	// stale devices threshold
+	SettingStaleDevicesThresholdDefault = "24h"
+
+	// SettingGeoLatitudeAttribute is the config key for the name of the
+	// inventory attribute holding the latitude of the devices
+	SettingGeoLatitudeAttribute = "geo_latitude_attribute"
+	// SettingGeoLatitudeAttributeDefault is the default value for the name
+	// of the latitude attribute
+	SettingGeoLatitudeAttributeDefault = "latitude"
+
+	// SettingGeoLongitudeAttribute is the config key for the name of the
+	// inventory attribute holding the longitude of the devices
+	SettingGeoLongitudeAttribute = "geo_longitude_attribute"
+	// SettingGeoLongitudeAttributeDefault is the default value for the name
+	// of the longitude attribute
+	SettingGeoLongitudeAttributeDefault = "longitude"
+
+	// SettingVersionAttributes is the config key for the names of the
+	// inventory attributes compared and sorted by version order
+	SettingVersionAttributes = "version_attributes"
+	// SettingVersionAttributesDefault is the default value for the names
+	// of the version attributes
+	SettingVersionAttributesDefault = "rootfs-image.version,mender_client_version"
+
+	// SettingRateLimitRate is the config key for the number of requests
+	// per second allowed to each tenant; zero disables the rate limit
+	SettingRateLimitRate = "rate_limit_rate"
+	// SettingRateLimitRateDefault is the default value for the number of
+	// requests per second allowed to each tenant
+	SettingRateLimitRateDefault = 20
+
+	// SettingRateLimitBurst is the config key for the number of requests
+	// allowed at once to each tenant, above the rate
+	SettingRateLimitBurst = "rate_limit_burst"
+	// SettingRateLimitBurstDefault is the default value for the number of
+	// requests allowed at once to each tenant
+	SettingRateLimitBurstDefault = 40
+
+	// SettingRateLimitConcurrency is the config key for the number of
+	// requests in flight allowed to each tenant; zero disables the limit
+	SettingRateLimitConcurrency = "rate_limit_concurrency"
+	// SettingRateLimitConcurrencyDefault is the default value for the
+	// number of requests in flight allowed to each tenant
+	SettingRateLimitConcurrencyDefault = 8
+
+	// SettingRateLimitTenants is the config key for the per-tenant
+	// overrides of the rate limits
+	SettingRateLimitTenants = "rate_limit_tenants"
+
+	// SettingQueryTimeout is the config key for the timeout of the device
+	// searches and aggregations; zero disables the timeout
+	SettingQueryTimeout = "query_timeout"
+	// SettingQueryTimeoutDefault is the default value for the timeout of
+	// the device searches and aggregations
+	SettingQueryTimeoutDefault = "10s"
+
+	// SettingMaxBuckets is the config key for the maximum number of
+	// buckets of an aggregation
+	SettingMaxBuckets = "max_buckets"
+	// SettingMaxBucketsDefault is the default value for the maximum number
+	// of buckets of an aggregation
+	SettingMaxBucketsDefault = model.MaxBucketsDefault
+
+	// SettingMaxFilterClauses is the config key for the maximum number of
+	// filter predicates of a search
+	SettingMaxFilterClauses = "max_filter_clauses"
+	// SettingMaxFilterClausesDefault is the default value for the maximum
+	// number of filter predicates of a search
+	SettingMaxFilterClausesDefault = model.MaxFilterClausesDefault
+
+	// SettingMaxExpressionDepth is the config key for the maximum nesting
+	// depth of the filter expressions
+	SettingMaxExpressionDepth = "max_expression_depth"
+	// SettingMaxExpressionDepthDefault is the default value for the
+	// maximum nesting depth of the filter expressions
+	SettingMaxExpressionDepthDefault = model.FilterExpressionMaxDepth
+
+	// SettingAggregationCache is the config key for the cache of the
+	// aggregation results: "lru" for an in-process cache of the server,
+	// expiring only after the TTL for the devices indexed by the other
+	// processes, "redis" for a cache shared in Redis, empty to disable the
+	// cache
+	SettingAggregationCache = "aggregation_cache"
+	// SettingAggregationCacheDefault is the default value for the cache of
+	// the aggregation results
+	SettingAggregationCacheDefault = ""
+
+	// SettingAggregationCacheSize is the config key for the maximum number
+	// of entries of the in-process aggregation cache
+	SettingAggregationCacheSize = "aggregation_cache_size"
+	// SettingAggregationCacheSizeDefault is the default value for the
+	// maximum number of entries of the in-process aggregation cache
+	SettingAggregationCacheSizeDefault = 10000
+
+	// SettingAggregationCacheTTL is the config key for the time after which
+	// the cached aggregation results expire
+	SettingAggregationCacheTTL = "aggregation_cache_ttl"
+	// SettingAggregationCacheTTLDefault is the default value for the time
+	// after which the cached aggregation results expire
+	SettingAggregationCacheTTLDefault = "1m"
+
+	// SettingIndexStrategy is the config key for the strategy mapping the
+	// data of the tenants to indices: "per-tenant" for indices per tenant,
+	// "shared" for indices shared by the tenants, routed by tenant
+	SettingIndexStrategy = "index_strategy"
+	// SettingIndexStrategyDefault is the default value for the strategy
+	// mapping the data of the tenants to indices
+	SettingIndexStrategyDefault = "per-tenant"
+
+	// SettingIndexShards is the config key for the default number of
+	// primary shards of the tenant indices
+	SettingIndexShards = "index_shards"
+	// SettingIndexShardsDefault is the default value for the default
+	// number of primary shards of the tenant indices
+	SettingIndexShardsDefault = 1
+
+	// SettingIndexReplicas is the config key for the default number of
+	// replicas of the tenant indices
+	SettingIndexReplicas = "index_replicas"
+	// SettingIndexReplicasDefault is the default value for the default
+	// number of replicas of the tenant indices
+	SettingIndexReplicasDefault = 1
+
+	// SettingIndexTiers is the config key for the per-tier settings of the
+	// indices of the provisioned tenants
+	SettingIndexTiers = "index_tiers"
+
+	// SettingIndexTargetShardSize is the config key for the size the
+	// primary shards of the tenant indices should not exceed
+	SettingIndexTargetShardSize = "index_target_shard_size"
+	// SettingIndexTargetShardSizeDefault is the default value for the size
+	// the primary shards of the tenant indices should not exceed
+	SettingIndexTargetShardSizeDefault = "30gb"
+
+	// SettingHistoryLifecyclePolicy is the config key for the path of the
+	// file with the ILM policy of the history indices
+	SettingHistoryLifecyclePolicy = "history_lifecycle_policy"
+	// SettingHistoryLifecyclePolicyDefault is the default value for the
+	// path of the file with the ILM policy of the history indices
+	SettingHistoryLifecyclePolicyDefault = ""
+
+	// SettingIndexerSyncInterval is the config key for the interval
+	// between the sync cycles of the indexer daemon
+	SettingIndexerSyncInterval = "indexer_sync_interval"
+	// SettingIndexerSyncIntervalDefault is the default value for the
+	// interval between the sync cycles of the indexer daemon
+	SettingIndexerSyncIntervalDefault = "5m"
+
+	// SettingIndexerLeaseDuration is the config key for the duration of
+	// the lease electing the indexer replica running the sync cycles
+	SettingIndexerLeaseDuration = "indexer_lease_duration"
+	// SettingIndexerLeaseDurationDefault is the default value for the
+	// duration of the lease electing the indexer replica
+	SettingIndexerLeaseDurationDefault = "30s"
+
+	// SettingRedisURL is the config key for the URL of the Redis server
+	SettingRedisURL = "redis_url"
+	// SettingRedisURLDefault is the default value for the URL of the Redis
+	// server
+	SettingRedisURLDefault = "redis://localhost:6379/0"
 )
 
 var (
+	// SettingIndexTiersDefault is the default value for the per-tier
+	// settings of the indices of the provisioned tenants
+	SettingIndexTiersDefault = map[string]interface{}{
+		model.TierEnterprise: map[string]interface{}{"shards": 2},
+	}
+
 	// Defaults are the default configuration settings
 	Defaults = []config.Default{
 		{Key: SettingListen, Value: SettingListenDefault},
+		{Key: SettingGRPCListen, Value: SettingGRPCListenDefault},
 		{Key: SettingElasticsearchAddresses, Value: SettingElasticsearchAddressesDefault},
 		{Key: SettingDebugLog, Value: SettingDebugLogDefault},
+		{Key: SettingHistoryRetention, Value: SettingHistoryRetentionDefault},
+		{Key: SettingDeploymentsAddr, Value: SettingDeploymentsAddrDefault},
+		{Key: SettingDeviceAuthAddr, Value: SettingDeviceAuthAddrDefault},
+		{Key: SettingDeviceConnectAddr, Value: SettingDeviceConnectAddrDefault},
+		{Key: SettingInventoryAddr, Value: SettingInventoryAddrDefault},
+		{Key: SettingStaleDevicesThreshold, Value: SettingStaleDevicesThresholdDefault},
+		{Key: SettingGeoLatitudeAttribute, Value: SettingGeoLatitudeAttributeDefault},
+		{Key: SettingGeoLongitudeAttribute, Value: SettingGeoLongitudeAttributeDefault},
+		{Key: SettingVersionAttributes, Value: SettingVersionAttributesDefault},
+		{Key: SettingRateLimitRate, Value: SettingRateLimitRateDefault},
+		{Key: SettingRateLimitBurst, Value: SettingRateLimitBurstDefault},
+		{Key: SettingRateLimitConcurrency, Value: SettingRateLimitConcurrencyDefault},
+		{Key: SettingQueryTimeout, Value: SettingQueryTimeoutDefault},
+		{Key: SettingMaxBuckets, Value: SettingMaxBucketsDefault},
+		{Key: SettingMaxFilterClauses, Value: SettingMaxFilterClausesDefault},
+		{Key: SettingMaxExpressionDepth, Value: SettingMaxExpressionDepthDefault},
+		{Key: SettingAggregationCache, Value: SettingAggregationCacheDefault},
+		{Key: SettingAggregationCacheSize, Value: SettingAggregationCacheSizeDefault},
+		{Key: SettingAggregationCacheTTL, Value: SettingAggregationCacheTTLDefault},
+		{Key: SettingRedisURL, Value: SettingRedisURLDefault},
+		{Key: SettingIndexStrategy, Value: SettingIndexStrategyDefault},
+		{Key: SettingIndexShards, Value: SettingIndexShardsDefault},
+		{Key: SettingIndexReplicas, Value: SettingIndexReplicasDefault},
+		{Key: SettingIndexTiers, Value: SettingIndexTiersDefault},
+		{Key: SettingIndexTargetShardSize, Value: SettingIndexTargetShardSizeDefault},
+		{Key: SettingHistoryLifecyclePolicy, Value: SettingHistoryLifecyclePolicyDefault},
+		{Key: SettingIndexerSyncInterval, Value: SettingIndexerSyncIntervalDefault},
+		{Key: SettingIndexerLeaseDuration, Value: SettingIndexerLeaseDurationDefault},
 	}
 )
@@ -0,0 +1,400 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"github.com/mendersoftware/reporting/model"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the
+// settings
+const EnvPrefix = "REPORTING"
+
+// EnvKeyReplacer maps the setting keys to the environment variable names
+var EnvKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// EnvVar returns the name of the environment variable overriding the
+// setting
+func EnvVar(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(EnvKeyReplacer.Replace(key))
+}
+
+// Setting describes a configuration setting
+type Setting struct {
+	Key string
+	// Reloadable settings are applied again by the server on SIGHUP
+	Reloadable bool
+	// Secret settings are URLs whose passwords are redacted when shown
+	Secret bool
+	// List settings are lists of names, see StringList
+	List bool
+
+	validate func(value interface{}) error
+}
+
+// Settings lists all the configuration settings
+var Settings = []Setting{
+	{Key: SettingListen, validate: isListenAddress(false)},
+	{Key: SettingGRPCListen, validate: isListenAddress(true)},
+	{Key: SettingElasticsearchAddresses, Secret: true,
+		validate: isURLs("http", "https")},
+	{Key: SettingDebugLog, Reloadable: true, validate: isBool},
+	{Key: SettingHistoryRetention, validate: isDuration(false)},
+	{Key: SettingDeploymentsAddr, validate: isURL(true, "http", "https")},
+	{Key: SettingDeviceAuthAddr, validate: isURL(true, "http", "https")},
+	{Key: SettingDeviceConnectAddr, validate: isURL(true, "http", "https")},
+	{Key: SettingInventoryAddr, validate: isURL(true, "http", "https")},
+	{Key: SettingStaleDevicesThreshold, validate: isDuration(true)},
+	{Key: SettingGeoLatitudeAttribute, validate: isString(false)},
+	{Key: SettingGeoLongitudeAttribute, validate: isString(false)},
+	{Key: SettingVersionAttributes, List: true, validate: isStringList},
+	{Key: SettingRateLimitRate, Reloadable: true, validate: isFloat(0)},
+	{Key: SettingRateLimitBurst, Reloadable: true, validate: isInt(0)},
+	{Key: SettingRateLimitConcurrency, Reloadable: true, validate: isInt(0)},
+	{Key: SettingRateLimitTenants, Reloadable: true, validate: isRateLimitOverrides},
+	{Key: SettingQueryTimeout, validate: isDuration(false)},
+	{Key: SettingMaxBuckets, validate: isInt(0)},
+	{Key: SettingMaxFilterClauses, validate: isInt(0)},
+	{Key: SettingMaxExpressionDepth, validate: isInt(0)},
+	{Key: SettingAggregationCache, validate: isOneOf("", "lru", "redis")},
+	{Key: SettingAggregationCacheSize, validate: isInt(1)},
+	{Key: SettingAggregationCacheTTL, validate: isDuration(true)},
+	{Key: SettingIndexStrategy, validate: isOneOf("per-tenant", "shared")},
+	{Key: SettingIndexShards, validate: isInt(1)},
+	{Key: SettingIndexReplicas, validate: isInt(0)},
+	{Key: SettingIndexTiers, validate: isIndexTiers},
+	{Key: SettingIndexTargetShardSize, validate: isByteSize},
+	{Key: SettingHistoryLifecyclePolicy, validate: isString(true)},
+	{Key: SettingIndexerSyncInterval, validate: isDuration(true)},
+	{Key: SettingIndexerLeaseDuration, validate: isDuration(true)},
+	{Key: SettingRedisURL, Secret: true, validate: isURL(true, "redis", "rediss")},
+}
+
+// keysReader is a configuration reader listing its keys, like viper
+type keysReader interface {
+	AllKeys() []string
+}
+
+// Validate validates all the settings, and reports all the invalid and
+// unknown settings at once
+func Validate(conf config.Reader) error {
+	problems := []string{}
+	known := make(map[string]bool, len(Settings))
+	for _, setting := range Settings {
+		known[setting.Key] = true
+		value := conf.Get(setting.Key)
+		if value == nil {
+			continue
+		}
+		if err := setting.validate(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s): %s",
+				setting.Key, EnvVar(setting.Key), err))
+		}
+	}
+	if keys, ok := conf.(keysReader); ok {
+		unknown := []string{}
+		for _, key := range keys.AllKeys() {
+			// the keys of the map settings are flattened
+			root := strings.SplitN(key, ".", 2)[0]
+			if !known[root] {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting", key))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Value is the effective value of a setting
+type Value struct {
+	Key        string      `json:"key"`
+	Value      interface{} `json:"value"`
+	Env        string      `json:"env"`
+	Reloadable bool        `json:"reloadable"`
+}
+
+// Values returns the effective values of all the settings, with the
+// passwords of the secret URLs redacted
+func Values(conf config.Reader) []*Value {
+	values := make([]*Value, 0, len(Settings))
+	for _, setting := range Settings {
+		value := conf.Get(setting.Key)
+		if setting.List && value != nil {
+			value = StringList(conf, setting.Key)
+		}
+		if setting.Secret {
+			value = redact(value)
+		}
+		values = append(values, &Value{
+			Key:        setting.Key,
+			Value:      value,
+			Env:        EnvVar(setting.Key),
+			Reloadable: setting.Reloadable,
+		})
+	}
+	return values
+}
+
+// String formats the value for display
+func (v *Value) String() string {
+	switch value := v.Value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, ",")
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(data)
+	}
+	return fmt.Sprint(v.Value)
+}
+
+// redact redacts the passwords of the URLs of the value
+func redact(value interface{}) interface{} {
+	redactURL := func(s string) string {
+		u, err := url.Parse(s)
+		if err != nil || u.User == nil {
+			return s
+		}
+		return u.Redacted()
+	}
+	switch v := value.(type) {
+	case string:
+		urls := strings.Fields(v)
+		for i, u := range urls {
+			urls[i] = redactURL(u)
+		}
+		return strings.Join(urls, " ")
+	case []string:
+		urls := make([]string, len(v))
+		for i, u := range v {
+			urls[i] = redactURL(u)
+		}
+		return urls
+	case []interface{}:
+		urls := make([]interface{}, len(v))
+		for i, u := range v {
+			urls[i] = redact(u)
+		}
+		return urls
+	}
+	return value
+}
+
+func isBool(value interface{}) error {
+	_, err := cast.ToBoolE(value)
+	return errors.Wrap(err, "must be true or false")
+}
+
+func isInt(min int) func(value interface{}) error {
+	return func(value interface{}) error {
+		n, err := cast.ToIntE(value)
+		if err != nil {
+			return errors.New("must be an integer")
+		} else if n < min {
+			return errors.Errorf("must be at least %d", min)
+		}
+		return nil
+	}
+}
+
+func isFloat(min float64) func(value interface{}) error {
+	return func(value interface{}) error {
+		n, err := cast.ToFloat64E(value)
+		if err != nil {
+			return errors.New("must be a number")
+		} else if n < min {
+			return errors.Errorf("must be at least %g", min)
+		}
+		return nil
+	}
+}
+
+func isDuration(positive bool) func(value interface{}) error {
+	return func(value interface{}) error {
+		d, err := cast.ToDurationE(value)
+		if err != nil {
+			return errors.New(`must be a duration, e.g. "30s" or "5m"`)
+		} else if d < 0 || positive && d == 0 {
+			if positive {
+				return errors.New("must be a positive duration")
+			}
+			return errors.New("cannot be negative")
+		}
+		return nil
+	}
+}
+
+func isString(optional bool) func(value interface{}) error {
+	return func(value interface{}) error {
+		s, err := cast.ToStringE(value)
+		if err != nil {
+			return errors.New("must be a string")
+		} else if !optional && strings.TrimSpace(s) == "" {
+			return errors.New("cannot be blank")
+		}
+		return nil
+	}
+}
+
+// StringList returns the value of a setting holding a list of names,
+// given either as a list or as a comma-separated string, e.g. in the
+// environment variables
+func StringList(conf config.Reader, key string) []string {
+	names, _ := toStringList(conf.Get(key))
+	return names
+}
+
+func toStringList(value interface{}) ([]string, error) {
+	var items []string
+	if s, ok := value.(string); ok {
+		items = strings.Split(s, ",")
+	} else {
+		var err error
+		if items, err = cast.ToStringSliceE(value); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		if name := strings.TrimSpace(item); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func isStringList(value interface{}) error {
+	_, err := toStringList(value)
+	return errors.Wrap(err, "must be a list of strings")
+}
+
+func isOneOf(values ...string) func(value interface{}) error {
+	return func(value interface{}) error {
+		s, _ := cast.ToStringE(value)
+		for _, v := range values {
+			if s == v {
+				return nil
+			}
+		}
+		return errors.Errorf("must be one of %q", values)
+	}
+}
+
+func isListenAddress(optional bool) func(value interface{}) error {
+	return func(value interface{}) error {
+		s, err := cast.ToStringE(value)
+		if err != nil {
+			return errors.New("must be a string")
+		} else if s == "" && optional {
+			return nil
+		}
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			return errors.Errorf(`must be a "host:port" address, got %q`, s)
+		}
+		return nil
+	}
+}
+
+func checkURL(s string, schemes []string) error {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return errors.Errorf("invalid URL %q", s)
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return errors.Errorf("URL %q: the scheme must be one of %q", u.Redacted(), schemes)
+}
+
+func isURL(optional bool, schemes ...string) func(value interface{}) error {
+	return func(value interface{}) error {
+		s, err := cast.ToStringE(value)
+		if err != nil {
+			return errors.New("must be a string")
+		} else if s == "" && optional {
+			return nil
+		}
+		return checkURL(s, schemes)
+	}
+}
+
+func isURLs(schemes ...string) func(value interface{}) error {
+	return func(value interface{}) error {
+		urls, err := cast.ToStringSliceE(value)
+		if err != nil {
+			return errors.New("must be a list of URLs")
+		} else if len(urls) == 0 {
+			return errors.New("cannot be empty")
+		}
+		for _, u := range urls {
+			if err := checkURL(u, schemes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func isByteSize(value interface{}) error {
+	s, err := cast.ToStringE(value)
+	if err != nil {
+		return errors.New("must be a string")
+	}
+	_, err = model.ParseByteSize(s)
+	return err
+}
+
+func isRateLimitOverrides(value interface{}) error {
+	overrides, err := cast.ToStringMapE(value)
+	if err != nil {
+		return errors.New("must be a map of tenant IDs to limits")
+	}
+	_, err = model.ParseRateLimitOverrides(overrides, model.RateLimits{})
+	return err
+}
+
+func isIndexTiers(value interface{}) error {
+	tiers, err := cast.ToStringMapE(value)
+	if err != nil {
+		return errors.New("must be a map of tiers to index settings")
+	}
+	_, err = model.ParseTierIndexSettings(tiers, model.DefaultIndexSettings)
+	return err
+}
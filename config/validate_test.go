@@ -0,0 +1,173 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package config
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// mapReader is a configuration reader backed by a map of flattened keys
+type mapReader struct {
+	config.Reader
+	values map[string]interface{}
+}
+
+func (r *mapReader) Get(key string) interface{} {
+	return r.values[key]
+}
+
+func (r *mapReader) AllKeys() []string {
+	keys := make([]string, 0, len(r.values))
+	for key := range r.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func defaultValues() map[string]interface{} {
+	values := make(map[string]interface{}, len(Defaults))
+	for _, def := range Defaults {
+		values[def.Key] = def.Value
+	}
+	return values
+}
+
+func TestSettings(t *testing.T) {
+	keys := make(map[string]bool, len(Settings))
+	for _, setting := range Settings {
+		assert.False(t, keys[setting.Key], setting.Key)
+		keys[setting.Key] = true
+	}
+	for _, def := range Defaults {
+		assert.True(t, keys[def.Key], def.Key)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := map[string]struct {
+		values map[string]interface{}
+		err    string
+	}{
+		"ok, defaults": {},
+		"ok, overrides": {
+			values: map[string]interface{}{
+				SettingDebugLog:                 "true",
+				SettingGRPCListen:               "",
+				SettingElasticsearchAddresses:   "http://a:9200 https://user:pass@b:9200",
+				SettingRateLimitRate:            "2.5",
+				SettingRateLimitTenants + ".t1": map[string]interface{}{"rate": 1},
+				SettingRedisURL:                 "redis://localhost:6379",
+				SettingIndexStrategy:            "shared",
+			},
+		},
+		"ko, invalid values": {
+			values: map[string]interface{}{
+				SettingListen:                 "8080",
+				SettingElasticsearchAddresses: "ftp://a",
+				SettingDebugLog:               "maybe",
+				SettingRateLimitBurst:         -1,
+				SettingQueryTimeout:           "soon",
+				SettingIndexStrategy:          "sharded",
+			},
+			err: "invalid configuration:\n" +
+				`  listen (REPORTING_LISTEN): must be a "host:port" address, got "8080"` + "\n" +
+				`  addresses (REPORTING_ADDRESSES): URL "ftp://a": the scheme must be one of ["http" "https"]` + "\n" +
+				`  debug_log (REPORTING_DEBUG_LOG): must be true or false: strconv.ParseBool: parsing "maybe": invalid syntax` + "\n" +
+				`  rate_limit_burst (REPORTING_RATE_LIMIT_BURST): must be at least 0` + "\n" +
+				`  query_timeout (REPORTING_QUERY_TIMEOUT): must be a duration, e.g. "30s" or "5m"` + "\n" +
+				`  index_strategy (REPORTING_INDEX_STRATEGY): must be one of ["per-tenant" "shared"]`,
+		},
+		"ko, unknown settings": {
+			values: map[string]interface{}{
+				"elasticsearch_addresses": "http://localhost:9200",
+				"debuglog":                true,
+			},
+			err: "invalid configuration:\n" +
+				"  debuglog: unknown setting\n" +
+				"  elasticsearch_addresses: unknown setting",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			values := defaultValues()
+			for key, value := range tc.values {
+				values[key] = value
+			}
+			err := Validate(&mapReader{values: values})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValues(t *testing.T) {
+	conf := defaultValues()
+	conf[SettingElasticsearchAddresses] = []string{
+		"http://localhost:9200", "https://user:secret@es:9200",
+	}
+	conf[SettingRedisURL] = "redis://:secret@redis:6379/0"
+
+	values := Values(&mapReader{values: conf})
+	assert.Len(t, values, len(Settings))
+	byKey := make(map[string]*Value, len(values))
+	for _, value := range values {
+		byKey[value.Key] = value
+	}
+	assert.Equal(t, "http://localhost:9200,https://user:xxxxx@es:9200",
+		byKey[SettingElasticsearchAddresses].String())
+	assert.Equal(t, "redis://:xxxxx@redis:6379/0", byKey[SettingRedisURL].String())
+	assert.Equal(t, []string{"rootfs-image.version", "mender_client_version"},
+		byKey[SettingVersionAttributes].Value)
+	assert.Equal(t, "REPORTING_REDIS_URL", byKey[SettingRedisURL].Env)
+	assert.True(t, byKey[SettingRateLimitRate].Reloadable)
+	assert.False(t, byKey[SettingListen].Reloadable)
+}
+
+func TestEnvVar(t *testing.T) {
+	assert.Equal(t, "REPORTING_DEBUG_LOG", EnvVar(SettingDebugLog))
+	assert.Equal(t, "REPORTING_RATE_LIMIT_TENANTS", EnvVar("rate-limit.tenants"))
+}
+
+func TestStringList(t *testing.T) {
+	conf := config.Config
+	config.SetDefaults(conf, Defaults)
+	conf.SetEnvPrefix(EnvPrefix)
+	conf.AutomaticEnv()
+	conf.SetEnvKeyReplacer(EnvKeyReplacer)
+
+	assert.Equal(t, []string{"rootfs-image.version", "mender_client_version"},
+		StringList(conf, SettingVersionAttributes))
+
+	env := EnvVar(SettingVersionAttributes)
+	os.Setenv(env, "os_version, kernel_version ,")
+	defer os.Unsetenv(env)
+	assert.Equal(t, []string{"os_version", "kernel_version"},
+		StringList(conf, SettingVersionAttributes))
+
+	// lists from the configuration file
+	list := &mapReader{values: map[string]interface{}{
+		SettingVersionAttributes: []interface{}{"a", " b "},
+	}}
+	assert.Equal(t, []string{"a", "b"}, StringList(list, SettingVersionAttributes))
+}
@@ -1,15 +1,23 @@
 module github.com/mendersoftware/reporting
 
-go 1.15
+go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.15.1
 	github.com/elastic/go-elasticsearch/v7 v7.13.1
+	github.com/getkin/kin-openapi v0.61.0
 	github.com/gin-gonic/gin v1.7.2
+	github.com/go-redis/redis/v8 v8.11.4
 	github.com/google/uuid v1.2.0
 	github.com/mendersoftware/go-lib-micro v0.0.0-20210531074842-2a04c90250ec
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.8.1
+	github.com/spf13/cast v1.3.0
+	github.com/spf13/viper v1.7.1
 	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli v1.22.5
-	golang.org/x/sys v0.0.0-20200116001909-b77594299b42
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da
+	google.golang.org/grpc v1.40.0
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
 )
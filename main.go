@@ -15,19 +15,36 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"github.com/urfave/cli"
 
+	"github.com/mendersoftware/reporting/app/backup"
+	"github.com/mendersoftware/reporting/app/bench"
+	"github.com/mendersoftware/reporting/app/cache"
 	"github.com/mendersoftware/reporting/app/indexer"
+	"github.com/mendersoftware/reporting/app/reporting"
 	"github.com/mendersoftware/reporting/app/server"
+	"github.com/mendersoftware/reporting/client/deployments"
+	"github.com/mendersoftware/reporting/client/deviceauth"
+	"github.com/mendersoftware/reporting/client/deviceconnect"
 	"github.com/mendersoftware/reporting/client/elasticsearch"
+	"github.com/mendersoftware/reporting/client/inventory"
 	dconfig "github.com/mendersoftware/reporting/config"
+	"github.com/mendersoftware/reporting/model"
 )
 
 func main() {
@@ -47,6 +64,27 @@ func doMain(args []string) {
 			},
 		},
 		Commands: []cli.Command{
+			{
+				Name:  "config",
+				Usage: "Inspect the configuration",
+				Subcommands: []cli.Command{
+					{
+						Name: "show",
+						Usage: "Print the effective value of each setting, merged from " +
+							"the defaults, the configuration file and the environment, " +
+							"with the environment variable overriding it; the " +
+							"passwords of the URLs are redacted",
+						Action: cmdConfigShow,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:  "format",
+								Usage: "Output format, text or json",
+								Value: "text",
+							},
+						},
+					},
+				},
+			},
 			{
 				Name:   "server",
 				Usage:  "Run the HTTP API server",
@@ -65,9 +103,29 @@ func doMain(args []string) {
 				Flags: []cli.Flag{
 					&cli.Int64Flag{
 						Name:  "devices",
-						Usage: "Number of devices to index",
+						Usage: "Number of devices to index, per sync cycle with --daemon",
 						Value: 1000,
 					},
+					&cli.StringFlag{
+						Name: "profile",
+						Usage: "Path of the YAML profile of the generated fleet, " +
+							"e.g. for benchmarking; defaults to a built-in profile",
+					},
+					&cli.BoolFlag{
+						Name: "daemon",
+						Usage: "Run sync cycles until stopped, leading the replicas " +
+							"through a lease in Elasticsearch; resumes the interrupted " +
+							"run unless --from-scratch",
+					},
+					&cli.BoolFlag{
+						Name: "resume",
+						Usage: "Resume the interrupted run from its checkpoint, " +
+							"with the same --profile",
+					},
+					&cli.BoolFlag{
+						Name:  "from-scratch",
+						Usage: "Discard the checkpoint of the interrupted run and start over",
+					},
 					&cli.BoolFlag{
 						Name:  "automigrate",
 						Usage: "Run database migrations before starting.",
@@ -79,6 +137,174 @@ func doMain(args []string) {
 				Usage:  "Run the migrations",
 				Action: cmdMigrate,
 			},
+			{
+				Name: "migrate-index-strategy",
+				Usage: "Move the data of the tenants stored with another " +
+					"index strategy to the configured one",
+				Description: "Copies the data of each tenant to the indices of the " +
+					"configured strategy, then deletes it from the old ones. Stop " +
+					"the indexer during the migration: the devices it writes while " +
+					"a tenant is copied are lost.",
+				Action: cmdMigrateIndexStrategy,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "Index strategy the data is stored with: per-tenant or shared",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tenant",
+						Usage: "ID of a tenant to migrate; defaults to all the tenants",
+					},
+				},
+			},
+			{
+				Name: "check-shard-sizes",
+				Usage: "Report the tenant indices whose primary shards exceed the " +
+					"target size, with the proposed number of shards",
+				Action: cmdCheckShardSizes,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name: "target-size",
+						Usage: "Target size of the primary shards, like 30gb; " +
+							"defaults to the index_target_shard_size setting",
+					},
+					cli.BoolFlag{
+						Name: "split",
+						Usage: "Split the reported indices into the proposed number " +
+							"of shards; the writes to an index are rejected while it " +
+							"is split, so stop the indexer first",
+					},
+				},
+			},
+			{
+				Name: "reconcile",
+				Usage: "Compare the indexed devices with the inventory, reindex " +
+					"the missing and stale devices and delete the orphaned ones; " +
+					"prints the drift report of each tenant as JSON",
+				Action: cmdReconcile,
+				Flags: []cli.Flag{
+					cli.StringSliceFlag{
+						Name:  "tenant",
+						Usage: "ID of a tenant to reconcile; defaults to all the indexed tenants",
+					},
+					cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Report the drift without fixing it",
+					},
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "Import the devices of a NDJSON or CSV file, \"-\" for stdin",
+				ArgsUsage: "FILE",
+				Description: "Validates each record and indexes the devices through " +
+					"the indexer, in batches; prints the errors of the invalid " +
+					"records as JSON lines. The documents rejected by Elasticsearch " +
+					"are recorded in the dead letters.",
+				Action: cmdImport,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name: "format",
+						Usage: "Format of the file, ndjson or csv; defaults to csv " +
+							"for the .csv files, ndjson otherwise",
+					},
+					cli.StringFlag{
+						Name: "mapping",
+						Usage: "Path of the JSON file mapping the CSV columns to the " +
+							"device fields and attributes",
+					},
+					cli.StringFlag{
+						Name:  "tenant",
+						Usage: "ID of the tenant of the devices without one",
+					},
+					cli.StringFlag{
+						Name:  "errors",
+						Usage: "Path of the file to write the errors to; defaults to stdout",
+					},
+				},
+			},
+			{
+				Name: "replay-dead-letters",
+				Usage: "Index again the devices rejected by Elasticsearch, " +
+					"e.g. after fixing a mapping conflict; the devices rejected " +
+					"again stay in the dead letters",
+				Action: cmdReplayDeadLetters,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "tenant",
+						Usage: "ID of the tenant to replay; defaults to all the tenants",
+					},
+				},
+			},
+			{
+				Name: "bench",
+				Usage: "Replay a mix of searches and aggregations against a " +
+					"populated cluster and report the latency percentiles, " +
+					"throughput and error rate of each query",
+				Action: cmdBench,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name: "mix",
+						Usage: "Path of the JSON mix of queries; defaults to a " +
+							"built-in mix querying the default indexer fleet",
+					},
+					cli.IntFlag{
+						Name:  "workers",
+						Usage: "Number of concurrent workers",
+						Value: 4,
+					},
+					cli.DurationFlag{
+						Name:  "duration",
+						Usage: "Duration of the run",
+						Value: 30 * time.Second,
+					},
+					cli.IntFlag{
+						Name:  "requests",
+						Usage: "Number of requests to send, stopping before the end of the duration",
+					},
+					cli.Int64Flag{
+						Name:  "seed",
+						Usage: "Seed of the picks of the queries and tenants; defaults to a random seed",
+					},
+					cli.StringFlag{
+						Name:  "format",
+						Usage: "Format of the report, text or json",
+						Value: "text",
+					},
+				},
+			},
+			{
+				Name: "backup",
+				Usage: "Write the devices, history and deployments of a tenant " +
+					"to a gzipped tar archive of NDJSON files with a manifest",
+				Action: cmdBackup,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "tenant",
+						Usage: "ID of the tenant to back up",
+					},
+					cli.StringFlag{
+						Name:  "output",
+						Usage: "Path of the archive, \"-\" for stdout",
+						Value: "-",
+					},
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "Restore a tenant from an archive written by backup, \"-\" for stdin",
+				ArgsUsage: "FILE",
+				Description: "Recreates the tenant indices with the current templates, " +
+					"bulk loads the documents and verifies the number of documents " +
+					"against the manifest of the archive.",
+				Action: cmdRestore,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "overwrite",
+						Usage: "Delete the existing data of the tenant first",
+					},
+				},
+			},
 		},
 	}
 	app.Usage = "Reporting"
@@ -93,11 +319,15 @@ func doMain(args []string) {
 				1)
 		}
 
-		// Enable setting config values by environment variables
-		config.Config.SetEnvPrefix("REPORTING")
-		config.Config.AutomaticEnv()
-		config.Config.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+		setConfigEnv(config.Config)
 
+		// config show prints the invalid configurations too
+		if args.Args().First() == "config" {
+			return nil
+		}
+		if err := dconfig.Validate(config.Config); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
 		return nil
 	}
 
@@ -112,6 +342,14 @@ func cmdServer(args *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if config.Config.GetString(dconfig.SettingAggregationCache) == "lru" {
+		log.Printf("the in-process aggregation cache is not invalidated by the " +
+			"devices indexed by the other processes, which are visible only once " +
+			"the cached results expire; use the redis aggregation cache instead")
+		esClient = cache.NewClient(esClient, cache.NewLRU(
+			config.Config.GetInt(dconfig.SettingAggregationCacheSize),
+			config.Config.GetDuration(dconfig.SettingAggregationCacheTTL)))
+	}
 	if args.Bool("automigrate") {
 		ctx := context.Background()
 		err := esClient.Migrate(ctx)
@@ -119,7 +357,74 @@ func cmdServer(args *cli.Context) error {
 			return err
 		}
 	}
-	return server.InitAndRun(config.Config, esClient)
+	return server.InitAndRun(config.Config, esClient, reloadConfig)
+}
+
+// reloadConfig reads the configuration file again and validates the
+// settings; the file is read into a new configuration first, and replaces
+// the settings of the configuration only if valid, so a rejected reload
+// leaves the configuration unchanged
+func reloadConfig() error {
+	path := config.Config.ConfigFileUsed()
+	if path == "" {
+		return dconfig.Validate(config.Config)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read configuration")
+	}
+	reloaded := viper.New()
+	config.SetDefaults(reloaded, dconfig.Defaults)
+	setConfigEnv(reloaded)
+	reloaded.SetConfigFile(path)
+	if err := reloaded.ReadConfig(bytes.NewReader(data)); err != nil {
+		return errors.Wrap(err, "failed to read configuration")
+	}
+	if err := dconfig.Validate(reloaded); err != nil {
+		return err
+	}
+	err = config.Config.ReadConfig(bytes.NewReader(data))
+	return errors.Wrap(err, "failed to read configuration")
+}
+
+// setConfigEnv enables setting the configuration values by environment
+// variables
+func setConfigEnv(conf *viper.Viper) {
+	conf.SetEnvPrefix(dconfig.EnvPrefix)
+	conf.AutomaticEnv()
+	conf.SetEnvKeyReplacer(dconfig.EnvKeyReplacer)
+}
+
+func cmdConfigShow(args *cli.Context) error {
+	values := dconfig.Values(config.Config)
+	switch format := args.String("format"); format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(values); err != nil {
+			return err
+		}
+	case "text":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tENVIRONMENT VARIABLE\tRELOADABLE")
+		for _, value := range values {
+			reloadable := "no"
+			if value.Reloadable {
+				reloadable = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+				value.Key, value, value.Env, reloadable)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	default:
+		return cli.NewExitError(fmt.Sprintf("unknown format: %q", format), 1)
+	}
+	if err := dconfig.Validate(config.Config); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
 }
 
 func cmdIndexer(args *cli.Context) error {
@@ -134,8 +439,56 @@ func cmdIndexer(args *cli.Context) error {
 			return err
 		}
 	}
+	mode := indexer.ResumeNone
+	switch {
+	case args.Bool("resume") && args.Bool("from-scratch"):
+		return cli.NewExitError("--resume and --from-scratch are mutually exclusive", 1)
+	case args.Bool("resume"):
+		mode = indexer.ResumeCheckpoint
+	case args.Bool("from-scratch"):
+		mode = indexer.ResumeFromScratch
+	}
+	var profile *model.FleetProfile
+	if path := args.String("profile"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to read the fleet profile")
+		}
+		if profile, err = model.ParseFleetProfile(data); err != nil {
+			return err
+		}
+	}
 	devices := args.Int64("devices")
-	return indexer.InitAndRun(config.Config, esClient, devices)
+	if args.Bool("daemon") {
+		if mode == indexer.ResumeNone {
+			mode = indexer.ResumeCheckpoint
+		}
+		return indexer.RunDaemon(config.Config, esClient, getIndexerClients(),
+			devices, profile, mode)
+	}
+	err = indexer.InitAndRun(config.Config, esClient, getIndexerClients(),
+		devices, profile, mode)
+	if errors.Cause(err) == indexer.ErrRunInterrupted {
+		return cli.NewExitError(err.Error()+
+			"; resume it with --resume or start over with --from-scratch", 1)
+	}
+	return err
+}
+
+// getIndexerClients returns the clients of the configured services the
+// indexer ingests data from
+func getIndexerClients() *indexer.Clients {
+	clients := &indexer.Clients{}
+	if addr := config.Config.GetString(dconfig.SettingDeploymentsAddr); addr != "" {
+		clients.Deployments = deployments.NewClient(addr)
+	}
+	if addr := config.Config.GetString(dconfig.SettingDeviceAuthAddr); addr != "" {
+		clients.DeviceAuth = deviceauth.NewClient(addr)
+	}
+	if addr := config.Config.GetString(dconfig.SettingDeviceConnectAddr); addr != "" {
+		clients.DeviceConnect = deviceconnect.NewClient(addr)
+	}
+	return clients
 }
 
 func cmdMigrate(args *cli.Context) error {
@@ -147,13 +500,376 @@ func cmdMigrate(args *cli.Context) error {
 	return esClient.Migrate(ctx)
 }
 
+func cmdMigrateIndexStrategy(args *cli.Context) error {
+	from := args.String("from")
+	if from == "" {
+		return cli.NewExitError("missing required flag: --from", 1)
+	}
+	esClient, err := getElasticsearchClient(args)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := esClient.Migrate(ctx); err != nil {
+		return err
+	}
+	tenantIDs := args.StringSlice("tenant")
+	if len(tenantIDs) == 0 {
+		tenantIDs, err = esClient.ListTenantIDs(ctx, from)
+		if err != nil {
+			return err
+		}
+	}
+	for i, tenantID := range tenantIDs {
+		log.Printf("migrating tenant %q (%d/%d)", tenantID, i+1, len(tenantIDs))
+		if err := esClient.MigrateTenant(ctx, tenantID, from); err != nil {
+			return errors.Wrapf(err, "failed to migrate the tenant %q", tenantID)
+		}
+	}
+	return nil
+}
+
+func cmdReconcile(args *cli.Context) error {
+	addr := config.Config.GetString(dconfig.SettingInventoryAddr)
+	if addr == "" {
+		return cli.NewExitError("missing required setting: "+dconfig.SettingInventoryAddr, 1)
+	}
+	esClient, err := getElasticsearchClient(args)
+	if err != nil {
+		return err
+	}
+	clients := getIndexerClients()
+	clients.Inventory = inventory.NewClient(addr)
+
+	ctx := context.Background()
+	tenantIDs := args.StringSlice("tenant")
+	if len(tenantIDs) == 0 {
+		tenantIDs, err = esClient.ListTenantIDs(ctx,
+			config.Config.GetString(dconfig.SettingIndexStrategy))
+		if err != nil {
+			return err
+		}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	drifting := 0
+	for i, tenantID := range tenantIDs {
+		log.Printf("reconciling tenant %q (%d/%d)", tenantID, i+1, len(tenantIDs))
+		report, err := indexer.Reconcile(ctx, config.Config, esClient, clients,
+			tenantID, args.Bool("dry-run"))
+		if report != nil {
+			if err := encoder.Encode(report); err != nil {
+				return err
+			}
+			if report.Drift() > 0 {
+				drifting++
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to reconcile the tenant %q", tenantID)
+		}
+	}
+	log.Printf("%d of %d tenants drifting from the inventory", drifting, len(tenantIDs))
+	return nil
+}
+
+func cmdImport(args *cli.Context) error {
+	path := args.Args().First()
+	if path == "" || args.NArg() > 1 {
+		return cli.NewExitError("expected exactly one file to import", 1)
+	}
+	format := args.String("format")
+	if format == "" {
+		format = model.ImportFormatNDJSON
+		if strings.HasSuffix(strings.ToLower(path), ".csv") {
+			format = model.ImportFormatCSV
+		}
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	var reader model.ImportReader
+	switch format {
+	case model.ImportFormatNDJSON:
+		reader = model.NewNDJSONReader(input)
+	case model.ImportFormatCSV:
+		if args.String("mapping") == "" {
+			return cli.NewExitError("--mapping is required to import a CSV file", 1)
+		}
+		data, err := ioutil.ReadFile(args.String("mapping"))
+		if err != nil {
+			return errors.Wrap(err, "failed to read the mapping")
+		}
+		mapping, err := model.ParseCSVMapping(data)
+		if err != nil {
+			return err
+		}
+		if reader, err = model.NewCSVReader(input, mapping); err != nil {
+			return err
+		}
+	default:
+		return cli.NewExitError(fmt.Sprintf("unknown format: %q", format), 1)
+	}
+
+	output := os.Stdout
+	if errorsPath := args.String("errors"); errorsPath != "" {
+		file, err := os.Create(errorsPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+	encoder := json.NewEncoder(output)
+
+	esClient, err := getElasticsearchClient(args)
+	if err != nil {
+		return err
+	}
+	stats, err := indexer.Import(context.Background(), config.Config, esClient,
+		getIndexerClients(), reader, args.String("tenant"),
+		func(importErr *model.ImportError) error {
+			return encoder.Encode(importErr)
+		})
+	if stats != nil {
+		log.Printf("%d records read, %d devices imported, %d records failed",
+			stats.Records, stats.Imported, stats.Failed)
+	}
+	return err
+}
+
+func cmdReplayDeadLetters(args *cli.Context) error {
+	esClient, err := getElasticsearchClient(args)
+	if err != nil {
+		return err
+	}
+	app := reporting.NewApp(esClient)
+	result, err := app.ReplayDeadLetters(context.Background(), args.String("tenant"))
+	if result != nil {
+		log.Printf("%d devices indexed, %d devices rejected again",
+			result.Indexed, result.Rejected)
+	}
+	return err
+}
+
+func cmdBench(args *cli.Context) error {
+	format := args.String("format")
+	if format != "text" && format != "json" {
+		return cli.NewExitError(fmt.Sprintf("unknown format: %q", format), 1)
+	}
+	mix := model.DefaultBenchMix()
+	if path := args.String("mix"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to read the benchmark mix")
+		}
+		if mix, err = model.ParseBenchMix(data); err != nil {
+			return err
+		}
+	}
+	params := &model.BenchParams{
+		Workers:  args.Int("workers"),
+		Duration: args.Duration("duration"),
+		Requests: args.Int("requests"),
+		Seed:     args.Int64("seed"),
+	}
+	if err := params.Validate(); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	esClient, err := getElasticsearchClient(args)
+	if err != nil {
+		return err
+	}
+	app := reporting.NewApp(esClient,
+		reporting.WithVersionAttributes(
+			dconfig.StringList(config.Config, dconfig.SettingVersionAttributes)))
+	log.Printf("replaying %d queries with %d workers", len(mix.Queries), params.Workers)
+	report, err := bench.Run(context.Background(), app, mix, params)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return bench.WriteText(os.Stdout, report)
+}
+
+func cmdBackup(args *cli.Context) error {
+	tenantID := args.String("tenant")
+	if tenantID == "" {
+		return cli.NewExitError("--tenant is required", 1)
+	}
+	output := os.Stdout
+	if path := args.String("output"); path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+	esClient, err := getElasticsearchClient(args)
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.Backup(context.Background(), esClient, tenantID, output)
+	if err != nil {
+		return err
+	}
+	for _, data := range model.TenantData {
+		log.Printf("%s: %d documents", data, manifest.Documents[data])
+	}
+	return nil
+}
+
+func cmdRestore(args *cli.Context) error {
+	path := args.Args().First()
+	if path == "" || args.NArg() > 1 {
+		return cli.NewExitError("expected exactly one archive to restore", 1)
+	}
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	esClient, err := getElasticsearchClient(args)
+	if err != nil {
+		return err
+	}
+	tierIndexSettings, err := model.ParseTierIndexSettings(
+		config.Config.GetStringMap(dconfig.SettingIndexTiers), model.IndexSettings{
+			Shards:   config.Config.GetInt(dconfig.SettingIndexShards),
+			Replicas: config.Config.GetInt(dconfig.SettingIndexReplicas),
+		})
+	if err != nil {
+		return errors.Wrap(err, "invalid "+dconfig.SettingIndexTiers)
+	}
+	app := reporting.NewApp(esClient,
+		reporting.WithTierIndexSettings(tierIndexSettings))
+	manifest, err := backup.Restore(context.Background(), app, esClient,
+		input, args.Bool("overwrite"))
+	if err == backup.ErrTenantHasData {
+		return cli.NewExitError(
+			"the tenant already has data; use --overwrite to replace it", 1)
+	} else if err != nil {
+		return err
+	}
+	for _, data := range model.TenantData {
+		log.Printf("%s: %d documents restored", data, manifest.Documents[data])
+	}
+	return nil
+}
+
+func cmdCheckShardSizes(args *cli.Context) error {
+	targetSize := args.String("target-size")
+	if targetSize == "" {
+		targetSize = config.Config.GetString(dconfig.SettingIndexTargetShardSize)
+	}
+	target, err := model.ParseByteSize(targetSize)
+	if err != nil {
+		return errors.Wrap(err, "invalid target size")
+	}
+	esClient, err := getElasticsearchClient(args)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	sizes, err := esClient.IndexSizes(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tSIZE\tSHARDS\tSHARD SIZE\tPROPOSED SHARDS")
+	splits := make([]*model.IndexSize, 0, len(sizes))
+	for _, size := range sizes {
+		if size.ShardSize() <= target {
+			continue
+		}
+		splits = append(splits, size)
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\n", size.Index,
+			model.FormatByteSize(size.Size), size.Shards,
+			model.FormatByteSize(size.ShardSize()), size.ProposeShards(target))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	log.Printf("%d of %d indices exceed the target shard size of %s",
+		len(splits), len(sizes), model.FormatByteSize(target))
+
+	if !args.Bool("split") {
+		return nil
+	}
+	for i, size := range splits {
+		shards := size.ProposeShards(target)
+		if shards == size.Shards {
+			log.Printf("skipping index %q: already at the maximum number of shards",
+				size.Index)
+			continue
+		}
+		log.Printf("splitting index %q into %d shards (%d/%d)",
+			size.Index, shards, i+1, len(splits))
+		if err := esClient.SplitIndex(ctx, size.Index, shards); err != nil {
+			return errors.Wrapf(err, "failed to split the index %q", size.Index)
+		}
+	}
+	return nil
+}
+
 func getElasticsearchClient(args *cli.Context) (elasticsearch.Client, error) {
 	addresses := config.Config.GetStringSlice(dconfig.SettingElasticsearchAddresses)
-	client, err := elasticsearch.NewClient(
+	opts := []elasticsearch.ElasticsearchClientOption{
 		elasticsearch.WithServerAddresses(addresses),
-	)
+		elasticsearch.WithQueryTimeout(
+			config.Config.GetDuration(dconfig.SettingQueryTimeout)),
+		elasticsearch.WithIndexStrategy(
+			config.Config.GetString(dconfig.SettingIndexStrategy)),
+		elasticsearch.WithIndexSettings(model.IndexSettings{
+			Shards:   config.Config.GetInt(dconfig.SettingIndexShards),
+			Replicas: config.Config.GetInt(dconfig.SettingIndexReplicas),
+		}),
+	}
+	if path := config.Config.GetString(dconfig.SettingHistoryLifecyclePolicy); path != "" {
+		policy, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the history lifecycle policy")
+		} else if !json.Valid(policy) {
+			return nil, errors.Errorf("invalid history lifecycle policy: %s", path)
+		}
+		opts = append(opts, elasticsearch.WithHistoryLifecyclePolicy(policy))
+	}
+	client, err := elasticsearch.NewClient(opts...)
 	if err != nil {
 		return nil, err
 	}
+
+	ttl := config.Config.GetDuration(dconfig.SettingAggregationCacheTTL)
+	switch backend := config.Config.GetString(dconfig.SettingAggregationCache); backend {
+	case "", "lru":
+		// the in-process cache is only read and invalidated by the server,
+		// see cmdServer
+	case "redis":
+		redisCache, err := cache.NewRedisFromURL(
+			config.Config.GetString(dconfig.SettingRedisURL), ttl)
+		if err != nil {
+			return nil, err
+		}
+		client = cache.NewClient(client, redisCache)
+	default:
+		return nil, errors.Errorf("unknown aggregation cache: %q", backend)
+	}
 	return client, nil
 }
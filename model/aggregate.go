@@ -0,0 +1,124 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+// AggregateParams are the parameters of the aggregation of the matching
+// devices by the values of an attribute
+type AggregateParams struct {
+	Filters     []FilterPredicate `json:"filters"`
+	FilterQuery string            `json:"query"`
+	Expression  *FilterExpression `json:"expression"`
+	Query       string            `json:"q"`
+	DeviceIDs   []string          `json:"device_ids"`
+	Scope       string            `json:"scope"`
+	Attribute   string            `json:"attribute"`
+	Size        int               `json:"size"`
+	TenantID    string            `json:"-"`
+
+	// VersionAttributes are the inventory attributes compared by version
+	// order
+	VersionAttributes VersionAttributes `json:"-"`
+}
+
+func (p *AggregateParams) searchParams() *SearchParams {
+	return &SearchParams{
+		Filters:     p.Filters,
+		FilterQuery: p.FilterQuery,
+		Expression:  p.Expression,
+		Query:       p.Query,
+		DeviceIDs:   p.DeviceIDs,
+
+		VersionAttributes: p.VersionAttributes,
+	}
+}
+
+// Validate validates the aggregation parameters and sets the defaults
+func (p *AggregateParams) Validate() error {
+	if err := validateAttribute(p.Scope, p.Attribute); err != nil {
+		return err
+	}
+	if p.Size == 0 {
+		p.Size = PerPageDefault
+	}
+	if err := validateBuckets("size", p.Size); err != nil {
+		return err
+	}
+	return p.searchParams().Validate()
+}
+
+// AggregateBucket is the number of devices with an attribute value
+type AggregateBucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// BuildAggregateQuery builds the Elasticsearch query aggregating the
+// matching devices by the values of the attribute; the values of the
+// inventory scopes are aggregated separately as strings and numbers
+func BuildAggregateQuery(params *AggregateParams) (Query, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	var aggs map[string]interface{}
+	if params.Scope == ScopeSystem {
+		aggs = map[string]interface{}{
+			"values": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": systemAttributes[params.Attribute],
+					"size":  params.Size,
+				},
+			},
+		}
+	} else {
+		path := inventoryScopes[params.Scope]
+		values := func(field string) map[string]interface{} {
+			return map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": field,
+					"size":  params.Size,
+				},
+				"aggs": map[string]interface{}{
+					"devices": map[string]interface{}{
+						"reverse_nested": map[string]interface{}{},
+					},
+				},
+			}
+		}
+		aggs = map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"nested": map[string]interface{}{"path": path},
+				"aggs": map[string]interface{}{
+					"filtered": map[string]interface{}{
+						"filter": map[string]interface{}{
+							"term": map[string]interface{}{path + ".name": params.Attribute},
+						},
+						"aggs": map[string]interface{}{
+							"strings": values(path + ".string"),
+							"numbers": values(path + ".numeric"),
+						},
+					},
+				},
+			},
+		}
+	}
+
+	return Query{
+		"query":            params.searchParams().boolQuery(),
+		"aggs":             aggs,
+		"size":             0,
+		"track_total_hits": true,
+	}, nil
+}
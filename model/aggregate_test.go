@@ -0,0 +1,90 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildAggregateQuery(t *testing.T) {
+	testCases := map[string]struct {
+		params *AggregateParams
+		aggs   string
+		err    string
+	}{
+		"ok, system attribute": {
+			params: &AggregateParams{Scope: ScopeSystem, Attribute: AttrStatus},
+			aggs:   `{"values": {"terms": {"field": "status", "size": 20}}}`,
+		},
+		"ok, inventory attribute": {
+			params: &AggregateParams{
+				Scope:     ScopeInventory,
+				Attribute: "device_type",
+				Size:      5,
+			},
+			aggs: `{"attributes": {
+				"nested": {"path": "inventoryAttributes"},
+				"aggs": {"filtered": {
+					"filter": {"term": {"inventoryAttributes.name": "device_type"}},
+					"aggs": {
+						"strings": {
+							"terms": {"field": "inventoryAttributes.string", "size": 5},
+							"aggs": {"devices": {"reverse_nested": {}}}
+						},
+						"numbers": {
+							"terms": {"field": "inventoryAttributes.numeric", "size": 5},
+							"aggs": {"devices": {"reverse_nested": {}}}
+						}
+					}
+				}}
+			}}`,
+		},
+		"ko, missing attribute": {
+			params: &AggregateParams{Scope: ScopeInventory},
+			err:    "attribute: cannot be blank",
+		},
+		"ko, size": {
+			params: &AggregateParams{Scope: ScopeSystem, Attribute: AttrStatus, Size: 20000},
+			err:    "size: must be between 1 and 10000",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			query, err := BuildAggregateQuery(tc.params)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			aggs, _ := json.Marshal(query["aggs"])
+			assert.JSONEq(t, tc.aggs, string(aggs))
+			assert.Equal(t, 0, query["size"])
+		})
+	}
+}
+
+func TestBuildDeviceIDsQuery(t *testing.T) {
+	query, err := BuildDeviceIDsQuery(&SearchParams{}, "", 100)
+	assert.NoError(t, err)
+	assert.NotContains(t, query, "search_after")
+	assert.Equal(t, 100, query["size"])
+
+	query, err = BuildDeviceIDsQuery(&SearchParams{}, "42", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"42"}, query["search_after"])
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BackupVersion is the version of the format of the backup archives
+const BackupVersion = 1
+
+// BackupManifestFile is the name of the manifest in the backup archives,
+// the first file of the archive
+const BackupManifestFile = "manifest.json"
+
+// BackupDataFile returns the name of the NDJSON file with the documents of
+// the tenant data in the backup archives
+func BackupDataFile(data string) string {
+	return data + ".ndjson"
+}
+
+// BackupManifest describes the content of a backup archive
+type BackupManifest struct {
+	Version   int       `json:"version"`
+	TenantID  string    `json:"tenantID"`
+	Tenant    *Tenant   `json:"tenant,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Documents is the number of documents of each tenant data
+	Documents map[string]int `json:"documents"`
+}
+
+// Validate validates the manifest of a backup archive
+func (m *BackupManifest) Validate() error {
+	if m.Version != BackupVersion {
+		return errors.Errorf("unsupported backup version: %d", m.Version)
+	}
+	if err := ValidateTenantID(m.TenantID); err != nil {
+		return err
+	}
+	for data := range m.Documents {
+		if !isTenantData(data) {
+			return errors.Errorf("unknown tenant data: %q", data)
+		}
+	}
+	return nil
+}
+
+func isTenantData(data string) bool {
+	for _, d := range TenantData {
+		if d == data {
+			return true
+		}
+	}
+	return false
+}
+
+// BackupDocument is a document of a backup archive
+type BackupDocument struct {
+	ID     string          `json:"id"`
+	Source json.RawMessage `json:"source"`
+}
@@ -0,0 +1,272 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed bench_default.json
+var defaultBenchMix []byte
+
+// Types of the benchmark queries
+const (
+	BenchQuerySearch    = "search"
+	BenchQueryCount     = "count"
+	BenchQueryAggregate = "aggregate"
+)
+
+// BenchMix is the mix of queries replayed by the benchmark
+type BenchMix struct {
+	// Tenants are the tenants queried, picked at random for each query
+	Tenants []string      `json:"tenants"`
+	Queries []*BenchQuery `json:"queries"`
+}
+
+// BenchQuery is a query of the benchmark mix
+type BenchQuery struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Weight is the frequency of the query relative to the other queries
+	// of the mix, defaults to 1
+	Weight int `json:"weight"`
+	// Params are the parameters of the query, as the body of the search
+	// and aggregate API requests
+	Params json.RawMessage `json:"params"`
+
+	search    *SearchParams
+	aggregate *AggregateParams
+}
+
+// DefaultBenchMix returns the default benchmark mix, querying the tenants
+// of the default fleet profile
+func DefaultBenchMix() *BenchMix {
+	mix, err := ParseBenchMix(defaultBenchMix)
+	if err != nil {
+		panic(err)
+	}
+	return mix
+}
+
+// ParseBenchMix parses and validates a JSON benchmark mix
+func ParseBenchMix(data []byte) (*BenchMix, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	mix := &BenchMix{}
+	if err := decoder.Decode(mix); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the benchmark mix")
+	}
+	if err := mix.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid benchmark mix")
+	}
+	return mix, nil
+}
+
+// Validate validates the benchmark mix, parses the parameters of the
+// queries and sets the defaults
+func (m *BenchMix) Validate() error {
+	if len(m.Tenants) == 0 {
+		return errors.New("tenants: cannot be empty")
+	}
+	for _, tenantID := range m.Tenants {
+		if err := ValidateTenantID(tenantID); err != nil {
+			return errors.Wrap(err, "tenants")
+		}
+	}
+	if len(m.Queries) == 0 {
+		return errors.New("queries: cannot be empty")
+	}
+	names := make(map[string]bool, len(m.Queries))
+	for _, query := range m.Queries {
+		if query.Name == "" {
+			return errors.New("queries: name cannot be blank")
+		} else if names[query.Name] {
+			return errors.Errorf("queries: duplicate query %q", query.Name)
+		}
+		names[query.Name] = true
+		if err := query.validate(); err != nil {
+			return errors.Wrapf(err, "queries: %s", query.Name)
+		}
+	}
+	return nil
+}
+
+func (q *BenchQuery) validate() error {
+	if q.Weight == 0 {
+		q.Weight = 1
+	} else if q.Weight < 0 {
+		return errors.New("weight: must be a positive integer")
+	}
+	params := q.Params
+	if len(params) == 0 {
+		params = json.RawMessage(`{}`)
+	}
+	switch q.Type {
+	case BenchQuerySearch, BenchQueryCount:
+		q.search = &SearchParams{}
+		if err := json.Unmarshal(params, q.search); err != nil {
+			return errors.Wrap(err, "params")
+		}
+		return errors.Wrap(q.search.Validate(), "params")
+	case BenchQueryAggregate:
+		q.aggregate = &AggregateParams{}
+		if err := json.Unmarshal(params, q.aggregate); err != nil {
+			return errors.Wrap(err, "params")
+		}
+		return errors.Wrap(q.aggregate.Validate(), "params")
+	default:
+		return errors.Errorf("type: unknown type %q", q.Type)
+	}
+}
+
+// SearchParams returns the parameters of the search and count queries for
+// the tenant
+func (q *BenchQuery) SearchParams(tenantID string) *SearchParams {
+	params := *q.search
+	params.TenantID = tenantID
+	return &params
+}
+
+// AggregateParams returns the parameters of the aggregate queries for the
+// tenant
+func (q *BenchQuery) AggregateParams(tenantID string) *AggregateParams {
+	params := *q.aggregate
+	params.TenantID = tenantID
+	return &params
+}
+
+// BenchParams are the parameters of a benchmark run
+type BenchParams struct {
+	// Workers is the number of concurrent workers sending the queries
+	Workers int
+	// Duration is the duration of the run
+	Duration time.Duration
+	// Requests is the number of queries to send; zero sends queries until
+	// the end of the run
+	Requests int
+	// Seed is the seed of the picks of the queries and tenants
+	Seed int64
+}
+
+// Validate validates the benchmark parameters
+func (p *BenchParams) Validate() error {
+	if p.Workers < 1 {
+		return errors.New("workers: must be at least 1")
+	} else if p.Duration < 0 {
+		return errors.New("duration: cannot be negative")
+	} else if p.Requests < 0 {
+		return errors.New("requests: cannot be negative")
+	} else if p.Duration == 0 && p.Requests == 0 {
+		return errors.New("either a duration or a number of requests is required")
+	}
+	return nil
+}
+
+// BenchReport is the result of a benchmark run
+type BenchReport struct {
+	Workers   int       `json:"workers"`
+	StartedAt time.Time `json:"started_at"`
+	// Elapsed is the duration of the run, in seconds
+	Elapsed float64            `json:"elapsed"`
+	Queries []*BenchQueryStats `json:"queries"`
+	Total   *BenchQueryStats   `json:"total"`
+}
+
+// BenchQueryStats are the statistics of the queries of a type of a
+// benchmark run
+type BenchQueryStats struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	Requests int    `json:"requests"`
+	Errors   int    `json:"errors"`
+	// ErrorRate is the share of the requests which failed
+	ErrorRate float64 `json:"error_rate"`
+	// Throughput is the number of requests per second
+	Throughput float64 `json:"throughput"`
+	// Latency is the latency of the successful requests
+	Latency BenchLatency `json:"latency"`
+	// LastError is the error of the last failed request
+	LastError string `json:"last_error,omitempty"`
+}
+
+// BenchLatency are the latency percentiles of the queries, in milliseconds
+type BenchLatency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// NewBenchQueryStats returns the statistics of the queries from the
+// latencies of the successful requests and the number of failed ones,
+// sent during elapsed
+func NewBenchQueryStats(name, queryType string, latencies []time.Duration,
+	failed int, elapsed time.Duration) *BenchQueryStats {
+	stats := &BenchQueryStats{
+		Name:     name,
+		Type:     queryType,
+		Requests: len(latencies) + failed,
+		Errors:   failed,
+	}
+	if stats.Requests > 0 {
+		stats.ErrorRate = float64(failed) / float64(stats.Requests)
+	}
+	if elapsed > 0 {
+		stats.Throughput = float64(stats.Requests) / elapsed.Seconds()
+	}
+	if len(latencies) == 0 {
+		return stats
+	}
+
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	// percentile returns the nearest-rank percentile
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+		return milliseconds(sorted[rank-1])
+	}
+	var sum time.Duration
+	for _, latency := range sorted {
+		sum += latency
+	}
+	stats.Latency = BenchLatency{
+		Min:  milliseconds(sorted[0]),
+		Mean: milliseconds(sum / time.Duration(len(sorted))),
+		P50:  percentile(50),
+		P90:  percentile(90),
+		P95:  percentile(95),
+		P99:  percentile(99),
+		Max:  milliseconds(sorted[len(sorted)-1]),
+	}
+	return stats
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultBenchMix(t *testing.T) {
+	mix := DefaultBenchMix()
+	assert.Equal(t, []string{"tenant1", "tenant2"}, mix.Tenants)
+	for _, query := range mix.Queries {
+		switch query.Type {
+		case BenchQuerySearch, BenchQueryCount:
+			params := query.SearchParams("tenant1")
+			assert.Equal(t, "tenant1", params.TenantID)
+			assert.Empty(t, query.search.TenantID)
+		case BenchQueryAggregate:
+			assert.Equal(t, "tenant2", query.AggregateParams("tenant2").TenantID)
+		}
+	}
+}
+
+func TestParseBenchMix(t *testing.T) {
+	testCases := map[string]struct {
+		mix string
+
+		weights []int
+		err     string
+	}{
+		"ok": {
+			mix: `{"tenants": ["t1"], "queries": [
+				{"name": "list", "type": "search"},
+				{"name": "count", "type": "count", "weight": 3,
+				 "params": {"q": "foo"}},
+				{"name": "os", "type": "aggregate", "weight": 2,
+				 "params": {"scope": "inventory", "attribute": "os"}}
+			]}`,
+			weights: []int{1, 3, 2},
+		},
+		"ko, unknown field": {
+			mix: `{"tenants": ["t1"], "query": []}`,
+			err: `failed to parse the benchmark mix: json: unknown field "query"`,
+		},
+		"ko, no tenants": {
+			mix: `{"queries": [{"name": "list", "type": "search"}]}`,
+			err: "invalid benchmark mix: tenants: cannot be empty",
+		},
+		"ko, no queries": {
+			mix: `{"tenants": ["t1"]}`,
+			err: "invalid benchmark mix: queries: cannot be empty",
+		},
+		"ko, duplicate query": {
+			mix: `{"tenants": ["t1"], "queries": [
+				{"name": "list", "type": "search"},
+				{"name": "list", "type": "count"}
+			]}`,
+			err: `invalid benchmark mix: queries: duplicate query "list"`,
+		},
+		"ko, unknown type": {
+			mix: `{"tenants": ["t1"], "queries": [{"name": "geo", "type": "geogrid"}]}`,
+			err: `invalid benchmark mix: queries: geo: type: unknown type "geogrid"`,
+		},
+		"ko, invalid params": {
+			mix: `{"tenants": ["t1"], "queries": [
+				{"name": "list", "type": "search", "params": {"per_page": 1000}}
+			]}`,
+			err: "invalid benchmark mix: queries: list: params: " +
+				"per_page: must be between 1 and 500",
+		},
+		"ko, aggregate without attribute": {
+			mix: `{"tenants": ["t1"], "queries": [{"name": "agg", "type": "aggregate"}]}`,
+			err: "invalid benchmark mix: queries: agg: params: attribute: cannot be blank",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mix, err := ParseBenchMix([]byte(tc.mix))
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			weights := []int{}
+			for _, query := range mix.Queries {
+				weights = append(weights, query.Weight)
+			}
+			assert.Equal(t, tc.weights, weights)
+		})
+	}
+}
+
+func TestBenchParamsValidate(t *testing.T) {
+	testCases := map[string]struct {
+		params BenchParams
+
+		err string
+	}{
+		"ok, duration": {
+			params: BenchParams{Workers: 4, Duration: time.Minute},
+		},
+		"ok, requests": {
+			params: BenchParams{Workers: 1, Requests: 100},
+		},
+		"ko, no workers": {
+			params: BenchParams{Duration: time.Minute},
+			err:    "workers: must be at least 1",
+		},
+		"ko, unbounded": {
+			params: BenchParams{Workers: 4},
+			err:    "either a duration or a number of requests is required",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.params.Validate()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewBenchQueryStats(t *testing.T) {
+	latencies := make([]time.Duration, 0, 100)
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	stats := NewBenchQueryStats("list", BenchQuerySearch, latencies, 25, 5*time.Second)
+	assert.Equal(t, &BenchQueryStats{
+		Name:       "list",
+		Type:       BenchQuerySearch,
+		Requests:   125,
+		Errors:     25,
+		ErrorRate:  0.2,
+		Throughput: 25,
+		Latency: BenchLatency{
+			Min:  1,
+			Mean: 50.5,
+			P50:  50,
+			P90:  90,
+			P95:  95,
+			P99:  99,
+			Max:  100,
+		},
+	}, stats)
+	// the latencies are not sorted in place
+	assert.Equal(t, 100*time.Millisecond, latencies[0])
+
+	stats = NewBenchQueryStats("list", BenchQuerySearch, nil, 0, 0)
+	assert.Equal(t, &BenchQueryStats{Name: "list", Type: BenchQuerySearch}, stats)
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import "time"
+
+// CheckpointIndexer is the ID of the checkpoint of the indexer runs
+const CheckpointIndexer = "indexer"
+
+// Checkpoint is the progress of a run of the indexer, saved after each
+// batch of devices to resume the run if interrupted; as the fleet generator
+// generates the same devices from the same seed and profile, the run resumes
+// from the number of devices indexed
+type Checkpoint struct {
+	ID string `json:"id"`
+	// Devices is the number of devices to index in the run
+	Devices int64 `json:"devices"`
+	// Indexed is the number of devices indexed so far
+	Indexed int64 `json:"indexed"`
+	// Seed is the seed of the fleet generator of the run
+	Seed int64 `json:"seed,omitempty"`
+	// Profile is the hash of the fleet profile of the run, see
+	// FleetProfile.Hash
+	Profile    string          `json:"profile,omitempty"`
+	Tenants    []*TenantCursor `json:"tenants,omitempty"`
+	StartedAt  time.Time       `json:"startedAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// TenantCursor is the progress of a run of the indexer for a tenant: the
+// number of devices of the tenant indexed so far, and the last one of them
+type TenantCursor struct {
+	TenantID      string    `json:"tenantID"`
+	Indexed       int64     `json:"indexed"`
+	LastDeviceID  string    `json:"lastDeviceID"`
+	LastUpdatedAt time.Time `json:"lastUpdatedAt"`
+}
+
+// NewCheckpoint returns the checkpoint of a new run indexing the devices
+func NewCheckpoint(id string, devices int64, now time.Time) *Checkpoint {
+	return &Checkpoint{
+		ID:        id,
+		Devices:   devices,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Tenant returns the cursor of the tenant, or nil if no device of the
+// tenant was indexed yet
+func (c *Checkpoint) Tenant(tenantID string) *TenantCursor {
+	for _, cursor := range c.Tenants {
+		if cursor.TenantID == tenantID {
+			return cursor
+		}
+	}
+	return nil
+}
+
+// Advance moves the checkpoint and the cursors of their tenants past the
+// indexed devices
+func (c *Checkpoint) Advance(devices []*Device, now time.Time) {
+	for _, device := range devices {
+		cursor := c.Tenant(device.GetTenantID())
+		if cursor == nil {
+			cursor = &TenantCursor{TenantID: device.GetTenantID()}
+			c.Tenants = append(c.Tenants, cursor)
+		}
+		cursor.Indexed++
+		cursor.LastDeviceID = device.GetID()
+		cursor.LastUpdatedAt = device.GetUpdatedAt()
+	}
+	c.Indexed += int64(len(devices))
+	c.UpdatedAt = now
+}
+
+// Remaining returns the number of devices left to index
+func (c *Checkpoint) Remaining() int64 {
+	if c.Indexed >= c.Devices {
+		return 0
+	}
+	return c.Devices - c.Indexed
+}
+
+// Finish marks the run as finished
+func (c *Checkpoint) Finish(now time.Time) {
+	c.UpdatedAt = now
+	c.FinishedAt = &now
+}
+
+// Finished tells if the run finished
+func (c *Checkpoint) Finished() bool {
+	return c.FinishedAt != nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointAdvance(t *testing.T) {
+	t1 := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	checkpoint := NewCheckpoint(CheckpointIndexer, 5, t1)
+	assert.Equal(t, int64(5), checkpoint.Remaining())
+	assert.Nil(t, checkpoint.Tenant("t1"))
+
+	checkpoint.Advance([]*Device{
+		NewDevice("1").SetTenantID("t1").SetUpdatedAt(t1),
+		NewDevice("2").SetTenantID("t2").SetUpdatedAt(t1),
+		NewDevice("3").SetTenantID("t1").SetUpdatedAt(t2),
+	}, t2)
+	assert.Equal(t, int64(3), checkpoint.Indexed)
+	assert.Equal(t, int64(2), checkpoint.Remaining())
+	assert.Equal(t, t2, checkpoint.UpdatedAt)
+	assert.Equal(t, &TenantCursor{
+		TenantID:      "t1",
+		Indexed:       2,
+		LastDeviceID:  "3",
+		LastUpdatedAt: t2,
+	}, checkpoint.Tenant("t1"))
+	assert.Equal(t, int64(1), checkpoint.Tenant("t2").Indexed)
+	assert.False(t, checkpoint.Finished())
+
+	checkpoint.Advance([]*Device{
+		NewDevice("4").SetTenantID("t2"),
+		NewDevice("5").SetTenantID("t2"),
+		NewDevice("6").SetTenantID("t2"),
+	}, t2)
+	assert.Equal(t, int64(0), checkpoint.Remaining())
+
+	checkpoint.Finish(t2)
+	assert.True(t, checkpoint.Finished())
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// Device connection statuses, as reported by deviceconnect
+const (
+	ConnectStatusOnline  = "online"
+	ConnectStatusOffline = "offline"
+	ConnectStatusUnknown = "unknown"
+)
+
+// ConnectStatus is the status of the device connection to deviceconnect
+type ConnectStatus struct {
+	Status    string     `json:"status"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// StaleDevice is a device which didn't contact the server recently
+type StaleDevice struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name,omitempty"`
+	Status   string     `json:"status,omitempty"`
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+}
+
+// StaleDevicesGroup holds the stale devices of a group
+type StaleDevicesGroup struct {
+	GroupName string         `json:"groupName"`
+	Count     int            `json:"count"`
+	Devices   []*StaleDevice `json:"devices"`
+}
+
+// StaleDevicesReport lists the devices not seen since the threshold,
+// grouped by group name
+type StaleDevicesReport struct {
+	Threshold string               `json:"threshold"`
+	Since     time.Time            `json:"since"`
+	Total     int                  `json:"total"`
+	Groups    []*StaleDevicesGroup `json:"groups"`
+}
+
+// BuildStaleDevicesQuery builds the Elasticsearch query returning the
+// devices not seen since the given time, aggregated by group name and
+// with up to perGroup devices for each group
+func BuildStaleDevicesQuery(since time.Time, perGroup int) Query {
+	return Query{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []interface{}{
+					map[string]interface{}{
+						"range": map[string]interface{}{
+							"lastSeen": map[string]interface{}{"lt": since},
+						},
+					},
+					map[string]interface{}{
+						"bool": map[string]interface{}{
+							"must_not": map[string]interface{}{
+								"exists": map[string]interface{}{"field": "lastSeen"},
+							},
+						},
+					},
+				},
+				"minimum_should_match": 1,
+			},
+		},
+		"aggs": map[string]interface{}{
+			"groups": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field":   "groupName",
+					"missing": "",
+					"size":    PerPageMax,
+				},
+				"aggs": map[string]interface{}{
+					"devices": map[string]interface{}{
+						"top_hits": map[string]interface{}{
+							"size": perGroup,
+							"sort": []interface{}{
+								map[string]interface{}{
+									"lastSeen": map[string]interface{}{
+										"order":   SortOrderAsc,
+										"missing": "_first",
+									},
+								},
+							},
+							"_source": []string{"id", "name", "status", "lastSeen"},
+						},
+					},
+				},
+			},
+		},
+		"size":             0,
+		"track_total_hits": true,
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetConnectivity(t *testing.T) {
+	updatedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	checkIn := updatedAt.Add(time.Hour)
+	connected := updatedAt.Add(2 * time.Hour)
+
+	testCases := map[string]struct {
+		updatedAt   *time.Time
+		lastCheckIn *time.Time
+		connect     *ConnectStatus
+
+		lastSeen *time.Time
+	}{
+		"never seen": {},
+		"inventory update only": {
+			updatedAt: &updatedAt,
+			lastSeen:  &updatedAt,
+		},
+		"check-in after inventory update": {
+			updatedAt:   &updatedAt,
+			lastCheckIn: &checkIn,
+			lastSeen:    &checkIn,
+		},
+		"online": {
+			updatedAt:   &updatedAt,
+			lastCheckIn: &checkIn,
+			connect: &ConnectStatus{
+				Status:    ConnectStatusOnline,
+				UpdatedAt: &connected,
+			},
+			lastSeen: &connected,
+		},
+		"offline": {
+			updatedAt:   &updatedAt,
+			lastCheckIn: &checkIn,
+			connect: &ConnectStatus{
+				Status:    ConnectStatusOffline,
+				UpdatedAt: &connected,
+			},
+			lastSeen: &checkIn,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			device := NewDevice("1")
+			device.UpdatedAt = tc.updatedAt
+			device.SetConnectivity(tc.lastCheckIn, tc.connect)
+			assert.Equal(t, tc.lastSeen, device.LastSeen)
+			if tc.connect != nil {
+				assert.Equal(t, tc.connect.Status, *device.ConnectStatus)
+			}
+		})
+	}
+}
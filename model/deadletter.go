@@ -0,0 +1,102 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a device document rejected by Elasticsearch, kept with the
+// reason of the rejection to be indexed again once the cause is fixed
+type DeadLetter struct {
+	ID        string `json:"id"`
+	TenantID  string `json:"tenantID,omitempty"`
+	DeviceID  string `json:"deviceID"`
+	ErrorType string `json:"errorType"`
+	Reason    string `json:"reason"`
+	// Attempts is the number of rejected attempts to index the document
+	Attempts      int             `json:"attempts"`
+	Payload       json.RawMessage `json:"payload"`
+	FirstFailedAt time.Time       `json:"firstFailedAt"`
+	LastFailedAt  time.Time       `json:"lastFailedAt"`
+}
+
+// DeadLetterID returns the ID of the dead letter of the device
+func DeadLetterID(tenantID, deviceID string) string {
+	return tenantID + ":" + deviceID
+}
+
+// DeadLetterFilter holds the filters to apply when listing the dead
+// letters, oldest rejection first
+type DeadLetterFilter struct {
+	TenantID string
+	Page     int64
+	PerPage  int64
+}
+
+// ReplayResult is the result of the replay of the dead letters
+type ReplayResult struct {
+	Indexed  int `json:"indexed"`
+	Rejected int `json:"rejected"`
+}
+
+// Rejections collects the devices rejected by Elasticsearch while indexing
+// on behalf of a caller, with the reasons of the rejections
+type Rejections struct {
+	mu      sync.Mutex
+	reasons map[string]string
+}
+
+type rejectionsKey struct{}
+
+// WithRejections returns a context collecting the devices rejected while
+// indexing with it
+func WithRejections(ctx context.Context) (context.Context, *Rejections) {
+	rejections := &Rejections{reasons: map[string]string{}}
+	return context.WithValue(ctx, rejectionsKey{}, rejections), rejections
+}
+
+// RejectionsFromContext returns the rejections collected by the context,
+// or nil
+func RejectionsFromContext(ctx context.Context) *Rejections {
+	rejections, _ := ctx.Value(rejectionsKey{}).(*Rejections)
+	return rejections
+}
+
+// Record records the rejection of the device; it is a no-op on nil
+// rejections
+func (r *Rejections) Record(tenantID, deviceID, reason string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reasons[DeadLetterID(tenantID, deviceID)] = reason
+}
+
+// Reason returns the reason of the rejection of the device, and whether
+// the device was rejected
+func (r *Rejections) Reason(tenantID, deviceID string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reason, ok := r.reasons[DeadLetterID(tenantID, deviceID)]
+	return reason, ok
+}
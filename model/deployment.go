@@ -0,0 +1,73 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// Device deployment statuses
+const (
+	DeploymentStatusSuccess          = "success"
+	DeploymentStatusFailure          = "failure"
+	DeploymentStatusAborted          = "aborted"
+	DeploymentStatusNoArtifact       = "noartifact"
+	DeploymentStatusAlreadyInstalled = "already-installed"
+	DeploymentStatusPending          = "pending"
+	DeploymentStatusDownloading      = "downloading"
+	DeploymentStatusInstalling       = "installing"
+	DeploymentStatusRebooting        = "rebooting"
+)
+
+// Deployment is a deployment of an artifact to a set of devices
+type Deployment struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name,omitempty"`
+	ArtifactName string     `json:"artifactName,omitempty"`
+	Status       string     `json:"status,omitempty"`
+	Created      *time.Time `json:"created,omitempty"`
+	Finished     *time.Time `json:"finished,omitempty"`
+}
+
+// DeviceDeployment is the deployment of an artifact to a single device
+type DeviceDeployment struct {
+	ID         string      `json:"id"`
+	TenantID   string      `json:"tenantID,omitempty"`
+	DeviceID   string      `json:"deviceID"`
+	Status     string      `json:"status,omitempty"`
+	Created    *time.Time  `json:"created,omitempty"`
+	Finished   *time.Time  `json:"finished,omitempty"`
+	Deployment *Deployment `json:"deployment,omitempty"`
+}
+
+func (d *DeviceDeployment) GetCreated() time.Time {
+	if d.Created != nil {
+		return *d.Created
+	}
+	return time.Time{}
+}
+
+// LastDeviceDeployments returns the most recent device deployment for each
+// device, indexed by device ID
+func LastDeviceDeployments(deployments []*DeviceDeployment) map[string]*DeviceDeployment {
+	last := make(map[string]*DeviceDeployment)
+	for _, deployment := range deployments {
+		current, ok := last[deployment.DeviceID]
+		if !ok || deployment.GetCreated().After(current.GetCreated()) {
+			last[deployment.DeviceID] = deployment
+		}
+	}
+	return last
+}
@@ -14,23 +14,14 @@
 
 package model
 
-import (
-	"fmt"
-	"math/rand"
-	"time"
-
-	"github.com/google/uuid"
-)
+import "time"
 
 const (
-	StatusAccepted = "accepted"
-	StatusPending  = "pending"
-)
-
-const (
-	attrMacAddress = "mac"
-	attrSerialNo   = "serial_no"
-	attrTag        = "tag"
+	StatusAccepted      = "accepted"
+	StatusPending       = "pending"
+	StatusRejected      = "rejected"
+	StatusPreauthorized = "preauthorized"
+	StatusNoAuth        = "noauth"
 )
 
 type Device struct {
@@ -44,6 +35,19 @@ type Device struct {
 	InventoryAttributes DeviceInventory `json:"inventoryAttributes,omitempty"`
 	CreatedAt           *time.Time      `json:"createdAt,omitempty"`
 	UpdatedAt           *time.Time      `json:"updatedAt,omitempty"`
+
+	LastDeploymentID       *string    `json:"lastDeploymentID,omitempty"`
+	LastDeploymentName     *string    `json:"lastDeploymentName,omitempty"`
+	LastDeploymentArtifact *string    `json:"lastDeploymentArtifact,omitempty"`
+	LastDeploymentStatus   *string    `json:"lastDeploymentStatus,omitempty"`
+	LastDeploymentFinished *time.Time `json:"lastDeploymentFinished,omitempty"`
+
+	LastCheckIn      *time.Time `json:"lastCheckIn,omitempty"`
+	ConnectStatus    *string    `json:"connectStatus,omitempty"`
+	ConnectUpdatedAt *time.Time `json:"connectUpdatedAt,omitempty"`
+	LastSeen         *time.Time `json:"lastSeen,omitempty"`
+
+	Location *GeoPoint `json:"location,omitempty"`
 }
 
 func NewDevice(id string) *Device {
@@ -136,12 +140,83 @@ func (a *Device) SetUpdatedAt(val time.Time) *Device {
 	return a
 }
 
+func (a *Device) GetLastDeploymentStatus() string {
+	if a.LastDeploymentStatus != nil {
+		return *a.LastDeploymentStatus
+	}
+	return ""
+}
+
+// SetLastDeployment denormalizes the device deployment into the device
+func (a *Device) SetLastDeployment(val *DeviceDeployment) *Device {
+	if val == nil {
+		return a
+	}
+	a.LastDeploymentID = &val.ID
+	a.LastDeploymentStatus = &val.Status
+	a.LastDeploymentFinished = val.Finished
+	if val.Deployment != nil {
+		a.LastDeploymentName = &val.Deployment.Name
+		a.LastDeploymentArtifact = &val.Deployment.ArtifactName
+	}
+	return a
+}
+
+func (a *Device) SetLocation(val *GeoPoint) *Device {
+	a.Location = val
+	return a
+}
+
+func (a *Device) GetLastSeen() time.Time {
+	if a.LastSeen != nil {
+		return *a.LastSeen
+	}
+	return time.Time{}
+}
+
+// SetConnectivity sets the last check-in time reported by deviceauth and
+// the connection status reported by deviceconnect, and updates the time
+// the device was last seen: the most recent among the last check-in, the
+// last inventory update (UpdatedAt) and the connection status change,
+// if the device is online
+func (a *Device) SetConnectivity(lastCheckIn *time.Time, connect *ConnectStatus) *Device {
+	if lastCheckIn != nil {
+		a.LastCheckIn = lastCheckIn
+	}
+	if connect != nil {
+		a.ConnectStatus = &connect.Status
+		a.ConnectUpdatedAt = connect.UpdatedAt
+	}
+
+	lastSeen := a.GetUpdatedAt()
+	if a.LastCheckIn != nil && a.LastCheckIn.After(lastSeen) {
+		lastSeen = *a.LastCheckIn
+	}
+	if a.ConnectStatus != nil && *a.ConnectStatus == ConnectStatusOnline &&
+		a.ConnectUpdatedAt != nil && a.ConnectUpdatedAt.After(lastSeen) {
+		lastSeen = *a.ConnectUpdatedAt
+	}
+	if !lastSeen.IsZero() {
+		a.LastSeen = &lastSeen
+	}
+	return a
+}
+
 type DeviceInventory []*InventoryAttribute
 
 type InventoryAttribute struct {
 	Name    *string  `json:"name,omitempty"`
 	String  []string `json:"string,omitempty"`
 	Numeric *float64 `json:"numeric,omitempty"`
+
+	// IP and Network are set at index time from the IP or CIDR formatted
+	// string values
+	IP      []string `json:"ip,omitempty"`
+	Network []string `json:"network,omitempty"`
+
+	// Version is set at index time from the string values of the version
+	// attributes
+	Version []string `json:"version,omitempty"`
 }
 
 func NewInventoryAttribute() *InventoryAttribute {
@@ -192,64 +267,3 @@ func (a *InventoryAttribute) SetNumeric(val float64) *InventoryAttribute {
 	a.Numeric = &val
 	return a
 }
-
-func randomMacAddress() string {
-	buf := make([]byte, 6)
-	_, _ = rand.Read(buf)
-	buf[0] |= 2
-	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", buf[0], buf[1], buf[2], buf[3], buf[4], buf[5])
-}
-
-func RandomDevice() *Device {
-	id := uuid.New().String()
-	device := NewDevice(id)
-	device.SetName("device-" + id)
-	device.SetTenantID(fmt.Sprintf("tenant%d", rand.Intn(2)+1))
-	device.SetCreatedAt(time.Now().UTC()).SetUpdatedAt(time.Now().UTC())
-
-	if rand.Intn(10) > 7 {
-		device.SetStatus(StatusPending)
-	} else {
-		device.SetStatus(StatusAccepted)
-	}
-
-	groupId := rand.Intn(100)
-	device.SetGroupName(fmt.Sprintf("group-%02d", groupId))
-
-	device.CustomAttributes = DeviceInventory{
-		NewInventoryAttribute().SetName(attrTag).SetString(fmt.Sprintf("value-%02d", rand.Intn(100))),
-	}
-
-	macAddress := randomMacAddress()
-
-	device.IdentityAttributes = DeviceInventory{
-		NewInventoryAttribute().SetName(attrMacAddress).SetString(macAddress),
-		NewInventoryAttribute().SetName(attrSerialNo).SetString(fmt.Sprintf("%012d", rand.Intn(999999999999))),
-	}
-
-	device.InventoryAttributes = DeviceInventory{
-		NewInventoryAttribute().SetName(attrMacAddress).SetString(macAddress),
-		NewInventoryAttribute().SetName("artifact_name").SetString("system-M1"),
-		NewInventoryAttribute().SetName("device_type").SetString("dm1"),
-		NewInventoryAttribute().SetName("hostname").SetString("Ambarella"),
-		NewInventoryAttribute().SetName("ipv4_bcm0").SetString("192.168.42.1/24"),
-		NewInventoryAttribute().SetName("ipv4_usb0").SetString("10.0.1.2/8"),
-		NewInventoryAttribute().SetName("ipv4_wlan0").SetString("192.168.1.111/24"),
-		NewInventoryAttribute().SetName("kernel").SetString("Linux version 4.14.181 (charles-chang@rdsuper) (gcc version 8.2.1 20180802 (Linaro GCC 8.2-2018.08~dev)) #1 SMP PREEMPT Fri Mar 12 13:21:16 CST 2021"),
-		NewInventoryAttribute().SetName("mac_bcm0").SetString(macAddress),
-		NewInventoryAttribute().SetName("mac_usb0").SetString(macAddress),
-		NewInventoryAttribute().SetName("mac_wlan0").SetString(macAddress),
-		NewInventoryAttribute().SetName("mem_total_kB").SetNumeric(1020664),
-		NewInventoryAttribute().SetName("group_id").SetNumeric(float64(groupId)),
-		NewInventoryAttribute().SetName("mender_bootloader_integration").SetString("unknown"),
-		NewInventoryAttribute().SetName("mender_client_version").SetString("7cb96ca"),
-		NewInventoryAttribute().SetName("network_interfaces").SetStrings([]string{"bcm0", "usb0", "wlan0"}),
-		NewInventoryAttribute().SetName("os").SetString("Ambarella Flexible Linux CV25 (2.5.7) DMS (0.0.0.21B)"),
-		NewInventoryAttribute().SetName("rootfs_type").SetString("ext4"),
-		NewInventoryAttribute().SetName("rootfs_type").SetString("ext4"),
-		NewInventoryAttribute().SetName("rootfs-image.checksum").SetString("dbc44ce5bd57f0c909dfb15a1efd9fd5d4e426c0fa95f18ea2876e1b8a08818f"),
-		NewInventoryAttribute().SetName("rootfs-image.version").SetString("system-M1"),
-	}
-
-	return device
-}
@@ -0,0 +1,553 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Filter expression limits; the maximum depth is the default of the
+// configurable query limits
+const (
+	FilterQueryMaxLength     = 4096
+	FilterExpressionMaxDepth = 16
+)
+
+// FilterExpression is a boolean combination of filter predicates; exactly
+// one of its fields is set
+type FilterExpression struct {
+	And       []*FilterExpression `json:"and,omitempty"`
+	Or        []*FilterExpression `json:"or,omitempty"`
+	Not       *FilterExpression   `json:"not,omitempty"`
+	Predicate *FilterPredicate    `json:"predicate,omitempty"`
+}
+
+func (e *FilterExpression) validate(depth int) error {
+	if e == nil {
+		return errors.New("cannot be null")
+	}
+	if maxDepth := GetQueryLimits().MaxDepth; depth > maxDepth {
+		return errors.Errorf("must be nested at most %d levels deep", maxDepth)
+	}
+	set := 0
+	for _, ok := range []bool{
+		e.And != nil, e.Or != nil, e.Not != nil, e.Predicate != nil,
+	} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New(
+			"must have exactly one of \"and\", \"or\", \"not\" or \"predicate\"")
+	}
+	switch {
+	case e.Predicate != nil:
+		return errors.Wrap(e.Predicate.Validate(), "predicate")
+	case e.Not != nil:
+		return errors.Wrap(e.Not.validate(depth+1), "not")
+	}
+	operator, operands := "and", e.And
+	if e.Or != nil {
+		operator, operands = "or", e.Or
+	}
+	if len(operands) == 0 {
+		return errors.Errorf("%s: cannot be empty", operator)
+	}
+	for i, operand := range operands {
+		if err := operand.validate(depth + 1); err != nil {
+			return errors.Wrapf(err, "%s[%d]", operator, i)
+		}
+	}
+	return nil
+}
+
+// Validate validates the filter expression
+func (e *FilterExpression) Validate() error {
+	return e.validate(1)
+}
+
+// Clause translates the filter expression into an Elasticsearch clause
+func (e *FilterExpression) Clause(versionAttributes VersionAttributes) interface{} {
+	switch {
+	case e.Predicate != nil:
+		clause, negate := FilterClause(*e.Predicate, versionAttributes)
+		if negate {
+			return map[string]interface{}{
+				"bool": map[string]interface{}{
+					"must_not": []interface{}{clause},
+				},
+			}
+		}
+		return clause
+	case e.Not != nil:
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": []interface{}{e.Not.Clause(versionAttributes)},
+			},
+		}
+	case e.Or != nil:
+		should := make([]interface{}, len(e.Or))
+		for i, operand := range e.Or {
+			should[i] = operand.Clause(versionAttributes)
+		}
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should":               should,
+				"minimum_should_match": 1,
+			},
+		}
+	}
+	filter := make([]interface{}, len(e.And))
+	for i, operand := range e.And {
+		filter[i] = operand.Clause(versionAttributes)
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": filter,
+		},
+	}
+}
+
+// ParseError is a syntax or validation error of a filter query, at the
+// given character position (starting from 1) of the query
+type ParseError struct {
+	Position int
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("query: position %d: %s", e.Position, e.Message)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	value  interface{}
+	offset int
+}
+
+// keyword returns the upper case keyword of an identifier token, or an
+// empty string for any other token
+func (t token) keyword() string {
+	if t.kind != tokenIdent {
+		return ""
+	}
+	switch keyword := strings.ToUpper(t.text); keyword {
+	case "AND", "OR", "NOT", "IN", "EXISTS", "TRUE", "FALSE":
+		return keyword
+	}
+	return ""
+}
+
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') ||
+		c == '.' || c == '-' || c == ':'
+}
+
+type lexer struct {
+	input  string
+	offset int
+}
+
+func (l *lexer) errorf(offset int, format string, args ...interface{}) error {
+	return &ParseError{
+		Position: utf8.RuneCountInString(l.input[:offset]) + 1,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.offset < len(l.input) && strings.IndexByte(" \t\r\n", l.input[l.offset]) >= 0 {
+		l.offset++
+	}
+	start := l.offset
+	if start == len(l.input) {
+		return token{kind: tokenEOF, offset: start}, nil
+	}
+
+	c := l.input[start]
+	switch {
+	case strings.IndexByte("()[],", c) >= 0:
+		l.offset++
+		kind := map[byte]tokenKind{
+			'(': tokenLParen, ')': tokenRParen,
+			'[': tokenLBracket, ']': tokenRBracket, ',': tokenComma,
+		}[c]
+		return token{kind: kind, text: string(c), offset: start}, nil
+
+	case c == '"':
+		for l.offset++; l.offset < len(l.input); l.offset++ {
+			switch l.input[l.offset] {
+			case '\\':
+				l.offset++
+			case '"':
+				l.offset++
+				text := l.input[start:l.offset]
+				value, err := strconv.Unquote(text)
+				if err != nil {
+					return token{}, l.errorf(start, "invalid string %s", text)
+				}
+				return token{kind: tokenString, text: text, value: value, offset: start}, nil
+			}
+		}
+		return token{}, l.errorf(start, "unterminated string")
+
+	case isIdentStart(c):
+		for l.offset++; l.offset < len(l.input) && isIdentChar(l.input[l.offset]); l.offset++ {
+		}
+		text := l.input[start:l.offset]
+		return token{kind: tokenIdent, text: text, value: text, offset: start}, nil
+
+	case c == '-' || (c >= '0' && c <= '9'):
+		for l.offset++; l.offset < len(l.input) &&
+			(isIdentChar(l.input[l.offset]) || l.input[l.offset] == '+'); l.offset++ {
+		}
+		text := l.input[start:l.offset]
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return token{}, l.errorf(start,
+				"invalid number %q, string values must be quoted", text)
+		}
+		return token{kind: tokenNumber, text: text, value: value, offset: start}, nil
+	}
+
+	for _, operator := range []string{"==", "!=", ">=", "<=", "=~", "=", ">", "<", "~"} {
+		if strings.HasPrefix(l.input[start:], operator) {
+			l.offset += len(operator)
+			return token{kind: tokenOperator, text: operator, offset: start}, nil
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(l.input[start:])
+	return token{}, l.errorf(start, "unexpected character %q", r)
+}
+
+var comparisonOperators = map[string]string{
+	"==": FilterTypeEq,
+	"=":  FilterTypeEq,
+	"!=": FilterTypeNe,
+	">":  FilterTypeGt,
+	">=": FilterTypeGte,
+	"<":  FilterTypeLt,
+	"<=": FilterTypeLte,
+	"=~": FilterTypeRegex,
+	"~":  FilterTypeRegex,
+}
+
+// parser is a recursive descent parser of the filter query language:
+//
+//	expression := and ( "OR" and )*
+//	and        := unary ( "AND" unary )*
+//	unary      := "NOT" unary | "(" expression ")" | predicate
+//	predicate  := attribute ( operator value | ["NOT"] "IN" list | ["NOT"] "EXISTS" )
+//	list       := "[" [ value ( "," value )* ] "]"
+type parser struct {
+	lexer *lexer
+	token token
+	depth int
+}
+
+func (p *parser) advance() error {
+	var err error
+	p.token, err = p.lexer.next()
+	return err
+}
+
+func (p *parser) unexpected(expected string) error {
+	return p.lexer.errorf(p.token.offset, "expected %s, found %s",
+		expected, p.token.describe())
+}
+
+// nest enters a nested expression, failing if it is too deep; the caller
+// must call unnest when leaving it, even on failure
+func (p *parser) nest() error {
+	p.depth++
+	if maxDepth := GetQueryLimits().MaxDepth; p.depth > maxDepth {
+		return p.lexer.errorf(p.token.offset,
+			"expression nested more than %d levels deep", maxDepth)
+	}
+	return nil
+}
+
+func (p *parser) unnest() {
+	p.depth--
+}
+
+func (p *parser) parseExpression() (*FilterExpression, error) {
+	defer p.unnest()
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+
+	operands := []*FilterExpression{}
+	for {
+		operand, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if p.token.keyword() != "OR" {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return &FilterExpression{Or: operands}, nil
+}
+
+func (p *parser) parseAnd() (*FilterExpression, error) {
+	operands := []*FilterExpression{}
+	for {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if p.token.keyword() != "AND" {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return &FilterExpression{And: operands}, nil
+}
+
+func (p *parser) parseUnary() (*FilterExpression, error) {
+	switch {
+	case p.token.keyword() == "NOT":
+		// each negation counts as a level, as in the JSON expressions
+		defer p.unnest()
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &FilterExpression{Not: operand}, nil
+
+	case p.token.kind == tokenLParen:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		expression, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if p.token.kind != tokenRParen {
+			return nil, p.unexpected("\")\"")
+		}
+		return expression, p.advance()
+	}
+	return p.parsePredicate()
+}
+
+// parseAttribute splits the attribute name into scope and attribute; names
+// without a scope prefix refer to the system attributes, if any, or to the
+// inventory attributes
+func parseAttribute(name string) (scope, attribute string) {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		scope, attribute = name[:i], name[i+1:]
+		if _, ok := inventoryScopes[scope]; ok || scope == ScopeSystem {
+			return scope, attribute
+		}
+	}
+	if _, ok := systemAttributes[name]; ok {
+		return ScopeSystem, name
+	}
+	return ScopeInventory, name
+}
+
+// globRegexp translates a glob pattern, where "*" matches any sequence of
+// characters and "?" any single character, into an Elasticsearch regexp
+func globRegexp(glob string) string {
+	var regexp strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			regexp.WriteString(".*")
+		case '?':
+			regexp.WriteString(".")
+		default:
+			if strings.ContainsRune(`.+|{}[]()"\#@&<>~`, r) {
+				regexp.WriteByte('\\')
+			}
+			regexp.WriteRune(r)
+		}
+	}
+	return regexp.String()
+}
+
+func (p *parser) parseValue() (interface{}, error) {
+	switch keyword := p.token.keyword(); {
+	case keyword == "TRUE" || keyword == "FALSE":
+		value := keyword == "TRUE"
+		return value, p.advance()
+	case keyword != "":
+		return nil, p.unexpected("value")
+	}
+	switch p.token.kind {
+	case tokenIdent, tokenString, tokenNumber:
+		value := p.token.value
+		return value, p.advance()
+	}
+	return nil, p.unexpected("value")
+}
+
+func (p *parser) parseList() ([]interface{}, error) {
+	if p.token.kind != tokenLBracket {
+		return nil, p.unexpected("\"[\"")
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	values := []interface{}{}
+	for p.token.kind != tokenRBracket {
+		if len(values) > 0 {
+			if p.token.kind != tokenComma {
+				return nil, p.unexpected("\",\" or \"]\"")
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, p.advance()
+}
+
+func (p *parser) parsePredicate() (*FilterExpression, error) {
+	start := p.token
+	if start.kind != tokenIdent || start.keyword() != "" {
+		return nil, p.unexpected("attribute")
+	}
+	predicate := &FilterPredicate{}
+	predicate.Scope, predicate.Attribute = parseAttribute(start.text)
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	negate := false
+	if p.token.keyword() == "NOT" {
+		negate = true
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	switch operator := p.token; {
+	case operator.keyword() == "IN":
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		predicate.Type = FilterTypeIn
+		if negate {
+			predicate.Type = FilterTypeNin
+		}
+		predicate.Value, err = p.parseList()
+	case operator.keyword() == "EXISTS":
+		predicate.Type = FilterTypeExists
+		predicate.Value = !negate
+		err = p.advance()
+	case negate:
+		return nil, p.unexpected("\"IN\" or \"EXISTS\"")
+	case operator.kind == tokenOperator:
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		predicate.Type = comparisonOperators[operator.text]
+		predicate.Value, err = p.parseValue()
+		if pattern, ok := predicate.Value.(string); ok && operator.text == "~" {
+			predicate.Value = globRegexp(pattern)
+		}
+	default:
+		return nil, p.unexpected("operator")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := predicate.Validate(); err != nil {
+		return nil, p.lexer.errorf(start.offset, "%s: %s", start.text, err.Error())
+	}
+	return &FilterExpression{Predicate: predicate}, nil
+}
+
+// ParseFilterQuery parses a filter query, like:
+//
+//	inventory.device_type == "dm1" AND (identity.mac ~ "02:*" OR status IN [pending])
+//
+// into the filter expression; attributes are prefixed by their scope,
+// "~" matches glob patterns and "=~" regular expressions
+func ParseFilterQuery(query string) (*FilterExpression, error) {
+	p := &parser{lexer: &lexer{input: query}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	expression, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenEOF {
+		return nil, p.unexpected("\"AND\", \"OR\" or end of query")
+	}
+	return expression, nil
+}
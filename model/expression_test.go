@@ -0,0 +1,165 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func predicate(scope, attribute, typ string, value interface{}) *FilterExpression {
+	return &FilterExpression{Predicate: &FilterPredicate{
+		Scope:     scope,
+		Attribute: attribute,
+		Type:      typ,
+		Value:     value,
+	}}
+}
+
+func TestParseFilterQuery(t *testing.T) {
+	testCases := map[string]struct {
+		query      string
+		expression *FilterExpression
+		err        string
+	}{
+		"ok, example": {
+			query: `inventory.device_type == "dm1" AND (identity.mac ~ "02:*" OR status IN [pending])`,
+			expression: &FilterExpression{And: []*FilterExpression{
+				predicate(ScopeInventory, "device_type", FilterTypeEq, "dm1"),
+				{Or: []*FilterExpression{
+					predicate(ScopeIdentity, "mac", FilterTypeRegex, "02:.*"),
+					predicate(ScopeSystem, AttrStatus, FilterTypeIn,
+						[]interface{}{"pending"}),
+				}},
+			}},
+		},
+		"ok, precedence": {
+			query: `a = 1 OR b != true and not c exists`,
+			expression: &FilterExpression{Or: []*FilterExpression{
+				predicate(ScopeInventory, "a", FilterTypeEq, float64(1)),
+				{And: []*FilterExpression{
+					predicate(ScopeInventory, "b", FilterTypeNe, true),
+					{Not: predicate(ScopeInventory, "c", FilterTypeExists, true)},
+				}},
+			}},
+		},
+		"ok, negated operators": {
+			query: `rootfs-image.version NOT IN ["1.0", "2.0"] AND custom.tag NOT EXISTS`,
+			expression: &FilterExpression{And: []*FilterExpression{
+				predicate(ScopeInventory, "rootfs-image.version", FilterTypeNin,
+					[]interface{}{"1.0", "2.0"}),
+				predicate(ScopeCustom, "tag", FilterTypeExists, false),
+			}},
+		},
+		"ok, comparisons and regexp": {
+			query: `mem_total_kB >= -1.5e3 AND hostname =~ "raspberry.*"`,
+			expression: &FilterExpression{And: []*FilterExpression{
+				predicate(ScopeInventory, "mem_total_kB", FilterTypeGte, -1500.0),
+				predicate(ScopeInventory, "hostname", FilterTypeRegex, "raspberry.*"),
+			}},
+		},
+		"ok, glob escaping": {
+			query:      `name ~ "dev.?[1]*"`,
+			expression: predicate(ScopeSystem, AttrName, FilterTypeRegex, `dev\..\[1\].*`),
+		},
+		"ko, empty": {
+			query: ``,
+			err:   `query: position 1: expected attribute, found end of query`,
+		},
+		"ko, missing parenthesis": {
+			query: `(a == 1`,
+			err:   `query: position 8: expected ")", found end of query`,
+		},
+		"ko, unquoted version": {
+			query: `a == 1.2.3`,
+			err:   `query: position 6: invalid number "1.2.3", string values must be quoted`,
+		},
+		"ko, unterminated string": {
+			query: `a == "foo`,
+			err:   `query: position 6: unterminated string`,
+		},
+		"ko, unexpected character": {
+			query: `a == 1 && b == 2`,
+			err:   `query: position 8: unexpected character '&'`,
+		},
+		"ko, trailing tokens": {
+			query: `a == 1 b == 2`,
+			err:   `query: position 8: expected "AND", "OR" or end of query, found "b"`,
+		},
+		"ko, invalid predicate": {
+			query: `a == 1 AND system.foo == "bar"`,
+			err:   `query: position 12: system.foo: attribute: unknown system attribute "foo"`,
+		},
+		"ko, position counts characters": {
+			query: `name == "ä" OR`,
+			err:   `query: position 15: expected attribute, found end of query`,
+		},
+		"ko, too deep": {
+			query: strings.Repeat("(", FilterExpressionMaxDepth+1) + "a == 1",
+			err:   `query: position 17: expression nested more than 16 levels deep`,
+		},
+		"ko, too many negations": {
+			query: strings.Repeat("NOT ", 10000) + "a == 1",
+			err:   `query: position 61: expression nested more than 16 levels deep`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expression, err := ParseFilterQuery(tc.query)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.IsType(t, &ParseError{}, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expression, expression)
+			}
+		})
+	}
+}
+
+func TestFilterExpressionJSON(t *testing.T) {
+	var params SearchParams
+	err := json.Unmarshal([]byte(`{"expression": {"or": [
+		{"predicate": {"scope": "system", "attribute": "status", "type": "$eq", "value": "accepted"}},
+		{"not": {"predicate": {"scope": "inventory", "attribute": "a", "type": "$exists", "value": true}}}
+	]}}`), &params)
+	assert.NoError(t, err)
+	assert.NoError(t, params.Validate())
+
+	expression, err := ParseFilterQuery(`status == "accepted" OR NOT a EXISTS`)
+	assert.NoError(t, err)
+	assert.Equal(t, expression, params.Expression)
+
+	params.Expression.Or[1].Not = &FilterExpression{}
+	assert.EqualError(t, params.Validate(), `expression: or[1]: not: `+
+		`must have exactly one of "and", "or", "not" or "predicate"`)
+}
+
+func TestFilterExpressionClause(t *testing.T) {
+	expression, err := ParseFilterQuery(`status != "rejected" OR NOT name == "foo"`)
+	assert.NoError(t, err)
+
+	clause, _ := json.Marshal(expression.Clause(nil))
+	assert.JSONEq(t, `{"bool": {
+		"minimum_should_match": 1,
+		"should": [
+			{"bool": {"must_not": [{"term": {"status": "rejected"}}]}},
+			{"bool": {"must_not": [{"term": {"name": "foo"}}]}}
+		]
+	}}`, string(clause))
+}
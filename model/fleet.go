@@ -0,0 +1,481 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed fleet_default.yaml
+var defaultFleetProfile []byte
+
+// Distributions of the values picked by the fleet generator
+const (
+	FleetDistributionUniform = "uniform"
+	FleetDistributionZipf    = "zipf"
+)
+
+// Types of the attributes generated by the fleet generator
+const (
+	FleetAttributeString  = "string"
+	FleetAttributeStrings = "strings"
+	FleetAttributeNumeric = "numeric"
+	FleetAttributeMAC     = "mac"
+)
+
+// maxFleetChurnRate bounds the churn rate, keeping short the chains of
+// updates leading back to a new device
+const maxFleetChurnRate = 0.95
+
+// FleetProfile describes the synthetic fleet generated by the indexer;
+// see fleet_default.yaml for the documentation of the fields
+type FleetProfile struct {
+	Seed       int64              `yaml:"seed"`
+	Tenants    FleetTenants       `yaml:"tenants"`
+	Statuses   map[string]float64 `yaml:"statuses"`
+	Groups     FleetGroups        `yaml:"groups"`
+	Churn      FleetChurn         `yaml:"churn"`
+	Attributes []*FleetAttribute  `yaml:"attributes"`
+}
+
+// FleetDistribution is the distribution of the values picked among n
+type FleetDistribution struct {
+	Distribution string  `yaml:"distribution"`
+	Skew         float64 `yaml:"skew"`
+}
+
+// FleetTenants describes the tenants of the fleet
+type FleetTenants struct {
+	Count             int    `yaml:"count"`
+	Prefix            string `yaml:"prefix"`
+	FleetDistribution `yaml:",inline"`
+}
+
+// FleetGroups describes the groups of the devices
+type FleetGroups struct {
+	Count             int     `yaml:"count"`
+	Prefix            string  `yaml:"prefix"`
+	Ungrouped         float64 `yaml:"ungrouped"`
+	FleetDistribution `yaml:",inline"`
+}
+
+// FleetChurn describes the updates of the devices
+type FleetChurn struct {
+	Rate       float64 `yaml:"rate"`
+	Attributes float64 `yaml:"attributes"`
+}
+
+// FleetAttribute describes an attribute of the devices
+type FleetAttribute struct {
+	Scope             string   `yaml:"scope"`
+	Name              string   `yaml:"name"`
+	Type              string   `yaml:"type"`
+	Values            []string `yaml:"values"`
+	Cardinality       int      `yaml:"cardinality"`
+	Min               float64  `yaml:"min"`
+	Max               float64  `yaml:"max"`
+	Count             int      `yaml:"count"`
+	Probability       *float64 `yaml:"probability"`
+	FleetDistribution `yaml:",inline"`
+}
+
+// DefaultFleetProfile returns the default profile of the fleet generator
+func DefaultFleetProfile() *FleetProfile {
+	profile, err := ParseFleetProfile(defaultFleetProfile)
+	if err != nil {
+		panic(err)
+	}
+	return profile
+}
+
+// ParseFleetProfile parses and validates a YAML fleet profile, and sets
+// the defaults of the missing fields
+func ParseFleetProfile(data []byte) (*FleetProfile, error) {
+	profile := &FleetProfile{}
+	if err := yaml.UnmarshalStrict(data, profile); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the fleet profile")
+	}
+	profile.setDefaults()
+	if err := profile.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid fleet profile")
+	}
+	return profile, nil
+}
+
+func (p *FleetProfile) setDefaults() {
+	if p.Tenants.Count == 0 {
+		p.Tenants.Count = 1
+	}
+	if p.Tenants.Prefix == "" {
+		p.Tenants.Prefix = "tenant"
+	}
+	if len(p.Statuses) == 0 {
+		p.Statuses = map[string]float64{StatusAccepted: 1}
+	}
+	if p.Groups.Prefix == "" {
+		p.Groups.Prefix = "group-"
+	}
+	for _, attr := range p.Attributes {
+		if attr.Scope == "" {
+			attr.Scope = ScopeInventory
+		}
+		if attr.Type == "" {
+			attr.Type = FleetAttributeString
+		}
+		if attr.Type == FleetAttributeStrings && attr.Count == 0 {
+			attr.Count = 1
+		}
+		if attr.Probability == nil {
+			always := 1.0
+			attr.Probability = &always
+		}
+	}
+}
+
+// Validate validates the fleet profile
+func (p *FleetProfile) Validate() error {
+	if p.Tenants.Count < 1 {
+		return errors.New("tenants: count must be at least 1")
+	}
+	if err := ValidateTenantID(p.Tenants.Prefix + "1"); err != nil {
+		return errors.Wrap(err, "tenants: invalid prefix")
+	}
+	if err := p.Tenants.validate(); err != nil {
+		return errors.Wrap(err, "tenants")
+	}
+	total := 0.0
+	for status, weight := range p.Statuses {
+		if !deviceStatuses[status] {
+			return errors.Errorf("statuses: unknown status %q", status)
+		} else if weight < 0 {
+			return errors.Errorf("statuses: negative weight of %q", status)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return errors.New("statuses: the weights cannot all be zero")
+	}
+	if p.Groups.Count < 0 {
+		return errors.New("groups: count must be a non-negative number")
+	} else if p.Groups.Ungrouped < 0 || p.Groups.Ungrouped > 1 {
+		return errors.New("groups: ungrouped must be between 0 and 1")
+	}
+	if err := p.Groups.validate(); err != nil {
+		return errors.Wrap(err, "groups")
+	}
+	if p.Churn.Rate < 0 || p.Churn.Rate > maxFleetChurnRate {
+		return errors.Errorf("churn: rate must be between 0 and %g", maxFleetChurnRate)
+	} else if p.Churn.Attributes < 0 || p.Churn.Attributes > 1 {
+		return errors.New("churn: attributes must be between 0 and 1")
+	}
+	names := make(map[string]bool, len(p.Attributes))
+	for _, attr := range p.Attributes {
+		if err := attr.validate(); err != nil {
+			return errors.Wrapf(err, "attributes: %s:%s", attr.Scope, attr.Name)
+		}
+		key := attr.Scope + ":" + attr.Name
+		if names[key] {
+			return errors.Errorf("attributes: %s: duplicate attribute", key)
+		}
+		names[key] = true
+	}
+	return nil
+}
+
+// Hash returns the digest of the profile, without its seed: along with the
+// seed of the generator, it identifies the generated fleet
+func (p *FleetProfile) Hash() (string, error) {
+	profile := *p
+	profile.Seed = 0
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode the fleet profile")
+	}
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func (d *FleetDistribution) validate() error {
+	switch d.Distribution {
+	case "", FleetDistributionUniform:
+	case FleetDistributionZipf:
+		if d.Skew <= 1 {
+			return errors.New("the skew of the zipf distribution must be greater than 1")
+		}
+	default:
+		return errors.Errorf("unknown distribution %q", d.Distribution)
+	}
+	return nil
+}
+
+// pick returns a number between 0 and n-1 following the distribution
+func (d *FleetDistribution) pick(rng *rand.Rand, n int) int {
+	if n <= 1 {
+		return 0
+	} else if d.Distribution == FleetDistributionZipf {
+		return int(rand.NewZipf(rng, d.Skew, 1, uint64(n-1)).Uint64())
+	}
+	return rng.Intn(n)
+}
+
+func (a *FleetAttribute) validate() error {
+	if a.Name == "" {
+		return errors.New("name cannot be blank")
+	}
+	switch a.Scope {
+	case ScopeIdentity, ScopeInventory, ScopeCustom:
+	default:
+		return errors.Errorf("unknown scope %q", a.Scope)
+	}
+	switch a.Type {
+	case FleetAttributeString, FleetAttributeStrings:
+	case FleetAttributeNumeric:
+		if a.Min > a.Max {
+			return errors.New("min cannot be greater than max")
+		}
+		fallthrough
+	case FleetAttributeMAC:
+		if len(a.Values) > 0 {
+			return errors.Errorf("values are not supported by the %s attributes", a.Type)
+		}
+	default:
+		return errors.Errorf("unknown type %q", a.Type)
+	}
+	if a.Cardinality < 0 {
+		return errors.New("cardinality must be a non-negative number")
+	} else if a.Count < 0 {
+		return errors.New("count must be a non-negative number")
+	} else if *a.Probability < 0 || *a.Probability > 1 {
+		return errors.New("probability must be between 0 and 1")
+	}
+	return a.FleetDistribution.validate()
+}
+
+// value returns a random value of the attribute; mac is the MAC address of
+// the device
+func (a *FleetAttribute) value(rng *rand.Rand, mac string) *InventoryAttribute {
+	attr := NewInventoryAttribute().SetName(a.Name)
+	switch a.Type {
+	case FleetAttributeMAC:
+		attr.SetString(mac)
+	case FleetAttributeNumeric:
+		if a.Cardinality == 1 {
+			attr.SetNumeric(a.Min)
+		} else if a.Cardinality > 1 {
+			step := (a.Max - a.Min) / float64(a.Cardinality-1)
+			attr.SetNumeric(a.Min + step*float64(a.pick(rng, a.Cardinality)))
+		} else {
+			attr.SetNumeric(a.Min + rng.Float64()*(a.Max-a.Min))
+		}
+	case FleetAttributeStrings:
+		n := 1 + rng.Intn(a.Count)
+		values := make([]string, 0, n)
+		picked := make(map[string]bool, n)
+		for i := 0; i < n; i++ {
+			value := a.stringValue(rng)
+			if !picked[value] {
+				picked[value] = true
+				values = append(values, value)
+			}
+		}
+		attr.SetStrings(values)
+	default:
+		attr.SetString(a.stringValue(rng))
+	}
+	return attr
+}
+
+func (a *FleetAttribute) stringValue(rng *rand.Rand) string {
+	if len(a.Values) > 0 {
+		return a.Values[a.pick(rng, len(a.Values))]
+	} else if a.Cardinality > 0 {
+		return fmt.Sprintf("%s-%02d", a.Name, a.pick(rng, a.Cardinality))
+	}
+	return fmt.Sprintf("%s-%016x", a.Name, rng.Uint64())
+}
+
+// Salts of the random sources of the devices, so that the decision to
+// update a device does not correlate with the generation of the device
+const (
+	fleetSaltDevice int64 = iota
+	fleetSaltUpdate
+)
+
+// FleetGenerator generates the devices of a fleet profile; the n-th device
+// depends only on the profile, the seed and n, so that a run can resume
+// at any device
+type FleetGenerator struct {
+	profile    *FleetProfile
+	seed       int64
+	statuses   []string
+	weights    []float64
+	attributes map[string]*FleetAttribute
+}
+
+// NewFleetGenerator returns a generator of the devices of the profile;
+// a zero seed picks a random one
+func NewFleetGenerator(profile *FleetProfile, seed int64) *FleetGenerator {
+	for seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	g := &FleetGenerator{
+		profile:    profile,
+		seed:       seed,
+		statuses:   make([]string, 0, len(profile.Statuses)),
+		attributes: make(map[string]*FleetAttribute, len(profile.Attributes)),
+	}
+	for status := range profile.Statuses {
+		g.statuses = append(g.statuses, status)
+	}
+	sort.Strings(g.statuses)
+	total := 0.0
+	for _, status := range g.statuses {
+		total += profile.Statuses[status]
+		g.weights = append(g.weights, total)
+	}
+	for _, attr := range profile.Attributes {
+		g.attributes[attr.Scope+":"+attr.Name] = attr
+	}
+	return g
+}
+
+// Seed returns the seed of the generator
+func (g *FleetGenerator) Seed() int64 {
+	return g.seed
+}
+
+// rand returns the random source of the n-th device
+func (g *FleetGenerator) rand(n, salt int64) *rand.Rand {
+	// splitmix64 finalizer, spreading the consecutive ordinals
+	z := uint64(g.seed) + uint64(2*n+salt)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return rand.New(rand.NewSource(int64(z ^ (z >> 31))))
+}
+
+// Device returns the n-th device of the fleet, starting at 0: a new
+// device, or, with the churn rate of the profile, an update of a device
+// generated before
+func (g *FleetGenerator) Device(n int64) *Device {
+	rng := g.rand(n, fleetSaltUpdate)
+	if n == 0 || rng.Float64() >= g.profile.Churn.Rate {
+		return g.newDevice(n)
+	}
+	device := g.newDevice(g.origin(rng.Int63n(n)))
+	g.update(rng, device)
+	return device
+}
+
+// origin returns the ordinal of the new device the n-th device is
+// an update of
+func (g *FleetGenerator) origin(n int64) int64 {
+	for n > 0 {
+		rng := g.rand(n, fleetSaltUpdate)
+		if rng.Float64() >= g.profile.Churn.Rate {
+			break
+		}
+		n = rng.Int63n(n)
+	}
+	return n
+}
+
+func (g *FleetGenerator) newDevice(n int64) *Device {
+	rng := g.rand(n, fleetSaltDevice)
+	id, _ := uuid.NewRandomFromReader(rng)
+	device := NewDevice(id.String())
+	device.SetName("device-" + id.String())
+
+	tenants := &g.profile.Tenants
+	device.SetTenantID(fmt.Sprintf("%s%d", tenants.Prefix,
+		tenants.pick(rng, tenants.Count)+1))
+
+	total := g.weights[len(g.weights)-1]
+	weight := rng.Float64() * total
+	status := sort.Search(len(g.weights), func(i int) bool {
+		return g.weights[i] > weight
+	})
+	if status == len(g.statuses) {
+		status--
+	}
+	device.SetStatus(g.statuses[status])
+
+	groups := &g.profile.Groups
+	if groups.Count > 0 && rng.Float64() >= groups.Ungrouped {
+		device.SetGroupName(fmt.Sprintf("%s%02d", groups.Prefix,
+			groups.pick(rng, groups.Count)))
+	}
+
+	mac := randomMacAddress(rng)
+	for _, attr := range g.profile.Attributes {
+		if rng.Float64() >= *attr.Probability {
+			continue
+		}
+		value := attr.value(rng, mac)
+		switch attr.Scope {
+		case ScopeIdentity:
+			device.IdentityAttributes = append(device.IdentityAttributes, value)
+		case ScopeCustom:
+			device.CustomAttributes = append(device.CustomAttributes, value)
+		default:
+			device.InventoryAttributes = append(device.InventoryAttributes, value)
+		}
+	}
+
+	now := time.Now().UTC()
+	device.SetCreatedAt(now).SetUpdatedAt(now)
+	return device
+}
+
+// update changes the attributes of the device with the churn probability
+// of the profile; the MAC addresses do not change
+func (g *FleetGenerator) update(rng *rand.Rand, device *Device) {
+	scopes := []struct {
+		name  string
+		attrs DeviceInventory
+	}{
+		{ScopeIdentity, device.IdentityAttributes},
+		{ScopeInventory, device.InventoryAttributes},
+		{ScopeCustom, device.CustomAttributes},
+	}
+	for _, scope := range scopes {
+		for i, attr := range scope.attrs {
+			spec := g.attributes[scope.name+":"+attr.GetName()]
+			if spec.Type == FleetAttributeMAC ||
+				rng.Float64() >= g.profile.Churn.Attributes {
+				continue
+			}
+			scope.attrs[i] = spec.value(rng, "")
+		}
+	}
+	device.SetUpdatedAt(time.Now().UTC())
+}
+
+func randomMacAddress(rng *rand.Rand) string {
+	buf := make([]byte, 6)
+	_, _ = rng.Read(buf)
+	buf[0] |= 2
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", buf[0], buf[1], buf[2], buf[3], buf[4], buf[5])
+}
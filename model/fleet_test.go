@@ -0,0 +1,208 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultFleetProfile(t *testing.T) {
+	profile := DefaultFleetProfile()
+	assert.Equal(t, 2, profile.Tenants.Count)
+	assert.Equal(t, 100, profile.Groups.Count)
+
+	names := map[string]int{}
+	for _, attr := range profile.Attributes {
+		names[attr.Scope+":"+attr.Name]++
+	}
+	for name, count := range names {
+		assert.Equal(t, 1, count, name)
+	}
+
+	device := NewFleetGenerator(profile, 1).Device(0)
+	assert.Contains(t, []string{"tenant1", "tenant2"}, device.GetTenantID())
+	assert.Contains(t, []string{StatusAccepted, StatusPending}, device.GetStatus())
+	assert.Len(t, device.IdentityAttributes, 2)
+	assert.Len(t, device.CustomAttributes, 1)
+	assert.Len(t, device.InventoryAttributes, 21)
+	assert.Equal(t, device.IdentityAttributes[0].GetString(),
+		device.InventoryAttributes[0].GetString())
+}
+
+func TestFleetProfileHash(t *testing.T) {
+	hash, err := DefaultFleetProfile().Hash()
+	assert.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	// the seed is not part of the profile
+	profile := DefaultFleetProfile()
+	profile.Seed = 42
+	seeded, err := profile.Hash()
+	assert.NoError(t, err)
+	assert.Equal(t, hash, seeded)
+
+	profile.Tenants.Count++
+	other, err := profile.Hash()
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+}
+
+func TestParseFleetProfile(t *testing.T) {
+	testCases := map[string]struct {
+		profile string
+
+		err string
+	}{
+		"ok": {
+			profile: `
+seed: 42
+tenants: {count: 10, distribution: zipf, skew: 1.5}
+statuses: {accepted: 9, pending: 1}
+groups: {count: 5, ungrouped: 0.2}
+churn: {rate: 0.3, attributes: 0.5}
+attributes:
+  - {name: device_type, values: [a, b], distribution: zipf, skew: 2}
+  - {name: ram, type: numeric, min: 1, max: 4, cardinality: 4}
+`,
+		},
+		"ok, defaults": {
+			profile: `{}`,
+		},
+		"ko, unknown field": {
+			profile: `tenant: {count: 1}`,
+			err: "failed to parse the fleet profile: yaml: unmarshal errors:\n" +
+				"  line 1: field tenant not found in type model.FleetProfile",
+		},
+		"ko, invalid tenant prefix": {
+			profile: `tenants: {prefix: Tenant}`,
+			err: "invalid fleet profile: tenants: invalid prefix: tenant_id: must " +
+				"be at most 128 lowercase alphanumeric characters, dashes or underscores",
+		},
+		"ko, zipf skew": {
+			profile: `tenants: {distribution: zipf, skew: 1}`,
+			err: "invalid fleet profile: tenants: the skew of the zipf " +
+				"distribution must be greater than 1",
+		},
+		"ko, unknown status": {
+			profile: `statuses: {active: 1}`,
+			err:     `invalid fleet profile: statuses: unknown status "active"`,
+		},
+		"ko, zero weights": {
+			profile: `statuses: {accepted: 0}`,
+			err:     "invalid fleet profile: statuses: the weights cannot all be zero",
+		},
+		"ko, churn rate": {
+			profile: `churn: {rate: 1}`,
+			err:     "invalid fleet profile: churn: rate must be between 0 and 0.95",
+		},
+		"ko, unknown attribute type": {
+			profile: `attributes: [{name: ram, type: bytes}]`,
+			err:     `invalid fleet profile: attributes: inventory:ram: unknown type "bytes"`,
+		},
+		"ko, numeric values": {
+			profile: `attributes: [{name: ram, type: numeric, values: ["1"]}]`,
+			err: "invalid fleet profile: attributes: inventory:ram: values are " +
+				"not supported by the numeric attributes",
+		},
+		"ko, duplicate attribute": {
+			profile: `attributes: [{name: os}, {name: os, scope: inventory}]`,
+			err:     "invalid fleet profile: attributes: inventory:os: duplicate attribute",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			profile, err := ParseFleetProfile([]byte(tc.profile))
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, profile)
+			}
+		})
+	}
+}
+
+func TestFleetGenerator(t *testing.T) {
+	profile, err := ParseFleetProfile([]byte(`
+tenants: {count: 20, distribution: zipf, skew: 1.5}
+statuses: {accepted: 3, pending: 1}
+groups: {count: 10, ungrouped: 0.5}
+churn: {rate: 0.4, attributes: 1}
+attributes:
+  - {scope: identity, name: mac, type: mac}
+  - {name: device_type, values: [a, b, c]}
+  - {name: ram, type: numeric, min: 1, max: 4, cardinality: 4}
+  - {name: interfaces, type: strings, cardinality: 5, count: 3}
+  - {name: modem, values: [lte], probability: 0.25}
+`))
+	assert.NoError(t, err)
+
+	const n = 4000
+	generator := NewFleetGenerator(profile, 42)
+	devices := make([]*Device, n)
+	for i := range devices {
+		devices[i] = generator.Device(int64(i))
+	}
+
+	// deterministic, in any order
+	other := NewFleetGenerator(profile, 42)
+	for _, i := range []int64{n - 1, 0, 1234} {
+		device := other.Device(i)
+		assert.Equal(t, devices[i].GetID(), device.GetID())
+		assert.Equal(t, devices[i].InventoryAttributes, device.InventoryAttributes)
+	}
+	assert.NotEqual(t, devices[0].GetID(), NewFleetGenerator(profile, 43).Device(0).GetID())
+
+	first := map[string]*Device{}
+	tenants := map[string]int{}
+	statuses := map[string]int{}
+	ungrouped, modems, updates := 0, 0, 0
+	for _, device := range devices {
+		if original, ok := first[device.GetID()]; ok {
+			updates++
+			assert.Equal(t, original.GetTenantID(), device.GetTenantID())
+			assert.Equal(t, original.IdentityAttributes, device.IdentityAttributes)
+			continue
+		}
+		first[device.GetID()] = device
+		tenants[device.GetTenantID()]++
+		statuses[device.GetStatus()]++
+		if device.GroupName == nil {
+			ungrouped++
+		}
+		for _, attr := range device.InventoryAttributes {
+			switch attr.GetName() {
+			case "modem":
+				modems++
+			case "ram":
+				assert.Contains(t, []float64{1, 2, 3, 4}, attr.GetNumeric())
+			case "interfaces":
+				assert.GreaterOrEqual(t, len(attr.GetStrings()), 1)
+				assert.LessOrEqual(t, len(attr.GetStrings()), 3)
+			}
+		}
+	}
+	total := len(first)
+	assert.InDelta(t, 0.4, float64(updates)/n, 0.05)
+	assert.InDelta(t, 0.75, float64(statuses[StatusAccepted])/float64(total), 0.05)
+	assert.InDelta(t, 0.5, float64(ungrouped)/float64(total), 0.05)
+	assert.InDelta(t, 0.25, float64(modems)/float64(total), 0.05)
+	// zipf: the first tenant is the largest
+	for tenant, count := range tenants {
+		assert.LessOrEqual(t, count, tenants["tenant1"], tenant)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Geohash grid precision limits
+const (
+	GeoGridPrecisionDefault = 5
+	GeoGridPrecisionMax     = 12
+)
+
+var distanceRegexp = regexp.MustCompile(
+	`^[0-9]+(\.[0-9]+)?(mi|miles|yd|yards|ft|feet|in|inch|km|kilometers|` +
+		`m|meters|cm|centimeters|mm|millimeters|NM|nmi|nauticalmiles)$`)
+
+// GeoPoint is a geographical location
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Validate validates the coordinates of the location
+func (p GeoPoint) Validate() error {
+	if p.Lat < -90 || p.Lat > 90 {
+		return errors.New("lat: must be between -90 and 90")
+	}
+	if p.Lon < -180 || p.Lon > 180 {
+		return errors.New("lon: must be between -180 and 180")
+	}
+	return nil
+}
+
+// GeoAttributes are the names of the inventory attributes holding the
+// latitude and the longitude of the devices
+type GeoAttributes struct {
+	Latitude  string
+	Longitude string
+}
+
+func numericValue(attr *InventoryAttribute) (float64, bool) {
+	if attr.Numeric != nil {
+		return *attr.Numeric, true
+	}
+	if len(attr.String) > 0 {
+		value, err := strconv.ParseFloat(attr.String[0], 64)
+		return value, err == nil
+	}
+	return 0, false
+}
+
+// Location returns the location of the device from its inventory
+// attributes, or nil if the attributes are missing or not valid
+func (g GeoAttributes) Location(inventory DeviceInventory) *GeoPoint {
+	if g.Latitude == "" || g.Longitude == "" {
+		return nil
+	}
+	var (
+		point        GeoPoint
+		hasLatitude  bool
+		hasLongitude bool
+	)
+	for _, attr := range inventory {
+		switch attr.GetName() {
+		case g.Latitude:
+			point.Lat, hasLatitude = numericValue(attr)
+		case g.Longitude:
+			point.Lon, hasLongitude = numericValue(attr)
+		}
+	}
+	if !hasLatitude || !hasLongitude || point.Validate() != nil {
+		return nil
+	}
+	return &point
+}
+
+// GeoDistanceFilter matches the devices within the distance from a point
+type GeoDistanceFilter struct {
+	Point    GeoPoint `json:"point"`
+	Distance string   `json:"distance"`
+}
+
+// Validate validates the geo distance filter
+func (f *GeoDistanceFilter) Validate() error {
+	if err := f.Point.Validate(); err != nil {
+		return errors.Wrap(err, "point")
+	}
+	if !distanceRegexp.MatchString(f.Distance) {
+		return errors.Errorf("distance: invalid distance %q", f.Distance)
+	}
+	return nil
+}
+
+// GeoBoundingBoxFilter matches the devices within a bounding box
+type GeoBoundingBoxFilter struct {
+	TopLeft     GeoPoint `json:"top_left"`
+	BottomRight GeoPoint `json:"bottom_right"`
+}
+
+// Validate validates the geo bounding box filter
+func (f *GeoBoundingBoxFilter) Validate() error {
+	if err := f.TopLeft.Validate(); err != nil {
+		return errors.Wrap(err, "top_left")
+	}
+	if err := f.BottomRight.Validate(); err != nil {
+		return errors.Wrap(err, "bottom_right")
+	}
+	if f.TopLeft.Lat < f.BottomRight.Lat {
+		return errors.New("top_left: must be north of bottom_right")
+	}
+	return nil
+}
+
+func geoClauses(geoDistance *GeoDistanceFilter,
+	geoBoundingBox *GeoBoundingBoxFilter) []interface{} {
+	clauses := []interface{}{}
+	if geoDistance != nil {
+		clauses = append(clauses, map[string]interface{}{
+			"geo_distance": map[string]interface{}{
+				"distance": geoDistance.Distance,
+				"location": geoDistance.Point,
+			},
+		})
+	}
+	if geoBoundingBox != nil {
+		clauses = append(clauses, map[string]interface{}{
+			"geo_bounding_box": map[string]interface{}{
+				"location": map[string]interface{}{
+					"top_left":     geoBoundingBox.TopLeft,
+					"bottom_right": geoBoundingBox.BottomRight,
+				},
+			},
+		})
+	}
+	return clauses
+}
+
+// GeoGridParams are the parameters of a geohash grid aggregation
+type GeoGridParams struct {
+	Filters        []FilterPredicate     `json:"filters"`
+	FilterQuery    string                `json:"query"`
+	Expression     *FilterExpression     `json:"expression"`
+	GeoDistance    *GeoDistanceFilter    `json:"geo_distance"`
+	GeoBoundingBox *GeoBoundingBoxFilter `json:"geo_bounding_box"`
+	Precision      int                   `json:"precision"`
+	TenantID       string                `json:"-"`
+}
+
+// Validate validates the geohash grid parameters and sets the defaults
+func (p *GeoGridParams) Validate() error {
+	if p.Precision == 0 {
+		p.Precision = GeoGridPrecisionDefault
+	}
+	if p.Precision < 1 || p.Precision > GeoGridPrecisionMax {
+		return errors.Errorf("precision: must be between 1 and %d", GeoGridPrecisionMax)
+	}
+	search := SearchParams{
+		Filters:        p.Filters,
+		FilterQuery:    p.FilterQuery,
+		Expression:     p.Expression,
+		GeoDistance:    p.GeoDistance,
+		GeoBoundingBox: p.GeoBoundingBox,
+	}
+	return search.Validate()
+}
+
+// GeoGridBucket is a cell of the geohash grid
+type GeoGridBucket struct {
+	Geohash  string    `json:"geohash"`
+	Count    int       `json:"count"`
+	Centroid *GeoPoint `json:"centroid,omitempty"`
+}
+
+// BuildGeoGridQuery builds the Elasticsearch query aggregating the
+// locations of the matching devices in a geohash grid
+func BuildGeoGridQuery(params *GeoGridParams) (Query, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	search := &SearchParams{
+		Filters:        params.Filters,
+		FilterQuery:    params.FilterQuery,
+		Expression:     params.Expression,
+		GeoDistance:    params.GeoDistance,
+		GeoBoundingBox: params.GeoBoundingBox,
+	}
+	return Query{
+		"query": search.boolQuery(),
+		"aggs": map[string]interface{}{
+			"grid": map[string]interface{}{
+				"geohash_grid": map[string]interface{}{
+					"field":     "location",
+					"precision": params.Precision,
+					"size":      GetQueryLimits().MaxBuckets,
+				},
+				"aggs": map[string]interface{}{
+					"centroid": map[string]interface{}{
+						"geo_centroid": map[string]interface{}{
+							"field": "location",
+						},
+					},
+				},
+			},
+		},
+		"size":             0,
+		"track_total_hits": true,
+	}, nil
+}
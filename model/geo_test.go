@@ -0,0 +1,106 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoAttributesLocation(t *testing.T) {
+	attrs := GeoAttributes{Latitude: "lat", Longitude: "lon"}
+
+	testCases := map[string]struct {
+		inventory DeviceInventory
+		location  *GeoPoint
+	}{
+		"numeric": {
+			inventory: DeviceInventory{
+				NewInventoryAttribute().SetName("lat").SetNumeric(59.91),
+				NewInventoryAttribute().SetName("lon").SetNumeric(10.75),
+			},
+			location: &GeoPoint{Lat: 59.91, Lon: 10.75},
+		},
+		"strings": {
+			inventory: DeviceInventory{
+				NewInventoryAttribute().SetName("lat").SetString("59.91"),
+				NewInventoryAttribute().SetName("lon").SetString("10.75"),
+			},
+			location: &GeoPoint{Lat: 59.91, Lon: 10.75},
+		},
+		"missing longitude": {
+			inventory: DeviceInventory{
+				NewInventoryAttribute().SetName("lat").SetNumeric(59.91),
+			},
+		},
+		"out of range": {
+			inventory: DeviceInventory{
+				NewInventoryAttribute().SetName("lat").SetNumeric(91),
+				NewInventoryAttribute().SetName("lon").SetNumeric(10.75),
+			},
+		},
+		"not a number": {
+			inventory: DeviceInventory{
+				NewInventoryAttribute().SetName("lat").SetString("north"),
+				NewInventoryAttribute().SetName("lon").SetNumeric(10.75),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.location, attrs.Location(tc.inventory))
+		})
+	}
+}
+
+func TestBuildGeoGridQuery(t *testing.T) {
+	query, err := BuildGeoGridQuery(&GeoGridParams{
+		GeoBoundingBox: &GeoBoundingBoxFilter{
+			TopLeft:     GeoPoint{Lat: 60, Lon: 10},
+			BottomRight: GeoPoint{Lat: 59, Lon: 11},
+		},
+	})
+	assert.NoError(t, err)
+	queryJSON, _ := json.Marshal(query)
+	assert.JSONEq(t, `{
+		"query": {"bool": {
+			"filter": [{"geo_bounding_box": {"location": {
+				"top_left": {"lat": 60, "lon": 10},
+				"bottom_right": {"lat": 59, "lon": 11}
+			}}}],
+			"must_not": []
+		}},
+		"aggs": {"grid": {
+			"geohash_grid": {"field": "location", "precision": 5, "size": 10000},
+			"aggs": {"centroid": {"geo_centroid": {"field": "location"}}}
+		}},
+		"size": 0,
+		"track_total_hits": true
+	}`, string(queryJSON))
+
+	_, err = BuildGeoGridQuery(&GeoGridParams{
+		GeoDistance: &GeoDistanceFilter{
+			Point:    GeoPoint{Lat: 60, Lon: 10},
+			Distance: "far",
+		},
+	})
+	assert.EqualError(t, err, `geo_distance: distance: invalid distance "far"`)
+
+	_, err = BuildGeoGridQuery(&GeoGridParams{Precision: 13})
+	assert.EqualError(t, err, "precision: must be between 1 and 12")
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Attribute scopes
+const (
+	ScopeSystem    = "system"
+	ScopeIdentity  = "identity"
+	ScopeInventory = "inventory"
+	ScopeCustom    = "custom"
+)
+
+// System attributes, stored as top-level fields of the device document
+const (
+	AttrName      = "name"
+	AttrGroupName = "groupName"
+	AttrStatus    = "status"
+)
+
+// AttributeValue is the value of an attribute at a given point in time
+type AttributeValue struct {
+	String  []string `json:"string,omitempty"`
+	Numeric *float64 `json:"numeric,omitempty"`
+}
+
+// AttributeChange records the change of a single device attribute
+type AttributeChange struct {
+	DeviceID  string          `json:"deviceID"`
+	TenantID  string          `json:"tenantID,omitempty"`
+	Scope     string          `json:"scope"`
+	Name      string          `json:"name"`
+	OldValue  *AttributeValue `json:"oldValue,omitempty"`
+	NewValue  *AttributeValue `json:"newValue,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// HistoryFilter holds the filters to apply when looking up the history
+// of a device
+type HistoryFilter struct {
+	Scope     string
+	Attribute string
+	From      *time.Time
+	To        *time.Time
+	Page      int64
+	PerPage   int64
+}
+
+func stringValue(val string) *AttributeValue {
+	if val == "" {
+		return nil
+	}
+	return &AttributeValue{String: []string{val}}
+}
+
+func inventoryValue(attr *InventoryAttribute) *AttributeValue {
+	if attr == nil || (len(attr.String) == 0 && attr.Numeric == nil) {
+		return nil
+	}
+	return &AttributeValue{
+		String:  attr.String,
+		Numeric: attr.Numeric,
+	}
+}
+
+func inventoryMap(inventory DeviceInventory) map[string]*InventoryAttribute {
+	attrs := make(map[string]*InventoryAttribute, len(inventory))
+	for _, attr := range inventory {
+		if attr != nil {
+			attrs[attr.GetName()] = attr
+		}
+	}
+	return attrs
+}
+
+func diffInventory(scope string, stored, incoming DeviceInventory) []*AttributeChange {
+	oldAttrs := inventoryMap(stored)
+	newAttrs := inventoryMap(incoming)
+
+	names := make([]string, 0, len(oldAttrs)+len(newAttrs))
+	for name := range oldAttrs {
+		names = append(names, name)
+	}
+	for name := range newAttrs {
+		if _, ok := oldAttrs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []*AttributeChange{}
+	for _, name := range names {
+		oldValue := inventoryValue(oldAttrs[name])
+		newValue := inventoryValue(newAttrs[name])
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, &AttributeChange{
+				Scope:    scope,
+				Name:     name,
+				OldValue: oldValue,
+				NewValue: newValue,
+			})
+		}
+	}
+	return changes
+}
+
+// DiffDevices compares the stored and the incoming version of a device and
+// returns the list of changed attributes; if there is no stored version of
+// the device, the history starts with the incoming one and no changes are
+// returned
+func DiffDevices(stored, incoming *Device, timestamp time.Time) []*AttributeChange {
+	if stored == nil || incoming == nil {
+		return nil
+	}
+
+	changes := []*AttributeChange{}
+	system := []struct {
+		name     string
+		old, new string
+	}{
+		{AttrName, stored.GetName(), incoming.GetName()},
+		{AttrGroupName, stored.GetGroupName(), incoming.GetGroupName()},
+		{AttrStatus, stored.GetStatus(), incoming.GetStatus()},
+	}
+	for _, attr := range system {
+		if attr.old != attr.new {
+			changes = append(changes, &AttributeChange{
+				Scope:    ScopeSystem,
+				Name:     attr.name,
+				OldValue: stringValue(attr.old),
+				NewValue: stringValue(attr.new),
+			})
+		}
+	}
+	changes = append(changes, diffInventory(ScopeIdentity,
+		stored.IdentityAttributes, incoming.IdentityAttributes)...)
+	changes = append(changes, diffInventory(ScopeInventory,
+		stored.InventoryAttributes, incoming.InventoryAttributes)...)
+	changes = append(changes, diffInventory(ScopeCustom,
+		stored.CustomAttributes, incoming.CustomAttributes)...)
+
+	for _, change := range changes {
+		change.DeviceID = incoming.GetID()
+		change.TenantID = incoming.GetTenantID()
+		change.Timestamp = timestamp
+	}
+	return changes
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffDevices(t *testing.T) {
+	now := time.Now()
+	numeric := func(val float64) *float64 {
+		return &val
+	}
+
+	testCases := map[string]struct {
+		stored   *Device
+		incoming *Device
+		changes  []*AttributeChange
+	}{
+		"new device": {
+			incoming: NewDevice("1").SetTenantID("tenant").SetStatus(StatusPending),
+		},
+		"no changes": {
+			stored: &Device{
+				ID:     strPtr("1"),
+				Status: strPtr(StatusAccepted),
+				InventoryAttributes: DeviceInventory{
+					NewInventoryAttribute().SetName("device_type").SetString("dm1"),
+				},
+			},
+			incoming: &Device{
+				ID:     strPtr("1"),
+				Status: strPtr(StatusAccepted),
+				InventoryAttributes: DeviceInventory{
+					NewInventoryAttribute().SetName("device_type").SetString("dm1"),
+				},
+			},
+			changes: []*AttributeChange{},
+		},
+		"changes": {
+			stored: &Device{
+				ID:       strPtr("1"),
+				TenantID: strPtr("tenant"),
+				Status:   strPtr(StatusPending),
+				IdentityAttributes: DeviceInventory{
+					NewInventoryAttribute().SetName("mac").SetString("00:11:22:33:44:55"),
+				},
+				InventoryAttributes: DeviceInventory{
+					NewInventoryAttribute().SetName("artifact_name").SetString("release-1"),
+					NewInventoryAttribute().SetName("mem_total_kB").SetNumeric(1024),
+				},
+			},
+			incoming: &Device{
+				ID:        strPtr("1"),
+				TenantID:  strPtr("tenant"),
+				Status:    strPtr(StatusAccepted),
+				GroupName: strPtr("production"),
+				IdentityAttributes: DeviceInventory{
+					NewInventoryAttribute().SetName("mac").SetString("00:11:22:33:44:55"),
+				},
+				InventoryAttributes: DeviceInventory{
+					NewInventoryAttribute().SetName("artifact_name").SetString("release-2"),
+				},
+				CustomAttributes: DeviceInventory{
+					NewInventoryAttribute().SetName("tag").SetString("value"),
+				},
+			},
+			changes: []*AttributeChange{
+				{
+					DeviceID:  "1",
+					TenantID:  "tenant",
+					Scope:     ScopeSystem,
+					Name:      AttrGroupName,
+					NewValue:  &AttributeValue{String: []string{"production"}},
+					Timestamp: now,
+				},
+				{
+					DeviceID:  "1",
+					TenantID:  "tenant",
+					Scope:     ScopeSystem,
+					Name:      AttrStatus,
+					OldValue:  &AttributeValue{String: []string{StatusPending}},
+					NewValue:  &AttributeValue{String: []string{StatusAccepted}},
+					Timestamp: now,
+				},
+				{
+					DeviceID:  "1",
+					TenantID:  "tenant",
+					Scope:     ScopeInventory,
+					Name:      "artifact_name",
+					OldValue:  &AttributeValue{String: []string{"release-1"}},
+					NewValue:  &AttributeValue{String: []string{"release-2"}},
+					Timestamp: now,
+				},
+				{
+					DeviceID:  "1",
+					TenantID:  "tenant",
+					Scope:     ScopeInventory,
+					Name:      "mem_total_kB",
+					OldValue:  &AttributeValue{Numeric: numeric(1024)},
+					Timestamp: now,
+				},
+				{
+					DeviceID:  "1",
+					TenantID:  "tenant",
+					Scope:     ScopeCustom,
+					Name:      "tag",
+					NewValue:  &AttributeValue{String: []string{"value"}},
+					Timestamp: now,
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			changes := DiffDevices(tc.stored, tc.incoming, now)
+			assert.Equal(t, tc.changes, changes)
+		})
+	}
+}
+
+func strPtr(val string) *string {
+	return &val
+}
@@ -0,0 +1,374 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Formats of the files of devices to import
+const (
+	ImportFormatNDJSON = "ndjson"
+	ImportFormatCSV    = "csv"
+)
+
+// maxImportLineSize is the maximum size of a line of an imported NDJSON file
+const maxImportLineSize = 1024 * 1024
+
+// Targets of the columns of a CSV file, other than the attributes
+const (
+	csvTargetID        = "id"
+	csvTargetTenantID  = "tenantID"
+	csvTargetName      = "name"
+	csvTargetGroupName = "groupName"
+	csvTargetStatus    = "status"
+	csvTargetCreatedAt = "createdAt"
+	csvTargetUpdatedAt = "updatedAt"
+
+	csvTypeNumeric = "numeric"
+)
+
+var deviceStatuses = map[string]bool{
+	StatusAccepted:      true,
+	StatusPending:       true,
+	StatusRejected:      true,
+	StatusPreauthorized: true,
+	StatusNoAuth:        true,
+}
+
+// ImportError is the error of a record of an imported file, which is
+// reported and skipped
+type ImportError struct {
+	Line     int    `json:"line"`
+	DeviceID string `json:"deviceID,omitempty"`
+	Reason   string `json:"error"`
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// ImportStats are the statistics of an import
+type ImportStats struct {
+	Records  int `json:"records"`
+	Imported int `json:"imported"`
+	Failed   int `json:"failed"`
+}
+
+// ImportReader reads the devices of an imported file
+type ImportReader interface {
+	// Read returns the next device, an *ImportError if the record is
+	// malformed, or io.EOF at the end of the file
+	Read() (*Device, error)
+	// Line returns the line of the last record read
+	Line() int
+}
+
+// ValidateImportedDevice validates a device read from an imported file
+func ValidateImportedDevice(device *Device) error {
+	if strings.TrimSpace(device.GetID()) == "" {
+		return errors.New("id: cannot be blank")
+	}
+	if err := ValidateTenantID(device.GetTenantID()); err != nil {
+		return errors.Wrap(err, "invalid tenant")
+	}
+	if device.Status != nil && !deviceStatuses[*device.Status] {
+		return errors.Errorf("status: unknown status %q", *device.Status)
+	}
+	for scope, attrs := range map[string]DeviceInventory{
+		ScopeIdentity:  device.IdentityAttributes,
+		ScopeInventory: device.InventoryAttributes,
+		ScopeCustom:    device.CustomAttributes,
+	} {
+		for _, attr := range attrs {
+			if attr == nil || attr.GetName() == "" {
+				return errors.Errorf("%s attributes: name cannot be blank", scope)
+			}
+		}
+	}
+	return nil
+}
+
+type ndjsonReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+// NewNDJSONReader returns a reader of the devices of a NDJSON file, one
+// JSON encoded Device per line; the blank lines are skipped, and the lines
+// longer than 1 MiB are reported as malformed
+func NewNDJSONReader(r io.Reader) ImportReader {
+	return &ndjsonReader{reader: bufio.NewReaderSize(r, 64*1024)}
+}
+
+func (r *ndjsonReader) Read() (*Device, error) {
+	for {
+		data, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		device := &Device{}
+		if err := decoder.Decode(device); err != nil {
+			return nil, &ImportError{Line: r.line, Reason: err.Error()}
+		}
+		return device, nil
+	}
+}
+
+// readLine reads the next line; the rest of a line longer than the maximum
+// size is skipped, and the line is reported as an ImportError
+func (r *ndjsonReader) readLine() ([]byte, error) {
+	line := []byte{}
+	tooLong := false
+	for isPrefix := true; isPrefix; {
+		var chunk []byte
+		var err error
+		chunk, isPrefix, err = r.reader.ReadLine()
+		if err == io.EOF {
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to read line %d", r.line+1)
+		}
+		tooLong = tooLong || len(line)+len(chunk) > maxImportLineSize
+		if !tooLong {
+			line = append(line, chunk...)
+		}
+	}
+	r.line++
+	if tooLong {
+		return nil, &ImportError{
+			Line:   r.line,
+			Reason: fmt.Sprintf("line longer than %d bytes", maxImportLineSize),
+		}
+	}
+	return line, nil
+}
+
+func (r *ndjsonReader) Line() int {
+	return r.line
+}
+
+// csvColumn is the target of a column of a CSV file
+type csvColumn struct {
+	target  string
+	scope   string
+	numeric bool
+}
+
+// CSVMapping maps the columns of a CSV file to the fields of the devices:
+// "id", "tenantID", "name", "groupName", "status", "createdAt" and
+// "updatedAt" (RFC 3339), or an attribute, as "<scope>:<name>", with the
+// identity, inventory or custom scope, and an optional ":numeric" suffix
+type CSVMapping map[string]string
+
+// ParseCSVMapping parses and validates the JSON encoded mapping of the
+// columns of a CSV file
+func ParseCSVMapping(data []byte) (CSVMapping, error) {
+	var mapping CSVMapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the mapping")
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// Validate validates the mapping, which must map a column to the device ID
+func (m CSVMapping) Validate() error {
+	hasID := false
+	for _, column := range m.columns() {
+		col, err := parseCSVTarget(m[column])
+		if err != nil {
+			return errors.Wrapf(err, "column %q", column)
+		}
+		hasID = hasID || col.target == csvTargetID
+	}
+	if !hasID {
+		return errors.New("no column mapped to the id")
+	}
+	return nil
+}
+
+// columns returns the names of the mapped columns, sorted
+func (m CSVMapping) columns() []string {
+	columns := make([]string, 0, len(m))
+	for column := range m {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func parseCSVTarget(target string) (*csvColumn, error) {
+	switch target {
+	case csvTargetID, csvTargetTenantID, csvTargetName, csvTargetGroupName,
+		csvTargetStatus, csvTargetCreatedAt, csvTargetUpdatedAt:
+		return &csvColumn{target: target}, nil
+	}
+	parts := strings.Split(target, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[1] == "" {
+		return nil, errors.Errorf("invalid target %q", target)
+	}
+	switch parts[0] {
+	case ScopeIdentity, ScopeInventory, ScopeCustom:
+	default:
+		return nil, errors.Errorf("unknown scope %q", parts[0])
+	}
+	col := &csvColumn{target: parts[1], scope: parts[0]}
+	if len(parts) == 3 {
+		if parts[2] != csvTypeNumeric {
+			return nil, errors.Errorf("unknown type %q", parts[2])
+		}
+		col.numeric = true
+	}
+	return col, nil
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[int]*csvColumn
+	line    int
+}
+
+// NewCSVReader returns a reader of the devices of a CSV file, with a
+// header line naming the columns; the unmapped columns and the empty
+// values are ignored
+func NewCSVReader(r io.Reader, mapping CSVMapping) (ImportReader, error) {
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the header")
+	}
+	columns := make(map[int]*csvColumn, len(mapping))
+	for i, name := range header {
+		if target, ok := mapping[strings.TrimSpace(name)]; ok {
+			columns[i], _ = parseCSVTarget(target)
+		}
+	}
+	for _, name := range mapping.columns() {
+		found := false
+		for _, col := range header {
+			found = found || strings.TrimSpace(col) == name
+		}
+		if !found {
+			return nil, errors.Errorf("column %q not found in the header", name)
+		}
+	}
+	return &csvReader{reader: reader, columns: columns, line: 1}, nil
+}
+
+func (r *csvReader) Read() (*Device, error) {
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	r.line++
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		return nil, &ImportError{Line: r.line, Reason: parseErr.Err.Error()}
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read line %d", r.line)
+	}
+	device := &Device{}
+	for i, value := range record {
+		col, ok := r.columns[i]
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			continue
+		}
+		if err := col.set(device, value); err != nil {
+			return nil, &ImportError{
+				Line:     r.line,
+				DeviceID: device.GetID(),
+				Reason:   err.Error(),
+			}
+		}
+	}
+	return device, nil
+}
+
+func (r *csvReader) Line() int {
+	return r.line
+}
+
+// set sets the target of the column of the device to the value
+func (c *csvColumn) set(device *Device, value string) error {
+	if c.scope != "" {
+		attr := NewInventoryAttribute().SetName(c.target)
+		if c.numeric {
+			num, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return errors.Errorf("%s:%s: not a number: %q", c.scope, c.target, value)
+			}
+			attr.SetNumeric(num)
+		} else {
+			attr.SetString(value)
+		}
+		switch c.scope {
+		case ScopeIdentity:
+			device.IdentityAttributes = append(device.IdentityAttributes, attr)
+		case ScopeInventory:
+			device.InventoryAttributes = append(device.InventoryAttributes, attr)
+		case ScopeCustom:
+			device.CustomAttributes = append(device.CustomAttributes, attr)
+		}
+		return nil
+	}
+	switch c.target {
+	case csvTargetID:
+		device.SetID(value)
+	case csvTargetTenantID:
+		device.SetTenantID(value)
+	case csvTargetName:
+		device.SetName(value)
+	case csvTargetGroupName:
+		device.SetGroupName(value)
+	case csvTargetStatus:
+		device.SetStatus(value)
+	case csvTargetCreatedAt, csvTargetUpdatedAt:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return errors.Errorf("%s: not a RFC 3339 time: %q", c.target, value)
+		}
+		if c.target == csvTargetCreatedAt {
+			device.SetCreatedAt(t.UTC())
+		} else {
+			device.SetUpdatedAt(t.UTC())
+		}
+	}
+	return nil
+}
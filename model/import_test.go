@@ -0,0 +1,220 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readAll reads the devices and the record errors of the reader
+func readAll(t *testing.T, reader ImportReader) ([]*Device, []*ImportError) {
+	devices := []*Device{}
+	importErrors := []*ImportError{}
+	for {
+		device, err := reader.Read()
+		if err == io.EOF {
+			return devices, importErrors
+		} else if importErr, ok := err.(*ImportError); ok {
+			importErrors = append(importErrors, importErr)
+		} else if assert.NoError(t, err) {
+			devices = append(devices, device)
+		} else {
+			return devices, importErrors
+		}
+	}
+}
+
+func TestNDJSONReader(t *testing.T) {
+	input := `{"id": "1", "tenantID": "tenant", "status": "accepted"}
+
+{"id": "2", "inventoryAttributes": [{"name": "cpu", "numeric": 4}]}
+{"id": "3", "unknown": true}
+{"id": "4",
+`
+	reader := NewNDJSONReader(strings.NewReader(input))
+	devices, importErrors := readAll(t, reader)
+	if assert.Len(t, devices, 2) {
+		assert.Equal(t, NewDevice("1").SetTenantID("tenant").SetStatus(StatusAccepted),
+			devices[0])
+		assert.Equal(t, float64(4), devices[1].InventoryAttributes[0].GetNumeric())
+	}
+	if assert.Len(t, importErrors, 2) {
+		assert.Equal(t, 4, importErrors[0].Line)
+		assert.Contains(t, importErrors[0].Reason, `unknown field "unknown"`)
+		assert.Equal(t, 5, importErrors[1].Line)
+	}
+	assert.Equal(t, 5, reader.Line())
+}
+
+func TestNDJSONReaderLongLine(t *testing.T) {
+	input := `{"id": "1"}` + "\n" +
+		`{"id": "` + strings.Repeat("a", maxImportLineSize) + `"}` + "\n" +
+		`{"id": "3"}`
+	reader := NewNDJSONReader(strings.NewReader(input))
+	devices, importErrors := readAll(t, reader)
+	if assert.Len(t, devices, 2) {
+		assert.Equal(t, "1", devices[0].GetID())
+		assert.Equal(t, "3", devices[1].GetID())
+	}
+	if assert.Len(t, importErrors, 1) {
+		assert.Equal(t, 2, importErrors[0].Line)
+		assert.Equal(t, "line longer than 1048576 bytes", importErrors[0].Reason)
+	}
+	assert.Equal(t, 3, reader.Line())
+}
+
+func TestParseCSVMapping(t *testing.T) {
+	testCases := map[string]struct {
+		mapping string
+		err     string
+	}{
+		"ok": {
+			mapping: `{
+				"device": "id",
+				"customer": "tenantID",
+				"mac": "identity:mac",
+				"cpus": "inventory:cpu_count:numeric",
+				"site": "custom:site"
+			}`,
+		},
+		"ko, no id": {
+			mapping: `{"mac": "identity:mac"}`,
+			err:     "no column mapped to the id",
+		},
+		"ko, unknown scope": {
+			mapping: `{"device": "id", "mac": "system:mac"}`,
+			err:     `column "mac": unknown scope "system"`,
+		},
+		"ko, unknown type": {
+			mapping: `{"device": "id", "cpus": "inventory:cpus:integer"}`,
+			err:     `column "cpus": unknown type "integer"`,
+		},
+		"ko, unknown target": {
+			mapping: `{"device": "id", "owner": "owner"}`,
+			err:     `column "owner": invalid target "owner"`,
+		},
+		"ko, malformed": {
+			mapping: `["id"]`,
+			err: "failed to parse the mapping: json: cannot unmarshal array " +
+				"into Go value of type model.CSVMapping",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCSVMapping([]byte(tc.mapping))
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	mapping := CSVMapping{
+		"device":  "id",
+		"status":  "status",
+		"updated": "updatedAt",
+		"mac":     "identity:mac",
+		"cpus":    "inventory:cpu_count:numeric",
+		"site":    "custom:site",
+	}
+	input := "device,status,updated,mac,cpus,site,notes\n" +
+		"1,accepted,2021-06-01T12:00:00Z,00:11:22:33:44:55,4,oslo,first\n" +
+		"2,pending,,,,,\n" +
+		"3,accepted,,,four,,\n" +
+		"4,accepted,yesterday,,,,\n" +
+		"5,\"accepted,\n"
+	reader, err := NewCSVReader(strings.NewReader(input), mapping)
+	if !assert.NoError(t, err) {
+		return
+	}
+	devices, importErrors := readAll(t, reader)
+	if assert.Len(t, devices, 2) {
+		expected := NewDevice("1").SetStatus(StatusAccepted).
+			SetUpdatedAt(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+		expected.IdentityAttributes = DeviceInventory{
+			NewInventoryAttribute().SetName("mac").SetString("00:11:22:33:44:55"),
+		}
+		expected.InventoryAttributes = DeviceInventory{
+			NewInventoryAttribute().SetName("cpu_count").SetNumeric(4),
+		}
+		expected.CustomAttributes = DeviceInventory{
+			NewInventoryAttribute().SetName("site").SetString("oslo"),
+		}
+		assert.Equal(t, expected, devices[0])
+		assert.Equal(t, NewDevice("2").SetStatus(StatusPending), devices[1])
+	}
+	assert.Equal(t, []*ImportError{
+		{Line: 4, DeviceID: "3", Reason: `inventory:cpu_count: not a number: "four"`},
+		{Line: 5, DeviceID: "4", Reason: `updatedAt: not a RFC 3339 time: "yesterday"`},
+		{Line: 6, Reason: `extraneous or missing " in quoted-field`},
+	}, importErrors)
+
+	_, err = NewCSVReader(strings.NewReader("id,mac\n"), mapping)
+	assert.EqualError(t, err, `column "cpus" not found in the header`)
+}
+
+func TestValidateImportedDevice(t *testing.T) {
+	status := "lost"
+	testCases := map[string]struct {
+		device *Device
+		err    string
+	}{
+		"ok": {
+			device: NewDevice("1").SetTenantID("tenant"),
+		},
+		"ko, no id": {
+			device: NewDevice(" ").SetTenantID("tenant"),
+			err:    "id: cannot be blank",
+		},
+		"ko, no tenant": {
+			device: NewDevice("1"),
+			err:    "invalid tenant: tenant_id: cannot be blank",
+		},
+		"ko, unknown status": {
+			device: &Device{
+				ID:       NewDevice("1").ID,
+				TenantID: NewDevice("tenant").ID,
+				Status:   &status,
+			},
+			err: `status: unknown status "lost"`,
+		},
+		"ko, attribute without name": {
+			device: &Device{
+				ID:                  NewDevice("1").ID,
+				TenantID:            NewDevice("tenant").ID,
+				InventoryAttributes: DeviceInventory{NewInventoryAttribute().SetString("x")},
+			},
+			err: "inventory attributes: name cannot be blank",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateImportedDevice(tc.device)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MaxShards is the maximum number of primary shards an index can be split
+// into
+const MaxShards = 1024
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{suffix: "tb", size: 1 << 40},
+	{suffix: "gb", size: 1 << 30},
+	{suffix: "mb", size: 1 << 20},
+	{suffix: "kb", size: 1 << 10},
+	{suffix: "b", size: 1},
+}
+
+// ParseByteSize parses a size in bytes with an optional unit among b, kb,
+// mb, gb and tb, like "50gb"
+func ParseByteSize(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	unit := int64(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			unit = u.size
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size <= 0 {
+		return 0, errors.Errorf("invalid size: %q", value)
+	}
+	return int64(size * float64(unit)), nil
+}
+
+// FormatByteSize formats the size in bytes with the largest unit among b,
+// kb, mb, gb and tb the size is at least one of, rounded to one decimal,
+// like "1.5gb"
+func FormatByteSize(size int64) string {
+	for _, u := range byteSizeUnits {
+		if size >= u.size {
+			value := math.Round(float64(size)/float64(u.size)*10) / 10
+			return strconv.FormatFloat(value, 'f', -1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatInt(size, 10) + "b"
+}
+
+// IndexSize is the size of the primary shards of an index
+type IndexSize struct {
+	Index  string `json:"index"`
+	Shards int    `json:"shards"`
+	Size   int64  `json:"size"`
+}
+
+// ShardSize returns the average size of the primary shards of the index
+func (s IndexSize) ShardSize() int64 {
+	if s.Shards < 1 {
+		return s.Size
+	}
+	return s.Size / int64(s.Shards)
+}
+
+// ProposeShards returns the number of primary shards to split the index
+// into for its shards not to exceed the target size, the current number
+// of shards if they do not. As the split of an index multiplies its shards
+// by a power of two, the proposal is the smallest such multiple, up to
+// MaxShards.
+func (s IndexSize) ProposeShards(target int64) int {
+	shards := s.Shards
+	if shards < 1 {
+		shards = 1
+	}
+	for shards*2 <= MaxShards && s.Size > target*int64(shards) {
+		shards *= 2
+	}
+	return shards
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	testCases := map[string]struct {
+		value string
+		size  int64
+		err   string
+	}{
+		"bytes": {
+			value: "512",
+			size:  512,
+		},
+		"gigabytes": {
+			value: "30gb",
+			size:  30 << 30,
+		},
+		"fractional, upper case": {
+			value: "1.5 MB",
+			size:  3 << 19,
+		},
+		"ko, invalid": {
+			value: "large",
+			err:   `invalid size: "large"`,
+		},
+		"ko, zero": {
+			value: "0kb",
+			err:   `invalid size: "0"`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			size, err := ParseByteSize(tc.value)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.size, size)
+			}
+		})
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	assert.Equal(t, "0b", FormatByteSize(0))
+	assert.Equal(t, "512b", FormatByteSize(512))
+	assert.Equal(t, "1.5mb", FormatByteSize(3<<19))
+	assert.Equal(t, "1.3gb", FormatByteSize(4<<30/3))
+	assert.Equal(t, "2tb", FormatByteSize(2<<40))
+}
+
+func TestIndexSizeProposeShards(t *testing.T) {
+	const gb = 1 << 30
+	testCases := map[string]struct {
+		size   IndexSize
+		shards int
+	}{
+		"within the target": {
+			size:   IndexSize{Shards: 2, Size: 50 * gb},
+			shards: 2,
+		},
+		"split in two": {
+			size:   IndexSize{Shards: 1, Size: 40 * gb},
+			shards: 2,
+		},
+		"split in eight": {
+			size:   IndexSize{Shards: 2, Size: 200 * gb},
+			shards: 8,
+		},
+		"up to the maximum": {
+			size:   IndexSize{Shards: 512, Size: 1 << 50},
+			shards: MaxShards,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.shards, tc.size.ProposeShards(30*gb))
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import "time"
+
+// LeaseIndexer is the ID of the lease held by the running indexer
+const LeaseIndexer = "indexer-lease"
+
+// Lease grants its holder the exclusive right to run a process until it
+// expires, unless renewed
+type Lease struct {
+	ID         string    `json:"id"`
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	RenewedAt  time.Time `json:"renewedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Expired tells if the lease expired
+func (l *Lease) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
@@ -0,0 +1,260 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"context"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Default query cost limits
+const (
+	MaxBucketsDefault       = 10000
+	MaxFilterClausesDefault = 100
+)
+
+// QueryLimits are the limits on the cost of the queries
+type QueryLimits struct {
+	// MaxBuckets is the maximum number of buckets of an aggregation
+	MaxBuckets int
+	// MaxFilterClauses is the maximum number of filter predicates of a
+	// search, including the ones of the filter expressions
+	MaxFilterClauses int
+	// MaxDepth is the maximum nesting depth of the filter expressions
+	MaxDepth int
+}
+
+var (
+	queryLimitsMu sync.RWMutex
+	queryLimits   = QueryLimits{
+		MaxBuckets:       MaxBucketsDefault,
+		MaxFilterClauses: MaxFilterClausesDefault,
+		MaxDepth:         FilterExpressionMaxDepth,
+	}
+)
+
+// SetQueryLimits sets the limits on the cost of the queries enforced when
+// validating the parameters; zero values select the defaults
+func SetQueryLimits(limits QueryLimits) {
+	if limits.MaxBuckets <= 0 {
+		limits.MaxBuckets = MaxBucketsDefault
+	}
+	if limits.MaxFilterClauses <= 0 {
+		limits.MaxFilterClauses = MaxFilterClausesDefault
+	}
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = FilterExpressionMaxDepth
+	}
+	queryLimitsMu.Lock()
+	defer queryLimitsMu.Unlock()
+	queryLimits = limits
+}
+
+// GetQueryLimits returns the limits on the cost of the queries; the limits
+// are set again when the configuration is reloaded, concurrently with the
+// validation of the queries
+func GetQueryLimits() QueryLimits {
+	queryLimitsMu.RLock()
+	defer queryLimitsMu.RUnlock()
+	return queryLimits
+}
+
+func validateBuckets(name string, size int) error {
+	if maxBuckets := GetQueryLimits().MaxBuckets; size < 1 || size > maxBuckets {
+		return errors.Errorf("%s: must be between 1 and %d", name, maxBuckets)
+	}
+	return nil
+}
+
+// countPredicates returns the number of filter predicates of the expression
+func (e *FilterExpression) countPredicates() int {
+	switch {
+	case e == nil:
+		return 0
+	case e.Predicate != nil:
+		return 1
+	case e.Not != nil:
+		return e.Not.countPredicates()
+	}
+	count := 0
+	for _, operand := range append(e.And, e.Or...) {
+		count += operand.countPredicates()
+	}
+	return count
+}
+
+// leadingWildcardRegexp matches the regular expressions starting with a
+// wildcard, like ".*foo", which must scan all the terms of the index; it
+// is the fallback of the regular expressions Go cannot parse
+var leadingWildcardRegexp = regexp.MustCompile(`^\(*\.([*+?]|\{)`)
+
+// startsWithWildcard returns true if the regular expression can match at
+// its start a repetition of any character or of a character class, like
+// ".*foo", "(a|.*)foo", "[a-z]*foo" or "\w+foo"
+func startsWithWildcard(pattern string) bool {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return leadingWildcardRegexp.MatchString(pattern)
+	}
+	return leadingWildcard(re)
+}
+
+func leadingWildcard(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		switch re.Sub[0].Op {
+		case syntax.OpAnyChar, syntax.OpAnyCharNotNL, syntax.OpCharClass:
+			return true
+		}
+		return leadingWildcard(re.Sub[0])
+	case syntax.OpCapture:
+		return leadingWildcard(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if leadingWildcard(sub) {
+				return true
+			}
+		}
+	case syntax.OpConcat:
+		// the operands matching the empty string are followed by the
+		// next ones at the start
+		for _, sub := range re.Sub {
+			if leadingWildcard(sub) {
+				return true
+			} else if !matchesEmpty(sub) {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// matchesEmpty returns true if the regular expression matches the empty
+// string
+func matchesEmpty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpStar, syntax.OpQuest,
+		syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return true
+	case syntax.OpRepeat:
+		return re.Min == 0 || matchesEmpty(re.Sub[0])
+	case syntax.OpPlus, syntax.OpCapture:
+		return matchesEmpty(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if matchesEmpty(sub) {
+				return true
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !matchesEmpty(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func validateRegexp(pattern string) error {
+	if startsWithWildcard(pattern) {
+		return errors.Errorf("value: regular expressions cannot start with a wildcard")
+	}
+	if strings.TrimSpace(pattern) == "" {
+		return errors.New("value: regular expression cannot be empty")
+	}
+	return nil
+}
+
+// Partial result reasons
+const (
+	PartialTimedOut      = "timed_out"
+	PartialShardFailures = "shard_failures"
+)
+
+// QueryStatus collects whether the results of the queries run on behalf of
+// a request are incomplete, because a query timed out or failed on some of
+// the shards
+type QueryStatus struct {
+	mu            sync.Mutex
+	timedOut      bool
+	shardFailures bool
+}
+
+type queryStatusKey struct{}
+
+// WithQueryStatus returns a context collecting the status of the queries
+// run with it
+func WithQueryStatus(ctx context.Context) (context.Context, *QueryStatus) {
+	status := &QueryStatus{}
+	return context.WithValue(ctx, queryStatusKey{}, status), status
+}
+
+// QueryStatusFromContext returns the query status collected by the
+// context, or nil
+func QueryStatusFromContext(ctx context.Context) *QueryStatus {
+	status, _ := ctx.Value(queryStatusKey{}).(*QueryStatus)
+	return status
+}
+
+// Record records the outcome of a query; it is a no-op on a nil status
+func (s *QueryStatus) Record(timedOut bool, failedShards int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timedOut = s.timedOut || timedOut
+	s.shardFailures = s.shardFailures || failedShards > 0
+}
+
+// Merge records the outcome of the queries recorded by another status; it
+// is a no-op on a nil status
+func (s *QueryStatus) Merge(other *QueryStatus) {
+	if s == nil || other == nil {
+		return
+	}
+	other.mu.Lock()
+	timedOut, shardFailures := other.timedOut, other.shardFailures
+	other.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timedOut = s.timedOut || timedOut
+	s.shardFailures = s.shardFailures || shardFailures
+}
+
+// Partial returns the reasons why the results are incomplete, if any
+func (s *QueryStatus) Partial() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reasons []string
+	if s.timedOut {
+		reasons = append(reasons, PartialTimedOut)
+	}
+	if s.shardFailures {
+		reasons = append(reasons, PartialShardFailures)
+	}
+	return reasons
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRegexp(t *testing.T) {
+	testCases := map[string]struct {
+		params *SearchParams
+		err    string
+	}{
+		"ok": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: "raspberry.*",
+			}}},
+		},
+		"ok, escaped dot": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: `\.*foo`,
+			}}},
+		},
+		"ko, leading wildcard": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: ".*foo",
+			}}},
+			err: "filters: value: regular expressions cannot start with a wildcard",
+		},
+		"ko, leading wildcard in group": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: "(.+)foo",
+			}}},
+			err: "filters: value: regular expressions cannot start with a wildcard",
+		},
+		"ok, character class": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: "[a-z]foo.*",
+			}}},
+		},
+		"ok, repeated literal": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: "(ab)+.*",
+			}}},
+		},
+		"ko, leading wildcard in alternation": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: "(a|.*)foo",
+			}}},
+			err: "filters: value: regular expressions cannot start with a wildcard",
+		},
+		"ko, leading repeated character class": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: "[a-z]*foo",
+			}}},
+			err: "filters: value: regular expressions cannot start with a wildcard",
+		},
+		"ko, leading repeated word character": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: `\w+foo`,
+			}}},
+			err: "filters: value: regular expressions cannot start with a wildcard",
+		},
+		"ko, wildcard after an optional prefix": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: "a*.{2,}foo",
+			}}},
+			err: "filters: value: regular expressions cannot start with a wildcard",
+		},
+		"ko, leading glob wildcard": {
+			params: &SearchParams{FilterQuery: `hostname ~ "*foo"`},
+			err: "query: position 1: hostname: " +
+				"value: regular expressions cannot start with a wildcard",
+		},
+		"ko, empty": {
+			params: &SearchParams{Filters: []FilterPredicate{{
+				Scope: ScopeInventory, Attribute: "hostname",
+				Type: FilterTypeRegex, Value: "",
+			}}},
+			err: "filters: value: regular expression cannot be empty",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.params.Validate()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	defer SetQueryLimits(QueryLimits{})
+	SetQueryLimits(QueryLimits{MaxBuckets: 50, MaxFilterClauses: 3})
+	assert.Equal(t, QueryLimits{
+		MaxBuckets:       50,
+		MaxFilterClauses: 3,
+		MaxDepth:         FilterExpressionMaxDepth,
+	}, GetQueryLimits())
+
+	filter := FilterPredicate{
+		Scope: ScopeInventory, Attribute: "device_type",
+		Type: FilterTypeEq, Value: "dm1",
+	}
+	params := &SearchParams{
+		Filters:     []FilterPredicate{filter, filter},
+		FilterQuery: `hostname == "a" OR hostname == "b"`,
+	}
+	assert.EqualError(t, params.Validate(),
+		"filters: must have at most 3 filter predicates, found 4")
+	params.Filters = params.Filters[:1]
+	assert.NoError(t, params.Validate())
+
+	aggregate := &AggregateParams{
+		Scope: ScopeInventory, Attribute: "device_type", Size: 51,
+	}
+	assert.EqualError(t, aggregate.Validate(), "size: must be between 1 and 50")
+	aggregate.Size = 50
+	assert.NoError(t, aggregate.Validate())
+
+	SetQueryLimits(QueryLimits{})
+	assert.Equal(t, QueryLimits{
+		MaxBuckets:       MaxBucketsDefault,
+		MaxFilterClauses: MaxFilterClausesDefault,
+		MaxDepth:         FilterExpressionMaxDepth,
+	}, GetQueryLimits())
+}
+
+func TestQueryLimitsDepth(t *testing.T) {
+	defer SetQueryLimits(QueryLimits{})
+	SetQueryLimits(QueryLimits{MaxDepth: 2})
+
+	query := strings.Repeat("(", 3) + `hostname == "a"` + strings.Repeat(")", 3)
+	params := &SearchParams{FilterQuery: query}
+	assert.EqualError(t, params.Validate(),
+		"query: position 3: expression nested more than 2 levels deep")
+	params.FilterQuery = `(hostname == "a")`
+	assert.NoError(t, params.Validate())
+}
+
+func TestQueryLimitsConcurrent(t *testing.T) {
+	defer SetQueryLimits(QueryLimits{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			SetQueryLimits(QueryLimits{MaxBuckets: i})
+		}
+	}()
+	aggregate := &AggregateParams{
+		Scope: ScopeInventory, Attribute: "device_type", Size: 1,
+	}
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, aggregate.Validate())
+	}
+	<-done
+}
+
+func TestQueryStatus(t *testing.T) {
+	var status *QueryStatus
+	status.Record(true, 1)
+	assert.Nil(t, status.Partial())
+	assert.Nil(t, QueryStatusFromContext(context.Background()))
+
+	ctx, status := WithQueryStatus(context.Background())
+	assert.Equal(t, status, QueryStatusFromContext(ctx))
+	assert.Nil(t, status.Partial())
+
+	status.Record(false, 0)
+	assert.Nil(t, status.Partial())
+	status.Record(false, 2)
+	assert.Equal(t, []string{PartialShardFailures}, status.Partial())
+	status.Record(true, 0)
+	assert.Equal(t, []string{PartialTimedOut, PartialShardFailures},
+		status.Partial())
+}
+
+func TestQueryStatusMerge(t *testing.T) {
+	_, status := WithQueryStatus(context.Background())
+	_, other := WithQueryStatus(context.Background())
+	status.Merge(nil)
+	status.Merge(other)
+	assert.Nil(t, status.Partial())
+
+	other.Record(true, 0)
+	status.Record(false, 1)
+	status.Merge(other)
+	assert.Equal(t, []string{PartialTimedOut, PartialShardFailures},
+		status.Partial())
+
+	var nilStatus *QueryStatus
+	nilStatus.Merge(other)
+	assert.Nil(t, nilStatus.Partial())
+}
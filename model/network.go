@@ -0,0 +1,161 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// parseAddress parses an IP address, optionally in CIDR notation, and
+// returns the address and, for CIDR values, the network
+func parseAddress(value string) (address string, network string, ok bool) {
+	if ip, ipNet, err := net.ParseCIDR(value); err == nil {
+		return ip.String(), ipNet.String(), true
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.String(), "", true
+	}
+	return "", "", false
+}
+
+// ParseAddresses sets the IP addresses and the networks of the attributes
+// with IP or CIDR formatted string values, like "192.168.42.1/24", so that
+// they can be matched by subnet and aggregated by network
+func (inv DeviceInventory) ParseAddresses() {
+	for _, attr := range inv {
+		if attr == nil {
+			continue
+		}
+		attr.IP = nil
+		attr.Network = nil
+		for _, value := range attr.String {
+			address, network, ok := parseAddress(value)
+			if !ok {
+				continue
+			}
+			attr.IP = append(attr.IP, address)
+			if network != "" {
+				attr.Network = append(attr.Network, network)
+			}
+		}
+	}
+}
+
+func validateSubnet(value interface{}) error {
+	subnet, ok := value.(string)
+	if !ok {
+		return errors.Errorf("value: %s requires a string", FilterTypeSubnet)
+	}
+	if _, _, err := net.ParseCIDR(subnet); err != nil {
+		return errors.Errorf("value: invalid subnet %q", subnet)
+	}
+	return nil
+}
+
+// SubnetsParams are the parameters of the aggregation of the devices by
+// network
+type SubnetsParams struct {
+	Filters     []FilterPredicate `json:"filters"`
+	FilterQuery string            `json:"query"`
+	Expression  *FilterExpression `json:"expression"`
+	Scope       string            `json:"scope"`
+	Attribute   string            `json:"attribute"`
+	Size        int               `json:"size"`
+	TenantID    string            `json:"-"`
+}
+
+// Validate validates the subnets parameters and sets the defaults
+func (p *SubnetsParams) Validate() error {
+	if p.Scope == "" {
+		p.Scope = ScopeInventory
+	}
+	if p.Scope != ScopeInventory && p.Scope != ScopeIdentity {
+		return errors.Errorf("scope: must be either %q or %q",
+			ScopeInventory, ScopeIdentity)
+	}
+	if p.Size == 0 {
+		p.Size = PerPageDefault
+	}
+	if err := validateBuckets("size", p.Size); err != nil {
+		return err
+	}
+	search := SearchParams{
+		Filters:     p.Filters,
+		FilterQuery: p.FilterQuery,
+		Expression:  p.Expression,
+	}
+	return search.Validate()
+}
+
+// SubnetBucket is the number of devices with addresses in a network
+type SubnetBucket struct {
+	Network string `json:"network"`
+	Count   int    `json:"count"`
+}
+
+// BuildSubnetsQuery builds the Elasticsearch query aggregating the
+// matching devices by the networks of their addresses, optionally
+// restricted to the addresses of a single attribute
+func BuildSubnetsQuery(params *SubnetsParams) (Query, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	path := inventoryScopes[params.Scope]
+
+	var attributes interface{} = map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
+	if params.Attribute != "" {
+		attributes = map[string]interface{}{
+			"term": map[string]interface{}{path + ".name": params.Attribute},
+		}
+	}
+
+	search := &SearchParams{
+		Filters:     params.Filters,
+		FilterQuery: params.FilterQuery,
+		Expression:  params.Expression,
+	}
+	return Query{
+		"query": search.boolQuery(),
+		"aggs": map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"nested": map[string]interface{}{"path": path},
+				"aggs": map[string]interface{}{
+					"filtered": map[string]interface{}{
+						"filter": attributes,
+						"aggs": map[string]interface{}{
+							"networks": map[string]interface{}{
+								"terms": map[string]interface{}{
+									"field": path + ".network",
+									"size":  params.Size,
+								},
+								"aggs": map[string]interface{}{
+									"devices": map[string]interface{}{
+										"reverse_nested": map[string]interface{}{},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"size":             0,
+		"track_total_hits": true,
+	}, nil
+}
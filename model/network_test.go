@@ -0,0 +1,71 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddresses(t *testing.T) {
+	inventory := DeviceInventory{
+		NewInventoryAttribute().SetName("ipv4_bcm0").SetString("192.168.42.1/24"),
+		NewInventoryAttribute().SetName("ipv4_usb0").SetString("10.0.1.2/8"),
+		NewInventoryAttribute().SetName("ipv6_wlan0").SetStrings([]string{
+			"fe80::1/64", "2001:db8::1",
+		}),
+		NewInventoryAttribute().SetName("hostname").SetString("Ambarella"),
+		NewInventoryAttribute().SetName("mem_total_kB").SetNumeric(1020664),
+	}
+	inventory.ParseAddresses()
+
+	assert.Equal(t, []string{"192.168.42.1"}, inventory[0].IP)
+	assert.Equal(t, []string{"192.168.42.0/24"}, inventory[0].Network)
+	assert.Equal(t, []string{"10.0.1.2"}, inventory[1].IP)
+	assert.Equal(t, []string{"10.0.0.0/8"}, inventory[1].Network)
+	assert.Equal(t, []string{"fe80::1", "2001:db8::1"}, inventory[2].IP)
+	assert.Equal(t, []string{"fe80::/64"}, inventory[2].Network)
+	assert.Nil(t, inventory[3].IP)
+	assert.Nil(t, inventory[3].Network)
+	assert.Nil(t, inventory[4].IP)
+}
+
+func TestSubnetFilter(t *testing.T) {
+	filter := FilterPredicate{
+		Scope:     ScopeInventory,
+		Attribute: "ipv4_usb0",
+		Type:      FilterTypeSubnet,
+		Value:     "10.0.0.0/8",
+	}
+	assert.NoError(t, filter.Validate())
+
+	clause, negate := FilterClause(filter, nil)
+	assert.False(t, negate)
+	clauseJSON, _ := json.Marshal(clause)
+	assert.JSONEq(t, `{"nested": {"path": "inventoryAttributes", "query": {"bool": {"filter": [
+		{"term": {"inventoryAttributes.name": "ipv4_usb0"}},
+		{"term": {"inventoryAttributes.ip": "10.0.0.0/8"}}
+	]}}}}`, string(clauseJSON))
+
+	filter.Value = "10.0.0.0"
+	assert.EqualError(t, filter.Validate(), `value: invalid subnet "10.0.0.0"`)
+
+	filter.Scope = ScopeSystem
+	filter.Attribute = AttrName
+	assert.EqualError(t, filter.Validate(),
+		`scope: $subnet requires either the "identity" or the "inventory" scope`)
+}
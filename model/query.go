@@ -0,0 +1,336 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Query is an Elasticsearch query
+type Query map[string]interface{}
+
+var rangeOperators = map[string]string{
+	FilterTypeGt:  "gt",
+	FilterTypeGte: "gte",
+	FilterTypeLt:  "lt",
+	FilterTypeLte: "lte",
+}
+
+// valueField returns the sub-field of a nested attribute storing values of
+// the same type as the given value
+func valueField(path string, value interface{}) string {
+	if _, ok := value.(float64); ok {
+		return path + ".numeric"
+	}
+	return path + ".string"
+}
+
+// valuesField returns the sub-field of a nested attribute and the values
+// to match it against; lists of numbers match the numeric values, any
+// other list matches the string values
+func valuesField(path string, values []interface{}) (string, []interface{}) {
+	numeric := len(values) > 0
+	for _, value := range values {
+		if _, ok := value.(float64); !ok {
+			numeric = false
+			break
+		}
+	}
+	if numeric {
+		return path + ".numeric", values
+	}
+	strValues := make([]interface{}, len(values))
+	for i, value := range values {
+		strValues[i] = toString(value)
+	}
+	return path + ".string", strValues
+}
+
+func toString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// valueClause returns the positive clause matching the filter against the
+// given field; negated filter types return the clause to exclude
+func valueClause(field string, filter FilterPredicate) (clause interface{}, negate bool) {
+	switch filter.Type {
+	case FilterTypeEq, FilterTypeNe:
+		clause = map[string]interface{}{
+			"term": map[string]interface{}{field: filter.Value},
+		}
+	case FilterTypeIn, FilterTypeNin:
+		clause = map[string]interface{}{
+			"terms": map[string]interface{}{field: filter.Value},
+		}
+	case FilterTypeGt, FilterTypeGte, FilterTypeLt, FilterTypeLte:
+		clause = map[string]interface{}{
+			"range": map[string]interface{}{
+				field: map[string]interface{}{
+					rangeOperators[filter.Type]: filter.Value,
+				},
+			},
+		}
+	case FilterTypeExists:
+		clause = map[string]interface{}{
+			"exists": map[string]interface{}{"field": field},
+		}
+	case FilterTypeRegex:
+		clause = map[string]interface{}{
+			"regexp": map[string]interface{}{field: filter.Value},
+		}
+	}
+	negate = filter.Type == FilterTypeNe || filter.Type == FilterTypeNin ||
+		(filter.Type == FilterTypeExists && filter.Value == false)
+	return clause, negate
+}
+
+func nestedClause(path, attribute string, clauses ...interface{}) interface{} {
+	filters := append([]interface{}{
+		map[string]interface{}{
+			"term": map[string]interface{}{path + ".name": attribute},
+		},
+	}, clauses...)
+	return map[string]interface{}{
+		"nested": map[string]interface{}{
+			"path": path,
+			"query": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"filter": filters,
+				},
+			},
+		},
+	}
+}
+
+// FilterClause translates a filter predicate into an Elasticsearch clause
+// and reports whether the clause must be excluded rather than matched;
+// filters on version attributes compare the values by version order
+func FilterClause(filter FilterPredicate,
+	versionAttributes VersionAttributes) (interface{}, bool) {
+	if filter.Scope == ScopeSystem {
+		return valueClause(systemAttributes[filter.Attribute], filter)
+	}
+
+	path := inventoryScopes[filter.Scope]
+	if filter.Scope == ScopeInventory && versionAttributes[filter.Attribute] {
+		if filter, ok := versionFilter(filter); ok {
+			clause, negate := valueClause(path+".version", filter)
+			return nestedClause(path, filter.Attribute, clause), negate
+		}
+	}
+	if filter.Type == FilterTypeExists {
+		return nestedClause(path, filter.Attribute), filter.Value == false
+	}
+	if filter.Type == FilterTypeSubnet {
+		return nestedClause(path, filter.Attribute, map[string]interface{}{
+			"term": map[string]interface{}{path + ".ip": filter.Value},
+		}), false
+	}
+	var field string
+	if values, ok := filter.Value.([]interface{}); ok {
+		field, filter.Value = valuesField(path, values)
+	} else if filter.Type == FilterTypeRegex {
+		field = path + ".string"
+	} else {
+		field = valueField(path, filter.Value)
+		if _, ok := filter.Value.(bool); ok {
+			filter.Value = toString(filter.Value)
+		}
+	}
+	clause, negate := valueClause(field, filter)
+	return nestedClause(path, filter.Attribute, clause), negate
+}
+
+// SortClauses translates a sorting criteria into Elasticsearch sort
+// clauses; version attributes are sorted by version order first
+func SortClauses(sort SortCriteria, versionAttributes VersionAttributes) []interface{} {
+	if sort.Scope == ScopeSystem {
+		return []interface{}{
+			map[string]interface{}{
+				systemAttributes[sort.Attribute]: map[string]interface{}{
+					"order": sort.Order,
+				},
+			},
+		}
+	}
+
+	path := inventoryScopes[sort.Scope]
+	nested := map[string]interface{}{
+		"path": path,
+		"filter": map[string]interface{}{
+			"term": map[string]interface{}{path + ".name": sort.Attribute},
+		},
+	}
+	fields := []string{path + ".numeric", path + ".string"}
+	if sort.Scope == ScopeInventory && versionAttributes[sort.Attribute] {
+		fields = append([]string{path + ".version"}, fields...)
+	}
+	clauses := []interface{}{}
+	for _, field := range fields {
+		clauses = append(clauses, map[string]interface{}{
+			field: map[string]interface{}{
+				"order":  sort.Order,
+				"nested": nested,
+			},
+		})
+	}
+	return clauses
+}
+
+// textClauses returns the clauses matching the free-text query against the
+// given string field: full-text on the analyzed sub-field and
+// case-insensitive prefix on the normalized one, for values like MAC
+// addresses and serial numbers which the analyzer splits or keeps whole
+func textClauses(field, query string) []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"match": map[string]interface{}{
+				field + ".text": map[string]interface{}{
+					"query":    query,
+					"operator": "and",
+				},
+			},
+		},
+		map[string]interface{}{
+			"prefix": map[string]interface{}{
+				field + ".lowercase": strings.ToLower(query),
+			},
+		},
+	}
+}
+
+// TextClause returns the clause matching the free-text query against the
+// device name and the identity and inventory string values
+func TextClause(query string) interface{} {
+	should := textClauses("name", query)
+	for _, path := range []string{
+		inventoryScopes[ScopeIdentity],
+		inventoryScopes[ScopeInventory],
+	} {
+		should = append(should, map[string]interface{}{
+			"nested": map[string]interface{}{
+				"path": path,
+				"query": map[string]interface{}{
+					"bool": map[string]interface{}{
+						"should":               textClauses(path+".string", query),
+						"minimum_should_match": 1,
+					},
+				},
+			},
+		})
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// boolQuery returns the Elasticsearch bool query matching the filters of
+// the search parameters
+func (sp *SearchParams) boolQuery() map[string]interface{} {
+	filters := []interface{}{}
+	mustNot := []interface{}{}
+	for _, filter := range sp.Filters {
+		clause, negate := FilterClause(filter, sp.VersionAttributes)
+		if negate {
+			mustNot = append(mustNot, clause)
+		} else {
+			filters = append(filters, clause)
+		}
+	}
+	// the filter query is parsed when validating the search parameters
+	expressions, _ := sp.filterExpressions()
+	for _, expression := range expressions {
+		filters = append(filters, expression.Clause(sp.VersionAttributes))
+	}
+	if query := strings.TrimSpace(sp.Query); query != "" {
+		filters = append(filters, TextClause(query))
+	}
+	filters = append(filters, geoClauses(sp.GeoDistance, sp.GeoBoundingBox)...)
+	if len(sp.DeviceIDs) > 0 {
+		filters = append(filters, map[string]interface{}{
+			"terms": map[string]interface{}{"id": sp.DeviceIDs},
+		})
+	}
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter":   filters,
+			"must_not": mustNot,
+		},
+	}
+}
+
+// BuildQuery builds the Elasticsearch query for the search parameters
+func BuildQuery(params *SearchParams) (Query, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	sort := []interface{}{}
+	for _, criteria := range params.Sort {
+		sort = append(sort, SortClauses(criteria, params.VersionAttributes)...)
+	}
+
+	return Query{
+		"query":            params.boolQuery(),
+		"sort":             sort,
+		"from":             (params.Page - 1) * params.PerPage,
+		"size":             params.PerPage,
+		"track_total_hits": true,
+	}, nil
+}
+
+// BuildCountQuery builds the Elasticsearch query counting the devices
+// matching the search parameters
+func BuildCountQuery(params *SearchParams) (Query, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return Query{
+		"query":            params.boolQuery(),
+		"size":             0,
+		"track_total_hits": true,
+	}, nil
+}
+
+// BuildDeviceIDsQuery builds the Elasticsearch query returning the IDs of
+// the devices matching the search parameters, sorted by ID, in batches of
+// the given size starting after the given ID; paging and sorting of the
+// search parameters are ignored
+func BuildDeviceIDsQuery(params *SearchParams, after string, size int) (Query, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	query := Query{
+		"query": params.boolQuery(),
+		"sort": []interface{}{
+			map[string]interface{}{"id": map[string]interface{}{"order": SortOrderAsc}},
+		},
+		"size":             size,
+		"_source":          []string{"id"},
+		"track_total_hits": false,
+	}
+	if after != "" {
+		query["search_after"] = []interface{}{after}
+	}
+	return query, nil
+}
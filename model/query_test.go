@@ -0,0 +1,134 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildQuery(t *testing.T) {
+	testCases := map[string]struct {
+		params *SearchParams
+		query  string
+		err    string
+	}{
+		"ok, defaults": {
+			params: &SearchParams{},
+			query: `{
+				"query": {"bool": {"filter": [], "must_not": []}},
+				"sort": [], "from": 0, "size": 20, "track_total_hits": true
+			}`,
+		},
+		"ok, filters and sort": {
+			params: &SearchParams{
+				Page:    2,
+				PerPage: 10,
+				Filters: []FilterPredicate{
+					{Scope: ScopeSystem, Attribute: "lastDeploymentStatus",
+						Type: FilterTypeEq, Value: DeploymentStatusFailure},
+					{Scope: ScopeInventory, Attribute: "artifact_name",
+						Type: FilterTypeNe, Value: "release-2"},
+					{Scope: ScopeInventory, Attribute: "mem_total_kB",
+						Type: FilterTypeGte, Value: float64(1024)},
+				},
+				Sort: []SortCriteria{
+					{Scope: ScopeSystem, Attribute: AttrName, Order: SortOrderAsc},
+				},
+			},
+			query: `{
+				"query": {"bool": {
+					"filter": [
+						{"term": {"lastDeploymentStatus": "failure"}},
+						{"nested": {"path": "inventoryAttributes", "query": {"bool": {"filter": [
+							{"term": {"inventoryAttributes.name": "mem_total_kB"}},
+							{"range": {"inventoryAttributes.numeric": {"gte": 1024}}}
+						]}}}}
+					],
+					"must_not": [
+						{"nested": {"path": "inventoryAttributes", "query": {"bool": {"filter": [
+							{"term": {"inventoryAttributes.name": "artifact_name"}},
+							{"term": {"inventoryAttributes.string": "release-2"}}
+						]}}}}
+					]
+				}},
+				"sort": [{"name": {"order": "asc"}}],
+				"from": 10, "size": 10, "track_total_hits": true
+			}`,
+		},
+		"ok, free-text query": {
+			params: &SearchParams{Query: " 02:AB "},
+			query: `{
+				"query": {"bool": {
+					"filter": [{"bool": {"minimum_should_match": 1, "should": [
+						{"match": {"name.text": {"query": "02:AB", "operator": "and"}}},
+						{"prefix": {"name.lowercase": "02:ab"}},
+						{"nested": {"path": "identityAttributes", "query": {"bool": {
+							"minimum_should_match": 1,
+							"should": [
+								{"match": {"identityAttributes.string.text": {"query": "02:AB", "operator": "and"}}},
+								{"prefix": {"identityAttributes.string.lowercase": "02:ab"}}
+							]
+						}}}},
+						{"nested": {"path": "inventoryAttributes", "query": {"bool": {
+							"minimum_should_match": 1,
+							"should": [
+								{"match": {"inventoryAttributes.string.text": {"query": "02:AB", "operator": "and"}}},
+								{"prefix": {"inventoryAttributes.string.lowercase": "02:ab"}}
+							]
+						}}}}
+					]}}],
+					"must_not": []
+				}},
+				"sort": [], "from": 0, "size": 20, "track_total_hits": true
+			}`,
+		},
+		"ko, unknown system attribute": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{Scope: ScopeSystem, Attribute: "foo", Type: FilterTypeEq, Value: "bar"},
+				},
+			},
+			err: `filters: attribute: unknown system attribute "foo"`,
+		},
+		"ko, bad filter type": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{Scope: ScopeInventory, Attribute: "foo", Type: "$foo", Value: "bar"},
+				},
+			},
+			err: `filters: type: unknown filter type "$foo"`,
+		},
+		"ko, bad per page": {
+			params: &SearchParams{PerPage: PerPageMax + 1},
+			err:    "per_page: must be between 1 and 500",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			query, err := BuildQuery(tc.params)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			queryJSON, _ := json.Marshal(query)
+			assert.JSONEq(t, tc.query, string(queryJSON))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"github.com/pkg/errors"
+)
+
+// RateLimits are the request limits of a tenant; zero values disable the
+// corresponding limit
+type RateLimits struct {
+	// Rate is the number of requests per second
+	Rate float64
+	// Burst is the number of requests allowed at once, above the rate
+	Burst int
+	// Concurrency is the number of requests in flight
+	Concurrency int
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// ParseRateLimitOverrides parses the per-tenant overrides of the rate
+// limits from the configuration, a map of tenant IDs to maps with any of
+// the "rate", "burst" and "concurrency" keys; missing keys take the default
+// limits
+func ParseRateLimitOverrides(config map[string]interface{},
+	defaults RateLimits) (map[string]RateLimits, error) {
+	overrides := make(map[string]RateLimits, len(config))
+	for tenantID, value := range config {
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("tenant %s: invalid limits", tenantID)
+		}
+		limits := defaults
+		for key, value := range settings {
+			number, ok := toFloat64(value)
+			if !ok || number < 0 {
+				return nil, errors.Errorf("tenant %s: %s: must be a non-negative number",
+					tenantID, key)
+			}
+			switch key {
+			case "rate":
+				limits.Rate = number
+			case "burst":
+				limits.Burst = int(number)
+			case "concurrency":
+				limits.Concurrency = int(number)
+			default:
+				return nil, errors.Errorf("tenant %s: unknown limit %q", tenantID, key)
+			}
+		}
+		overrides[tenantID] = limits
+	}
+	return overrides, nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimitOverrides(t *testing.T) {
+	defaults := RateLimits{Rate: 10, Burst: 20, Concurrency: 4}
+	overrides, err := ParseRateLimitOverrides(map[string]interface{}{
+		"tenant": map[string]interface{}{"rate": 1.5, "concurrency": 1},
+	}, defaults)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]RateLimits{
+		"tenant": {Rate: 1.5, Burst: 20, Concurrency: 1},
+	}, overrides)
+
+	_, err = ParseRateLimitOverrides(map[string]interface{}{
+		"tenant": map[string]interface{}{"speed": 1},
+	}, defaults)
+	assert.EqualError(t, err, `tenant tenant: unknown limit "speed"`)
+
+	_, err = ParseRateLimitOverrides(map[string]interface{}{
+		"tenant": map[string]interface{}{"rate": -1},
+	}, defaults)
+	assert.EqualError(t, err, `tenant tenant: rate: must be a non-negative number`)
+}
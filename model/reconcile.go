@@ -0,0 +1,66 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import "time"
+
+// DriftReport is the drift of the devices of a tenant indexed by the
+// service from the devices in the inventory, the source of truth
+type DriftReport struct {
+	TenantID  string    `json:"tenant_id"`
+	StartedAt time.Time `json:"started_at"`
+	DryRun    bool      `json:"dry_run"`
+
+	// SourceDevices and IndexedDevices are the numbers of devices in the
+	// inventory and in the index
+	SourceDevices  int `json:"source_devices"`
+	IndexedDevices int `json:"indexed_devices"`
+
+	// Missing are the devices in the inventory only, Stale the devices
+	// indexed before their last update in the inventory, and Orphaned the
+	// devices in the index only
+	Missing  []string `json:"missing"`
+	Stale    []string `json:"stale"`
+	Orphaned []string `json:"orphaned"`
+
+	// Reindexed and Deleted are the numbers of devices reindexed and
+	// deleted to fix the drift, always zero with a dry run
+	Reindexed int `json:"reindexed"`
+	Deleted   int `json:"deleted"`
+}
+
+// Drift returns the number of devices drifting from the inventory
+func (r *DriftReport) Drift() int {
+	return len(r.Missing) + len(r.Stale) + len(r.Orphaned)
+}
+
+// BuildReconcileQuery builds the Elasticsearch query returning the IDs and
+// update times of all the devices, sorted by ID, in batches of the given
+// size starting after the given ID
+func BuildReconcileQuery(after string, size int) Query {
+	query := Query{
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+		"sort": []interface{}{
+			map[string]interface{}{"id": map[string]interface{}{"order": SortOrderAsc}},
+		},
+		"size":             size,
+		"_source":          []string{"id", "updatedAt"},
+		"track_total_hits": false,
+	}
+	if after != "" {
+		query["search_after"] = []interface{}{after}
+	}
+	return query
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildReconcileQuery(t *testing.T) {
+	query, _ := json.Marshal(BuildReconcileQuery("", 100))
+	assert.JSONEq(t, `{
+		"query": {"match_all": {}},
+		"sort": [{"id": {"order": "asc"}}],
+		"size": 100,
+		"_source": ["id", "updatedAt"],
+		"track_total_hits": false
+	}`, string(query))
+
+	query, _ = json.Marshal(BuildReconcileQuery("device-1", 10))
+	assert.JSONEq(t, `{
+		"query": {"match_all": {}},
+		"sort": [{"id": {"order": "asc"}}],
+		"size": 10,
+		"search_after": ["device-1"],
+		"_source": ["id", "updatedAt"],
+		"track_total_hits": false
+	}`, string(query))
+}
+
+func TestDriftReportDrift(t *testing.T) {
+	report := &DriftReport{
+		Missing:  []string{"1", "2"},
+		Stale:    []string{"3"},
+		Orphaned: []string{"4"},
+	}
+	assert.Equal(t, 4, report.Drift())
+	assert.Equal(t, 0, (&DriftReport{}).Drift())
+}
@@ -0,0 +1,255 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Filter predicate types
+const (
+	FilterTypeEq     = "$eq"
+	FilterTypeNe     = "$ne"
+	FilterTypeIn     = "$in"
+	FilterTypeNin    = "$nin"
+	FilterTypeGt     = "$gt"
+	FilterTypeGte    = "$gte"
+	FilterTypeLt     = "$lt"
+	FilterTypeLte    = "$lte"
+	FilterTypeExists = "$exists"
+	FilterTypeRegex  = "$regex"
+	FilterTypeSubnet = "$subnet"
+)
+
+// Sort orders
+const (
+	SortOrderAsc  = "asc"
+	SortOrderDesc = "desc"
+)
+
+// Search paging limits
+const (
+	PerPageDefault = 20
+	PerPageMax     = 500
+)
+
+// QueryMaxLength is the maximum length of the free-text query
+const QueryMaxLength = 256
+
+// systemAttributes maps the attributes of the system scope to the fields
+// of the device document
+var systemAttributes = map[string]string{
+	"id":                     "id",
+	AttrName:                 "name",
+	AttrGroupName:            "groupName",
+	AttrStatus:               "status",
+	"createdAt":              "createdAt",
+	"updatedAt":              "updatedAt",
+	"lastDeploymentID":       "lastDeploymentID",
+	"lastDeploymentName":     "lastDeploymentName",
+	"lastDeploymentArtifact": "lastDeploymentArtifact",
+	"lastDeploymentStatus":   "lastDeploymentStatus",
+	"lastDeploymentFinished": "lastDeploymentFinished",
+	"lastCheckIn":            "lastCheckIn",
+	"connectStatus":          "connectStatus",
+	"connectUpdatedAt":       "connectUpdatedAt",
+	"lastSeen":               "lastSeen",
+}
+
+// inventoryScopes maps the attribute scopes to the nested fields of the
+// device document
+var inventoryScopes = map[string]string{
+	ScopeIdentity:  "identityAttributes",
+	ScopeInventory: "inventoryAttributes",
+	ScopeCustom:    "customAttributes",
+}
+
+// SearchParams are the parameters of a device search
+type SearchParams struct {
+	Page           int                   `json:"page"`
+	PerPage        int                   `json:"per_page"`
+	Query          string                `json:"q"`
+	Filters        []FilterPredicate     `json:"filters"`
+	FilterQuery    string                `json:"query"`
+	Expression     *FilterExpression     `json:"expression"`
+	GeoDistance    *GeoDistanceFilter    `json:"geo_distance"`
+	GeoBoundingBox *GeoBoundingBoxFilter `json:"geo_bounding_box"`
+	Sort           []SortCriteria        `json:"sort"`
+	DeviceIDs      []string              `json:"device_ids"`
+	TenantID       string                `json:"-"`
+
+	// VersionAttributes are the inventory attributes compared and sorted
+	// by version order
+	VersionAttributes VersionAttributes `json:"-"`
+}
+
+// filterExpressions returns the filter expression of the search and the
+// one parsed from the filter query, if any
+func (sp *SearchParams) filterExpressions() ([]*FilterExpression, error) {
+	expressions := []*FilterExpression{}
+	if sp.Expression != nil {
+		expressions = append(expressions, sp.Expression)
+	}
+	if strings.TrimSpace(sp.FilterQuery) != "" {
+		expression, err := ParseFilterQuery(sp.FilterQuery)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expression)
+	}
+	return expressions, nil
+}
+
+// FilterPredicate is a single filter on a device attribute
+type FilterPredicate struct {
+	Scope     string      `json:"scope"`
+	Attribute string      `json:"attribute"`
+	Type      string      `json:"type"`
+	Value     interface{} `json:"value"`
+}
+
+// SortCriteria is a sorting criteria on a device attribute
+type SortCriteria struct {
+	Scope     string `json:"scope"`
+	Attribute string `json:"attribute"`
+	Order     string `json:"order"`
+}
+
+func validateAttribute(scope, attribute string) error {
+	if attribute == "" {
+		return errors.New("attribute: cannot be blank")
+	}
+	if scope == ScopeSystem {
+		if _, ok := systemAttributes[attribute]; !ok {
+			return errors.Errorf("attribute: unknown system attribute %q", attribute)
+		}
+	} else if _, ok := inventoryScopes[scope]; !ok {
+		return errors.Errorf("scope: unknown scope %q", scope)
+	}
+	return nil
+}
+
+// Validate validates the search parameters and sets the defaults
+func (sp *SearchParams) Validate() error {
+	if sp.PerPage == 0 {
+		sp.PerPage = PerPageDefault
+	}
+	if sp.Page == 0 {
+		sp.Page = 1
+	}
+	if sp.Page < 1 {
+		return errors.New("page: must be a positive integer")
+	}
+	if sp.PerPage < 1 || sp.PerPage > PerPageMax {
+		return errors.Errorf("per_page: must be between 1 and %d", PerPageMax)
+	}
+	if len(sp.Query) > QueryMaxLength {
+		return errors.Errorf("q: must be at most %d characters long", QueryMaxLength)
+	}
+	for _, filter := range sp.Filters {
+		if err := filter.Validate(); err != nil {
+			return errors.Wrap(err, "filters")
+		}
+	}
+	if sp.Expression != nil {
+		if err := sp.Expression.Validate(); err != nil {
+			return errors.Wrap(err, "expression")
+		}
+	}
+	if len(sp.FilterQuery) > FilterQueryMaxLength {
+		return errors.Errorf("query: must be at most %d characters long",
+			FilterQueryMaxLength)
+	}
+	expressions, err := sp.filterExpressions()
+	if err != nil {
+		return err
+	}
+	clauses := len(sp.Filters)
+	for _, expression := range expressions {
+		clauses += expression.countPredicates()
+	}
+	if maxClauses := GetQueryLimits().MaxFilterClauses; clauses > maxClauses {
+		return errors.Errorf("filters: must have at most %d filter predicates, found %d",
+			maxClauses, clauses)
+	}
+	if sp.GeoDistance != nil {
+		if err := sp.GeoDistance.Validate(); err != nil {
+			return errors.Wrap(err, "geo_distance")
+		}
+	}
+	if sp.GeoBoundingBox != nil {
+		if err := sp.GeoBoundingBox.Validate(); err != nil {
+			return errors.Wrap(err, "geo_bounding_box")
+		}
+	}
+	for _, sort := range sp.Sort {
+		if err := sort.Validate(); err != nil {
+			return errors.Wrap(err, "sort")
+		}
+	}
+	return nil
+}
+
+// Validate validates the filter predicate
+func (f FilterPredicate) Validate() error {
+	if err := validateAttribute(f.Scope, f.Attribute); err != nil {
+		return err
+	}
+	switch f.Type {
+	case FilterTypeEq, FilterTypeNe, FilterTypeGt, FilterTypeGte,
+		FilterTypeLt, FilterTypeLte:
+		switch f.Value.(type) {
+		case string, float64, bool:
+		default:
+			return errors.Errorf("value: %s requires a string, number or boolean", f.Type)
+		}
+	case FilterTypeIn, FilterTypeNin:
+		if _, ok := f.Value.([]interface{}); !ok {
+			return errors.Errorf("value: %s requires an array", f.Type)
+		}
+	case FilterTypeExists:
+		if _, ok := f.Value.(bool); !ok {
+			return errors.Errorf("value: %s requires a boolean", f.Type)
+		}
+	case FilterTypeRegex:
+		pattern, ok := f.Value.(string)
+		if !ok {
+			return errors.Errorf("value: %s requires a string", f.Type)
+		}
+		return validateRegexp(pattern)
+	case FilterTypeSubnet:
+		if f.Scope != ScopeIdentity && f.Scope != ScopeInventory {
+			return errors.Errorf("scope: %s requires either the %q or the %q scope",
+				f.Type, ScopeIdentity, ScopeInventory)
+		}
+		return validateSubnet(f.Value)
+	default:
+		return errors.Errorf("type: unknown filter type %q", f.Type)
+	}
+	return nil
+}
+
+// Validate validates the sorting criteria
+func (s SortCriteria) Validate() error {
+	if err := validateAttribute(s.Scope, s.Attribute); err != nil {
+		return err
+	}
+	if s.Order != SortOrderAsc && s.Order != SortOrderDesc {
+		return errors.Errorf("order: must be either %q or %q", SortOrderAsc, SortOrderDesc)
+	}
+	return nil
+}
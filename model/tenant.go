@@ -0,0 +1,209 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tenant tiers, selecting the settings of the tenant indices
+const (
+	TierOS           = "os"
+	TierProfessional = "professional"
+	TierEnterprise   = "enterprise"
+
+	TierDefault = TierOS
+)
+
+// Tenant statuses
+const (
+	TenantStatusActive    = "active"
+	TenantStatusSuspended = "suspended"
+	TenantStatusDeleting  = "deleting"
+	TenantStatusDeleted   = "deleted"
+)
+
+// Data of a tenant, deleted in order by the tenant deletion; saved
+// searches are not stored by the service, so there are none to delete
+const (
+	TenantDataDevices     = "devices"
+	TenantDataHistory     = "history"
+	TenantDataDeployments = "deployments"
+)
+
+// TenantData lists the data of a tenant, in deletion order
+var TenantData = []string{
+	TenantDataDevices,
+	TenantDataHistory,
+	TenantDataDeployments,
+}
+
+// IndexSettings are the settings of the indices of a tenant
+type IndexSettings struct {
+	Shards   int `json:"number_of_shards"`
+	Replicas int `json:"number_of_replicas"`
+}
+
+// DefaultIndexSettings are the default settings of the tenant indices
+var DefaultIndexSettings = IndexSettings{Shards: 1, Replicas: 1}
+
+// DefaultTierIndexSettings are the index settings of each tier
+var DefaultTierIndexSettings = map[string]IndexSettings{
+	TierOS:           DefaultIndexSettings,
+	TierProfessional: DefaultIndexSettings,
+	TierEnterprise:   {Shards: 2, Replicas: 1},
+}
+
+// Validate validates the index settings
+func (s IndexSettings) Validate() error {
+	if s.Shards < 1 {
+		return errors.New("shards: must be at least 1")
+	} else if s.Replicas < 0 {
+		return errors.New("replicas: must be a non-negative number")
+	}
+	return nil
+}
+
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), v == math.Trunc(v)
+	}
+	return 0, false
+}
+
+// ParseTierIndexSettings parses the index settings of the tiers from the
+// configuration, a map of tiers to maps with any of the "shards" and
+// "replicas" keys; missing tiers and keys take the default settings
+func ParseTierIndexSettings(config map[string]interface{},
+	defaults IndexSettings) (map[string]IndexSettings, error) {
+	if err := defaults.Validate(); err != nil {
+		return nil, err
+	}
+	tiers := map[string]IndexSettings{
+		TierOS:           defaults,
+		TierProfessional: defaults,
+		TierEnterprise:   defaults,
+	}
+	for tier, value := range config {
+		settings, ok := tiers[tier]
+		if !ok {
+			return nil, errors.Errorf("unknown tier %q", tier)
+		}
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("tier %s: invalid index settings", tier)
+		}
+		for key, value := range values {
+			number, ok := toInt(value)
+			if !ok {
+				return nil, errors.Errorf("tier %s: %s: must be an integer", tier, key)
+			}
+			switch key {
+			case "shards":
+				settings.Shards = number
+			case "replicas":
+				settings.Replicas = number
+			default:
+				return nil, errors.Errorf("tier %s: unknown index setting %q", tier, key)
+			}
+		}
+		if err := settings.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "tier %s", tier)
+		}
+		tiers[tier] = settings
+	}
+	return tiers, nil
+}
+
+// Tenant is a tenant of the service and the status of its data
+type Tenant struct {
+	ID        string          `json:"id"`
+	Tier      string          `json:"tier,omitempty"`
+	Status    string          `json:"status"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	Deletion  *TenantDeletion `json:"deletion,omitempty"`
+}
+
+// TenantDeletion is the progress of the deletion of the data of a tenant
+type TenantDeletion struct {
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Deleted lists the data deleted so far
+	Deleted []string `json:"deleted"`
+	// Attempts is the number of times the deletion was started
+	Attempts int `json:"attempts"`
+	// Error is the error which interrupted the last attempt, if any
+	Error string `json:"error,omitempty"`
+}
+
+// IsDeleted returns true if the data was deleted
+func (d *TenantDeletion) IsDeleted(data string) bool {
+	for _, deleted := range d.Deleted {
+		if deleted == data {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantIDRegexp matches the tenant IDs usable in index names
+var tenantIDRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidateTenantID validates a tenant ID, which must be usable in the
+// names of the tenant indices
+func ValidateTenantID(tenantID string) error {
+	if tenantID == "" {
+		return errors.New("tenant_id: cannot be blank")
+	}
+	if len(tenantID) > 128 || !tenantIDRegexp.MatchString(tenantID) {
+		return errors.New("tenant_id: must be at most 128 lowercase " +
+			"alphanumeric characters, dashes or underscores")
+	}
+	return nil
+}
+
+// ProvisionTenantParams are the parameters of the provisioning of a tenant
+type ProvisionTenantParams struct {
+	TenantID string `json:"tenant_id"`
+	Tier     string `json:"tier"`
+}
+
+// Validate validates the provisioning parameters, and sets the default
+// tier
+func (p *ProvisionTenantParams) Validate() error {
+	if err := ValidateTenantID(p.TenantID); err != nil {
+		return err
+	}
+	if p.Tier == "" {
+		p.Tier = TierDefault
+	}
+	switch p.Tier {
+	case TierOS, TierProfessional, TierEnterprise:
+	default:
+		return errors.Errorf("tier: must be one of %q, %q or %q",
+			TierOS, TierProfessional, TierEnterprise)
+	}
+	return nil
+}
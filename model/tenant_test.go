@@ -0,0 +1,111 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvisionTenantParamsValidate(t *testing.T) {
+	testCases := map[string]struct {
+		params *ProvisionTenantParams
+		tier   string
+		err    string
+	}{
+		"ok, default tier": {
+			params: &ProvisionTenantParams{TenantID: "5f7c8e3a9b1d2c0012345678"},
+			tier:   TierOS,
+		},
+		"ok, enterprise": {
+			params: &ProvisionTenantParams{TenantID: "tenant_1", Tier: TierEnterprise},
+			tier:   TierEnterprise,
+		},
+		"ko, missing tenant": {
+			params: &ProvisionTenantParams{},
+			err:    "tenant_id: cannot be blank",
+		},
+		"ko, uppercase tenant": {
+			params: &ProvisionTenantParams{TenantID: "Tenant"},
+			err: "tenant_id: must be at most 128 lowercase " +
+				"alphanumeric characters, dashes or underscores",
+		},
+		"ko, wildcard tenant": {
+			params: &ProvisionTenantParams{TenantID: "tenant*"},
+			err: "tenant_id: must be at most 128 lowercase " +
+				"alphanumeric characters, dashes or underscores",
+		},
+		"ko, long tenant": {
+			params: &ProvisionTenantParams{TenantID: strings.Repeat("a", 129)},
+			err: "tenant_id: must be at most 128 lowercase " +
+				"alphanumeric characters, dashes or underscores",
+		},
+		"ko, unknown tier": {
+			params: &ProvisionTenantParams{TenantID: "tenant", Tier: "gold"},
+			err:    `tier: must be one of "os", "professional" or "enterprise"`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.params.Validate()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.tier, tc.params.Tier)
+			}
+		})
+	}
+}
+
+func TestTenantDeletionIsDeleted(t *testing.T) {
+	deletion := &TenantDeletion{Deleted: []string{TenantDataDevices}}
+	assert.True(t, deletion.IsDeleted(TenantDataDevices))
+	assert.False(t, deletion.IsDeleted(TenantDataHistory))
+}
+
+func TestParseTierIndexSettings(t *testing.T) {
+	defaults := IndexSettings{Shards: 1, Replicas: 2}
+	tiers, err := ParseTierIndexSettings(map[string]interface{}{
+		TierEnterprise:   map[string]interface{}{"shards": 4},
+		TierProfessional: map[string]interface{}{"replicas": float64(1)},
+	}, defaults)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]IndexSettings{
+		TierOS:           {Shards: 1, Replicas: 2},
+		TierProfessional: {Shards: 1, Replicas: 1},
+		TierEnterprise:   {Shards: 4, Replicas: 2},
+	}, tiers)
+
+	_, err = ParseTierIndexSettings(map[string]interface{}{
+		"gold": map[string]interface{}{"shards": 4},
+	}, defaults)
+	assert.EqualError(t, err, `unknown tier "gold"`)
+
+	_, err = ParseTierIndexSettings(map[string]interface{}{
+		TierOS: map[string]interface{}{"shards": 1.5},
+	}, defaults)
+	assert.EqualError(t, err, `tier os: shards: must be an integer`)
+
+	_, err = ParseTierIndexSettings(map[string]interface{}{
+		TierOS: map[string]interface{}{"shards": 0},
+	}, defaults)
+	assert.EqualError(t, err, `tier os: shards: must be at least 1`)
+
+	_, err = ParseTierIndexSettings(nil, IndexSettings{Shards: 1, Replicas: -1})
+	assert.EqualError(t, err, `replicas: must be a non-negative number`)
+}
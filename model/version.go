@@ -0,0 +1,153 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// versionComponents is the maximum number of numeric components of a
+	// version; all versions are padded to it to compare them by component
+	versionComponents = 8
+
+	// versionRelease sorts after versionPreRelease, so that releases sort
+	// after their pre-releases
+	versionRelease    = "~"
+	versionPreRelease = "-"
+)
+
+var versionRegexp = regexp.MustCompile(
+	`^v?([0-9]+(?:\.[0-9]+)*)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+func encodeVersionNumber(number string) (string, bool) {
+	value, err := strconv.ParseUint(number, 10, 32)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%010d", value), true
+}
+
+// EncodeVersion encodes a semantic or dotted numeric version, with optional
+// pre-release and build metadata, as a string whose lexical order is the
+// version order: numeric components are zero-padded, missing ones count as
+// zero, pre-releases sort before their release and numeric pre-release
+// identifiers sort before alphanumeric ones; it returns false if the value
+// is not a version
+func EncodeVersion(value string) (string, bool) {
+	match := versionRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return "", false
+	}
+
+	numbers := strings.Split(match[1], ".")
+	if len(numbers) > versionComponents {
+		return "", false
+	}
+	for len(numbers) < versionComponents {
+		numbers = append(numbers, "0")
+	}
+	parts := make([]string, 0, len(numbers)+1)
+	for _, number := range numbers {
+		part, ok := encodeVersionNumber(number)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, part)
+	}
+
+	if match[2] == "" {
+		parts = append(parts, versionRelease)
+	} else {
+		identifiers := strings.Split(match[2], ".")
+		for i, identifier := range identifiers {
+			if part, ok := encodeVersionNumber(identifier); ok {
+				identifiers[i] = part
+			}
+		}
+		parts = append(parts, versionPreRelease+strings.Join(identifiers, "."))
+	}
+	return strings.Join(parts, "."), true
+}
+
+// VersionAttributes is the set of the names of the inventory attributes
+// holding versions
+type VersionAttributes map[string]bool
+
+// NewVersionAttributes returns the set of the given attribute names
+func NewVersionAttributes(names []string) VersionAttributes {
+	attrs := make(VersionAttributes, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			attrs[name] = true
+		}
+	}
+	return attrs
+}
+
+// ParseVersions sets the encoded versions of the attributes holding
+// versions, so that they can be compared and sorted by version order
+func (inv DeviceInventory) ParseVersions(versionAttributes VersionAttributes) {
+	for _, attr := range inv {
+		if attr == nil {
+			continue
+		}
+		attr.Version = nil
+		if !versionAttributes[attr.GetName()] {
+			continue
+		}
+		for _, value := range attr.String {
+			if version, ok := EncodeVersion(value); ok {
+				attr.Version = append(attr.Version, version)
+			}
+		}
+	}
+}
+
+// versionFilter translates the values of a filter on a version attribute
+// into encoded versions; it returns false if the filter doesn't compare
+// versions
+func versionFilter(filter FilterPredicate) (FilterPredicate, bool) {
+	switch filter.Type {
+	case FilterTypeEq, FilterTypeNe, FilterTypeGt, FilterTypeGte,
+		FilterTypeLt, FilterTypeLte:
+		value, ok := filter.Value.(string)
+		if !ok {
+			return filter, false
+		}
+		if filter.Value, ok = EncodeVersion(value); !ok {
+			return filter, false
+		}
+	case FilterTypeIn, FilterTypeNin:
+		values, _ := filter.Value.([]interface{})
+		versions := make([]interface{}, len(values))
+		for i, value := range values {
+			str, ok := value.(string)
+			if !ok {
+				return filter, false
+			}
+			if versions[i], ok = EncodeVersion(str); !ok {
+				return filter, false
+			}
+		}
+		filter.Value = versions
+	default:
+		return filter, false
+	}
+	return filter, true
+}
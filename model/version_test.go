@@ -0,0 +1,155 @@
+// Copyright 2021 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeVersionOrder(t *testing.T) {
+	ordered := []string{
+		"1.2",
+		"1.2.3-alpha",
+		"1.2.3-alpha.1",
+		"1.2.3-alpha.beta",
+		"1.2.3-beta.2",
+		"1.2.3-beta.11",
+		"1.2.3-rc.1",
+		"1.2.3",
+		"1.2.3.4",
+		"1.2.3.4.5",
+		"1.10.0",
+		"2.9.0",
+		"3.0.0-beta.1",
+		"3.0.0",
+		"3.0.0.1",
+	}
+	encoded := make([]string, len(ordered))
+	for i, value := range ordered {
+		var ok bool
+		encoded[i], ok = EncodeVersion(value)
+		assert.True(t, ok, value)
+	}
+	for i := 1; i < len(encoded); i++ {
+		assert.Less(t, encoded[i-1], encoded[i],
+			"%s < %s", ordered[i-1], ordered[i])
+	}
+}
+
+func TestEncodeVersion(t *testing.T) {
+	testCases := map[string]struct {
+		value string
+		equal string
+		ok    bool
+	}{
+		"ok, missing components": {
+			value: "3.0",
+			equal: "3.0.0",
+			ok:    true,
+		},
+		"ok, v prefix": {
+			value: "v2.6.1",
+			equal: "2.6.1",
+			ok:    true,
+		},
+		"ok, build metadata ignored": {
+			value: "2.6.1+build.42",
+			equal: "2.6.1",
+			ok:    true,
+		},
+		"ko, commit hash": {
+			value: "7cb96ca",
+		},
+		"ko, artifact name": {
+			value: "system-M1",
+		},
+		"ko, too many components": {
+			value: "1.2.3.4.5.6.7.8.9",
+		},
+		"ko, empty": {
+			value: "",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			encoded, ok := EncodeVersion(tc.value)
+			assert.Equal(t, tc.ok, ok)
+			if tc.ok {
+				expected, _ := EncodeVersion(tc.equal)
+				assert.Equal(t, expected, encoded)
+			}
+		})
+	}
+}
+
+func TestParseVersions(t *testing.T) {
+	inventory := DeviceInventory{
+		NewInventoryAttribute().SetName("rootfs-image.version").SetString("2.6.1"),
+		NewInventoryAttribute().SetName("mender_client_version").SetString("7cb96ca"),
+		NewInventoryAttribute().SetName("hostname").SetString("1.0.0"),
+	}
+	inventory.ParseVersions(NewVersionAttributes([]string{
+		"rootfs-image.version", " mender_client_version ", "",
+	}))
+
+	expected, _ := EncodeVersion("2.6.1")
+	assert.Equal(t, []string{expected}, inventory[0].Version)
+	assert.Nil(t, inventory[1].Version)
+	assert.Nil(t, inventory[2].Version)
+}
+
+func TestVersionFilterClause(t *testing.T) {
+	versionAttributes := NewVersionAttributes([]string{"rootfs-image.version"})
+	encoded, _ := EncodeVersion("3.0.0")
+
+	filter := FilterPredicate{
+		Scope:     ScopeInventory,
+		Attribute: "rootfs-image.version",
+		Type:      FilterTypeGte,
+		Value:     "3.0.0",
+	}
+	clause, negate := FilterClause(filter, versionAttributes)
+	assert.False(t, negate)
+	assert.Equal(t, nestedClause("inventoryAttributes", "rootfs-image.version",
+		map[string]interface{}{
+			"range": map[string]interface{}{
+				"inventoryAttributes.version": map[string]interface{}{
+					"gte": encoded,
+				},
+			},
+		}), clause)
+
+	// values which are not versions fall back to the string comparison
+	filter.Value = "system-M1"
+	clause, _ = FilterClause(filter, versionAttributes)
+	assert.Equal(t, nestedClause("inventoryAttributes", "rootfs-image.version",
+		map[string]interface{}{
+			"range": map[string]interface{}{
+				"inventoryAttributes.string": map[string]interface{}{
+					"gte": "system-M1",
+				},
+			},
+		}), clause)
+
+	sort := SortClauses(SortCriteria{
+		Scope:     ScopeInventory,
+		Attribute: "rootfs-image.version",
+		Order:     SortOrderDesc,
+	}, versionAttributes)
+	assert.Len(t, sort, 3)
+	assert.Contains(t, sort[0], "inventoryAttributes.version")
+}